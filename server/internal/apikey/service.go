@@ -0,0 +1,310 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Supported API key scopes.
+const (
+	ScopeTorrentsRead    = "torrents:read"
+	ScopeTorrentsAdd     = "torrents:add"
+	ScopeTorrentsControl = "torrents:control"
+	ScopeTorrentsRemove  = "torrents:remove"
+)
+
+// HeaderName is the request header automation clients use to present their key.
+const HeaderName = "X-Api-Key"
+
+const (
+	keyPrefix     = "rtk_"
+	keySecretSize = 32
+	displayLength = len(keyPrefix) + 8
+)
+
+var allowedScopes = map[string]struct{}{
+	ScopeTorrentsRead:    {},
+	ScopeTorrentsAdd:     {},
+	ScopeTorrentsControl: {},
+	ScopeTorrentsRemove:  {},
+}
+
+var (
+	ErrInvalidKey    = errors.New("invalid api key")
+	ErrExpiredKey    = errors.New("api key has expired")
+	ErrOwnerDisabled = errors.New("api key owner is disabled")
+)
+
+// Service manages API keys that let automation clients act on behalf of a user.
+type Service struct {
+	app core.App
+}
+
+// NewService constructs a Service instance.
+func NewService(app core.App) *Service {
+	return &Service{app: app}
+}
+
+// Response represents the subset of API key information exposed by the API.
+// The key hash is never returned.
+type Response struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  string   `json:"expiresAt,omitempty"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+	Created    string   `json:"created"`
+}
+
+// CreateResult is returned once when a key is created and carries the plaintext key.
+type CreateResult struct {
+	Response
+	Key string `json:"key"`
+}
+
+// CreateParams holds the data required to create a new API key.
+type CreateParams struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// Key is an authenticated API key together with its owner.
+type Key struct {
+	ID     string
+	Scopes []string
+	User   *core.Record
+}
+
+// HasScope reports whether the key grants the given scope.
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateKey() (string, error) {
+	secret := make([]byte, keySecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return keyPrefix + hex.EncodeToString(secret), nil
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func mapKeyRecord(record *core.Record) Response {
+	return Response{
+		ID:         record.Id,
+		Name:       record.GetString("name"),
+		Prefix:     record.GetString("prefix"),
+		Scopes:     record.GetStringSlice("scopes"),
+		ExpiresAt:  formatDate(record, "expiresAt"),
+		LastUsedAt: formatDate(record, "lastUsedAt"),
+		Created:    formatDate(record, "created"),
+	}
+}
+
+func (s *Service) keyCollection() (*core.Collection, error) {
+	return s.app.FindCollectionByNameOrId("api_keys")
+}
+
+// List returns all API keys owned by the given user.
+func (s *Service) List(userID string) ([]Response, error) {
+	collection, err := s.keyCollection()
+	if err != nil {
+		return nil, fmt.Errorf("find api_keys collection: %w", err)
+	}
+
+	records, err := s.app.FindRecordsByFilter(collection, "user = {:user}", "-created", 0, 0, dbx.Params{"user": userID})
+	if err != nil {
+		return nil, fmt.Errorf("find api keys: %w", err)
+	}
+
+	responses := make([]Response, 0, len(records))
+	for _, record := range records {
+		responses = append(responses, mapKeyRecord(record))
+	}
+
+	return responses, nil
+}
+
+// Create generates a new API key for the given user. The plaintext key is only
+// available in the returned result; only its hash is persisted.
+func (s *Service) Create(userID string, params CreateParams) (CreateResult, error) {
+	if strings.TrimSpace(userID) == "" {
+		return CreateResult{}, ValidationError{Message: "user id is required"}
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		return CreateResult{}, ValidationError{Message: "name is required"}
+	}
+
+	if len(params.Scopes) == 0 {
+		return CreateResult{}, ValidationError{Message: "at least one scope is required"}
+	}
+
+	scopes := make([]string, 0, len(params.Scopes))
+	seen := make(map[string]struct{}, len(params.Scopes))
+	for _, scope := range params.Scopes {
+		cleaned := strings.ToLower(strings.TrimSpace(scope))
+		if _, ok := allowedScopes[cleaned]; !ok {
+			return CreateResult{}, ValidationError{Message: fmt.Sprintf("invalid scope: %s", scope)}
+		}
+		if _, dup := seen[cleaned]; dup {
+			continue
+		}
+		seen[cleaned] = struct{}{}
+		scopes = append(scopes, cleaned)
+	}
+
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		return CreateResult{}, ValidationError{Message: "expiresAt must be in the future"}
+	}
+
+	collection, err := s.keyCollection()
+	if err != nil {
+		return CreateResult{}, fmt.Errorf("find api_keys collection: %w", err)
+	}
+
+	key, err := generateKey()
+	if err != nil {
+		return CreateResult{}, fmt.Errorf("generate api key: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("prefix", key[:displayLength])
+	record.Set("keyHash", hashKey(key))
+	record.Set("scopes", scopes)
+	record.Set("user", userID)
+	if params.ExpiresAt != nil {
+		record.Set("expiresAt", *params.ExpiresAt)
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return CreateResult{}, fmt.Errorf("save api key: %w", err)
+	}
+
+	return CreateResult{Response: mapKeyRecord(record), Key: key}, nil
+}
+
+// Revoke deletes an API key owned by the given user.
+func (s *Service) Revoke(userID, id string) error {
+	collection, err := s.keyCollection()
+	if err != nil {
+		return fmt.Errorf("find api_keys collection: %w", err)
+	}
+
+	record, err := s.app.FindRecordById(collection, id, nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NotFoundError{Message: "api key not found"}
+		}
+		return fmt.Errorf("find api key: %w", err)
+	}
+
+	// Don't reveal the existence of keys that belong to other users
+	if record.GetString("user") != userID {
+		return NotFoundError{Message: "api key not found"}
+	}
+
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete api key: %w", err)
+	}
+
+	return nil
+}
+
+// Authenticate resolves a plaintext key to its owner and scopes and
+// records the time it was used.
+func (s *Service) Authenticate(rawKey string) (*Key, error) {
+	rawKey = strings.TrimSpace(rawKey)
+	if !strings.HasPrefix(rawKey, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	collection, err := s.keyCollection()
+	if err != nil {
+		return nil, fmt.Errorf("find api_keys collection: %w", err)
+	}
+
+	record, err := s.app.FindFirstRecordByData(collection, "keyHash", hashKey(rawKey))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidKey
+		}
+		return nil, fmt.Errorf("find api key: %w", err)
+	}
+
+	expiresAt := record.GetDateTime("expiresAt")
+	if !expiresAt.IsZero() && time.Now().After(expiresAt.Time()) {
+		return nil, ErrExpiredKey
+	}
+
+	owner, err := s.app.FindRecordById("users", record.GetString("user"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidKey
+		}
+		return nil, fmt.Errorf("find api key owner: %w", err)
+	}
+
+	if owner.GetBool("disabled") {
+		return nil, ErrOwnerDisabled
+	}
+
+	record.Set("lastUsedAt", time.Now())
+	if err := s.app.Save(record); err != nil {
+		return nil, fmt.Errorf("update api key usage: %w", err)
+	}
+
+	return &Key{
+		ID:     record.Id,
+		Scopes: record.GetStringSlice("scopes"),
+		User:   owner,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package apikey
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/testutil"
+)
+
+func TestCreateAuthenticateRevoke(t *testing.T) {
+	testApp := testutil.NewTestApp(t)
+
+	owner := testutil.CreateUser(t, testApp, "automation@example.com", "user")
+	service := NewService(testApp)
+
+	created, err := service.Create(owner.Id, CreateParams{
+		Name:   "sonarr",
+		Scopes: []string{ScopeTorrentsAdd, ScopeTorrentsRead},
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	record, err := testApp.FindRecordById("api_keys", created.ID)
+	if err != nil {
+		t.Fatalf("Failed to load created key: %v", err)
+	}
+	if record.GetString("keyHash") == created.Key {
+		t.Errorf("Key must not be stored in plaintext")
+	}
+
+	key, err := service.Authenticate(created.Key)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if key.User.Id != owner.Id {
+		t.Errorf("Expected key owner %s, got %s", owner.Id, key.User.Id)
+	}
+	if !key.HasScope(ScopeTorrentsAdd) || key.HasScope(ScopeTorrentsRemove) {
+		t.Errorf("Unexpected scopes: %v", key.Scopes)
+	}
+
+	keys, err := service.List(owner.Id)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == "" {
+		t.Errorf("Expected one key with lastUsedAt set, got %+v", keys)
+	}
+
+	if err := service.Revoke("someone-else", created.ID); err == nil {
+		t.Errorf("Expected revoking another user's key to fail")
+	}
+	if err := service.Revoke(owner.Id, created.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := service.Authenticate(created.Key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey after revoke, got %v", err)
+	}
+}
+
+func TestAuthenticateExpiredKey(t *testing.T) {
+	testApp := testutil.NewTestApp(t)
+
+	owner := testutil.CreateUser(t, testApp, "automation@example.com", "user")
+	service := NewService(testApp)
+
+	expiresAt := time.Now().Add(time.Hour)
+	created, err := service.Create(owner.Id, CreateParams{
+		Name:      "script",
+		Scopes:    []string{ScopeTorrentsRead},
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	record, err := testApp.FindRecordById("api_keys", created.ID)
+	if err != nil {
+		t.Fatalf("Failed to load created key: %v", err)
+	}
+	record.Set("expiresAt", time.Now().Add(-time.Minute))
+	if err := testApp.Save(record); err != nil {
+		t.Fatalf("Failed to expire key: %v", err)
+	}
+
+	if _, err := service.Authenticate(created.Key); !errors.Is(err, ErrExpiredKey) {
+		t.Errorf("Expected ErrExpiredKey, got %v", err)
+	}
+}
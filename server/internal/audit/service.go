@@ -0,0 +1,324 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Result values stored with every entry.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Common audit actions.
+const (
+	ActionTorrentAdd        = "torrent.add"
+	ActionTorrentRemove     = "torrent.remove"
+	ActionTorrentStart      = "torrent.start"
+	ActionTorrentStop       = "torrent.stop"
+	ActionTorrentUpdate     = "torrent.update"
+	ActionUserCreate        = "user.create"
+	ActionUserUpdate        = "user.update"
+	ActionUserDelete        = "user.delete"
+	ActionInviteCreate      = "invite.create"
+	ActionInviteRevoke      = "invite.revoke"
+	ActionInviteAccept      = "invite.accept"
+	ActionAdminSetup        = "admin.setup"
+	ActionPreferencesUpdate = "preferences.update"
+	ActionAuditPrune        = "audit.prune"
+	ActionTwoFactorEnable   = "2fa.enable"
+	ActionTwoFactorDisable  = "2fa.disable"
+	ActionTwoFactorReset    = "2fa.reset"
+	ActionSecurityUpdate    = "security.update"
+	ActionPasswordChange    = "user.password"
+	ActionSessionRevoke     = "session.revoke"
+	ActionAuthLockout       = "auth.lockout"
+	ActionWebhookCreate     = "webhook.create"
+	ActionWebhookUpdate     = "webhook.update"
+	ActionWebhookDelete     = "webhook.delete"
+	ActionChannelCreate     = "channel.create"
+	ActionChannelUpdate     = "channel.update"
+	ActionChannelDelete     = "channel.delete"
+	ActionRSSFeedCreate     = "rss.feed.create"
+	ActionRSSFeedUpdate     = "rss.feed.update"
+	ActionRSSFeedDelete     = "rss.feed.delete"
+	ActionRSSRuleCreate     = "rss.rule.create"
+	ActionRSSRuleUpdate     = "rss.rule.update"
+	ActionRSSRuleDelete     = "rss.rule.delete"
+	ActionWatchFolderCreate = "watchfolder.create"
+	ActionWatchFolderUpdate = "watchfolder.update"
+	ActionWatchFolderDelete = "watchfolder.delete"
+	ActionWatchFolderImport = "watchfolder.import"
+	ActionHookCreate        = "hook.create"
+	ActionHookUpdate        = "hook.update"
+	ActionHookDelete        = "hook.delete"
+	ActionHookRetry         = "hook.retry"
+	ActionProviderCreate    = "search.provider.create"
+	ActionProviderUpdate    = "search.provider.update"
+	ActionProviderDelete    = "search.provider.delete"
+	ActionMediaServerCreate = "mediaserver.create"
+	ActionMediaServerUpdate = "mediaserver.update"
+	ActionMediaServerDelete = "mediaserver.delete"
+	ActionMediaRefresh      = "mediaserver.refresh"
+	ActionPluginUpdate      = "plugin.update"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// Actor identifies who performed an action.
+type Actor struct {
+	UserID   string
+	Email    string
+	APIKeyID string
+	IP       string
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a copy of ctx carrying the given actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx. Actions without an
+// actor are attributed to the system.
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorContextKey{}).(Actor)
+	return actor
+}
+
+// Entry describes a single audited action.
+type Entry struct {
+	Action  string
+	Targets []string
+	Before  any
+	After   any
+	Details any
+	Err     error
+}
+
+// Service writes and queries the audit log.
+type Service struct {
+	app core.App
+}
+
+// NewService constructs a Service instance.
+func NewService(app core.App) *Service {
+	return &Service{app: app}
+}
+
+// Record persists an audit entry for the actor found in ctx. Failures are
+// logged rather than returned so auditing never breaks the audited action.
+// A nil Service is a no-op.
+func (s *Service) Record(ctx context.Context, entry Entry) {
+	if s == nil {
+		return
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId("audit_log")
+	if err != nil {
+		log.Printf("[Audit] audit_log collection not found: %v", err)
+		return
+	}
+
+	actor := ActorFromContext(ctx)
+
+	record := core.NewRecord(collection)
+	record.Set("actor", actor.UserID)
+	record.Set("actorEmail", actor.Email)
+	record.Set("apiKey", actor.APIKeyID)
+	record.Set("ip", actor.IP)
+	record.Set("action", entry.Action)
+	record.Set("targets", entry.Targets)
+	record.Set("before", entry.Before)
+	record.Set("after", entry.After)
+	record.Set("details", entry.Details)
+
+	if entry.Err != nil {
+		record.Set("result", ResultFailure)
+		record.Set("error", truncate(entry.Err.Error(), 1000))
+	} else {
+		record.Set("result", ResultSuccess)
+	}
+
+	if err := s.app.Save(record); err != nil {
+		log.Printf("[Audit] Failed to record %s: %v", entry.Action, err)
+	}
+}
+
+// ListParams holds the optional filters for querying the audit log.
+type ListParams struct {
+	Page    int
+	PerPage int
+	Action  string
+	ActorID string
+	Target  string
+	Result  string
+	From    *time.Time
+	To      *time.Time
+}
+
+// EntryResponse represents an audit entry exposed by the API.
+type EntryResponse struct {
+	ID         string `json:"id"`
+	Actor      string `json:"actor"`
+	ActorEmail string `json:"actorEmail"`
+	APIKey     string `json:"apiKey,omitempty"`
+	Action     string `json:"action"`
+	Targets    any    `json:"targets"`
+	Before     any    `json:"before,omitempty"`
+	After      any    `json:"after,omitempty"`
+	Details    any    `json:"details,omitempty"`
+	IP         string `json:"ip"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+	Created    string `json:"created"`
+}
+
+// ListResult is a single page of audit entries.
+type ListResult struct {
+	Page       int             `json:"page"`
+	PerPage    int             `json:"perPage"`
+	TotalItems int64           `json:"totalItems"`
+	TotalPages int64           `json:"totalPages"`
+	Items      []EntryResponse `json:"items"`
+}
+
+func mapEntryRecord(record *core.Record) EntryResponse {
+	return EntryResponse{
+		ID:         record.Id,
+		Actor:      record.GetString("actor"),
+		ActorEmail: record.GetString("actorEmail"),
+		APIKey:     record.GetString("apiKey"),
+		Action:     record.GetString("action"),
+		Targets:    record.Get("targets"),
+		Before:     record.Get("before"),
+		After:      record.Get("after"),
+		Details:    record.Get("details"),
+		IP:         record.GetString("ip"),
+		Result:     record.GetString("result"),
+		Error:      record.GetString("error"),
+		Created:    record.GetDateTime("created").Time().Format(time.RFC3339),
+	}
+}
+
+// List returns a page of audit entries matching params, newest first.
+func (s *Service) List(params ListParams) (ListResult, error) {
+	page := params.Page
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := params.PerPage
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	var exprs []dbx.Expression
+	if params.Action != "" {
+		exprs = append(exprs, dbx.HashExp{"action": params.Action})
+	}
+	if params.ActorID != "" {
+		exprs = append(exprs, dbx.HashExp{"actor": params.ActorID})
+	}
+	if params.Result != "" {
+		exprs = append(exprs, dbx.HashExp{"result": params.Result})
+	}
+	if params.Target != "" {
+		// targets is a JSON array of strings
+		exprs = append(exprs, dbx.Like("targets", fmt.Sprintf("%q", params.Target)))
+	}
+	if params.From != nil {
+		from, err := types.ParseDateTime(*params.From)
+		if err != nil {
+			return ListResult{}, fmt.Errorf("parse from date: %w", err)
+		}
+		exprs = append(exprs, dbx.NewExp("created >= {:from}", dbx.Params{"from": from.String()}))
+	}
+	if params.To != nil {
+		to, err := types.ParseDateTime(*params.To)
+		if err != nil {
+			return ListResult{}, fmt.Errorf("parse to date: %w", err)
+		}
+		exprs = append(exprs, dbx.NewExp("created <= {:to}", dbx.Params{"to": to.String()}))
+	}
+
+	total, err := s.app.CountRecords("audit_log", exprs...)
+	if err != nil {
+		return ListResult{}, fmt.Errorf("count audit entries: %w", err)
+	}
+
+	query := s.app.RecordQuery("audit_log").
+		OrderBy("created DESC", "id DESC").
+		Limit(int64(perPage)).
+		Offset(int64((page - 1) * perPage))
+	for _, expr := range exprs {
+		query.AndWhere(expr)
+	}
+
+	var records []*core.Record
+	if err := query.All(&records); err != nil {
+		return ListResult{}, fmt.Errorf("find audit entries: %w", err)
+	}
+
+	items := make([]EntryResponse, 0, len(records))
+	for _, record := range records {
+		items = append(items, mapEntryRecord(record))
+	}
+
+	return ListResult{
+		Page:       page,
+		PerPage:    perPage,
+		TotalItems: total,
+		TotalPages: (total + int64(perPage) - 1) / int64(perPage),
+		Items:      items,
+	}, nil
+}
+
+// Prune deletes audit entries older than the retention period and returns
+// how many entries were removed.
+func (s *Service) Prune(retention time.Duration) (int64, error) {
+	cutoff, err := types.ParseDateTime(time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("parse cutoff date: %w", err)
+	}
+
+	result, err := s.app.NonconcurrentDB().Delete("audit_log", dbx.NewExp("created < {:cutoff}", dbx.Params{"cutoff": cutoff.String()})).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired audit entries: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count deleted audit entries: %w", err)
+	}
+
+	if removed > 0 {
+		s.Record(context.Background(), Entry{
+			Action:  ActionAuditPrune,
+			Details: map[string]any{"removed": removed, "retentionDays": int(retention.Hours() / 24)},
+		})
+	}
+
+	return removed, nil
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
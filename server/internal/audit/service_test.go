@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/testutil"
+)
+
+func TestRecordAndList(t *testing.T) {
+	testApp := testutil.NewTestApp(t)
+
+	service := NewService(testApp)
+	ctx := WithActor(context.Background(), Actor{Email: "admin@example.com", IP: "10.0.0.5"})
+
+	service.Record(ctx, Entry{Action: ActionTorrentAdd, Targets: []string{"abc"}})
+	service.Record(ctx, Entry{Action: ActionTorrentRemove, Targets: []string{"1", "2"}, Err: errors.New("rpc failed")})
+	service.Record(context.Background(), Entry{Action: ActionPreferencesUpdate, Before: map[string]any{"peer-port": 1}, After: map[string]any{"peer-port": 2}})
+
+	all, err := service.List(ListParams{})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if all.TotalItems != 3 || len(all.Items) != 3 {
+		t.Fatalf("Expected 3 entries, got %d (%d items)", all.TotalItems, len(all.Items))
+	}
+
+	failures, err := service.List(ListParams{Result: ResultFailure})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(failures.Items) != 1 || failures.Items[0].Error != "rpc failed" || failures.Items[0].IP != "10.0.0.5" {
+		t.Errorf("Unexpected failure entries: %+v", failures.Items)
+	}
+
+	byTarget, err := service.List(ListParams{Target: "2"})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(byTarget.Items) != 1 || byTarget.Items[0].Action != ActionTorrentRemove {
+		t.Errorf("Unexpected target entries: %+v", byTarget.Items)
+	}
+
+	paged, err := service.List(ListParams{Page: 2, PerPage: 2})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if paged.TotalPages != 2 || len(paged.Items) != 1 {
+		t.Errorf("Expected second page with 1 of 2 pages, got %d items of %d pages", len(paged.Items), paged.TotalPages)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	testApp := testutil.NewTestApp(t)
+
+	service := NewService(testApp)
+	service.Record(context.Background(), Entry{Action: ActionTorrentAdd})
+
+	// Backdate the entry past the retention window
+	if _, err := testApp.NonconcurrentDB().NewQuery("UPDATE audit_log SET created = '2000-01-01 00:00:00.000Z'").Execute(); err != nil {
+		t.Fatalf("Failed to backdate entry: %v", err)
+	}
+	service.Record(context.Background(), Entry{Action: ActionTorrentStart})
+
+	removed, err := service.Prune(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 pruned entry, got %d", removed)
+	}
+
+	// The remaining entry plus the prune record itself
+	result, err := service.List(ListParams{})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if result.TotalItems != 2 {
+		t.Errorf("Expected 2 remaining entries, got %d", result.TotalItems)
+	}
+}
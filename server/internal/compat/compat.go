@@ -0,0 +1,35 @@
+// Package compat implements the web APIs of other download clients on top of
+// torrent.Service so existing automation tools can talk to Retorrent directly.
+// Callers authenticate with Retorrent API keys, so the key's scopes and the
+// owner's torrent visibility apply to everything they do.
+package compat
+
+import (
+	"context"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/apikey"
+	"backend/internal/audit"
+)
+
+// Caller identifies who issues a compatibility API request.
+type Caller struct {
+	UserID  string
+	IsAdmin bool
+}
+
+// authorize marks the request as made by the owner of key and returns the
+// audit annotated context together with the caller.
+func authorize(re *core.RequestEvent, key *apikey.Key) (context.Context, Caller) {
+	re.Auth = key.User
+
+	ctx := audit.WithActor(re.Request.Context(), audit.Actor{
+		UserID:   key.User.Id,
+		Email:    key.User.Email(),
+		APIKeyID: key.ID,
+		IP:       re.RealIP(),
+	})
+
+	return ctx, Caller{UserID: key.User.Id, IsAdmin: key.User.GetString("role") == "admin"}
+}
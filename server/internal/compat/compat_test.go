@@ -0,0 +1,62 @@
+package compat
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/apikey"
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+// newTestServer serves the compatibility endpoints backed by the mock client
+// and returns a user with an API key granting the given scopes.
+func newTestServer(t *testing.T, scopes ...string) (*tests.TestApp, http.Handler, *core.Record, string) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	owner := testutil.CreateUser(t, testApp, "sonarr@example.com", "user")
+
+	apiKeys := apikey.NewService(testApp)
+	created, err := apiKeys.Create(owner.Id, apikey.CreateParams{Name: "sonarr", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("Failed to create api key: %v", err)
+	}
+
+	client := transmission.NewMockClient(testApp)
+	syncService := transmission.NewSyncService(testApp, client, 0)
+	service := torrent.NewService(&pocketbase.PocketBase{App: testApp}, client, syncService, audit.NewService(testApp))
+	if err := service.ForceSync(); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	router, err := apis.NewRouter(testApp)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	rpc := NewTransmissionRPC(service, apiKeys)
+	router.POST("/transmission/rpc", rpc.Serve)
+
+	qb := NewQBittorrentAPI(service, apiKeys)
+	router.POST("/api/v2/auth/login", qb.Login)
+	router.GET("/api/v2/app/version", qb.Version).BindFunc(qb.RequireScope(""))
+	router.GET("/api/v2/torrents/info", qb.TorrentsInfo).BindFunc(qb.RequireScope(apikey.ScopeTorrentsRead))
+	router.POST("/api/v2/torrents/add", qb.TorrentsAdd).BindFunc(qb.RequireScope(apikey.ScopeTorrentsAdd))
+	router.POST("/api/v2/torrents/pause", qb.TorrentsPause).BindFunc(qb.RequireScope(apikey.ScopeTorrentsControl))
+
+	mux, err := router.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router mux: %v", err)
+	}
+
+	return testApp, mux, owner, created.Key
+}
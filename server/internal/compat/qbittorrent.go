@@ -0,0 +1,581 @@
+package compat
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+
+	"backend/internal/apikey"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+const (
+	// QBittorrentCookie is the session cookie set by the login endpoint
+	QBittorrentCookie = "SID"
+
+	qbittorrentVersion       = "v4.6.7"
+	qbittorrentWebAPIVersion = "2.9.3"
+
+	// qbittorrentSessionTTL is how long an idle login stays valid
+	qbittorrentSessionTTL = time.Hour
+
+	// qbittorrentMaxUpload bounds the multipart body of torrents/add
+	qbittorrentMaxUpload = 32 << 20
+
+	// qbittorrentInfiniteETA is the eta qBittorrent reports for unknown ETAs
+	qbittorrentInfiniteETA = 8640000
+
+	// requestKeyQBittorrentKey is the request store key of the session's API key
+	requestKeyQBittorrentKey = "qbittorrentKey"
+)
+
+// errHashesRequired is returned for torrent actions without a hashes value
+var errHashesRequired = errors.New("hashes are required")
+
+// qbittorrentSession is a login, remembered by its SID cookie. The raw key is
+// kept so each request re-checks it and revoked keys stop working at once.
+type qbittorrentSession struct {
+	rawKey   string
+	lastSeen time.Time
+}
+
+// QBittorrentAPI serves the subset of the qBittorrent Web API used by tools
+// such as autobrr and cross-seed. The login password is a Retorrent API key.
+type QBittorrentAPI struct {
+	service *torrent.Service
+	apiKeys *apikey.Service
+
+	mu       sync.Mutex
+	sessions map[string]*qbittorrentSession
+}
+
+// NewQBittorrentAPI constructs a QBittorrentAPI.
+func NewQBittorrentAPI(service *torrent.Service, apiKeys *apikey.Service) *QBittorrentAPI {
+	return &QBittorrentAPI{
+		service:  service,
+		apiKeys:  apiKeys,
+		sessions: map[string]*qbittorrentSession{},
+	}
+}
+
+// Login handles /api/v2/auth/login. The API key is taken from the password,
+// or from the username when the password is empty.
+func (q *QBittorrentAPI) Login(re *core.RequestEvent) error {
+	rawKey := re.Request.FormValue("password")
+	if rawKey == "" {
+		rawKey = re.Request.FormValue("username")
+	}
+
+	if q.apiKeys == nil {
+		return re.String(http.StatusOK, "Fails.")
+	}
+
+	if _, err := q.apiKeys.Authenticate(rawKey); err != nil {
+		if errors.Is(err, apikey.ErrOwnerDisabled) {
+			return re.String(http.StatusForbidden, "Forbidden")
+		}
+		if !errors.Is(err, apikey.ErrInvalidKey) && !errors.Is(err, apikey.ErrExpiredKey) {
+			log.Printf("authenticate qbittorrent login: %v", err)
+		}
+		return re.String(http.StatusOK, "Fails.")
+	}
+
+	sid := security.RandomString(32)
+
+	q.mu.Lock()
+	q.sweep(time.Now())
+	q.sessions[sid] = &qbittorrentSession{rawKey: rawKey, lastSeen: time.Now()}
+	q.mu.Unlock()
+
+	http.SetCookie(re.Response, &http.Cookie{
+		Name:     QBittorrentCookie,
+		Value:    sid,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return re.String(http.StatusOK, "Ok.")
+}
+
+// Logout handles /api/v2/auth/logout.
+func (q *QBittorrentAPI) Logout(re *core.RequestEvent) error {
+	if cookie, err := re.Request.Cookie(QBittorrentCookie); err == nil {
+		q.mu.Lock()
+		delete(q.sessions, cookie.Value)
+		q.mu.Unlock()
+	}
+
+	return re.String(http.StatusOK, "")
+}
+
+// sweep drops idle sessions; the caller must hold q.mu
+func (q *QBittorrentAPI) sweep(now time.Time) {
+	for sid, session := range q.sessions {
+		if now.Sub(session.lastSeen) > qbittorrentSessionTTL {
+			delete(q.sessions, sid)
+		}
+	}
+}
+
+// RequireScope rejects requests without a valid session or whose API key
+// lacks scope. An empty scope only requires a login.
+func (q *QBittorrentAPI) RequireScope(scope string) func(*core.RequestEvent) error {
+	return func(re *core.RequestEvent) error {
+		cookie, err := re.Request.Cookie(QBittorrentCookie)
+		if err != nil {
+			return re.String(http.StatusForbidden, "Forbidden")
+		}
+
+		now := time.Now()
+		q.mu.Lock()
+		session, ok := q.sessions[cookie.Value]
+		if ok && now.Sub(session.lastSeen) > qbittorrentSessionTTL {
+			delete(q.sessions, cookie.Value)
+			ok = false
+		}
+		if ok {
+			session.lastSeen = now
+		}
+		q.mu.Unlock()
+
+		if !ok {
+			return re.String(http.StatusForbidden, "Forbidden")
+		}
+
+		key, err := q.apiKeys.Authenticate(session.rawKey)
+		if err != nil {
+			q.mu.Lock()
+			delete(q.sessions, cookie.Value)
+			q.mu.Unlock()
+			return re.String(http.StatusForbidden, "Forbidden")
+		}
+
+		if scope != "" && !key.HasScope(scope) {
+			return re.String(http.StatusForbidden, "Forbidden")
+		}
+
+		re.Set(requestKeyQBittorrentKey, key)
+		return re.Next()
+	}
+}
+
+// Version handles /api/v2/app/version.
+func (q *QBittorrentAPI) Version(re *core.RequestEvent) error {
+	return re.String(http.StatusOK, qbittorrentVersion)
+}
+
+// WebAPIVersion handles /api/v2/app/webapiVersion.
+func (q *QBittorrentAPI) WebAPIVersion(re *core.RequestEvent) error {
+	return re.String(http.StatusOK, qbittorrentWebAPIVersion)
+}
+
+// TorrentsInfo handles /api/v2/torrents/info.
+func (q *QBittorrentAPI) TorrentsInfo(re *core.RequestEvent) error {
+	ctx, caller := authorize(re, re.Get(requestKeyQBittorrentKey).(*apikey.Key))
+
+	torrents, err := q.service.VisibleTorrents(ctx, caller.UserID, caller.IsAdmin)
+	if err != nil {
+		log.Printf("qbittorrent torrents info: %v", err)
+		return re.String(http.StatusInternalServerError, "failed to fetch torrents")
+	}
+
+	form := re.Request
+	hashes := parseHashes(form.FormValue("hashes"))
+	_, filterCategory := form.Form["category"]
+	category := form.FormValue("category")
+	tag := form.FormValue("tag")
+	filter := form.FormValue("filter")
+
+	result := make([]map[string]any, 0, len(torrents))
+	for _, t := range torrents {
+		if hashes != nil {
+			if _, ok := hashes[strings.ToLower(t.HashString)]; !ok {
+				continue
+			}
+		}
+
+		info := qbittorrentInfo(t)
+		if filterCategory && info["category"] != category {
+			continue
+		}
+		if tag != "" && !hasLabel(t, tag) {
+			continue
+		}
+		if !matchesFilter(t, info["state"].(string), filter) {
+			continue
+		}
+
+		result = append(result, info)
+	}
+
+	if sortKey := form.FormValue("sort"); sortKey != "" {
+		reverse := form.FormValue("reverse") == "true"
+		sort.SliceStable(result, func(i, j int) bool {
+			if reverse {
+				return lessValue(result[j][sortKey], result[i][sortKey])
+			}
+			return lessValue(result[i][sortKey], result[j][sortKey])
+		})
+	}
+
+	if offset, err := strconv.Atoi(form.FormValue("offset")); err == nil && offset > 0 {
+		if offset > len(result) {
+			offset = len(result)
+		}
+		result = result[offset:]
+	}
+	if limit, err := strconv.Atoi(form.FormValue("limit")); err == nil && limit > 0 && limit < len(result) {
+		result = result[:limit]
+	}
+
+	return re.JSON(http.StatusOK, result)
+}
+
+// TorrentsAdd handles /api/v2/torrents/add with magnet links in urls and
+// .torrent files in torrents.
+func (q *QBittorrentAPI) TorrentsAdd(re *core.RequestEvent) error {
+	ctx, caller := authorize(re, re.Get(requestKeyQBittorrentKey).(*apikey.Key))
+
+	if strings.HasPrefix(re.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := re.Request.ParseMultipartForm(qbittorrentMaxUpload); err != nil {
+			return re.String(http.StatusBadRequest, "invalid request body")
+		}
+	}
+
+	var sources []string
+	for _, line := range strings.Split(re.Request.FormValue("urls"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			sources = append(sources, line)
+		}
+	}
+
+	if re.Request.MultipartForm != nil {
+		for _, header := range re.Request.MultipartForm.File["torrents"] {
+			file, err := header.Open()
+			if err != nil {
+				return re.String(http.StatusBadRequest, "invalid torrent file")
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return re.String(http.StatusBadRequest, "invalid torrent file")
+			}
+			sources = append(sources, base64.StdEncoding.EncodeToString(data))
+		}
+	}
+
+	if len(sources) == 0 {
+		return re.String(http.StatusBadRequest, "no torrents to add")
+	}
+
+	var downloadDir *string
+	if savePath := re.Request.FormValue("savepath"); savePath != "" {
+		downloadDir = &savePath
+	}
+
+	// qBittorrent 5 renamed paused to stopped
+	paused := re.Request.FormValue("paused") == "true" || re.Request.FormValue("stopped") == "true"
+
+	var labels []string
+	if category := re.Request.FormValue("category"); category != "" {
+		labels = append(labels, category)
+	}
+	for _, tag := range strings.Split(re.Request.FormValue("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			labels = append(labels, tag)
+		}
+	}
+
+	added := 0
+	for _, source := range sources {
+		// Fetching torrents from URLs isn't supported, only magnets and files
+		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			log.Printf("qbittorrent add: skipping unsupported url source")
+			continue
+		}
+
+		autoStart := !paused
+		t, err := q.service.AddTorrent(ctx, torrent.AddTorrentRequest{
+			Torrent:     source,
+			DownloadDir: downloadDir,
+			AutoStart:   &autoStart,
+			UserID:      caller.UserID,
+		})
+		if err != nil || t == nil {
+			log.Printf("qbittorrent add: %v", err)
+			continue
+		}
+		added++
+
+		if paused {
+			if err := q.service.PerformAction(ctx, strconv.FormatInt(t.ID, 10), torrent.ActionRequest{Action: "stop"}); err != nil {
+				log.Printf("Failed to pause torrent %d added over the qbittorrent api: %v", t.ID, err)
+			}
+		}
+
+		if len(labels) > 0 {
+			if err := q.service.UpdateTorrents(ctx, []int64{t.ID}, transmission.TorrentSettings{Labels: labels}); err != nil {
+				log.Printf("Failed to label torrent %d added over the qbittorrent api: %v", t.ID, err)
+			}
+		}
+	}
+
+	if added == 0 {
+		return re.String(http.StatusOK, "Fails.")
+	}
+
+	return re.String(http.StatusOK, "Ok.")
+}
+
+// TorrentsDelete handles /api/v2/torrents/delete.
+func (q *QBittorrentAPI) TorrentsDelete(re *core.RequestEvent) error {
+	ctx, caller := authorize(re, re.Get(requestKeyQBittorrentKey).(*apikey.Key))
+
+	ids, err := q.selectHashes(ctx, caller, re.Request.FormValue("hashes"))
+	if err != nil {
+		return selectionError(re, err)
+	}
+	if len(ids) == 0 {
+		return re.String(http.StatusOK, "")
+	}
+
+	deleteFiles := re.Request.FormValue("deleteFiles") == "true"
+	if err := q.service.RemoveTorrents(ctx, torrent.RemoveTorrentRequest{IDs: ids, DeleteLocalData: &deleteFiles}); err != nil {
+		log.Printf("qbittorrent delete: %v", err)
+		return re.String(http.StatusInternalServerError, "failed to delete torrents")
+	}
+
+	return re.String(http.StatusOK, "")
+}
+
+// TorrentsPause handles /api/v2/torrents/pause (stop in qBittorrent 5).
+func (q *QBittorrentAPI) TorrentsPause(re *core.RequestEvent) error {
+	return q.performAction(re, "stop")
+}
+
+// TorrentsResume handles /api/v2/torrents/resume (start in qBittorrent 5).
+func (q *QBittorrentAPI) TorrentsResume(re *core.RequestEvent) error {
+	return q.performAction(re, "start")
+}
+
+func (q *QBittorrentAPI) performAction(re *core.RequestEvent, action string) error {
+	ctx, caller := authorize(re, re.Get(requestKeyQBittorrentKey).(*apikey.Key))
+
+	ids, err := q.selectHashes(ctx, caller, re.Request.FormValue("hashes"))
+	if err != nil {
+		return selectionError(re, err)
+	}
+
+	for _, id := range ids {
+		if err := q.service.PerformAction(ctx, strconv.FormatInt(id, 10), torrent.ActionRequest{Action: action}); err != nil {
+			log.Printf("qbittorrent %s: %v", action, err)
+			return re.String(http.StatusInternalServerError, "failed to "+action+" torrents")
+		}
+	}
+
+	return re.String(http.StatusOK, "")
+}
+
+// selectHashes resolves a hashes value ("|" separated or "all") to the ids
+// of torrents visible to the caller
+func (q *QBittorrentAPI) selectHashes(ctx context.Context, caller Caller, value string) ([]int64, error) {
+	if value == "" {
+		return nil, errHashesRequired
+	}
+
+	torrents, err := q.service.VisibleTorrents(ctx, caller.UserID, caller.IsAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := parseHashes(value)
+	ids := make([]int64, 0, len(torrents))
+	for _, t := range torrents {
+		if _, ok := hashes[strings.ToLower(t.HashString)]; ok || hashes == nil {
+			ids = append(ids, t.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// selectionError writes the response for a failed selectHashes
+func selectionError(re *core.RequestEvent, err error) error {
+	if errors.Is(err, errHashesRequired) {
+		return re.String(http.StatusBadRequest, err.Error())
+	}
+
+	log.Printf("qbittorrent select torrents: %v", err)
+	return re.String(http.StatusInternalServerError, "failed to fetch torrents")
+}
+
+// parseHashes splits a "|" separated hash list. It returns nil for no
+// filter, i.e. an empty value or "all".
+func parseHashes(value string) map[string]struct{} {
+	if value == "" || value == "all" {
+		return nil
+	}
+
+	hashes := map[string]struct{}{}
+	for _, hash := range strings.Split(value, "|") {
+		if hash = strings.TrimSpace(hash); hash != "" {
+			hashes[strings.ToLower(hash)] = struct{}{}
+		}
+	}
+	return hashes
+}
+
+func hasLabel(t *transmission.TorrentData, label string) bool {
+	for _, l := range t.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// qbittorrentState maps a torrent to its qBittorrent state name
+func qbittorrentState(t *transmission.TorrentData) string {
+	if t.ErrorString != "" {
+		return "error"
+	}
+
+	done := t.PercentDone >= 1
+	switch t.Status {
+	case transmission.StatusStopped:
+		if done {
+			return "pausedUP"
+		}
+		return "pausedDL"
+	case transmission.StatusCheckWait, transmission.StatusCheck:
+		if done {
+			return "checkingUP"
+		}
+		return "checkingDL"
+	case transmission.StatusDownloadWait:
+		return "queuedDL"
+	case transmission.StatusDownload:
+		if t.RateDownload > 0 {
+			return "downloading"
+		}
+		return "stalledDL"
+	case transmission.StatusSeedWait:
+		return "queuedUP"
+	case transmission.StatusSeed:
+		if t.RateUpload > 0 {
+			return "uploading"
+		}
+		return "stalledUP"
+	default:
+		return "unknown"
+	}
+}
+
+// matchesFilter applies the filter parameter of torrents/info
+func matchesFilter(t *transmission.TorrentData, state, filter string) bool {
+	switch filter {
+	case "downloading":
+		return t.Status == transmission.StatusDownload || t.Status == transmission.StatusDownloadWait
+	case "seeding":
+		return t.Status == transmission.StatusSeed || t.Status == transmission.StatusSeedWait
+	case "completed":
+		return t.PercentDone >= 1
+	case "paused", "stopped":
+		return t.Status == transmission.StatusStopped
+	case "resumed", "running":
+		return t.Status != transmission.StatusStopped
+	case "active":
+		return t.RateDownload > 0 || t.RateUpload > 0
+	case "inactive":
+		return t.RateDownload == 0 && t.RateUpload == 0
+	case "stalled":
+		return state == "stalledDL" || state == "stalledUP"
+	case "errored":
+		return state == "error"
+	default:
+		return true
+	}
+}
+
+// qbittorrentInfo returns the torrents/info object of a torrent. The first
+// label is used as category and all labels as tags.
+func qbittorrentInfo(t *transmission.TorrentData) map[string]any {
+	var category string
+	if len(t.Labels) > 0 {
+		category = t.Labels[0]
+	}
+
+	var completionOn int64
+	if t.DoneDate != nil {
+		completionOn = t.DoneDate.Unix()
+	}
+
+	eta := t.ETA
+	if eta < 0 {
+		eta = qbittorrentInfiniteETA
+	}
+
+	amountLeft := int64(float64(t.SizeWhenDone) * (1 - t.PercentDone))
+	if amountLeft < 0 {
+		amountLeft = 0
+	}
+
+	contentPath := t.DownloadDir
+	if contentPath != "" {
+		contentPath = strings.TrimRight(contentPath, "/") + "/" + t.Name
+	}
+
+	return map[string]any{
+		"hash":          t.HashString,
+		"infohash_v1":   t.HashString,
+		"name":          t.Name,
+		"size":          t.SizeWhenDone,
+		"total_size":    t.TotalSize,
+		"progress":      t.PercentDone,
+		"dlspeed":       t.RateDownload,
+		"upspeed":       t.RateUpload,
+		"downloaded":    t.DownloadedEver,
+		"uploaded":      t.UploadedEver,
+		"amount_left":   amountLeft,
+		"completed":     t.SizeWhenDone - amountLeft,
+		"ratio":         t.UploadRatio,
+		"eta":           eta,
+		"state":         qbittorrentState(t),
+		"added_on":      t.AddedDate.Unix(),
+		"completion_on": completionOn,
+		"save_path":     t.DownloadDir,
+		"content_path":  contentPath,
+		"category":      category,
+		"tags":          strings.Join(t.Labels, ", "),
+	}
+}
+
+// lessValue orders torrents/info values of the same field
+func lessValue(a, b any) bool {
+	switch a := a.(type) {
+	case string:
+		b, _ := b.(string)
+		return a < b
+	case int64:
+		b, _ := b.(int64)
+		return a < b
+	case float64:
+		b, _ := b.(float64)
+		return a < b
+	default:
+		return false
+	}
+}
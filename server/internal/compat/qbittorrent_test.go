@@ -0,0 +1,108 @@
+package compat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"backend/internal/apikey"
+)
+
+func qbCall(handler http.Handler, method, path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func qbLogin(t *testing.T, handler http.Handler, key string) *http.Cookie {
+	t.Helper()
+
+	rec := qbCall(handler, http.MethodPost, "/api/v2/auth/login", url.Values{"username": {"autobrr"}, "password": {key}}, nil)
+	if rec.Body.String() != "Ok." {
+		t.Fatalf("Expected the login to succeed, got %q", rec.Body.String())
+	}
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == QBittorrentCookie {
+			return cookie
+		}
+	}
+	t.Fatalf("Expected a %s cookie", QBittorrentCookie)
+	return nil
+}
+
+func TestQBittorrentLogin(t *testing.T) {
+	_, handler, _, key := newTestServer(t, apikey.ScopeTorrentsRead)
+
+	rec := qbCall(handler, http.MethodPost, "/api/v2/auth/login", url.Values{"username": {"autobrr"}, "password": {"wrong"}}, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "Fails." {
+		t.Fatalf("Expected Fails. for a wrong key, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	if rec := qbCall(handler, http.MethodGet, "/api/v2/app/version", nil, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 without a session, got %d", rec.Code)
+	}
+
+	cookie := qbLogin(t, handler, key)
+	if rec := qbCall(handler, http.MethodGet, "/api/v2/app/version", nil, cookie); rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "v4.") {
+		t.Errorf("Expected a v4 version, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// The key lacks the add scope
+	rec = qbCall(handler, http.MethodPost, "/api/v2/torrents/add", url.Values{"urls": {"magnet:?xt=urn:btih:abc"}}, cookie)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a missing scope, got %d", rec.Code)
+	}
+}
+
+func TestQBittorrentAddInfoPause(t *testing.T) {
+	testApp, handler, owner, key := newTestServer(t, apikey.ScopeTorrentsRead, apikey.ScopeTorrentsAdd, apikey.ScopeTorrentsControl)
+	cookie := qbLogin(t, handler, key)
+
+	rec := qbCall(handler, http.MethodPost, "/api/v2/torrents/add", url.Values{
+		"urls":     {"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"},
+		"savepath": {"/downloads/movies"},
+		"category": {"movies"},
+	}, cookie)
+	if rec.Body.String() != "Ok." {
+		t.Fatalf("Expected the add to succeed, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	info := func(query string) []map[string]any {
+		rec := qbCall(handler, http.MethodGet, "/api/v2/torrents/info?"+query, nil, cookie)
+		var torrents []map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &torrents); err != nil {
+			t.Fatalf("Failed to decode torrents info %q: %v", rec.Body.String(), err)
+		}
+		return torrents
+	}
+
+	torrents := info("category=movies")
+	if len(torrents) != 1 || torrents[0]["save_path"] != "/downloads/movies" {
+		t.Fatalf("Expected only the added torrent, got %+v", torrents)
+	}
+	hash := torrents[0]["hash"].(string)
+
+	record, err := testApp.FindFirstRecordByData("torrents", "hash", hash)
+	if err != nil {
+		t.Fatalf("Failed to find the added torrent: %v", err)
+	}
+	if record.GetString("user") != owner.Id {
+		t.Errorf("Expected the torrent to be owned by the caller")
+	}
+
+	if rec := qbCall(handler, http.MethodPost, "/api/v2/torrents/pause", url.Values{"hashes": {hash}}, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the pause to succeed, got %d", rec.Code)
+	}
+	if torrents := info("filter=paused"); len(torrents) != 1 || torrents[0]["state"] != "pausedDL" {
+		t.Errorf("Expected the torrent to be paused, got %+v", torrents)
+	}
+}
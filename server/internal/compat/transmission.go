@@ -0,0 +1,514 @@
+package compat
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+
+	"backend/internal/apikey"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+const (
+	// TransmissionSessionHeader carries the CSRF token of the Transmission RPC protocol
+	TransmissionSessionHeader = "X-Transmission-Session-Id"
+
+	transmissionRPCVersion        = 17
+	transmissionRPCVersionMinimum = 14
+	transmissionVersion           = "4.0.0 (Retorrent)"
+
+	// recentlyActive is the special ids value selecting torrents with recent activity
+	recentlyActive = "recently-active"
+)
+
+// transmissionStatusCodes maps torrent states to the numeric RPC status codes
+var transmissionStatusCodes = map[transmission.TorrentStatus]int{
+	transmission.StatusStopped:      0,
+	transmission.StatusCheckWait:    1,
+	transmission.StatusCheck:        2,
+	transmission.StatusDownloadWait: 3,
+	transmission.StatusDownload:     4,
+	transmission.StatusSeedWait:     5,
+	transmission.StatusSeed:         6,
+}
+
+// transmissionMethodScopes lists the supported RPC methods and the API key
+// scope each of them requires
+var transmissionMethodScopes = map[string]string{
+	"session-get":    apikey.ScopeTorrentsRead,
+	"torrent-get":    apikey.ScopeTorrentsRead,
+	"torrent-add":    apikey.ScopeTorrentsAdd,
+	"torrent-remove": apikey.ScopeTorrentsRemove,
+	"torrent-set":    apikey.ScopeTorrentsControl,
+}
+
+// TransmissionRPC serves the Transmission RPC protocol so clients such as
+// Sonarr, Radarr or Transmission remotes can use Retorrent as their download
+// client. Callers authenticate with basic auth, using an API key as password.
+type TransmissionRPC struct {
+	service   *torrent.Service
+	apiKeys   *apikey.Service
+	sessionID string
+}
+
+// NewTransmissionRPC constructs a TransmissionRPC with a fresh session id.
+func NewTransmissionRPC(service *torrent.Service, apiKeys *apikey.Service) *TransmissionRPC {
+	return &TransmissionRPC{
+		service:   service,
+		apiKeys:   apiKeys,
+		sessionID: security.RandomString(48),
+	}
+}
+
+// rpcRequest is the envelope of a Transmission RPC request
+type rpcRequest struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       json.RawMessage `json:"tag,omitempty"`
+}
+
+// rpcResponse is the envelope of a Transmission RPC response. Result is
+// "success" or an error message.
+type rpcResponse struct {
+	Result    string          `json:"result"`
+	Arguments any             `json:"arguments"`
+	Tag       json.RawMessage `json:"tag,omitempty"`
+}
+
+// Serve handles a request to the RPC endpoint: it authenticates the caller,
+// performs the session id handshake and dispatches the method.
+func (t *TransmissionRPC) Serve(re *core.RequestEvent) error {
+	key, err := t.authenticate(re)
+	if err != nil {
+		if errors.Is(err, apikey.ErrOwnerDisabled) {
+			return re.String(http.StatusForbidden, err.Error())
+		}
+		if !errors.Is(err, apikey.ErrInvalidKey) && !errors.Is(err, apikey.ErrExpiredKey) {
+			log.Printf("authenticate transmission rpc: %v", err)
+			return re.String(http.StatusInternalServerError, "internal server error")
+		}
+		re.Response.Header().Set("WWW-Authenticate", `Basic realm="Transmission"`)
+		return re.String(http.StatusUnauthorized, "Unauthorized")
+	}
+
+	// Clients fetch the session id from the 409 response and retry with it
+	re.Response.Header().Set(TransmissionSessionHeader, t.sessionID)
+	sessionID := re.Request.Header.Get(TransmissionSessionHeader)
+	if subtle.ConstantTimeCompare([]byte(sessionID), []byte(t.sessionID)) != 1 {
+		return re.String(http.StatusConflict, fmt.Sprintf("<h1>409: Conflict</h1><p>Your request had an invalid session-id header.</p><p><code>%s: %s</code></p>", TransmissionSessionHeader, t.sessionID))
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(re.Request.Body).Decode(&req); err != nil {
+		return re.String(http.StatusBadRequest, "invalid request body")
+	}
+
+	scope, ok := transmissionMethodScopes[req.Method]
+	if !ok {
+		return re.JSON(http.StatusOK, rpcResponse{Result: "method name not recognized", Arguments: map[string]any{}, Tag: req.Tag})
+	}
+	if !key.HasScope(scope) {
+		return re.JSON(http.StatusOK, rpcResponse{
+			Result:    fmt.Sprintf("api key is missing the %s scope", scope),
+			Arguments: map[string]any{},
+			Tag:       req.Tag,
+		})
+	}
+
+	ctx, caller := authorize(re, key)
+	arguments, err := t.Handle(ctx, caller, req.Method, req.Arguments)
+	if err != nil {
+		return re.JSON(http.StatusOK, rpcResponse{Result: err.Error(), Arguments: map[string]any{}, Tag: req.Tag})
+	}
+
+	return re.JSON(http.StatusOK, rpcResponse{Result: "success", Arguments: arguments, Tag: req.Tag})
+}
+
+// authenticate resolves the basic auth credentials to an API key. The key is
+// taken from the password, or from the username for clients that only have
+// a single credential field.
+func (t *TransmissionRPC) authenticate(re *core.RequestEvent) (*apikey.Key, error) {
+	username, password, ok := re.Request.BasicAuth()
+	if !ok || t.apiKeys == nil {
+		return nil, apikey.ErrInvalidKey
+	}
+
+	rawKey := password
+	if rawKey == "" {
+		rawKey = username
+	}
+
+	return t.apiKeys.Authenticate(rawKey)
+}
+
+// Handle runs a single RPC method for the caller and returns its arguments.
+func (t *TransmissionRPC) Handle(ctx context.Context, caller Caller, method string, rawArgs json.RawMessage) (any, error) {
+	switch method {
+	case "session-get":
+		return t.sessionGet(ctx, rawArgs)
+	case "torrent-get":
+		return t.torrentGet(ctx, caller, rawArgs)
+	case "torrent-add":
+		return t.torrentAdd(ctx, caller, rawArgs)
+	case "torrent-remove":
+		return t.torrentRemove(ctx, caller, rawArgs)
+	case "torrent-set":
+		return t.torrentSet(ctx, caller, rawArgs)
+	default:
+		return nil, fmt.Errorf("method name not recognized")
+	}
+}
+
+// decodeArgs unmarshals the method arguments, which may be omitted
+func decodeArgs(rawArgs json.RawMessage, v any) error {
+	if len(rawArgs) == 0 || string(rawArgs) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(rawArgs, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func (t *TransmissionRPC) sessionGet(ctx context.Context, rawArgs json.RawMessage) (any, error) {
+	var args struct {
+		Fields []string `json:"fields"`
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return nil, err
+	}
+
+	settings, err := t.service.SessionSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	settings["version"] = transmissionVersion
+	settings["rpc-version"] = transmissionRPCVersion
+	settings["rpc-version-minimum"] = transmissionRPCVersionMinimum
+	settings["session-id"] = t.sessionID
+
+	return filterFields(settings, args.Fields), nil
+}
+
+func (t *TransmissionRPC) torrentGet(ctx context.Context, caller Caller, rawArgs json.RawMessage) (any, error) {
+	var args struct {
+		IDs    json.RawMessage `json:"ids"`
+		Fields []string        `json:"fields"`
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return nil, err
+	}
+
+	torrents, err := t.selectTorrents(ctx, caller, args.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]any, 0, len(torrents))
+	for _, torrent := range torrents {
+		result = append(result, filterFields(transmissionTorrentFields(torrent), args.Fields))
+	}
+
+	arguments := map[string]any{"torrents": result}
+	if isRecentlyActive(args.IDs) {
+		// Removed torrents aren't tracked, report none
+		arguments["removed"] = []int64{}
+	}
+
+	return arguments, nil
+}
+
+func (t *TransmissionRPC) torrentAdd(ctx context.Context, caller Caller, rawArgs json.RawMessage) (any, error) {
+	var args struct {
+		Filename    string   `json:"filename"`
+		Metainfo    string   `json:"metainfo"`
+		DownloadDir *string  `json:"download-dir"`
+		Paused      *bool    `json:"paused"`
+		Labels      []string `json:"labels"`
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return nil, err
+	}
+
+	source := args.Metainfo
+	if source == "" {
+		if !strings.HasPrefix(args.Filename, "magnet:") {
+			return nil, fmt.Errorf("only magnet links and metainfo are supported")
+		}
+		source = args.Filename
+	}
+
+	req := torrent.AddTorrentRequest{
+		Torrent:     source,
+		DownloadDir: args.DownloadDir,
+		UserID:      caller.UserID,
+	}
+	if args.Paused != nil {
+		autoStart := !*args.Paused
+		req.AutoStart = &autoStart
+	}
+
+	added, err := t.service.AddTorrent(ctx, req)
+	var duplicateErr torrent.DuplicateError
+	if errors.As(err, &duplicateErr) {
+		// Transmission reports duplicates as a successful call
+		return map[string]any{
+			"torrent-duplicate": map[string]any{
+				"id":         duplicateErr.TransmissionID,
+				"name":       duplicateErr.Name,
+				"hashString": duplicateErr.Hash,
+			},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if added == nil {
+		return nil, fmt.Errorf("failed to add torrent")
+	}
+
+	if args.Paused != nil && *args.Paused {
+		if err := t.service.PerformAction(ctx, strconv.FormatInt(added.ID, 10), torrent.ActionRequest{Action: "stop"}); err != nil {
+			log.Printf("Failed to pause torrent %d added over rpc: %v", added.ID, err)
+		}
+	}
+
+	if len(args.Labels) > 0 {
+		if err := t.service.UpdateTorrents(ctx, []int64{added.ID}, transmission.TorrentSettings{Labels: args.Labels}); err != nil {
+			log.Printf("Failed to label torrent %d added over rpc: %v", added.ID, err)
+		}
+	}
+
+	return map[string]any{
+		"torrent-added": map[string]any{
+			"id":         added.ID,
+			"name":       added.Name,
+			"hashString": added.HashString,
+		},
+	}, nil
+}
+
+func (t *TransmissionRPC) torrentRemove(ctx context.Context, caller Caller, rawArgs json.RawMessage) (any, error) {
+	var args struct {
+		IDs             json.RawMessage `json:"ids"`
+		DeleteLocalData bool            `json:"delete-local-data"`
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return nil, err
+	}
+
+	// Unlike Transmission, never treat missing ids as "all torrents" here
+	if len(args.IDs) == 0 {
+		return nil, fmt.Errorf("ids are required")
+	}
+
+	ids, err := t.selectIDs(ctx, caller, args.IDs)
+	if err != nil || len(ids) == 0 {
+		return map[string]any{}, err
+	}
+
+	deleteLocalData := args.DeleteLocalData
+	if err := t.service.RemoveTorrents(ctx, torrent.RemoveTorrentRequest{IDs: ids, DeleteLocalData: &deleteLocalData}); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{}, nil
+}
+
+func (t *TransmissionRPC) torrentSet(ctx context.Context, caller Caller, rawArgs json.RawMessage) (any, error) {
+	var args struct {
+		IDs json.RawMessage `json:"ids"`
+		transmission.TorrentSettings
+	}
+	if err := decodeArgs(rawArgs, &args); err != nil {
+		return nil, err
+	}
+
+	ids, err := t.selectIDs(ctx, caller, args.IDs)
+	if err != nil || len(ids) == 0 {
+		return map[string]any{}, err
+	}
+
+	if err := t.service.UpdateTorrents(ctx, ids, args.TorrentSettings); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{}, nil
+}
+
+// selectTorrents returns the torrents visible to the caller that match the
+// ids argument: a single id, a list of ids and hashes, "recently-active", or
+// nothing for all torrents.
+func (t *TransmissionRPC) selectTorrents(ctx context.Context, caller Caller, rawIDs json.RawMessage) ([]*transmission.TorrentData, error) {
+	torrents, err := t.service.VisibleTorrents(ctx, caller.UserID, caller.IsAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rawIDs) == 0 || string(rawIDs) == "null" {
+		return torrents, nil
+	}
+
+	if isRecentlyActive(rawIDs) {
+		selected := make([]*transmission.TorrentData, 0, len(torrents))
+		for _, torrent := range torrents {
+			if isActive(torrent) {
+				selected = append(selected, torrent)
+			}
+		}
+		return selected, nil
+	}
+
+	ids, hashes, err := parseIDs(rawIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]*transmission.TorrentData, 0, len(ids)+len(hashes))
+	for _, torrent := range torrents {
+		_, byID := ids[torrent.ID]
+		_, byHash := hashes[strings.ToLower(torrent.HashString)]
+		if byID || byHash {
+			selected = append(selected, torrent)
+		}
+	}
+
+	return selected, nil
+}
+
+// selectIDs is like selectTorrents but returns the torrent ids
+func (t *TransmissionRPC) selectIDs(ctx context.Context, caller Caller, rawIDs json.RawMessage) ([]int64, error) {
+	torrents, err := t.selectTorrents(ctx, caller, rawIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(torrents))
+	for _, torrent := range torrents {
+		ids = append(ids, torrent.ID)
+	}
+	return ids, nil
+}
+
+func isRecentlyActive(rawIDs json.RawMessage) bool {
+	var value string
+	return json.Unmarshal(rawIDs, &value) == nil && value == recentlyActive
+}
+
+// isActive reports whether a torrent transfers data or is being worked on
+func isActive(torrent *transmission.TorrentData) bool {
+	if torrent.RateDownload > 0 || torrent.RateUpload > 0 {
+		return true
+	}
+
+	switch torrent.Status {
+	case transmission.StatusCheck, transmission.StatusDownload:
+		return true
+	}
+
+	return time.Since(torrent.AddedDate) < time.Minute
+}
+
+// parseIDs splits the ids argument into numeric ids and lowercase hashes
+func parseIDs(rawIDs json.RawMessage) (map[int64]struct{}, map[string]struct{}, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal(rawIDs, &values); err != nil {
+		// A single id
+		values = []json.RawMessage{rawIDs}
+	}
+
+	ids := map[int64]struct{}{}
+	hashes := map[string]struct{}{}
+	for _, value := range values {
+		var id int64
+		if err := json.Unmarshal(value, &id); err == nil {
+			ids[id] = struct{}{}
+			continue
+		}
+
+		var hash string
+		if err := json.Unmarshal(value, &hash); err != nil {
+			return nil, nil, fmt.Errorf("invalid ids")
+		}
+		hashes[strings.ToLower(hash)] = struct{}{}
+	}
+
+	return ids, hashes, nil
+}
+
+// transmissionTorrentFields returns the torrent-get fields of a torrent
+func transmissionTorrentFields(torrent *transmission.TorrentData) map[string]any {
+	var doneDate int64
+	if torrent.DoneDate != nil {
+		doneDate = torrent.DoneDate.Unix()
+	}
+
+	var errorCode int
+	if torrent.Error != "" {
+		if _, err := fmt.Sscanf(torrent.Error, "Error code: %d", &errorCode); err != nil {
+			// Local errors are the most common ones
+			errorCode = 3
+		}
+	}
+
+	labels := torrent.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+
+	leftUntilDone := int64(float64(torrent.SizeWhenDone) * (1 - torrent.PercentDone))
+	if leftUntilDone < 0 {
+		leftUntilDone = 0
+	}
+
+	return map[string]any{
+		"id":             torrent.ID,
+		"name":           torrent.Name,
+		"hashString":     torrent.HashString,
+		"status":         transmissionStatusCodes[torrent.Status],
+		"percentDone":    torrent.PercentDone,
+		"sizeWhenDone":   torrent.SizeWhenDone,
+		"totalSize":      torrent.TotalSize,
+		"leftUntilDone":  leftUntilDone,
+		"rateDownload":   torrent.RateDownload,
+		"rateUpload":     torrent.RateUpload,
+		"uploadRatio":    torrent.UploadRatio,
+		"eta":            torrent.ETA,
+		"downloadedEver": torrent.DownloadedEver,
+		"uploadedEver":   torrent.UploadedEver,
+		"addedDate":      torrent.AddedDate.Unix(),
+		"doneDate":       doneDate,
+		"error":          errorCode,
+		"errorString":    torrent.ErrorString,
+		"downloadDir":    torrent.DownloadDir,
+		"isFinished":     torrent.PercentDone >= 1 && torrent.Status == transmission.StatusStopped,
+		"labels":         labels,
+	}
+}
+
+// filterFields keeps only the requested fields; no fields means all of them
+func filterFields(values map[string]any, fields []string) map[string]any {
+	if len(fields) == 0 {
+		return values
+	}
+
+	filtered := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if value, ok := values[field]; ok {
+			filtered[field] = value
+		}
+	}
+	return filtered
+}
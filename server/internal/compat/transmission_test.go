@@ -0,0 +1,116 @@
+package compat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/internal/apikey"
+)
+
+func rpcCall(handler http.Handler, key, sessionID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/transmission/rpc", strings.NewReader(body))
+	if key != "" {
+		req.SetBasicAuth("sonarr", key)
+	}
+	if sessionID != "" {
+		req.Header.Set(TransmissionSessionHeader, sessionID)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeRPC(t *testing.T, rec *httptest.ResponseRecorder) (string, map[string]json.RawMessage) {
+	t.Helper()
+
+	var res struct {
+		Result    string                     `json:"result"`
+		Arguments map[string]json.RawMessage `json:"arguments"`
+		Tag       int                        `json:"tag"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Failed to decode rpc response %q: %v", rec.Body.String(), err)
+	}
+	return res.Result, res.Arguments
+}
+
+func TestTransmissionRPCHandshake(t *testing.T) {
+	_, handler, _, key := newTestServer(t, apikey.ScopeTorrentsRead)
+
+	rec := rpcCall(handler, "", "", `{"method":"session-get"}`)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("Expected a basic auth challenge, got %d", rec.Code)
+	}
+
+	rec = rpcCall(handler, key, "", `{"method":"session-get"}`)
+	sessionID := rec.Header().Get(TransmissionSessionHeader)
+	if rec.Code != http.StatusConflict || sessionID == "" {
+		t.Fatalf("Expected a 409 carrying the session id, got %d", rec.Code)
+	}
+
+	rec = rpcCall(handler, key, sessionID, `{"method":"session-get","arguments":{"fields":["rpc-version","download-dir"]},"tag":7}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	result, arguments := decodeRPC(t, rec)
+	if result != "success" || string(arguments["rpc-version"]) != "17" || arguments["download-dir"] == nil {
+		t.Errorf("Unexpected session-get response: %s", rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"tag":7`) {
+		t.Errorf("Expected the tag to be echoed: %s", rec.Body.String())
+	}
+
+	// Methods outside the key's scopes are refused
+	rec = rpcCall(handler, key, sessionID, `{"method":"torrent-remove","arguments":{"ids":[1]}}`)
+	if result, _ := decodeRPC(t, rec); !strings.Contains(result, apikey.ScopeTorrentsRemove) {
+		t.Errorf("Expected a missing scope error, got %q", result)
+	}
+}
+
+func TestTransmissionRPCAddTagsCaller(t *testing.T) {
+	testApp, handler, owner, key := newTestServer(t, apikey.ScopeTorrentsRead, apikey.ScopeTorrentsAdd)
+	sessionID := rpcCall(handler, key, "", "{}").Header().Get(TransmissionSessionHeader)
+
+	rec := rpcCall(handler, key, sessionID, `{"method":"torrent-add","arguments":{"filename":"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567","download-dir":"/downloads/tv","labels":["tv"]}}`)
+	result, arguments := decodeRPC(t, rec)
+	if result != "success" {
+		t.Fatalf("torrent-add failed: %s", rec.Body.String())
+	}
+
+	var added struct {
+		ID         int64  `json:"id"`
+		HashString string `json:"hashString"`
+	}
+	if err := json.Unmarshal(arguments["torrent-added"], &added); err != nil || added.HashString == "" {
+		t.Fatalf("Expected torrent-added in the response: %s", rec.Body.String())
+	}
+
+	record, err := testApp.FindFirstRecordByData("torrents", "hash", added.HashString)
+	if err != nil {
+		t.Fatalf("Failed to find the added torrent: %v", err)
+	}
+	if record.GetString("user") != owner.Id {
+		t.Errorf("Expected the torrent to be owned by the caller, got %q", record.GetString("user"))
+	}
+
+	// Non-admins only see their own torrents
+	rec = rpcCall(handler, key, sessionID, `{"method":"torrent-get","arguments":{"fields":["id","hashString","status","downloadDir","labels"]}}`)
+	_, arguments = decodeRPC(t, rec)
+
+	var torrents []map[string]any
+	if err := json.Unmarshal(arguments["torrents"], &torrents); err != nil {
+		t.Fatalf("Failed to decode torrents: %v", err)
+	}
+	if len(torrents) != 1 || torrents[0]["hashString"] != added.HashString {
+		t.Fatalf("Expected only the added torrent, got %+v", torrents)
+	}
+	if torrents[0]["downloadDir"] != "/downloads/tv" || torrents[0]["name"] != nil {
+		t.Errorf("Unexpected fields: %+v", torrents[0])
+	}
+	if labels, _ := torrents[0]["labels"].([]any); len(labels) != 1 || labels[0] != "tv" {
+		t.Errorf("Expected the tv label, got %+v", torrents[0]["labels"])
+	}
+}
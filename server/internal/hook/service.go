@@ -0,0 +1,735 @@
+// Package hook runs admin-configured commands when downloads complete.
+package hook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"backend/internal/audit"
+	"backend/internal/transmission"
+)
+
+// Environment variables describing the completed torrent.
+const (
+	EnvTorrentName = "RETORRENT_TORRENT_NAME"
+	EnvTorrentHash = "RETORRENT_TORRENT_HASH"
+	EnvTorrentID   = "RETORRENT_TORRENT_ID"
+	EnvDownloadDir = "RETORRENT_DOWNLOAD_DIR"
+	EnvOwner       = "RETORRENT_OWNER"
+	EnvOwnerID     = "RETORRENT_OWNER_ID"
+	EnvCategory    = "RETORRENT_CATEGORY"
+	EnvLabels      = "RETORRENT_LABELS"
+)
+
+// baseEnv lists the server environment variables every command gets. The
+// rest of the server's environment holds secrets such as the Transmission
+// credentials, so it is only passed as hooks list it in PassEnv.
+var baseEnv = []string{"PATH", "HOME", "LANG"}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Run states stored in the hook_runs collection.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	defaultTimeout  = 300
+	maxTimeout      = 3600
+	maxOutputSize   = 64 << 10
+	maxErrorLength  = 1000
+	defaultLogLimit = 50
+	maxLogLimit     = 500
+	// killGrace is how long a killed command may keep its output open
+	killGrace = 5 * time.Second
+)
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// Response represents a completion hook as exposed by the API.
+type Response struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	Timeout    int      `json:"timeout"`
+	Categories []string `json:"categories"`
+	PassEnv    []string `json:"passEnv"`
+	Enabled    bool     `json:"enabled"`
+	Created    string   `json:"created"`
+	Updated    string   `json:"updated"`
+}
+
+// Params holds the fields of a completion hook to create or update. Nil
+// fields are left untouched on update.
+type Params struct {
+	Name    *string   `json:"name"`
+	Command *string   `json:"command"`
+	Args    *[]string `json:"args"`
+	// Timeout is in seconds
+	Timeout *int `json:"timeout"`
+	// Categories limits the hook to torrents whose first label is listed;
+	// empty means every torrent
+	Categories *[]string `json:"categories"`
+	// PassEnv names server environment variables passed to the command
+	// besides PATH, HOME, LANG and the RETORRENT_ variables
+	PassEnv *[]string `json:"passEnv"`
+	Enabled *bool     `json:"enabled"`
+}
+
+// RunResponse represents an execution of a hook.
+type RunResponse struct {
+	ID          string            `json:"id"`
+	Hook        string            `json:"hook"`
+	TorrentHash string            `json:"torrentHash"`
+	TorrentName string            `json:"torrentName"`
+	Env         map[string]string `json:"env"`
+	Status      string            `json:"status"`
+	ExitCode    int               `json:"exitCode"`
+	Output      string            `json:"output"`
+	Error       string            `json:"error,omitempty"`
+	RetryOf     string            `json:"retryOf,omitempty"`
+	StartedAt   string            `json:"startedAt,omitempty"`
+	FinishedAt  string            `json:"finishedAt,omitempty"`
+	Created     string            `json:"created"`
+}
+
+// Service manages completion hooks and runs them for completed downloads.
+type Service struct {
+	app   core.App
+	audit *audit.Service
+	// slots bounds the number of commands running at once
+	slots chan struct{}
+
+	mu sync.Mutex
+	// active holds the ids of queued and running runs
+	active map[string]struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewService constructs a Service running at most concurrency commands at
+// once.
+func NewService(app core.App, auditService *audit.Service, concurrency int) *Service {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Service{
+		app:    app,
+		audit:  auditService,
+		slots:  make(chan struct{}, concurrency),
+		active: map[string]struct{}{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Stop kills running commands and waits for their runs to be recorded.
+func (s *Service) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func stringSlice(record *core.Record, field string) []string {
+	values := []string{}
+	if err := record.UnmarshalJSONField(field, &values); err != nil || values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func hookTimeout(record *core.Record) int {
+	if timeout := record.GetInt("timeout"); timeout > 0 {
+		return timeout
+	}
+	return defaultTimeout
+}
+
+func mapHookRecord(record *core.Record) Response {
+	return Response{
+		ID:         record.Id,
+		Name:       record.GetString("name"),
+		Command:    record.GetString("command"),
+		Args:       stringSlice(record, "args"),
+		Timeout:    hookTimeout(record),
+		Categories: stringSlice(record, "categories"),
+		PassEnv:    stringSlice(record, "passEnv"),
+		Enabled:    record.GetBool("enabled"),
+		Created:    formatDate(record, "created"),
+		Updated:    formatDate(record, "updated"),
+	}
+}
+
+func mapRunRecord(record *core.Record) RunResponse {
+	env := map[string]string{}
+	_ = record.UnmarshalJSONField("env", &env)
+
+	return RunResponse{
+		ID:          record.Id,
+		Hook:        record.GetString("hook"),
+		TorrentHash: record.GetString("torrentHash"),
+		TorrentName: record.GetString("torrentName"),
+		Env:         env,
+		Status:      record.GetString("status"),
+		ExitCode:    record.GetInt("exitCode"),
+		Output:      record.GetString("output"),
+		Error:       record.GetString("error"),
+		RetryOf:     record.GetString("retryOf"),
+		StartedAt:   formatDate(record, "startedAt"),
+		FinishedAt:  formatDate(record, "finishedAt"),
+		Created:     formatDate(record, "created"),
+	}
+}
+
+// List returns all completion hooks.
+func (s *Service) List() ([]Response, error) {
+	records, err := s.app.FindRecordsByFilter("completion_hooks", "", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find completion hooks: %w", err)
+	}
+
+	hooks := make([]Response, 0, len(records))
+	for _, record := range records {
+		hooks = append(hooks, mapHookRecord(record))
+	}
+	return hooks, nil
+}
+
+// Create adds a completion hook. Hooks are enabled unless stated otherwise.
+func (s *Service) Create(ctx context.Context, params Params) (Response, error) {
+	collection, err := s.app.FindCollectionByNameOrId("completion_hooks")
+	if err != nil {
+		return Response{}, fmt.Errorf("find completion_hooks collection: %w", err)
+	}
+
+	if params.Name == nil || params.Command == nil {
+		return Response{}, ValidationError{Message: "name and command are required"}
+	}
+	if params.Enabled == nil {
+		enabled := true
+		params.Enabled = &enabled
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("args", []string{})
+	record.Set("categories", []string{})
+	record.Set("passEnv", []string{})
+	record.Set("timeout", defaultTimeout)
+	if err := applyParams(record, params); err != nil {
+		return Response{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return Response{}, fmt.Errorf("save completion hook: %w", err)
+	}
+
+	response := mapHookRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionHookCreate,
+		Targets: []string{record.Id},
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Update changes a completion hook.
+func (s *Service) Update(ctx context.Context, id string, params Params) (Response, error) {
+	record, err := s.findRecord("completion_hooks", id, "completion hook")
+	if err != nil {
+		return Response{}, err
+	}
+
+	before := mapHookRecord(record)
+	if err := applyParams(record, params); err != nil {
+		return Response{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return Response{}, fmt.Errorf("save completion hook: %w", err)
+	}
+
+	response := mapHookRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionHookUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Delete removes a completion hook together with its runs.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	record, err := s.findRecord("completion_hooks", id, "completion hook")
+	if err != nil {
+		return err
+	}
+
+	before := mapHookRecord(record)
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete completion hook: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionHookDelete,
+		Targets: []string{id},
+		Before:  before,
+	})
+
+	return nil
+}
+
+// Runs returns the most recent runs of a hook.
+func (s *Service) Runs(id string, limit int) ([]RunResponse, error) {
+	if _, err := s.findRecord("completion_hooks", id, "completion hook"); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	records, err := s.app.FindRecordsByFilter("hook_runs", "hook = {:hook}", "-created", limit, 0, dbx.Params{"hook": id})
+	if err != nil {
+		return nil, fmt.Errorf("find hook runs: %w", err)
+	}
+
+	runs := make([]RunResponse, 0, len(records))
+	for _, record := range records {
+		runs = append(runs, mapRunRecord(record))
+	}
+	return runs, nil
+}
+
+// Retry runs a hook again with the environment of a finished run. The new
+// run is queued and returned right away.
+func (s *Service) Retry(ctx context.Context, hookID, runID string) (RunResponse, error) {
+	hook, err := s.findRecord("completion_hooks", hookID, "completion hook")
+	if err != nil {
+		return RunResponse{}, err
+	}
+
+	previous, err := s.findRecord("hook_runs", runID, "hook run")
+	if err != nil {
+		return RunResponse{}, err
+	}
+	if previous.GetString("hook") != hook.Id {
+		return RunResponse{}, NotFoundError{Message: "hook run not found"}
+	}
+	// Runs left queued or running by a restart can be retried
+	s.mu.Lock()
+	_, active := s.active[previous.Id]
+	s.mu.Unlock()
+	if active {
+		return RunResponse{}, ValidationError{Message: "hook run has not finished yet"}
+	}
+
+	env := map[string]string{}
+	if err := previous.UnmarshalJSONField("env", &env); err != nil {
+		return RunResponse{}, fmt.Errorf("read hook run environment: %w", err)
+	}
+
+	run, err := s.createRun(hook, previous.GetString("torrentHash"), previous.GetString("torrentName"), env, previous.Id)
+	if err != nil {
+		return RunResponse{}, fmt.Errorf("create hook run: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionHookRetry,
+		Targets: []string{hook.Id},
+		Details: map[string]string{
+			"run":     run.Id,
+			"retryOf": previous.Id,
+			"torrent": previous.GetString("torrentName"),
+		},
+	})
+
+	response := mapRunRecord(run)
+	s.start(hook, run)
+	return response, nil
+}
+
+// PruneRuns deletes runs older than retention.
+func (s *Service) PruneRuns(retention time.Duration) (int64, error) {
+	cutoff, err := types.ParseDateTime(time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("parse cutoff date: %w", err)
+	}
+
+	result, err := s.app.NonconcurrentDB().Delete("hook_runs", dbx.NewExp("created < {:cutoff}", dbx.Params{"cutoff": cutoff.String()})).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("delete old hook runs: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *Service) findRecord(collection, id, label string) (*core.Record, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ValidationError{Message: label + " id is required"}
+	}
+
+	record, err := s.app.FindRecordById(collection, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: label + " not found"}
+		}
+		return nil, fmt.Errorf("find %s: %w", label, err)
+	}
+	return record, nil
+}
+
+// applyParams validates params and sets them on record
+func applyParams(record *core.Record, params Params) error {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" {
+			return ValidationError{Message: "name cannot be empty"}
+		}
+		record.Set("name", name)
+	}
+
+	if params.Command != nil {
+		command := strings.TrimSpace(*params.Command)
+		if command == "" {
+			return ValidationError{Message: "command cannot be empty"}
+		}
+		if _, err := exec.LookPath(command); err != nil {
+			return ValidationError{Message: fmt.Sprintf("command %s is not an executable on the server", command)}
+		}
+		record.Set("command", command)
+	}
+
+	if params.Args != nil {
+		args := *params.Args
+		if args == nil {
+			args = []string{}
+		}
+		record.Set("args", args)
+	}
+
+	if params.Timeout != nil {
+		if *params.Timeout < 1 || *params.Timeout > maxTimeout {
+			return ValidationError{Message: fmt.Sprintf("timeout must be between 1 and %d seconds", maxTimeout)}
+		}
+		record.Set("timeout", *params.Timeout)
+	}
+
+	if params.Categories != nil {
+		categories := []string{}
+		seen := map[string]struct{}{}
+		for _, value := range *params.Categories {
+			category := strings.TrimSpace(value)
+			if category == "" {
+				continue
+			}
+			if _, dup := seen[category]; dup {
+				continue
+			}
+			seen[category] = struct{}{}
+			categories = append(categories, category)
+		}
+		record.Set("categories", categories)
+	}
+
+	if params.PassEnv != nil {
+		names := []string{}
+		seen := map[string]struct{}{}
+		for _, value := range *params.PassEnv {
+			name := strings.TrimSpace(value)
+			if !envNamePattern.MatchString(name) {
+				return ValidationError{Message: fmt.Sprintf("%q is not an environment variable name", value)}
+			}
+			if _, dup := seen[name]; dup {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+		record.Set("passEnv", names)
+	}
+
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	return nil
+}
+
+// HandleEvent runs the enabled hooks for a completed download. It is meant
+// to be registered with transmission.SyncService.OnEvent.
+func (s *Service) HandleEvent(event transmission.Event) {
+	if event.Type != transmission.EventDownloadCompleted {
+		return
+	}
+
+	records, err := s.app.FindRecordsByFilter("completion_hooks", "enabled = true", "", 0, 0)
+	if err != nil {
+		log.Printf("[Hook] Failed to find completion hooks: %v", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	env := s.environment(event)
+	for _, record := range records {
+		if !appliesTo(record, env[EnvCategory]) {
+			continue
+		}
+
+		run, err := s.createRun(record, event.Torrent.HashString, event.Torrent.Name, env, "")
+		if err != nil {
+			log.Printf("[Hook] Failed to queue %s for %s: %v", record.GetString("name"), event.Torrent.Name, err)
+			continue
+		}
+		s.start(record, run)
+	}
+}
+
+// environment describes the torrent of an event for the command
+func (s *Service) environment(event transmission.Event) map[string]string {
+	torrent := event.Torrent
+
+	var category string
+	if len(torrent.Labels) > 0 {
+		category = torrent.Labels[0]
+	}
+
+	var owner string
+	if event.UserID != "" {
+		if user, err := s.app.FindRecordById("users", event.UserID); err == nil {
+			owner = user.GetString("email")
+		}
+	}
+
+	return map[string]string{
+		EnvTorrentName: torrent.Name,
+		EnvTorrentHash: torrent.HashString,
+		EnvTorrentID:   strconv.FormatInt(torrent.ID, 10),
+		EnvDownloadDir: torrent.DownloadDir,
+		EnvOwner:       owner,
+		EnvOwnerID:     event.UserID,
+		EnvCategory:    category,
+		EnvLabels:      strings.Join(torrent.Labels, ","),
+	}
+}
+
+func appliesTo(record *core.Record, category string) bool {
+	categories := stringSlice(record, "categories")
+	if len(categories) == 0 {
+		return true
+	}
+	for _, value := range categories {
+		if strings.EqualFold(value, category) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) createRun(hook *core.Record, hash, name string, env map[string]string, retryOf string) (*core.Record, error) {
+	collection, err := s.app.FindCollectionByNameOrId("hook_runs")
+	if err != nil {
+		return nil, fmt.Errorf("find hook_runs collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("hook", hook.Id)
+	record.Set("torrentHash", hash)
+	record.Set("torrentName", truncate(name, 1000))
+	record.Set("env", env)
+	record.Set("status", StatusQueued)
+	record.Set("retryOf", retryOf)
+
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// start runs the hook in the background once a slot is free
+func (s *Service) start(hook, run *core.Record) {
+	s.mu.Lock()
+	s.active[run.Id] = struct{}{}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.active, run.Id)
+			s.mu.Unlock()
+		}()
+
+		select {
+		case s.slots <- struct{}{}:
+		case <-s.ctx.Done():
+			run.Set("status", StatusFailed)
+			run.Set("error", "cancelled on shutdown")
+			s.saveRun(run)
+			return
+		}
+		defer func() { <-s.slots }()
+
+		s.execute(hook, run)
+	}()
+}
+
+// execute runs the command and records its outcome on the run
+func (s *Service) execute(hook, run *core.Record) {
+	env := map[string]string{}
+	_ = run.UnmarshalJSONField("env", &env)
+
+	timeout := time.Duration(hookTimeout(hook)) * time.Second
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.GetString("command"), stringSlice(hook, "args")...)
+	cmd.Env = []string{}
+	for _, name := range append(append([]string{}, baseEnv...), stringSlice(hook, "passEnv")...) {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cmd.Env = append(cmd.Env, key+"="+env[key])
+	}
+
+	output := &limitedBuffer{limit: maxOutputSize}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.WaitDelay = killGrace
+
+	run.Set("status", StatusRunning)
+	run.Set("startedAt", time.Now())
+	s.saveRun(run)
+
+	err := cmd.Run()
+
+	run.Set("finishedAt", time.Now())
+	run.Set("output", output.String())
+	if cmd.ProcessState != nil {
+		run.Set("exitCode", cmd.ProcessState.ExitCode())
+	} else {
+		run.Set("exitCode", -1)
+	}
+
+	switch {
+	case err == nil:
+		run.Set("status", StatusSucceeded)
+		run.Set("error", "")
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("timed out after %s", timeout)
+	case s.ctx.Err() != nil:
+		err = errors.New("cancelled on shutdown")
+	}
+
+	if err != nil {
+		run.Set("status", StatusFailed)
+		run.Set("error", truncate(err.Error(), maxErrorLength))
+		log.Printf("[Hook] %s failed for %s: %v", hook.GetString("name"), run.GetString("torrentName"), err)
+	}
+	s.saveRun(run)
+}
+
+func (s *Service) saveRun(run *core.Record) {
+	if err := s.app.Save(run); err != nil {
+		log.Printf("[Hook] Failed to update run %s: %v", run.Id, err)
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it. exec calls Write
+// from one goroutine at a time when stdout and stderr share the writer.
+type limitedBuffer struct {
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - len(b.data); room > 0 {
+		if len(p) > room {
+			b.data = append(b.data, p[:room]...)
+			b.truncated = true
+		} else {
+			b.data = append(b.data, p...)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
+	}
+	// Report everything as written so the command isn't stopped by a full buffer
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	output := strings.ToValidUTF8(string(b.data), "")
+	if b.truncated {
+		output += "\n[output truncated]"
+	}
+	return output
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
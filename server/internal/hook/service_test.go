@@ -0,0 +1,211 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/transmission"
+)
+
+func newTestService(t *testing.T, concurrency int) (*tests.TestApp, *Service) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	service := NewService(testApp, audit.NewService(testApp), concurrency)
+	t.Cleanup(service.Stop)
+
+	return testApp, service
+}
+
+// createShellHook runs script with /bin/sh
+func createShellHook(t *testing.T, service *Service, name, script string, params Params) Response {
+	t.Helper()
+
+	command := "/bin/sh"
+	args := []string{"-c", script}
+	params.Name = &name
+	params.Command = &command
+	params.Args = &args
+
+	hook, err := service.Create(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	return hook
+}
+
+func completedEvent(userID string, labels ...string) transmission.Event {
+	return transmission.Event{
+		Type: transmission.EventDownloadCompleted,
+		Torrent: transmission.TorrentData{
+			ID:          7,
+			Name:        "Debian 12",
+			HashString:  "abcdef",
+			DownloadDir: "/downloads",
+			Labels:      labels,
+		},
+		UserID: userID,
+		Time:   time.Now(),
+	}
+}
+
+func runsOf(t *testing.T, service *Service, hookID string) []RunResponse {
+	t.Helper()
+
+	runs, err := service.Runs(hookID, 0)
+	if err != nil {
+		t.Fatalf("Runs failed: %v", err)
+	}
+	return runs
+}
+
+func TestHookReceivesTorrentEnvironment(t *testing.T) {
+	testApp, service := newTestService(t, 2)
+	owner := testutil.CreateUser(t, testApp, "owner@example.com", "user")
+
+	all := createShellHook(t, service, "Print", `printf '%s|%s|%s|%s|%s|%s' "$RETORRENT_TORRENT_NAME" "$RETORRENT_TORRENT_HASH" "$RETORRENT_DOWNLOAD_DIR" "$RETORRENT_OWNER" "$RETORRENT_CATEGORY" "$RETORRENT_LABELS"`, Params{})
+	movies := []string{"movies"}
+	other := createShellHook(t, service, "Movies only", "true", Params{Categories: &movies})
+
+	// Only completed downloads run hooks
+	added := completedEvent(owner.Id, "tv", "hd")
+	added.Type = transmission.EventTorrentAdded
+	service.HandleEvent(added)
+	service.HandleEvent(completedEvent(owner.Id, "tv", "hd"))
+	service.wg.Wait()
+
+	runs := runsOf(t, service, all.ID)
+	if len(runs) != 1 {
+		t.Fatalf("Expected 1 run, got %d", len(runs))
+	}
+	run := runs[0]
+	if run.Status != StatusSucceeded || run.ExitCode != 0 || run.StartedAt == "" || run.FinishedAt == "" {
+		t.Errorf("Expected a successful run, got %+v", run)
+	}
+	if run.Output != "Debian 12|abcdef|/downloads|owner@example.com|tv|tv,hd" {
+		t.Errorf("Unexpected output %q", run.Output)
+	}
+	if run.Env[EnvOwnerID] != owner.Id || run.Env[EnvTorrentID] != "7" {
+		t.Errorf("Expected the environment to be recorded, got %v", run.Env)
+	}
+
+	if runs := runsOf(t, service, other.ID); len(runs) != 0 {
+		t.Errorf("Expected hooks of other categories not to run, got %d runs", len(runs))
+	}
+}
+
+func TestHookEnvironmentIsMinimal(t *testing.T) {
+	_, service := newTestService(t, 1)
+	t.Setenv("TRANSMISSION_PASSWORD", "secret")
+	t.Setenv("MEDIA_ROOT", "/media")
+
+	script := `printf '%s|%s|%s' "$TRANSMISSION_PASSWORD" "$MEDIA_ROOT" "$RETORRENT_TORRENT_NAME"`
+	plain := createShellHook(t, service, "Plain", script, Params{})
+	passEnv := []string{"MEDIA_ROOT"}
+	allowed := createShellHook(t, service, "Allowed", script, Params{PassEnv: &passEnv})
+
+	service.HandleEvent(completedEvent(""))
+	service.wg.Wait()
+
+	if runs := runsOf(t, service, plain.ID); len(runs) != 1 || runs[0].Output != "||Debian 12" {
+		t.Errorf("Expected the server environment to be withheld, got %+v", runs)
+	}
+	if runs := runsOf(t, service, allowed.ID); len(runs) != 1 || runs[0].Output != "|/media|Debian 12" {
+		t.Errorf("Expected only the listed variable to be passed, got %+v", runs)
+	}
+
+	invalid := []string{"A=B"}
+	name := "Invalid"
+	var validationErr ValidationError
+	if _, err := service.Update(context.Background(), allowed.ID, Params{Name: &name, PassEnv: &invalid}); !errors.As(err, &validationErr) {
+		t.Errorf("Expected invalid variable names to be rejected, got %v", err)
+	}
+}
+
+func TestHookFailuresAndRetry(t *testing.T) {
+	_, service := newTestService(t, 2)
+
+	failing := createShellHook(t, service, "Failing", "echo 'unpack failed' >&2; exit 3", Params{})
+	timeout := 1
+	slow := createShellHook(t, service, "Slow", "exec sleep 10", Params{Timeout: &timeout})
+
+	service.HandleEvent(completedEvent(""))
+	service.wg.Wait()
+
+	runs := runsOf(t, service, failing.ID)
+	if len(runs) != 1 || runs[0].Status != StatusFailed || runs[0].ExitCode != 3 || runs[0].Output != "unpack failed\n" {
+		t.Fatalf("Expected a failed run with the exit code and output, got %+v", runs)
+	}
+	slowRuns := runsOf(t, service, slow.ID)
+	if len(slowRuns) != 1 || slowRuns[0].Status != StatusFailed || !strings.Contains(slowRuns[0].Error, "timed out") {
+		t.Fatalf("Expected the slow command to time out, got %+v", slowRuns)
+	}
+
+	// Retrying after a fix uses the recorded environment
+	args := []string{"-c", `echo "retried $RETORRENT_TORRENT_NAME"`}
+	if _, err := service.Update(context.Background(), failing.ID, Params{Args: &args}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	retry, err := service.Retry(context.Background(), failing.ID, runs[0].ID)
+	if err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if retry.RetryOf != runs[0].ID || retry.Status != StatusQueued {
+		t.Errorf("Expected a queued retry, got %+v", retry)
+	}
+	service.wg.Wait()
+
+	runs = runsOf(t, service, failing.ID)
+	if len(runs) != 2 || runs[0].ID != retry.ID || runs[0].Status != StatusSucceeded || runs[0].Output != "retried Debian 12\n" {
+		t.Errorf("Expected the retry to succeed, got %+v", runs)
+	}
+
+	var notFoundErr NotFoundError
+	if _, err := service.Retry(context.Background(), slow.ID, runs[1].ID); !errors.As(err, &notFoundErr) {
+		t.Errorf("Expected retrying a run of another hook to fail, got %v", err)
+	}
+}
+
+func TestHookConcurrencyLimit(t *testing.T) {
+	_, service := newTestService(t, 1)
+
+	// The lock directory can't be created twice, so overlapping runs fail
+	lock := filepath.Join(t.TempDir(), "lock")
+	script := "mkdir " + lock + " || exit 9; sleep 0.2; rmdir " + lock
+	first := createShellHook(t, service, "First", script, Params{})
+	second := createShellHook(t, service, "Second", script, Params{})
+
+	service.HandleEvent(completedEvent(""))
+	service.wg.Wait()
+
+	for _, id := range []string{first.ID, second.ID} {
+		if runs := runsOf(t, service, id); len(runs) != 1 || runs[0].Status != StatusSucceeded {
+			t.Errorf("Expected runs not to overlap, got %+v", runs)
+		}
+	}
+}
+
+func TestHookValidation(t *testing.T) {
+	_, service := newTestService(t, 1)
+
+	name := "Broken"
+	missing := "/nonexistent/post-process"
+	if _, err := service.Create(context.Background(), Params{Name: &name, Command: &missing}); err == nil {
+		t.Errorf("Expected missing commands to be rejected")
+	}
+
+	hook := createShellHook(t, service, "Valid", "true", Params{})
+	timeout := 0
+	if _, err := service.Update(context.Background(), hook.ID, Params{Timeout: &timeout}); err == nil {
+		t.Errorf("Expected a zero timeout to be rejected")
+	}
+}
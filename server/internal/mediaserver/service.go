@@ -0,0 +1,652 @@
+// Package mediaserver asks Jellyfin, Emby and Plex servers to refresh their
+// libraries when downloads complete.
+package mediaserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"backend/internal/audit"
+	"backend/internal/transmission"
+)
+
+// Supported media server types.
+const (
+	TypeJellyfin = "jellyfin"
+	TypeEmby     = "emby"
+	TypePlex     = "plex"
+)
+
+// Refresh states stored in the media_refreshes collection.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	defaultMaxAttempts = 4
+	defaultBaseDelay   = 5 * time.Second
+	requestTimeout     = 15 * time.Second
+	maxErrorLength     = 1000
+	defaultLogLimit    = 50
+	maxLogLimit        = 500
+)
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// Response represents a media server as exposed by the API. The token is
+// never returned.
+type Response struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	URL          string   `json:"url"`
+	HasToken     bool     `json:"hasToken"`
+	Sections     []string `json:"sections"`
+	Categories   []string `json:"categories"`
+	DownloadDirs []string `json:"downloadDirs"`
+	Enabled      bool     `json:"enabled"`
+	Created      string   `json:"created"`
+	Updated      string   `json:"updated"`
+}
+
+// Params holds the fields of a media server to create or update. Nil fields
+// are left untouched on update.
+type Params struct {
+	Name  *string `json:"name"`
+	Type  *string `json:"type"`
+	URL   *string `json:"url"`
+	Token *string `json:"token"`
+	// Sections lists the Plex library sections to refresh; empty refreshes
+	// all of them
+	Sections *[]string `json:"sections"`
+	// Categories and DownloadDirs limit the refreshes to completed torrents
+	// whose first label is listed or that were saved below a listed
+	// directory; both empty means every completed torrent
+	Categories   *[]string `json:"categories"`
+	DownloadDirs *[]string `json:"downloadDirs"`
+	Enabled      *bool     `json:"enabled"`
+}
+
+// RefreshResponse represents an entry of the refresh log.
+type RefreshResponse struct {
+	ID             string `json:"id"`
+	Server         string `json:"server"`
+	TorrentHash    string `json:"torrentHash,omitempty"`
+	TorrentName    string `json:"torrentName,omitempty"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	ResponseStatus int    `json:"responseStatus,omitempty"`
+	Error          string `json:"error,omitempty"`
+	FinishedAt     string `json:"finishedAt,omitempty"`
+	Created        string `json:"created"`
+}
+
+// Service manages media servers and refreshes their libraries.
+type Service struct {
+	app    core.App
+	audit  *audit.Service
+	client *http.Client
+
+	// maxAttempts and baseDelay control the retries; the delay doubles
+	// after every failed attempt
+	maxAttempts int
+	baseDelay   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewService constructs a Service instance.
+func NewService(app core.App, auditService *audit.Service) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Service{
+		app:         app,
+		audit:       auditService,
+		client:      &http.Client{Timeout: requestTimeout},
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Stop cancels pending retries and waits for running refreshes to finish.
+func (s *Service) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func stringSlice(record *core.Record, field string) []string {
+	values := []string{}
+	if err := record.UnmarshalJSONField(field, &values); err != nil || values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func mapServerRecord(record *core.Record) Response {
+	return Response{
+		ID:           record.Id,
+		Name:         record.GetString("name"),
+		Type:         record.GetString("type"),
+		URL:          record.GetString("url"),
+		HasToken:     record.GetString("token") != "",
+		Sections:     stringSlice(record, "sections"),
+		Categories:   stringSlice(record, "categories"),
+		DownloadDirs: stringSlice(record, "downloadDirs"),
+		Enabled:      record.GetBool("enabled"),
+		Created:      formatDate(record, "created"),
+		Updated:      formatDate(record, "updated"),
+	}
+}
+
+func mapRefreshRecord(record *core.Record) RefreshResponse {
+	return RefreshResponse{
+		ID:             record.Id,
+		Server:         record.GetString("server"),
+		TorrentHash:    record.GetString("torrentHash"),
+		TorrentName:    record.GetString("torrentName"),
+		Status:         record.GetString("status"),
+		Attempts:       record.GetInt("attempts"),
+		ResponseStatus: record.GetInt("responseStatus"),
+		Error:          record.GetString("error"),
+		FinishedAt:     formatDate(record, "finishedAt"),
+		Created:        formatDate(record, "created"),
+	}
+}
+
+// List returns all media servers.
+func (s *Service) List() ([]Response, error) {
+	records, err := s.app.FindRecordsByFilter("media_servers", "", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find media servers: %w", err)
+	}
+
+	servers := make([]Response, 0, len(records))
+	for _, record := range records {
+		servers = append(servers, mapServerRecord(record))
+	}
+	return servers, nil
+}
+
+// Create adds a media server. Servers are enabled unless stated otherwise.
+func (s *Service) Create(ctx context.Context, params Params) (Response, error) {
+	collection, err := s.app.FindCollectionByNameOrId("media_servers")
+	if err != nil {
+		return Response{}, fmt.Errorf("find media_servers collection: %w", err)
+	}
+
+	if params.Name == nil || params.Type == nil || params.URL == nil {
+		return Response{}, ValidationError{Message: "name, type and url are required"}
+	}
+	if params.Enabled == nil {
+		enabled := true
+		params.Enabled = &enabled
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("sections", []string{})
+	record.Set("categories", []string{})
+	record.Set("downloadDirs", []string{})
+	if err := applyParams(record, params); err != nil {
+		return Response{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return Response{}, fmt.Errorf("save media server: %w", err)
+	}
+
+	response := mapServerRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionMediaServerCreate,
+		Targets: []string{record.Id},
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Update changes a media server.
+func (s *Service) Update(ctx context.Context, id string, params Params) (Response, error) {
+	record, err := s.findRecord("media_servers", id, "media server")
+	if err != nil {
+		return Response{}, err
+	}
+
+	before := mapServerRecord(record)
+	if err := applyParams(record, params); err != nil {
+		return Response{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return Response{}, fmt.Errorf("save media server: %w", err)
+	}
+
+	response := mapServerRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionMediaServerUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Delete removes a media server and its refresh log.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	record, err := s.findRecord("media_servers", id, "media server")
+	if err != nil {
+		return err
+	}
+
+	before := mapServerRecord(record)
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete media server: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionMediaServerDelete,
+		Targets: []string{id},
+		Before:  before,
+	})
+
+	return nil
+}
+
+// Refreshes returns the most recent refreshes of a media server.
+func (s *Service) Refreshes(id string, limit int) ([]RefreshResponse, error) {
+	if _, err := s.findRecord("media_servers", id, "media server"); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	records, err := s.app.FindRecordsByFilter("media_refreshes", "server = {:server}", "-created", limit, 0, dbx.Params{"server": id})
+	if err != nil {
+		return nil, fmt.Errorf("find media refreshes: %w", err)
+	}
+
+	refreshes := make([]RefreshResponse, 0, len(records))
+	for _, record := range records {
+		refreshes = append(refreshes, mapRefreshRecord(record))
+	}
+	return refreshes, nil
+}
+
+// Refresh asks a media server to refresh its libraries regardless of its
+// filters, e.g. to check its settings. The refresh is queued and returned
+// right away.
+func (s *Service) Refresh(ctx context.Context, id string) (RefreshResponse, error) {
+	server, err := s.findRecord("media_servers", id, "media server")
+	if err != nil {
+		return RefreshResponse{}, err
+	}
+
+	refresh, err := s.createRefresh(server, "", "")
+	if err != nil {
+		return RefreshResponse{}, fmt.Errorf("create media refresh: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionMediaRefresh,
+		Targets: []string{server.Id},
+		Details: map[string]string{"refresh": refresh.Id},
+	})
+
+	response := mapRefreshRecord(refresh)
+	s.start(server, refresh)
+	return response, nil
+}
+
+// PruneRefreshes deletes refreshes older than retention.
+func (s *Service) PruneRefreshes(retention time.Duration) (int64, error) {
+	cutoff, err := types.ParseDateTime(time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("parse cutoff date: %w", err)
+	}
+
+	result, err := s.app.NonconcurrentDB().Delete("media_refreshes", dbx.NewExp("created < {:cutoff}", dbx.Params{"cutoff": cutoff.String()})).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("delete old media refreshes: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *Service) findRecord(collection, id, label string) (*core.Record, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ValidationError{Message: label + " id is required"}
+	}
+
+	record, err := s.app.FindRecordById(collection, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: label + " not found"}
+		}
+		return nil, fmt.Errorf("find %s: %w", label, err)
+	}
+	return record, nil
+}
+
+// applyParams validates params and sets them on record
+func applyParams(record *core.Record, params Params) error {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" {
+			return ValidationError{Message: "name cannot be empty"}
+		}
+		record.Set("name", name)
+	}
+
+	if params.Type != nil {
+		serverType := strings.ToLower(strings.TrimSpace(*params.Type))
+		switch serverType {
+		case TypeJellyfin, TypeEmby, TypePlex:
+		default:
+			return ValidationError{Message: fmt.Sprintf("invalid type: %s", *params.Type)}
+		}
+		record.Set("type", serverType)
+	}
+
+	if params.URL != nil {
+		parsed, err := url.Parse(strings.TrimSpace(*params.URL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return ValidationError{Message: "url must be an http or https URL"}
+		}
+		record.Set("url", strings.TrimRight(parsed.String(), "/"))
+	}
+
+	if params.Token != nil {
+		record.Set("token", strings.TrimSpace(*params.Token))
+	}
+
+	if params.Sections != nil {
+		record.Set("sections", cleanList(*params.Sections, func(value string) string { return value }))
+	}
+
+	if params.Categories != nil {
+		record.Set("categories", cleanList(*params.Categories, func(value string) string { return value }))
+	}
+
+	if params.DownloadDirs != nil {
+		for _, dir := range *params.DownloadDirs {
+			if dir = strings.TrimSpace(dir); dir != "" && !path.IsAbs(dir) {
+				return ValidationError{Message: fmt.Sprintf("download directory must be absolute: %s", dir)}
+			}
+		}
+		record.Set("downloadDirs", cleanList(*params.DownloadDirs, path.Clean))
+	}
+
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	return nil
+}
+
+// cleanList trims, normalizes and dedupes values, dropping empty ones
+func cleanList(values []string, normalize func(string) string) []string {
+	cleaned := []string{}
+	seen := map[string]struct{}{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		value = normalize(value)
+		if _, dup := seen[value]; dup {
+			continue
+		}
+		seen[value] = struct{}{}
+		cleaned = append(cleaned, value)
+	}
+	return cleaned
+}
+
+// HandleEvent refreshes the libraries of the enabled media servers matching
+// a completed download. It is meant to be registered with
+// transmission.SyncService.OnEvent.
+func (s *Service) HandleEvent(event transmission.Event) {
+	if event.Type != transmission.EventDownloadCompleted {
+		return
+	}
+
+	records, err := s.app.FindRecordsByFilter("media_servers", "enabled = true", "", 0, 0)
+	if err != nil {
+		log.Printf("[MediaServer] Failed to find media servers: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		if !appliesTo(record, event.Torrent) {
+			continue
+		}
+
+		refresh, err := s.createRefresh(record, event.Torrent.HashString, event.Torrent.Name)
+		if err != nil {
+			log.Printf("[MediaServer] Failed to log refresh of %s: %v", record.GetString("name"), err)
+			continue
+		}
+		s.start(record, refresh)
+	}
+}
+
+// appliesTo reports whether a completed torrent belongs to the libraries of
+// a media server, by its category or by its download directory
+func appliesTo(record *core.Record, torrent transmission.TorrentData) bool {
+	categories := stringSlice(record, "categories")
+	dirs := stringSlice(record, "downloadDirs")
+	if len(categories) == 0 && len(dirs) == 0 {
+		return true
+	}
+
+	if len(torrent.Labels) > 0 {
+		for _, category := range categories {
+			if strings.EqualFold(category, torrent.Labels[0]) {
+				return true
+			}
+		}
+	}
+
+	if torrent.DownloadDir != "" {
+		downloadDir := path.Clean(torrent.DownloadDir)
+		for _, dir := range dirs {
+			if downloadDir == dir || strings.HasPrefix(downloadDir, strings.TrimSuffix(dir, "/")+"/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *Service) createRefresh(server *core.Record, hash, name string) (*core.Record, error) {
+	collection, err := s.app.FindCollectionByNameOrId("media_refreshes")
+	if err != nil {
+		return nil, fmt.Errorf("find media_refreshes collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("server", server.Id)
+	record.Set("torrentHash", hash)
+	record.Set("torrentName", truncate(name, 500))
+	record.Set("status", StatusPending)
+	record.Set("attempts", 0)
+
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *Service) start(server, refresh *core.Record) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.refresh(server, refresh)
+	}()
+}
+
+// refresh sends the refresh requests of a server, retrying with exponential
+// backoff, and logs every attempt on the refresh record
+func (s *Service) refresh(server, refresh *core.Record) {
+	delay := s.baseDelay
+
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		status, err := s.send(server)
+
+		refresh.Set("attempts", attempt)
+		refresh.Set("responseStatus", status)
+		if err == nil {
+			refresh.Set("status", StatusSucceeded)
+			refresh.Set("error", "")
+			refresh.Set("finishedAt", time.Now())
+			s.saveRefresh(refresh)
+			return
+		}
+
+		refresh.Set("error", truncate(err.Error(), maxErrorLength))
+
+		// Client errors such as a wrong token won't go away by retrying
+		retry := status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+		if !retry || attempt == s.maxAttempts {
+			break
+		}
+		s.saveRefresh(refresh)
+
+		select {
+		case <-s.ctx.Done():
+			refresh.Set("error", truncate("refresh cancelled on shutdown: "+err.Error(), maxErrorLength))
+			refresh.Set("status", StatusFailed)
+			refresh.Set("finishedAt", time.Now())
+			s.saveRefresh(refresh)
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	log.Printf("[MediaServer] Refresh of %s failed: %s", server.GetString("name"), refresh.GetString("error"))
+	refresh.Set("status", StatusFailed)
+	refresh.Set("finishedAt", time.Now())
+	s.saveRefresh(refresh)
+}
+
+// send makes a single refresh attempt and returns the response status of the
+// failed request, if any
+func (s *Service) send(server *core.Record) (int, error) {
+	base := server.GetString("url")
+	token := server.GetString("token")
+
+	if server.GetString("type") != TypePlex {
+		return s.request(http.MethodPost, base+"/Library/Refresh", func(req *http.Request) {
+			if token != "" {
+				req.Header.Set("X-Emby-Token", token)
+				req.Header.Set("Authorization", fmt.Sprintf("MediaBrowser Token=%q", token))
+			}
+		})
+	}
+
+	sections := stringSlice(server, "sections")
+	if len(sections) == 0 {
+		sections = []string{"all"}
+	}
+	for _, section := range sections {
+		status, err := s.request(http.MethodGet, base+"/library/sections/"+url.PathEscape(section)+"/refresh", func(req *http.Request) {
+			req.Header.Set("Accept", "application/json")
+			if token != "" {
+				req.Header.Set("X-Plex-Token", token)
+			}
+		})
+		if err != nil {
+			return status, fmt.Errorf("section %s: %w", section, err)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+func (s *Service) request(method, target string, authorize func(*http.Request)) (int, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "Retorrent")
+	authorize(req)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+func (s *Service) saveRefresh(refresh *core.Record) {
+	if err := s.app.Save(refresh); err != nil {
+		log.Printf("[MediaServer] Failed to update refresh %s: %v", refresh.Id, err)
+	}
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
@@ -0,0 +1,218 @@
+package mediaserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/transmission"
+)
+
+// standIn is an httptest media server that records the refresh requests it
+// receives and fails the first failures of them with status.
+type standIn struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	requests []*http.Request
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+	if len(s.requests) <= s.failures {
+		w.WriteHeader(s.status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *standIn) received() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+func newStandIn(t *testing.T, failures, status int) (*standIn, string) {
+	t.Helper()
+
+	handler := &standIn{failures: failures, status: status}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return handler, server.URL
+}
+
+func newTestService(t *testing.T) (*tests.TestApp, *Service) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	service := NewService(testApp, audit.NewService(testApp))
+	service.baseDelay = 10 * time.Millisecond
+	t.Cleanup(service.Stop)
+
+	return testApp, service
+}
+
+func createServer(t *testing.T, service *Service, name, serverType, url string, params Params) Response {
+	t.Helper()
+
+	token := "t0ken"
+	params.Name = &name
+	params.Type = &serverType
+	params.URL = &url
+	params.Token = &token
+
+	server, err := service.Create(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	return server
+}
+
+func completedEvent(downloadDir string, labels ...string) transmission.Event {
+	return transmission.Event{
+		Type: transmission.EventDownloadCompleted,
+		Torrent: transmission.TorrentData{
+			ID:          7,
+			Name:        "Big Buck Bunny",
+			HashString:  "abcdef",
+			DownloadDir: downloadDir,
+			Labels:      labels,
+		},
+		Time: time.Now(),
+	}
+}
+
+func refreshesOf(t *testing.T, service *Service, id string) []RefreshResponse {
+	t.Helper()
+
+	refreshes, err := service.Refreshes(id, 0)
+	if err != nil {
+		t.Fatalf("Refreshes failed: %v", err)
+	}
+	return refreshes
+}
+
+func TestRefreshOnCompletion(t *testing.T) {
+	_, service := newTestService(t)
+
+	jellyfin, jellyfinURL := newStandIn(t, 0, 0)
+	plex, plexURL := newStandIn(t, 0, 0)
+	emby, embyURL := newStandIn(t, 0, 0)
+
+	movies := []string{"movies"}
+	jellyfinServer := createServer(t, service, "Jellyfin", TypeJellyfin, jellyfinURL+"/", Params{Categories: &movies})
+	sections := []string{"1", "4"}
+	dirs := []string{"/media/movies/"}
+	plexServer := createServer(t, service, "Plex", TypePlex, plexURL, Params{Sections: &sections, DownloadDirs: &dirs})
+	tv := []string{"tv"}
+	createServer(t, service, "Emby", TypeEmby, embyURL, Params{Categories: &tv})
+
+	// Only completed downloads trigger refreshes
+	added := completedEvent("/media/movies/new", "movies")
+	added.Type = transmission.EventTorrentAdded
+	service.HandleEvent(added)
+	// Matches Jellyfin by category and Plex by download directory
+	service.HandleEvent(completedEvent("/media/movies/new", "Movies"))
+	// Matches neither: /media/movies-old is not below /media/movies
+	service.HandleEvent(completedEvent("/media/movies-old"))
+	service.wg.Wait()
+
+	requests := jellyfin.received()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 Jellyfin refresh, got %d", len(requests))
+	}
+	if req := requests[0]; req.Method != http.MethodPost || req.URL.Path != "/Library/Refresh" || req.Header.Get("X-Emby-Token") != "t0ken" {
+		t.Errorf("Unexpected Jellyfin request %s %s", req.Method, req.URL.Path)
+	}
+
+	requests = plex.received()
+	if len(requests) != 2 || requests[0].URL.Path != "/library/sections/1/refresh" || requests[1].URL.Path != "/library/sections/4/refresh" {
+		t.Fatalf("Expected both Plex sections to be refreshed, got %d requests", len(requests))
+	}
+	if requests[0].Header.Get("X-Plex-Token") != "t0ken" {
+		t.Errorf("Expected the Plex token to be sent")
+	}
+
+	if len(emby.received()) != 0 {
+		t.Errorf("Expected servers of other categories not to be refreshed")
+	}
+
+	refreshes := refreshesOf(t, service, plexServer.ID)
+	if len(refreshes) != 1 || refreshes[0].Status != StatusSucceeded || refreshes[0].TorrentName != "Big Buck Bunny" || refreshes[0].FinishedAt == "" {
+		t.Errorf("Expected a successful refresh to be logged, got %+v", refreshes)
+	}
+	if refreshes := refreshesOf(t, service, jellyfinServer.ID); len(refreshes) != 1 {
+		t.Errorf("Expected 1 logged Jellyfin refresh, got %d", len(refreshes))
+	}
+}
+
+func TestRefreshRetries(t *testing.T) {
+	_, service := newTestService(t)
+
+	flaky, flakyURL := newStandIn(t, 2, http.StatusServiceUnavailable)
+	unauthorized, unauthorizedURL := newStandIn(t, 10, http.StatusUnauthorized)
+
+	flakyServer := createServer(t, service, "Flaky", TypeEmby, flakyURL, Params{})
+	unauthorizedServer := createServer(t, service, "Unauthorized", TypePlex, unauthorizedURL, Params{})
+
+	service.HandleEvent(completedEvent("/downloads"))
+	service.wg.Wait()
+
+	refreshes := refreshesOf(t, service, flakyServer.ID)
+	if len(flaky.received()) != 3 || len(refreshes) != 1 || refreshes[0].Status != StatusSucceeded || refreshes[0].Attempts != 3 {
+		t.Errorf("Expected the refresh to succeed on the third attempt, got %+v", refreshes)
+	}
+
+	// A rejected token won't be accepted on retry
+	refreshes = refreshesOf(t, service, unauthorizedServer.ID)
+	if len(unauthorized.received()) != 1 || len(refreshes) != 1 || refreshes[0].Status != StatusFailed || refreshes[0].ResponseStatus != http.StatusUnauthorized {
+		t.Errorf("Expected a single failed attempt, got %+v", refreshes)
+	}
+	if unauthorized.received()[0].URL.Path != "/library/sections/all/refresh" {
+		t.Errorf("Expected all Plex sections to be refreshed without a section list")
+	}
+
+	// Admins can refresh by hand to check a server
+	refresh, err := service.Refresh(context.Background(), flakyServer.ID)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	service.wg.Wait()
+	refreshes = refreshesOf(t, service, flakyServer.ID)
+	if len(refreshes) != 2 || refreshes[0].ID != refresh.ID || refreshes[0].Status != StatusSucceeded {
+		t.Errorf("Expected the manual refresh to succeed, got %+v", refreshes)
+	}
+}
+
+func TestServerValidation(t *testing.T) {
+	_, service := newTestService(t)
+
+	cases := map[string]Params{
+		"unknown type": {Name: ptr("Kodi"), Type: ptr("kodi"), URL: ptr("http://kodi:8080")},
+		"invalid url":  {Name: ptr("Plex"), Type: ptr("plex"), URL: ptr("plex:32400")},
+		"relative dir": {Name: ptr("Plex"), Type: ptr("plex"), URL: ptr("http://plex:32400"), DownloadDirs: &[]string{"media/movies"}},
+		"missing name": {Type: ptr("plex"), URL: ptr("http://plex:32400")},
+		"empty name":   {Name: ptr(" "), Type: ptr("plex"), URL: ptr("http://plex:32400")},
+	}
+
+	for name, params := range cases {
+		if _, err := service.Create(context.Background(), params); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
+
+func ptr(value string) *string {
+	return &value
+}
@@ -0,0 +1,155 @@
+package metainfo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxDepth bounds the nesting of lists and dictionaries; v2 file trees nest
+// once per directory level
+const maxDepth = 256
+
+// decoder reads bencoded values. Strings decode to string, integers to
+// int64, lists to []any and dictionaries to map[string]any.
+type decoder struct {
+	data []byte
+	pos  int
+	// infoStart and infoEnd delimit the info dictionary of the top-level
+	// dictionary, whose raw bytes make up the infohash
+	infoStart, infoEnd int
+}
+
+// decode parses data, which must hold exactly one value
+func decode(data []byte) (any, *decoder, error) {
+	d := &decoder{data: data, infoStart: -1}
+	value, err := d.value(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, nil, fmt.Errorf("trailing data at offset %d", d.pos)
+	}
+	return value, d, nil
+}
+
+func (d *decoder) errorf(format string, args ...any) error {
+	return fmt.Errorf("offset %d: %s", d.pos, fmt.Sprintf(format, args...))
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if d.pos >= len(d.data) {
+		return nil, errors.New("unexpected end of data")
+	}
+	if depth > maxDepth {
+		return nil, d.errorf("nested too deeply")
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		return d.integer()
+	case c == 'l':
+		return d.list(depth)
+	case c == 'd':
+		return d.dict(depth)
+	case c >= '0' && c <= '9':
+		return d.string()
+	default:
+		return nil, d.errorf("unexpected byte %q", c)
+	}
+}
+
+func (d *decoder) integer() (int64, error) {
+	end := bytes.IndexByte(d.data[d.pos:], 'e')
+	if end < 0 {
+		return 0, d.errorf("unterminated integer")
+	}
+
+	digits := string(d.data[d.pos+1 : d.pos+end])
+	// Leading zeros and negative zero are not allowed
+	if digits == "" || digits == "-0" || (len(digits) > 1 && digits[0] == '0') || (len(digits) > 2 && digits[:2] == "-0") {
+		return 0, d.errorf("invalid integer %q", digits)
+	}
+	value, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, d.errorf("invalid integer %q", digits)
+	}
+
+	d.pos += end + 1
+	return value, nil
+}
+
+func (d *decoder) string() (string, error) {
+	colon := bytes.IndexByte(d.data[d.pos:], ':')
+	if colon < 0 {
+		return "", d.errorf("unterminated string length")
+	}
+
+	length, err := strconv.Atoi(string(d.data[d.pos : d.pos+colon]))
+	if err != nil || length < 0 {
+		return "", d.errorf("invalid string length")
+	}
+
+	start := d.pos + colon + 1
+	if length > len(d.data)-start {
+		return "", d.errorf("string exceeds data")
+	}
+
+	d.pos = start + length
+	return string(d.data[start:d.pos]), nil
+}
+
+func (d *decoder) list(depth int) ([]any, error) {
+	d.pos++
+
+	values := []any{}
+	for {
+		if d.pos >= len(d.data) {
+			return nil, errors.New("unterminated list")
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			return values, nil
+		}
+
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+}
+
+func (d *decoder) dict(depth int) (map[string]any, error) {
+	d.pos++
+
+	values := map[string]any{}
+	for {
+		if d.pos >= len(d.data) {
+			return nil, errors.New("unterminated dictionary")
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			return values, nil
+		}
+
+		if c := d.data[d.pos]; c < '0' || c > '9' {
+			return nil, d.errorf("dictionary key is not a string")
+		}
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+
+		start := d.pos
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if depth == 0 && key == "info" {
+			d.infoStart, d.infoEnd = start, d.pos
+		}
+		values[key] = value
+	}
+}
@@ -0,0 +1,428 @@
+// Package metainfo reads .torrent files and magnet links so torrents can be
+// inspected before they are added.
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSize is the largest .torrent file accepted.
+const MaxSize = 10 << 20
+
+// File is a file of a torrent. Index is the position Transmission uses for
+// the file in files-unwanted and the priority lists.
+type File struct {
+	Index int    `json:"index"`
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+}
+
+// Node is an entry of the file tree of a torrent.
+type Node struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// Index is set on files
+	Index    *int    `json:"index,omitempty"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+// MetaInfo describes a torrent.
+type MetaInfo struct {
+	Name string `json:"name"`
+	// InfoHash is the lowercase hex v1 infohash, unless the torrent is v2 only
+	InfoHash string `json:"infoHash,omitempty"`
+	// InfoHashV2 is the lowercase hex v2 infohash of v2 and hybrid torrents
+	InfoHashV2  string   `json:"infoHashV2,omitempty"`
+	Size        int64    `json:"size"`
+	PieceLength int64    `json:"pieceLength,omitempty"`
+	Pieces      int      `json:"pieces,omitempty"`
+	Private     bool     `json:"private"`
+	Trackers    []string `json:"trackers"`
+	// Files lists the files in index order; Path includes the directories
+	// below the torrent's own directory
+	Files     []File     `json:"files"`
+	Tree      *Node      `json:"tree,omitempty"`
+	Comment   string     `json:"comment,omitempty"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	// Magnet is set for magnet links, whose files are only known once the
+	// metadata has been fetched from peers
+	Magnet bool `json:"magnet"`
+}
+
+// Read parses what AddTorrent accepts: a magnet link or a base64 encoded
+// .torrent file.
+func Read(source string) (*MetaInfo, error) {
+	source = strings.TrimSpace(source)
+	if strings.HasPrefix(source, "magnet:") {
+		return ParseMagnet(source)
+	}
+
+	if base64.StdEncoding.DecodedLen(len(source)) > MaxSize {
+		return nil, fmt.Errorf("torrent file exceeds %d bytes", MaxSize)
+	}
+	data, err := base64.StdEncoding.DecodeString(source)
+	if err != nil {
+		return nil, errors.New("torrent is neither a magnet link nor a base64 encoded torrent file")
+	}
+	return Parse(data)
+}
+
+// Encode checks that data is a .torrent file and returns it base64 encoded,
+// as AddTorrent accepts it.
+func Encode(data []byte) (string, error) {
+	if _, err := Parse(data); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Parse reads a .torrent file.
+func Parse(data []byte) (*MetaInfo, error) {
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("torrent file exceeds %d bytes", MaxSize)
+	}
+
+	value, d, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent file: %w", err)
+	}
+	root, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid torrent file: not a dictionary")
+	}
+	info, ok := root["info"].(map[string]any)
+	if !ok || d.infoStart < 0 {
+		return nil, errors.New("invalid torrent file: missing info dictionary")
+	}
+	rawInfo := data[d.infoStart:d.infoEnd]
+
+	meta := &MetaInfo{
+		Name:      utf8String(info, "name"),
+		Private:   integer(info, "private") == 1,
+		Trackers:  trackers(root),
+		Files:     []File{},
+		Comment:   utf8String(root, "comment"),
+		CreatedBy: str(root, "created by"),
+	}
+	if meta.Name == "" {
+		return nil, errors.New("invalid torrent file: missing name")
+	}
+	if created := integer(root, "creation date"); created > 0 {
+		createdAt := time.Unix(created, 0).UTC()
+		meta.CreatedAt = &createdAt
+	}
+
+	meta.PieceLength = integer(info, "piece length")
+	if meta.PieceLength <= 0 {
+		return nil, errors.New("invalid torrent file: missing piece length")
+	}
+
+	pieces, v1 := info["pieces"].(string)
+	v2 := integer(info, "meta version") == 2
+	if !v1 && !v2 {
+		return nil, errors.New("invalid torrent file: missing pieces")
+	}
+
+	if v1 {
+		if len(pieces)%sha1.Size != 0 {
+			return nil, errors.New("invalid torrent file: malformed pieces")
+		}
+		sum := sha1.Sum(rawInfo)
+		meta.InfoHash = hex.EncodeToString(sum[:])
+		meta.Pieces = len(pieces) / sha1.Size
+	}
+	if v2 {
+		sum := sha256.Sum256(rawInfo)
+		meta.InfoHashV2 = hex.EncodeToString(sum[:])
+	}
+
+	// Hybrid torrents list their files both ways; Transmission indexes the
+	// v1 list
+	if v1 {
+		err = meta.readFiles(info)
+	} else {
+		err = meta.readFileTree(info)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent file: %w", err)
+	}
+
+	for _, file := range meta.Files {
+		meta.Size += file.Size
+	}
+	if !v1 {
+		meta.Pieces = int((meta.Size + meta.PieceLength - 1) / meta.PieceLength)
+	}
+	meta.Tree = buildTree(meta.Name, meta.Files)
+
+	return meta, nil
+}
+
+// readFiles reads the v1 file list
+func (m *MetaInfo) readFiles(info map[string]any) error {
+	list, multi := info["files"].([]any)
+	if !multi {
+		length := integer(info, "length")
+		if length < 0 {
+			return errors.New("negative file length")
+		}
+		m.Files = append(m.Files, File{Index: 0, Path: m.Name, Size: length})
+		return nil
+	}
+
+	for _, item := range list {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			return errors.New("malformed file entry")
+		}
+		// Transmission skips BEP 47 padding files, so they take no index
+		if strings.Contains(str(entry, "attr"), "p") {
+			continue
+		}
+
+		parts, ok := entry["path.utf-8"].([]any)
+		if !ok {
+			parts, _ = entry["path"].([]any)
+		}
+		path, err := joinPath(parts)
+		if err != nil {
+			return err
+		}
+
+		length := integer(entry, "length")
+		if length < 0 {
+			return errors.New("negative file length")
+		}
+		m.Files = append(m.Files, File{Index: len(m.Files), Path: path, Size: length})
+	}
+
+	if len(m.Files) == 0 {
+		return errors.New("torrent has no files")
+	}
+	return nil
+}
+
+// readFileTree reads the v2 file tree. Its entries are sorted by name, which
+// gives the file order.
+func (m *MetaInfo) readFileTree(info map[string]any) error {
+	tree, ok := info["file tree"].(map[string]any)
+	if !ok {
+		return errors.New("missing file tree")
+	}
+
+	var walk func(node map[string]any, parents []string) error
+	walk = func(node map[string]any, parents []string) error {
+		names := make([]string, 0, len(node))
+		for name := range node {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			child, ok := node[name].(map[string]any)
+			if !ok || name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+				return fmt.Errorf("invalid file tree entry %q", name)
+			}
+			parts := append(append([]string(nil), parents...), name)
+
+			if file, isFile := child[""].(map[string]any); isFile {
+				length := integer(file, "length")
+				if length < 0 {
+					return errors.New("negative file length")
+				}
+				m.Files = append(m.Files, File{Index: len(m.Files), Path: strings.Join(parts, "/"), Size: length})
+				continue
+			}
+			if err := walk(child, parts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(tree, nil); err != nil {
+		return err
+	}
+	if len(m.Files) == 0 {
+		return errors.New("torrent has no files")
+	}
+	return nil
+}
+
+func joinPath(parts []any) (string, error) {
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		name, ok := part.(string)
+		if !ok || name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return "", fmt.Errorf("invalid file path %v", parts)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", errors.New("empty file path")
+	}
+	return strings.Join(names, "/"), nil
+}
+
+// buildTree nests the files of a torrent below a root named after it
+func buildTree(name string, files []File) *Node {
+	if len(files) == 1 && files[0].Path == name {
+		index := files[0].Index
+		return &Node{Name: name, Size: files[0].Size, Index: &index}
+	}
+
+	root := &Node{Name: name}
+	for _, file := range files {
+		node := root
+		node.Size += file.Size
+
+		parts := strings.Split(file.Path, "/")
+		for i, part := range parts {
+			var child *Node
+			for _, existing := range node.Children {
+				if existing.Name == part && existing.Index == nil {
+					child = existing
+					break
+				}
+			}
+			if child == nil || i == len(parts)-1 {
+				child = &Node{Name: part}
+				node.Children = append(node.Children, child)
+			}
+			child.Size += file.Size
+			if i == len(parts)-1 {
+				index := file.Index
+				child.Index = &index
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// trackers lists the announce URLs of a torrent, tier by tier
+func trackers(root map[string]any) []string {
+	urls := []string{}
+	seen := map[string]struct{}{}
+	add := func(value any) {
+		tracker, ok := value.(string)
+		if !ok || strings.TrimSpace(tracker) == "" {
+			return
+		}
+		tracker = strings.TrimSpace(tracker)
+		if _, dup := seen[tracker]; dup {
+			return
+		}
+		seen[tracker] = struct{}{}
+		urls = append(urls, tracker)
+	}
+
+	if tiers, ok := root["announce-list"].([]any); ok {
+		for _, tier := range tiers {
+			if list, ok := tier.([]any); ok {
+				for _, tracker := range list {
+					add(tracker)
+				}
+			}
+		}
+	}
+	add(root["announce"])
+
+	return urls
+}
+
+func str(dict map[string]any, key string) string {
+	value, _ := dict[key].(string)
+	return value
+}
+
+// utf8String prefers the .utf-8 variant of a key some clients write
+func utf8String(dict map[string]any, key string) string {
+	if value := str(dict, key+".utf-8"); value != "" {
+		return value
+	}
+	return str(dict, key)
+}
+
+func integer(dict map[string]any, key string) int64 {
+	value, _ := dict[key].(int64)
+	return value
+}
+
+// ParseMagnet reads a magnet link. Only the name, infohashes, trackers and
+// size it names are known.
+func ParseMagnet(uri string) (*MetaInfo, error) {
+	if !strings.HasPrefix(uri, "magnet:?") {
+		return nil, errors.New("invalid magnet link")
+	}
+	params, err := url.ParseQuery(strings.TrimPrefix(uri, "magnet:?"))
+	if err != nil {
+		return nil, errors.New("invalid magnet link")
+	}
+
+	meta := &MetaInfo{
+		Name:     strings.TrimSpace(params.Get("dn")),
+		Trackers: []string{},
+		Files:    []File{},
+		Magnet:   true,
+	}
+
+	for _, xt := range params["xt"] {
+		if value, ok := strings.CutPrefix(xt, "urn:btih:"); ok {
+			if hash, ok := NormalizeInfoHash(value); ok && meta.InfoHash == "" {
+				meta.InfoHash = hash
+			}
+		}
+		if value, ok := strings.CutPrefix(xt, "urn:btmh:"); ok {
+			// A multihash: 0x12 for sha2-256 and 0x20 for its length
+			value = strings.ToLower(value)
+			if len(value) == 68 && strings.HasPrefix(value, "1220") {
+				if _, err := hex.DecodeString(value); err == nil && meta.InfoHashV2 == "" {
+					meta.InfoHashV2 = value[4:]
+				}
+			}
+		}
+	}
+	if meta.InfoHash == "" && meta.InfoHashV2 == "" {
+		return nil, errors.New("magnet link has no BitTorrent infohash")
+	}
+
+	for _, tracker := range params["tr"] {
+		if tracker = strings.TrimSpace(tracker); tracker != "" {
+			meta.Trackers = append(meta.Trackers, tracker)
+		}
+	}
+	if size, err := strconv.ParseInt(params.Get("xl"), 10, 64); err == nil && size > 0 {
+		meta.Size = size
+	}
+
+	return meta, nil
+}
+
+// NormalizeInfoHash returns a v1 infohash as lowercase hex, accepting hex
+// and base32 encodings.
+func NormalizeInfoHash(value string) (string, bool) {
+	switch len(value) {
+	case 40:
+		if _, err := hex.DecodeString(value); err == nil {
+			return strings.ToLower(value), true
+		}
+	case 32:
+		if decoded, err := base32.StdEncoding.DecodeString(strings.ToUpper(value)); err == nil {
+			return hex.EncodeToString(decoded), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,190 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// encode bencodes the values the decoder produces
+func encode(value any) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%d:%s", len(v), v)
+	case int:
+		return fmt.Sprintf("i%de", v)
+	case []any:
+		var b strings.Builder
+		b.WriteString("l")
+		for _, item := range v {
+			b.WriteString(encode(item))
+		}
+		b.WriteString("e")
+		return b.String()
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var b strings.Builder
+		b.WriteString("d")
+		for _, key := range keys {
+			b.WriteString(encode(key) + encode(v[key]))
+		}
+		b.WriteString("e")
+		return b.String()
+	}
+	panic(fmt.Sprintf("cannot encode %T", value))
+}
+
+func TestParseMultiFileTorrent(t *testing.T) {
+	info := map[string]any{
+		"name":         "Album",
+		"piece length": 16384,
+		"pieces":       strings.Repeat("x", 40),
+		"private":      1,
+		"files": []any{
+			map[string]any{"length": 100, "path": []any{"CD1", "01.flac"}},
+			map[string]any{"length": 50, "path": []any{".pad", "50"}, "attr": "p"},
+			map[string]any{"length": 200, "path": []any{"CD1", "02.flac"}},
+			map[string]any{"length": 10, "path": []any{"cover.jpg"}},
+		},
+	}
+	data := encode(map[string]any{
+		"announce":      "https://b.example/announce",
+		"announce-list": []any{[]any{"https://a.example/announce"}, []any{"https://b.example/announce"}},
+		"creation date": 1700000000,
+		"info":          info,
+	})
+
+	meta, err := Read(base64.StdEncoding.EncodeToString([]byte(data)))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	sum := sha1.Sum([]byte(encode(info)))
+	if meta.InfoHash != hex.EncodeToString(sum[:]) || meta.InfoHashV2 != "" {
+		t.Errorf("Expected the sha1 of the info dictionary, got %s", meta.InfoHash)
+	}
+	if meta.Name != "Album" || meta.Size != 310 || meta.PieceLength != 16384 || meta.Pieces != 2 || !meta.Private {
+		t.Errorf("Unexpected torrent %+v", meta)
+	}
+	if strings.Join(meta.Trackers, ",") != "https://a.example/announce,https://b.example/announce" {
+		t.Errorf("Expected deduplicated trackers in tier order, got %v", meta.Trackers)
+	}
+	if meta.CreatedAt == nil || meta.CreatedAt.Unix() != 1700000000 {
+		t.Errorf("Unexpected creation date %v", meta.CreatedAt)
+	}
+
+	// Padding files take no index
+	expected := []File{{0, "CD1/01.flac", 100}, {1, "CD1/02.flac", 200}, {2, "cover.jpg", 10}}
+	if fmt.Sprint(meta.Files) != fmt.Sprint(expected) {
+		t.Errorf("Expected files %v, got %v", expected, meta.Files)
+	}
+
+	if len(meta.Tree.Children) != 2 || meta.Tree.Children[0].Name != "CD1" || meta.Tree.Children[0].Size != 300 || len(meta.Tree.Children[0].Children) != 2 {
+		t.Errorf("Unexpected file tree %+v", meta.Tree)
+	}
+	if cover := meta.Tree.Children[1]; cover.Index == nil || *cover.Index != 2 {
+		t.Errorf("Expected the cover to be file 2, got %+v", cover)
+	}
+}
+
+func TestParseV2Torrent(t *testing.T) {
+	file := func(length int) map[string]any {
+		return map[string]any{"": map[string]any{"length": length, "pieces root": strings.Repeat("r", 32)}}
+	}
+	info := map[string]any{
+		"name":         "Show",
+		"piece length": 16384,
+		"meta version": 2,
+		"file tree": map[string]any{
+			"b.mkv": file(20000),
+			"Extras": map[string]any{
+				"a.mkv": file(100),
+			},
+		},
+	}
+
+	meta, err := Parse([]byte(encode(map[string]any{"info": info})))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(encode(info)))
+	if meta.InfoHashV2 != hex.EncodeToString(sum[:]) || meta.InfoHash != "" {
+		t.Errorf("Expected only the v2 infohash, got %q and %q", meta.InfoHash, meta.InfoHashV2)
+	}
+	expected := []File{{0, "Extras/a.mkv", 100}, {1, "b.mkv", 20000}}
+	if fmt.Sprint(meta.Files) != fmt.Sprint(expected) || meta.Size != 20100 || meta.Pieces != 2 {
+		t.Errorf("Expected files %v in tree order, got %v (%d bytes, %d pieces)", expected, meta.Files, meta.Size, meta.Pieces)
+	}
+
+	// Hybrid torrents hash both ways
+	info["pieces"] = strings.Repeat("x", 20)
+	info["length"] = 20100
+	hybrid, err := Parse([]byte(encode(map[string]any{"info": info})))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if hybrid.InfoHash == "" || hybrid.InfoHashV2 == "" {
+		t.Errorf("Expected both infohashes, got %q and %q", hybrid.InfoHash, hybrid.InfoHashV2)
+	}
+}
+
+func TestParseRejectsMalformedTorrents(t *testing.T) {
+	valid := map[string]any{"name": "a", "piece length": 1, "pieces": strings.Repeat("x", 20), "length": 1}
+	cases := map[string]string{
+		"not bencode":     "hello",
+		"trailing data":   encode(map[string]any{"info": valid}) + "x",
+		"leading zero":    "d4:infod6:lengthi01eee",
+		"not a dict":      encode([]any{"info"}),
+		"missing info":    encode(map[string]any{"announce": "x"}),
+		"short string":    "d4:info99:abce",
+		"deep nesting":    strings.Repeat("l", 1000) + strings.Repeat("e", 1000),
+		"path traversal":  encode(map[string]any{"info": map[string]any{"name": "a", "piece length": 1, "pieces": strings.Repeat("x", 20), "files": []any{map[string]any{"length": 1, "path": []any{"..", "etc"}}}}}),
+		"malformed piece": encode(map[string]any{"info": map[string]any{"name": "a", "piece length": 1, "pieces": "xyz", "length": 1}}),
+	}
+
+	for name, data := range cases {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEncodeChecksTheFile(t *testing.T) {
+	data := encode(map[string]any{"info": map[string]any{"name": "a", "piece length": 1, "pieces": strings.Repeat("x", 20), "length": 1}})
+
+	source, err := Encode([]byte(data))
+	if err != nil || source != base64.StdEncoding.EncodeToString([]byte(data)) {
+		t.Errorf("Expected the file base64 encoded, got %q (%v)", source, err)
+	}
+	if _, err := Encode([]byte("<html>Not found</html>")); err == nil {
+		t.Errorf("Expected other content to be rejected")
+	}
+}
+
+func TestParseMagnet(t *testing.T) {
+	meta, err := ParseMagnet("magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH&xt=urn:btmh:1220" + strings.Repeat("AB", 32) + "&dn=Some+Name&tr=udp%3A%2F%2Ft.example%3A80&xl=42")
+	if err != nil {
+		t.Fatalf("ParseMagnet failed: %v", err)
+	}
+	if meta.InfoHash != "0123456789abcdef0123456789abcdef01234567" || meta.InfoHashV2 != strings.Repeat("ab", 32) {
+		t.Errorf("Expected normalized infohashes, got %q and %q", meta.InfoHash, meta.InfoHashV2)
+	}
+	if meta.Name != "Some Name" || meta.Size != 42 || !meta.Magnet || len(meta.Trackers) != 1 || meta.Trackers[0] != "udp://t.example:80" {
+		t.Errorf("Unexpected magnet %+v", meta)
+	}
+
+	if _, err := ParseMagnet("magnet:?dn=nothing"); err == nil {
+		t.Errorf("Expected magnets without an infohash to be rejected")
+	}
+}
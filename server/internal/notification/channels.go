@@ -0,0 +1,601 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+	"backend/internal/transmission"
+)
+
+const (
+	channelTimeout      = 15 * time.Second
+	maxChannelError     = 1000
+	defaultTitleSource  = `{{.Summary}}`
+	defaultBodySource   = `{{.Torrent.Name}}{{if .Torrent.Error}}: {{.Torrent.Error}}{{end}}`
+	maxRenderedTitleLen = 250
+	maxRenderedBodyLen  = 2000
+)
+
+// DeliveryError indicates that a channel could not deliver a test message.
+type DeliveryError struct {
+	Message string
+}
+
+func (e DeliveryError) Error() string {
+	return e.Message
+}
+
+// ChannelResponse represents a notification channel as exposed by the API.
+// Secret config values such as tokens are never returned; their keys are
+// listed in ConfiguredSecrets instead.
+type ChannelResponse struct {
+	ID                string         `json:"id"`
+	Name              string         `json:"name"`
+	Provider          string         `json:"provider"`
+	Config            map[string]any `json:"config"`
+	ConfiguredSecrets []string       `json:"configuredSecrets"`
+	Events            []string       `json:"events"`
+	TitleTemplate     string         `json:"titleTemplate"`
+	BodyTemplate      string         `json:"bodyTemplate"`
+	Enabled           bool           `json:"enabled"`
+	LastSentAt        string         `json:"lastSentAt,omitempty"`
+	LastError         string         `json:"lastError,omitempty"`
+	Created           string         `json:"created"`
+	Updated           string         `json:"updated"`
+}
+
+// ChannelParams holds the fields of a channel to create or update. Nil fields
+// are left untouched on update. Config keys missing on update keep their
+// stored value, so secrets don't have to be sent again.
+type ChannelParams struct {
+	Name          *string         `json:"name"`
+	Provider      *string         `json:"provider"`
+	Config        *map[string]any `json:"config"`
+	Events        *[]string       `json:"events"`
+	TitleTemplate *string         `json:"titleTemplate"`
+	BodyTemplate  *string         `json:"bodyTemplate"`
+	Enabled       *bool           `json:"enabled"`
+}
+
+// TemplateData is available to channel title and body templates.
+type TemplateData struct {
+	// Event is added, completed, error or removed
+	Event string
+	// Summary is a short description of the event, e.g. "Download completed"
+	Summary string
+	Torrent TemplateTorrent
+	// Owner is the name or email of the torrent's owner
+	Owner   string
+	AppName string
+	AppURL  string
+	Time    time.Time
+}
+
+// TemplateTorrent describes the torrent of an event to templates.
+type TemplateTorrent struct {
+	Name        string
+	Hash        string
+	DownloadDir string
+	Labels      []string
+	Error       string
+	// Size is the size when done in bytes; use {{bytes .Torrent.Size}} to format it
+	Size int64
+}
+
+var eventSummaries = map[transmission.EventType]string{
+	transmission.EventTorrentAdded:      "Torrent added",
+	transmission.EventDownloadCompleted: "Download completed",
+	transmission.EventTorrentError:      "Download failed",
+	transmission.EventTorrentRemoved:    "Torrent removed",
+}
+
+var templateFuncs = template.FuncMap{
+	"bytes": formatBytes,
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// ChannelService manages notification channels and forwards torrent
+// lifecycle events to them.
+type ChannelService struct {
+	app    core.App
+	audit  *audit.Service
+	client *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewChannelService constructs a ChannelService instance.
+func NewChannelService(app core.App, auditService *audit.Service) *ChannelService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ChannelService{
+		app:    app,
+		audit:  auditService,
+		client: &http.Client{Timeout: channelTimeout},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Stop cancels running deliveries and waits for them to finish.
+func (s *ChannelService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+// channelConfig decodes the stored config of a channel record
+func channelConfig(record *core.Record) map[string]any {
+	config := map[string]any{}
+	if raw, err := json.Marshal(record.Get("config")); err == nil {
+		_ = json.Unmarshal(raw, &config)
+	}
+	return config
+}
+
+func mapChannelRecord(record *core.Record) ChannelResponse {
+	config := channelConfig(record)
+
+	configuredSecrets := []string{}
+	for _, key := range providers[record.GetString("provider")].secrets {
+		if value, ok := config[key]; ok {
+			if value != "" && value != nil {
+				configuredSecrets = append(configuredSecrets, key)
+			}
+			delete(config, key)
+		}
+	}
+
+	return ChannelResponse{
+		ID:                record.Id,
+		Name:              record.GetString("name"),
+		Provider:          record.GetString("provider"),
+		Config:            config,
+		ConfiguredSecrets: configuredSecrets,
+		Events:            record.GetStringSlice("events"),
+		TitleTemplate:     record.GetString("titleTemplate"),
+		BodyTemplate:      record.GetString("bodyTemplate"),
+		Enabled:           record.GetBool("enabled"),
+		LastSentAt:        formatDate(record, "lastSentAt"),
+		LastError:         record.GetString("lastError"),
+		Created:           formatDate(record, "created"),
+		Updated:           formatDate(record, "updated"),
+	}
+}
+
+// List returns all notification channels.
+func (s *ChannelService) List() ([]ChannelResponse, error) {
+	records, err := s.app.FindRecordsByFilter("notification_channels", "", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find notification channels: %w", err)
+	}
+
+	channels := make([]ChannelResponse, 0, len(records))
+	for _, record := range records {
+		channels = append(channels, mapChannelRecord(record))
+	}
+	return channels, nil
+}
+
+// Create adds a notification channel. Channels are enabled unless stated
+// otherwise.
+func (s *ChannelService) Create(ctx context.Context, params ChannelParams) (ChannelResponse, error) {
+	collection, err := s.app.FindCollectionByNameOrId("notification_channels")
+	if err != nil {
+		return ChannelResponse{}, fmt.Errorf("find notification_channels collection: %w", err)
+	}
+
+	if params.Name == nil || params.Provider == nil || params.Events == nil {
+		return ChannelResponse{}, ValidationError{Message: "name, provider and events are required"}
+	}
+	if params.Enabled == nil {
+		enabled := true
+		params.Enabled = &enabled
+	}
+
+	record := core.NewRecord(collection)
+	if err := s.applyChannelParams(record, params); err != nil {
+		return ChannelResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return ChannelResponse{}, fmt.Errorf("save notification channel: %w", err)
+	}
+
+	response := mapChannelRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionChannelCreate,
+		Targets: []string{record.Id},
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Update changes a notification channel.
+func (s *ChannelService) Update(ctx context.Context, id string, params ChannelParams) (ChannelResponse, error) {
+	record, err := s.findChannel(id)
+	if err != nil {
+		return ChannelResponse{}, err
+	}
+
+	before := mapChannelRecord(record)
+	if err := s.applyChannelParams(record, params); err != nil {
+		return ChannelResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return ChannelResponse{}, fmt.Errorf("save notification channel: %w", err)
+	}
+
+	response := mapChannelRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionChannelUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Delete removes a notification channel.
+func (s *ChannelService) Delete(ctx context.Context, id string) error {
+	record, err := s.findChannel(id)
+	if err != nil {
+		return err
+	}
+
+	before := mapChannelRecord(record)
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete notification channel: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionChannelDelete,
+		Targets: []string{id},
+		Before:  before,
+	})
+
+	return nil
+}
+
+func (s *ChannelService) findChannel(id string) (*core.Record, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ValidationError{Message: "channel id is required"}
+	}
+
+	record, err := s.app.FindRecordById("notification_channels", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: "notification channel not found"}
+		}
+		return nil, fmt.Errorf("find notification channel: %w", err)
+	}
+	return record, nil
+}
+
+// applyChannelParams validates params and sets them on record
+func (s *ChannelService) applyChannelParams(record *core.Record, params ChannelParams) error {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" {
+			return ValidationError{Message: "name cannot be empty"}
+		}
+		record.Set("name", name)
+	}
+
+	config := channelConfig(record)
+	if params.Provider != nil {
+		providerName := strings.ToLower(strings.TrimSpace(*params.Provider))
+		if _, ok := providers[providerName]; !ok {
+			return ValidationError{Message: fmt.Sprintf("invalid provider, must be one of %s", strings.Join(Providers(), ", "))}
+		}
+		// Settings of another provider don't carry over
+		if providerName != record.GetString("provider") {
+			config = map[string]any{}
+		}
+		record.Set("provider", providerName)
+	}
+
+	if params.Config != nil {
+		for key, value := range *params.Config {
+			if value == nil {
+				delete(config, key)
+				continue
+			}
+			config[key] = value
+		}
+	}
+
+	rawConfig, err := json.Marshal(config)
+	if err != nil {
+		return ValidationError{Message: "invalid channel config"}
+	}
+	if _, err := NewNotifier(record.GetString("provider"), rawConfig, s.client); err != nil {
+		return err
+	}
+	record.Set("config", config)
+
+	if params.Events != nil {
+		events, err := normalizeEvents(*params.Events)
+		if err != nil {
+			return err
+		}
+		record.Set("events", events)
+	}
+
+	if params.TitleTemplate != nil {
+		if err := validateTemplate(*params.TitleTemplate); err != nil {
+			return ValidationError{Message: "invalid title template: " + err.Error()}
+		}
+		record.Set("titleTemplate", *params.TitleTemplate)
+	}
+
+	if params.BodyTemplate != nil {
+		if err := validateTemplate(*params.BodyTemplate); err != nil {
+			return ValidationError{Message: "invalid body template: " + err.Error()}
+		}
+		record.Set("bodyTemplate", *params.BodyTemplate)
+	}
+
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	return nil
+}
+
+func normalizeEvents(values []string) ([]string, error) {
+	allowed := make(map[string]struct{}, len(transmission.EventTypes))
+	for _, eventType := range transmission.EventTypes {
+		allowed[string(eventType)] = struct{}{}
+	}
+
+	events := make([]string, 0, len(values))
+	seen := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		cleaned := strings.ToLower(strings.TrimSpace(value))
+		if _, ok := allowed[cleaned]; !ok {
+			return nil, ValidationError{Message: fmt.Sprintf("invalid event: %s", value)}
+		}
+		if _, dup := seen[cleaned]; dup {
+			continue
+		}
+		seen[cleaned] = struct{}{}
+		events = append(events, cleaned)
+	}
+
+	if len(events) == 0 {
+		return nil, ValidationError{Message: "at least one event is required"}
+	}
+	return events, nil
+}
+
+// validateTemplate parses a template source and renders it with sample data,
+// so unknown fields are caught when the channel is saved
+func validateTemplate(source string) error {
+	if strings.TrimSpace(source) == "" {
+		return nil
+	}
+
+	tmpl, err := template.New("channel").Funcs(templateFuncs).Parse(source)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(&bytes.Buffer{}, sampleTemplateData("Retorrent", ""))
+}
+
+func render(source, fallback string, data TemplateData, limit int) (string, error) {
+	if strings.TrimSpace(source) == "" {
+		source = fallback
+	}
+
+	tmpl, err := template.New("channel").Funcs(templateFuncs).Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+
+	return truncate(strings.TrimSpace(out.String()), limit), nil
+}
+
+// renderMessage formats the message a channel sends for data
+func renderMessage(record *core.Record, data TemplateData) (Message, error) {
+	title, err := render(record.GetString("titleTemplate"), defaultTitleSource, data, maxRenderedTitleLen)
+	if err != nil {
+		return Message{}, fmt.Errorf("render title: %w", err)
+	}
+	body, err := render(record.GetString("bodyTemplate"), defaultBodySource, data, maxRenderedBodyLen)
+	if err != nil {
+		return Message{}, fmt.Errorf("render body: %w", err)
+	}
+
+	return Message{
+		Event: transmission.EventType(data.Event),
+		Title: title,
+		Body:  body,
+		URL:   data.AppURL,
+	}, nil
+}
+
+func sampleTemplateData(appName, appURL string) TemplateData {
+	return TemplateData{
+		Event:   string(transmission.EventDownloadCompleted),
+		Summary: eventSummaries[transmission.EventDownloadCompleted],
+		Torrent: TemplateTorrent{
+			Name:        "Test notification from " + appName,
+			Hash:        "0000000000000000000000000000000000000000",
+			DownloadDir: "/downloads",
+			Size:        1 << 30,
+		},
+		Owner:   "Retorrent",
+		AppName: appName,
+		AppURL:  appURL,
+		Time:    time.Now(),
+	}
+}
+
+func (s *ChannelService) templateData(event transmission.Event) TemplateData {
+	meta := s.app.Settings().Meta
+
+	var owner string
+	if event.UserID != "" {
+		if user, err := s.app.FindRecordById("users", event.UserID); err == nil {
+			owner = displayName(user)
+		}
+	}
+
+	return TemplateData{
+		Event:   string(event.Type),
+		Summary: eventSummaries[event.Type],
+		Torrent: TemplateTorrent{
+			Name:        event.Torrent.Name,
+			Hash:        event.Torrent.HashString,
+			DownloadDir: event.Torrent.DownloadDir,
+			Labels:      event.Torrent.Labels,
+			Error:       event.Torrent.ErrorString,
+			Size:        event.Torrent.SizeWhenDone,
+		},
+		Owner:   owner,
+		AppName: meta.AppName,
+		AppURL:  strings.TrimRight(meta.AppURL, "/") + "/",
+		Time:    event.Time,
+	}
+}
+
+// send renders and delivers a message through a channel and records the
+// outcome on the channel
+func (s *ChannelService) send(ctx context.Context, record *core.Record, data TemplateData) error {
+	err := func() error {
+		message, err := renderMessage(record, data)
+		if err != nil {
+			return err
+		}
+
+		rawConfig, err := json.Marshal(channelConfig(record))
+		if err != nil {
+			return err
+		}
+		notifier, err := NewNotifier(record.GetString("provider"), rawConfig, s.client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, channelTimeout)
+		defer cancel()
+		return notifier.Send(ctx, message)
+	}()
+
+	if err != nil {
+		record.Set("lastError", truncate(err.Error(), maxChannelError))
+	} else {
+		record.Set("lastSentAt", time.Now())
+		record.Set("lastError", "")
+	}
+	if saveErr := s.app.Save(record); saveErr != nil {
+		log.Printf("[Notification] Failed to record delivery status of channel %s: %v", record.Id, saveErr)
+	}
+
+	return err
+}
+
+// truncate cuts value to at most limit bytes without splitting a character
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
+
+// Test sends a sample message through a channel.
+func (s *ChannelService) Test(ctx context.Context, id string) error {
+	record, err := s.findChannel(id)
+	if err != nil {
+		return err
+	}
+
+	meta := s.app.Settings().Meta
+	data := sampleTemplateData(meta.AppName, strings.TrimRight(meta.AppURL, "/")+"/")
+
+	if err := s.send(ctx, record, data); err != nil {
+		return DeliveryError{Message: err.Error()}
+	}
+	return nil
+}
+
+func subscribed(record *core.Record, eventType transmission.EventType) bool {
+	for _, value := range record.GetStringSlice("events") {
+		if value == string(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleEvent forwards a lifecycle event to every enabled channel subscribed
+// to it. It is meant to be registered with transmission.SyncService.OnEvent.
+func (s *ChannelService) HandleEvent(event transmission.Event) {
+	records, err := s.app.FindRecordsByFilter("notification_channels", "enabled = true", "", 0, 0)
+	if err != nil {
+		log.Printf("[Notification] Failed to find notification channels: %v", err)
+		return
+	}
+
+	var data *TemplateData
+	for _, record := range records {
+		if !subscribed(record, event.Type) {
+			continue
+		}
+		if data == nil {
+			built := s.templateData(event)
+			data = &built
+		}
+
+		s.wg.Add(1)
+		go func(record *core.Record, data TemplateData) {
+			defer s.wg.Done()
+			if err := s.send(s.ctx, record, data); err != nil {
+				log.Printf("[Notification] Failed to notify channel %s: %v", record.GetString("name"), err)
+			}
+		}(record, *data)
+	}
+}
@@ -0,0 +1,267 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"backend/internal/audit"
+	"backend/internal/transmission"
+)
+
+// providerRequest is a request received by the provider stand-in
+type providerRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+// providerServer stands in for ntfy, Gotify, Telegram, Discord and Matrix by
+// recording every request
+type providerServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []providerRequest
+}
+
+func newProviderServer(t *testing.T) *providerServer {
+	t.Helper()
+
+	server := &providerServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		server.mu.Lock()
+		server.requests = append(server.requests, providerRequest{Method: r.Method, Path: r.URL.EscapedPath(), Header: r.Header, Body: string(body)})
+		server.mu.Unlock()
+
+		if strings.Contains(r.URL.Path, "broken") {
+			http.Error(w, "unknown topic", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *providerServer) take() []providerRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+func newChannelService(t *testing.T) (*ChannelService, *providerServer) {
+	t.Helper()
+
+	testApp, _, _ := newTestService(t)
+	service := NewChannelService(testApp, audit.NewService(testApp))
+	t.Cleanup(service.Stop)
+
+	return service, newProviderServer(t)
+}
+
+func createChannel(t *testing.T, service *ChannelService, provider string, config map[string]any, events []string) ChannelResponse {
+	t.Helper()
+
+	name := "Team " + provider
+	channel, err := service.Create(context.Background(), ChannelParams{Name: &name, Provider: &provider, Config: &config, Events: &events})
+	if err != nil {
+		t.Fatalf("Create %s channel failed: %v", provider, err)
+	}
+	return channel
+}
+
+func TestProvidersSendTestMessages(t *testing.T) {
+	service, server := newChannelService(t)
+
+	cases := []struct {
+		provider string
+		config   map[string]any
+		check    func(t *testing.T, req providerRequest)
+	}{
+		{
+			provider: "ntfy",
+			config:   map[string]any{"server": server.URL, "topic": "downloads", "token": "tk_secret", "priority": "high"},
+			check: func(t *testing.T, req providerRequest) {
+				if req.Path != "/downloads" || req.Header.Get("Authorization") != "Bearer tk_secret" || req.Header.Get("Priority") != "high" {
+					t.Errorf("Unexpected ntfy request: %+v", req)
+				}
+				if req.Header.Get("Title") != "Download completed" || !strings.Contains(req.Body, "Test notification") {
+					t.Errorf("Unexpected ntfy message: title %q body %q", req.Header.Get("Title"), req.Body)
+				}
+			},
+		},
+		{
+			provider: "gotify",
+			config:   map[string]any{"server": server.URL, "token": "app-token"},
+			check: func(t *testing.T, req providerRequest) {
+				var payload struct {
+					Title    string `json:"title"`
+					Message  string `json:"message"`
+					Priority int    `json:"priority"`
+				}
+				json.Unmarshal([]byte(req.Body), &payload)
+				if req.Path != "/message" || req.Header.Get("X-Gotify-Key") != "app-token" || payload.Title != "Download completed" || payload.Priority != 5 {
+					t.Errorf("Unexpected gotify request: %+v", req)
+				}
+			},
+		},
+		{
+			provider: "telegram",
+			config:   map[string]any{"apiUrl": server.URL, "botToken": "123:abc", "chatId": -100200300},
+			check: func(t *testing.T, req providerRequest) {
+				var payload struct {
+					ChatID string `json:"chat_id"`
+					Text   string `json:"text"`
+				}
+				json.Unmarshal([]byte(req.Body), &payload)
+				if req.Path != "/bot123:abc/sendMessage" || payload.ChatID != "-100200300" || !strings.HasPrefix(payload.Text, "Download completed\n") {
+					t.Errorf("Unexpected telegram request: %+v", req)
+				}
+			},
+		},
+		{
+			provider: "discord",
+			config:   map[string]any{"webhookUrl": server.URL + "/api/webhooks/1/token", "username": "Retorrent"},
+			check: func(t *testing.T, req providerRequest) {
+				var payload struct {
+					Username string `json:"username"`
+					Embeds   []struct {
+						Title string `json:"title"`
+						Color int    `json:"color"`
+					} `json:"embeds"`
+				}
+				json.Unmarshal([]byte(req.Body), &payload)
+				if req.Path != "/api/webhooks/1/token" || payload.Username != "Retorrent" || len(payload.Embeds) != 1 || payload.Embeds[0].Title != "Download completed" || payload.Embeds[0].Color == 0 {
+					t.Errorf("Unexpected discord request: %+v", req)
+				}
+			},
+		},
+		{
+			provider: "matrix",
+			config:   map[string]any{"homeserver": server.URL, "accessToken": "syt_secret", "roomId": "!room:example.org"},
+			check: func(t *testing.T, req providerRequest) {
+				var payload map[string]string
+				json.Unmarshal([]byte(req.Body), &payload)
+				if req.Method != http.MethodPut || !strings.HasPrefix(req.Path, "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/") {
+					t.Errorf("Unexpected matrix request: %s %s", req.Method, req.Path)
+				}
+				if req.Header.Get("Authorization") != "Bearer syt_secret" || payload["msgtype"] != "m.notice" || !strings.HasPrefix(payload["body"], "Download completed\n") {
+					t.Errorf("Unexpected matrix message: %+v", req)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.provider, func(t *testing.T) {
+			channel := createChannel(t, service, tc.provider, tc.config, []string{"completed"})
+
+			if err := service.Test(context.Background(), channel.ID); err != nil {
+				t.Fatalf("Test failed: %v", err)
+			}
+
+			requests := server.take()
+			if len(requests) != 1 {
+				t.Fatalf("Expected 1 request, got %d", len(requests))
+			}
+			tc.check(t, requests[0])
+		})
+	}
+}
+
+func TestChannelEventFilteringAndTemplates(t *testing.T) {
+	service, server := newChannelService(t)
+	owner := createUser(t, service.app, "owner@example.com", "user", nil)
+
+	completed := createChannel(t, service, "ntfy", map[string]any{"server": server.URL, "topic": "completed"}, []string{"completed"})
+	title := "{{.Owner}} finished {{.Torrent.Name}}"
+	body := "{{bytes .Torrent.Size}} in {{.Torrent.DownloadDir}}"
+	if _, err := service.Update(context.Background(), completed.ID, ChannelParams{TitleTemplate: &title, BodyTemplate: &body}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	disabled := createChannel(t, service, "ntfy", map[string]any{"server": server.URL, "topic": "disabled"}, []string{"completed", "error"})
+	enabled := false
+	if _, err := service.Update(context.Background(), disabled.ID, ChannelParams{Enabled: &enabled}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	service.HandleEvent(torrentEvent(transmission.EventTorrentError, owner.Id))
+	service.wg.Wait()
+	if requests := server.take(); len(requests) != 0 {
+		t.Fatalf("Expected no requests for unsubscribed or disabled channels, got %d", len(requests))
+	}
+
+	event := torrentEvent(transmission.EventDownloadCompleted, owner.Id)
+	event.Torrent.SizeWhenDone = 3 << 20
+	service.HandleEvent(event)
+	service.wg.Wait()
+
+	requests := server.take()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(requests))
+	}
+	if got := requests[0].Header.Get("Title"); got != "owner finished Debian 12" {
+		t.Errorf("Unexpected rendered title %q", got)
+	}
+	if requests[0].Body != "3.0 MiB in /downloads" {
+		t.Errorf("Unexpected rendered body %q", requests[0].Body)
+	}
+
+	invalid := "{{.Torrent.Nope}}"
+	if _, err := service.Update(context.Background(), completed.ID, ChannelParams{BodyTemplate: &invalid}); err == nil {
+		t.Errorf("Expected templates with unknown fields to be rejected")
+	}
+}
+
+func TestChannelSecretsAndFailures(t *testing.T) {
+	service, server := newChannelService(t)
+
+	channel := createChannel(t, service, "ntfy", map[string]any{"server": server.URL, "topic": "broken", "token": "tk_secret"}, []string{"error"})
+	if _, ok := channel.Config["token"]; ok || len(channel.ConfiguredSecrets) != 1 {
+		t.Errorf("Expected the token to be hidden, got %+v", channel)
+	}
+
+	// Updating other config keys keeps the stored token
+	config := map[string]any{"priority": "low"}
+	if _, err := service.Update(context.Background(), channel.ID, ChannelParams{Config: &config}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	var deliveryErr DeliveryError
+	if err := service.Test(context.Background(), channel.ID); !errors.As(err, &deliveryErr) || !strings.Contains(deliveryErr.Message, "400") {
+		t.Fatalf("Expected a delivery error with the response status, got %v", err)
+	}
+
+	requests := server.take()
+	if len(requests) != 1 || requests[0].Header.Get("Authorization") != "Bearer tk_secret" || requests[0].Header.Get("Priority") != "low" {
+		t.Errorf("Expected the stored token and the new priority to be used, got %+v", requests)
+	}
+
+	channels, err := service.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(channels) != 1 || channels[0].LastError == "" {
+		t.Errorf("Expected the failure to be recorded on the channel, got %+v", channels)
+	}
+
+	provider := "matrix"
+	if _, err := service.Update(context.Background(), channel.ID, ChannelParams{Provider: &provider}); err == nil {
+		t.Errorf("Expected switching providers without a matching config to be rejected")
+	}
+}
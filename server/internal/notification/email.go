@@ -0,0 +1,290 @@
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/mail"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+
+	"backend/internal/transmission"
+)
+
+var eventEmailTemplate = template.Must(template.New("event").Parse(`<p>Hello {{.Name}},</p>
+{{if .Failed}}<p>The download <strong>{{.Torrent}}</strong> failed:</p>
+<p>{{.Error}}</p>{{else}}<p>The download <strong>{{.Torrent}}</strong> has completed.</p>{{end}}
+{{if .DownloadDir}}<p>Location: {{.DownloadDir}}</p>{{end}}
+<p><a href="{{.Link}}">Open {{.AppName}}</a></p>`))
+
+var digestEmailTemplate = template.Must(template.New("digest").Parse(`<p>Hello {{.Name}},</p>
+<p>Here is what happened in {{.AppName}} since the last digest.</p>
+{{if .Completed}}<p><strong>Completed</strong></p>
+<ul>{{range .Completed}}<li>{{.Torrent}}</li>{{end}}</ul>{{end}}
+{{if .Failed}}<p><strong>Failed</strong></p>
+<ul>{{range .Failed}}<li>{{.Torrent}}: {{.Error}}</li>{{end}}</ul>{{end}}
+<p><a href="{{.Link}}">Open {{.AppName}}</a></p>`))
+
+// digestEntry is a torrent listed in a digest email
+type digestEntry struct {
+	Torrent string
+	Error   string
+}
+
+// EmailService emails users about completed and failed downloads, either
+// right away or bundled into a daily digest.
+type EmailService struct {
+	app core.App
+	wg  sync.WaitGroup
+}
+
+// NewEmailService constructs an EmailService instance.
+func NewEmailService(app core.App) *EmailService {
+	return &EmailService{app: app}
+}
+
+// Stop waits for the emails being sent in the background.
+func (s *EmailService) Stop() {
+	s.wg.Wait()
+}
+
+// wantsEmail reports whether the preferences opt in to emails for an event type
+func wantsEmail(prefs Preferences, eventType transmission.EventType) bool {
+	switch eventType {
+	case transmission.EventDownloadCompleted:
+		return prefs.Email.Completed
+	case transmission.EventTorrentError:
+		return prefs.Email.Failed
+	default:
+		return false
+	}
+}
+
+// recipient is a user to notify together with their preferences
+type recipient struct {
+	user  *core.Record
+	prefs Preferences
+}
+
+// recipients returns the owner of the torrent and the admins who opted in to
+// notifications for all torrents, as far as they want emails for the event
+func (s *EmailService) recipients(event transmission.Event) ([]recipient, error) {
+	var candidates []*core.Record
+
+	if event.UserID != "" {
+		owner, err := s.app.FindRecordById("users", event.UserID)
+		if err == nil {
+			candidates = append(candidates, owner)
+		}
+	}
+
+	admins, err := s.app.FindRecordsByFilter("users", "role = 'admin' && id != {:owner}", "", 0, 0, dbx.Params{"owner": event.UserID})
+	if err != nil {
+		return nil, fmt.Errorf("find admins: %w", err)
+	}
+
+	var result []recipient
+	for _, candidate := range candidates {
+		if r, ok := s.recipient(candidate, event.Type, false); ok {
+			result = append(result, r)
+		}
+	}
+	for _, admin := range admins {
+		if r, ok := s.recipient(admin, event.Type, true); ok {
+			result = append(result, r)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *EmailService) recipient(user *core.Record, eventType transmission.EventType, asAdmin bool) (recipient, bool) {
+	if user.GetBool("disabled") || user.Email() == "" {
+		return recipient{}, false
+	}
+
+	prefs, err := PreferencesFromRecord(user)
+	if err != nil {
+		log.Printf("[Notification] Invalid preferences of user %s: %v", user.Id, err)
+		return recipient{}, false
+	}
+
+	if asAdmin && !prefs.Email.AllTorrents {
+		return recipient{}, false
+	}
+
+	return recipient{user: user, prefs: prefs}, wantsEmail(prefs, eventType)
+}
+
+// HandleEvent emails the recipients of completed and failed downloads, or
+// queues the event for their digest. It is meant to be registered with
+// transmission.SyncService.OnEvent.
+func (s *EmailService) HandleEvent(event transmission.Event) {
+	if event.Type != transmission.EventDownloadCompleted && event.Type != transmission.EventTorrentError {
+		return
+	}
+
+	recipients, err := s.recipients(event)
+	if err != nil {
+		log.Printf("[Notification] Failed to find email recipients: %v", err)
+		return
+	}
+
+	for _, r := range recipients {
+		if r.prefs.Email.Mode == EmailModeDigest {
+			if err := s.queueDigestItem(r.user, event); err != nil {
+				log.Printf("[Notification] Failed to queue digest item for %s: %v", r.user.Email(), err)
+			}
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(user *core.Record) {
+			defer s.wg.Done()
+			if err := s.sendEventEmail(user, event); err != nil {
+				log.Printf("[Notification] Failed to email %s: %v", user.Email(), err)
+			}
+		}(r.user)
+	}
+}
+
+func (s *EmailService) queueDigestItem(user *core.Record, event transmission.Event) error {
+	collection, err := s.app.FindCollectionByNameOrId("email_digest_items")
+	if err != nil {
+		return fmt.Errorf("find email_digest_items collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("user", user.Id)
+	record.Set("event", string(event.Type))
+	record.Set("torrentName", event.Torrent.Name)
+	record.Set("torrentHash", event.Torrent.HashString)
+	record.Set("errorString", event.Torrent.ErrorString)
+
+	return s.app.Save(record)
+}
+
+func (s *EmailService) appLink() string {
+	return strings.TrimRight(s.app.Settings().Meta.AppURL, "/") + "/"
+}
+
+func displayName(user *core.Record) string {
+	if name := strings.TrimSpace(user.GetString("name")); name != "" {
+		return name
+	}
+	return user.Email()
+}
+
+func (s *EmailService) sendEventEmail(user *core.Record, event transmission.Event) error {
+	meta := s.app.Settings().Meta
+	failed := event.Type == transmission.EventTorrentError
+
+	var body bytes.Buffer
+	err := eventEmailTemplate.Execute(&body, map[string]any{
+		"Name":        displayName(user),
+		"AppName":     meta.AppName,
+		"Torrent":     event.Torrent.Name,
+		"Failed":      failed,
+		"Error":       event.Torrent.ErrorString,
+		"DownloadDir": event.Torrent.DownloadDir,
+		"Link":        s.appLink(),
+	})
+	if err != nil {
+		return fmt.Errorf("render notification email: %w", err)
+	}
+
+	subject := fmt.Sprintf("Download completed: %s", event.Torrent.Name)
+	if failed {
+		subject = fmt.Sprintf("Download failed: %s", event.Torrent.Name)
+	}
+
+	return s.send(user, subject, body.String())
+}
+
+func (s *EmailService) send(user *core.Record, subject, html string) error {
+	meta := s.app.Settings().Meta
+
+	message := &mailer.Message{
+		From:    mail.Address{Name: meta.SenderName, Address: meta.SenderAddress},
+		To:      []mail.Address{{Name: user.GetString("name"), Address: user.Email()}},
+		Subject: subject,
+		HTML:    html,
+	}
+
+	return s.app.NewMailClient().Send(message)
+}
+
+// SendDigests emails every user with queued digest items a summary and
+// clears the items that were sent. It returns the number of digests sent.
+func (s *EmailService) SendDigests() (int, error) {
+	items, err := s.app.FindRecordsByFilter("email_digest_items", "", "created", 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("find digest items: %w", err)
+	}
+
+	byUser := map[string][]*core.Record{}
+	var order []string
+	for _, item := range items {
+		userID := item.GetString("user")
+		if _, ok := byUser[userID]; !ok {
+			order = append(order, userID)
+		}
+		byUser[userID] = append(byUser[userID], item)
+	}
+
+	sent := 0
+	for _, userID := range order {
+		userItems := byUser[userID]
+
+		user, err := s.app.FindRecordById("users", userID)
+		if err == nil && !user.GetBool("disabled") {
+			if err := s.sendDigest(user, userItems); err != nil {
+				log.Printf("[Notification] Failed to send digest to %s: %v", user.Email(), err)
+				continue
+			}
+			sent++
+		}
+
+		for _, item := range userItems {
+			if err := s.app.Delete(item); err != nil {
+				log.Printf("[Notification] Failed to delete digest item %s: %v", item.Id, err)
+			}
+		}
+	}
+
+	return sent, nil
+}
+
+func (s *EmailService) sendDigest(user *core.Record, items []*core.Record) error {
+	meta := s.app.Settings().Meta
+
+	var completed, failed []digestEntry
+	for _, item := range items {
+		entry := digestEntry{Torrent: item.GetString("torrentName"), Error: item.GetString("errorString")}
+		if item.GetString("event") == string(transmission.EventTorrentError) {
+			failed = append(failed, entry)
+		} else {
+			completed = append(completed, entry)
+		}
+	}
+
+	var body bytes.Buffer
+	err := digestEmailTemplate.Execute(&body, map[string]any{
+		"Name":      displayName(user),
+		"AppName":   meta.AppName,
+		"Completed": completed,
+		"Failed":    failed,
+		"Link":      s.appLink(),
+	})
+	if err != nil {
+		return fmt.Errorf("render digest email: %w", err)
+	}
+
+	subject := fmt.Sprintf("%s daily digest: %d completed, %d failed", meta.AppName, len(completed), len(failed))
+	return s.send(user, subject, body.String())
+}
@@ -0,0 +1,175 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+
+	"backend/internal/testutil"
+	"backend/internal/transmission"
+)
+
+func newTestService(t *testing.T) (*tests.TestApp, *EmailService, *testutil.SMTPServer) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	smtpServer := testutil.NewSMTPServer(t)
+	// Route mail through the SMTP stand-in instead of the test app's in-memory mailer
+	testApp.OnMailerSend().BindFunc(func(e *core.MailerEvent) error {
+		e.Mailer = &mailer.SMTPClient{Host: smtpServer.Host, Port: smtpServer.Port}
+		return e.Next()
+	})
+
+	service := NewEmailService(testApp)
+	t.Cleanup(service.Stop)
+
+	return testApp, service, smtpServer
+}
+
+// createUser creates a user with notification preferences, if any
+func createUser(t *testing.T, app core.App, email, role string, prefs *Preferences) *core.Record {
+	t.Helper()
+
+	record := testutil.CreateUser(t, app, email, role)
+	if prefs != nil {
+		record.Set("notifications", prefs)
+		if err := app.Save(record); err != nil {
+			t.Fatalf("Failed to save notification preferences: %v", err)
+		}
+	}
+	return record
+}
+
+func torrentEvent(eventType transmission.EventType, userID string) transmission.Event {
+	torrent := transmission.TorrentData{ID: 3, Name: "Debian 12", HashString: "abcdef", DownloadDir: "/downloads"}
+	if eventType == transmission.EventTorrentError {
+		torrent.ErrorString = "No data found"
+	}
+	return transmission.Event{Type: eventType, Torrent: torrent, RecordID: "record123", UserID: userID, Time: time.Now()}
+}
+
+func recipientsOf(messages []testutil.SMTPMessage) map[string]string {
+	result := map[string]string{}
+	for _, message := range messages {
+		for _, to := range message.To {
+			// Undo quoted-printable soft line breaks before inspecting the body
+			result[to] = strings.ReplaceAll(message.Data, "=\r\n", "")
+		}
+	}
+	return result
+}
+
+func TestInstantEmailsRespectOptIns(t *testing.T) {
+	testApp, service, smtpServer := newTestService(t)
+
+	owner := createUser(t, testApp, "owner@example.com", "user", &Preferences{Email: EmailPreferences{Completed: true, Failed: true}})
+	createUser(t, testApp, "admin@example.com", "admin", &Preferences{Email: EmailPreferences{Failed: true, AllTorrents: true}})
+	createUser(t, testApp, "quiet-admin@example.com", "admin", nil)
+	createUser(t, testApp, "other@example.com", "user", &Preferences{Email: EmailPreferences{Completed: true, Failed: true}})
+
+	service.HandleEvent(torrentEvent(transmission.EventDownloadCompleted, owner.Id))
+	service.Stop()
+
+	received := recipientsOf(smtpServer.Messages())
+	if len(received) != 1 {
+		t.Fatalf("Expected only the owner to be emailed about the completion, got %v", received)
+	}
+	if body, ok := received["owner@example.com"]; !ok || !strings.Contains(body, "Download completed: Debian 12") {
+		t.Errorf("Expected a completion email to the owner, got %v", received)
+	}
+
+	service.HandleEvent(torrentEvent(transmission.EventTorrentError, owner.Id))
+	service.HandleEvent(torrentEvent(transmission.EventTorrentAdded, owner.Id))
+	service.Stop()
+
+	messages := smtpServer.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("Expected the owner and the opted-in admin to be emailed about the failure, got %d emails", len(messages))
+	}
+	received = recipientsOf(messages[1:])
+	for _, email := range []string{"owner@example.com", "admin@example.com"} {
+		body, ok := received[email]
+		if !ok {
+			t.Errorf("Expected a failure email to %s", email)
+			continue
+		}
+		if !strings.Contains(body, "Download failed: Debian 12") || !strings.Contains(body, "No data found") {
+			t.Errorf("Expected the failure email to %s to name the torrent and the error", email)
+		}
+	}
+}
+
+func TestDigestMode(t *testing.T) {
+	testApp, service, smtpServer := newTestService(t)
+
+	owner := createUser(t, testApp, "owner@example.com", "user", &Preferences{Email: EmailPreferences{Completed: true, Failed: true, Mode: EmailModeDigest}})
+
+	service.HandleEvent(torrentEvent(transmission.EventDownloadCompleted, owner.Id))
+	service.HandleEvent(torrentEvent(transmission.EventTorrentError, owner.Id))
+	service.Stop()
+
+	if len(smtpServer.Messages()) != 0 {
+		t.Fatalf("Expected digest events to be queued instead of emailed")
+	}
+
+	sent, err := service.SendDigests()
+	if err != nil {
+		t.Fatalf("SendDigests failed: %v", err)
+	}
+	if sent != 1 {
+		t.Fatalf("Expected 1 digest, got %d", sent)
+	}
+
+	messages := smtpServer.Messages()
+	if len(messages) != 1 || messages[0].To[0] != "owner@example.com" {
+		t.Fatalf("Expected a single digest to the owner, got %+v", messages)
+	}
+	body := strings.ReplaceAll(messages[0].Data, "=\r\n", "")
+	if !strings.Contains(body, "1 completed, 1 failed") || !strings.Contains(body, "No data found") {
+		t.Errorf("Expected the digest to list both events")
+	}
+
+	// Sent items are cleared, so the next digest run has nothing to send
+	sent, err = service.SendDigests()
+	if err != nil {
+		t.Fatalf("SendDigests failed: %v", err)
+	}
+	if sent != 0 {
+		t.Errorf("Expected no digest after the items were sent, got %d", sent)
+	}
+}
+
+func TestAllTorrentsIsAdminOnly(t *testing.T) {
+	testApp, _, _ := newTestService(t)
+	preferences := NewPreferencesService(testApp)
+
+	member := createUser(t, testApp, "member@example.com", "user", nil)
+
+	if _, err := preferences.Update(member.Id, Preferences{Email: EmailPreferences{AllTorrents: true}}); err == nil {
+		t.Errorf("Expected non-admins to be refused notifications for all torrents")
+	}
+	if _, err := preferences.Update(member.Id, Preferences{Email: EmailPreferences{Mode: "hourly"}}); err == nil {
+		t.Errorf("Expected unknown email modes to be rejected")
+	}
+
+	prefs, err := preferences.Update(member.Id, Preferences{Email: EmailPreferences{Completed: true}})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if prefs.Email.Mode != EmailModeInstant {
+		t.Errorf("Expected the mode to default to instant, got %q", prefs.Email.Mode)
+	}
+
+	stored, err := preferences.Get(member.Id)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !stored.Email.Completed || stored.Email.Failed {
+		t.Errorf("Unexpected stored preferences: %+v", stored)
+	}
+}
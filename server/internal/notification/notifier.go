@@ -0,0 +1,425 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"backend/internal/transmission"
+)
+
+// Message is a rendered notification handed to a Notifier.
+type Message struct {
+	Event transmission.EventType
+	Title string
+	Body  string
+	// URL links back to the web UI
+	URL string
+}
+
+// Notifier delivers messages to an external service.
+type Notifier interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// provider describes a notification channel type
+type provider struct {
+	// build validates a channel config and returns a notifier for it
+	build func(config json.RawMessage, client *http.Client) (Notifier, error)
+	// secrets are config keys that are never returned by the API
+	secrets []string
+}
+
+// providers lists the supported notification channel types by name
+var providers = map[string]provider{
+	"ntfy":     {build: newNtfyNotifier, secrets: []string{"token"}},
+	"gotify":   {build: newGotifyNotifier, secrets: []string{"token"}},
+	"telegram": {build: newTelegramNotifier, secrets: []string{"botToken"}},
+	"discord":  {build: newDiscordNotifier, secrets: []string{"webhookUrl"}},
+	"matrix":   {build: newMatrixNotifier, secrets: []string{"accessToken"}},
+}
+
+// Providers returns the names of the supported notification channel types.
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewNotifier builds the notifier of a provider from its JSON config.
+func NewNotifier(providerName string, config json.RawMessage, client *http.Client) (Notifier, error) {
+	p, ok := providers[providerName]
+	if !ok {
+		return nil, ValidationError{Message: fmt.Sprintf("unknown provider: %s", providerName)}
+	}
+	return p.build(config, client)
+}
+
+func decodeConfig(raw json.RawMessage, dest any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		raw = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return ValidationError{Message: "invalid channel config"}
+	}
+	return nil
+}
+
+func parseServerURL(value, field string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", ValidationError{Message: field + " must be an http or https URL"}
+	}
+	return strings.TrimRight(parsed.String(), "/"), nil
+}
+
+// post sends a request and turns non-2xx responses into errors
+func post(ctx context.Context, client *http.Client, method, target string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, method, target string, header http.Header, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+	return post(ctx, client, method, target, header, body)
+}
+
+// plainText joins title and body for services without a separate title
+func plainText(message Message) string {
+	if message.Body == "" {
+		return message.Title
+	}
+	if message.Title == "" {
+		return message.Body
+	}
+	return message.Title + "\n" + message.Body
+}
+
+// ntfyNotifier publishes to an ntfy topic, see https://docs.ntfy.sh/publish/
+type ntfyNotifier struct {
+	client   *http.Client
+	target   string
+	token    string
+	priority string
+}
+
+func newNtfyNotifier(raw json.RawMessage, client *http.Client) (Notifier, error) {
+	var config struct {
+		Server   string `json:"server"`
+		Topic    string `json:"topic"`
+		Token    string `json:"token"`
+		Priority string `json:"priority"`
+	}
+	if err := decodeConfig(raw, &config); err != nil {
+		return nil, err
+	}
+
+	if config.Server == "" {
+		config.Server = "https://ntfy.sh"
+	}
+	server, err := parseServerURL(config.Server, "server")
+	if err != nil {
+		return nil, err
+	}
+	topic := strings.TrimSpace(config.Topic)
+	if topic == "" || strings.Contains(topic, "/") {
+		return nil, ValidationError{Message: "topic is required and cannot contain slashes"}
+	}
+
+	return &ntfyNotifier{
+		client:   client,
+		target:   server + "/" + url.PathEscape(topic),
+		token:    strings.TrimSpace(config.Token),
+		priority: strings.TrimSpace(config.Priority),
+	}, nil
+}
+
+func (n *ntfyNotifier) Send(ctx context.Context, message Message) error {
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	if message.Title != "" {
+		// Headers are ASCII only; ntfy decodes RFC 2047 encoded words
+		header.Set("Title", mime.QEncoding.Encode("utf-8", message.Title))
+	}
+	if message.URL != "" {
+		header.Set("Click", message.URL)
+	}
+	if n.priority != "" {
+		header.Set("Priority", n.priority)
+	}
+	if message.Event != "" {
+		header.Set("Tags", string(message.Event))
+	}
+	if n.token != "" {
+		header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	return post(ctx, n.client, http.MethodPost, n.target, header, []byte(message.Body))
+}
+
+// gotifyNotifier creates Gotify messages, see https://gotify.net/docs/pushmsg
+type gotifyNotifier struct {
+	client   *http.Client
+	target   string
+	token    string
+	priority int
+}
+
+func newGotifyNotifier(raw json.RawMessage, client *http.Client) (Notifier, error) {
+	var config struct {
+		Server   string `json:"server"`
+		Token    string `json:"token"`
+		Priority *int   `json:"priority"`
+	}
+	if err := decodeConfig(raw, &config); err != nil {
+		return nil, err
+	}
+
+	server, err := parseServerURL(config.Server, "server")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(config.Token) == "" {
+		return nil, ValidationError{Message: "token is required"}
+	}
+
+	priority := 5
+	if config.Priority != nil {
+		priority = *config.Priority
+	}
+
+	return &gotifyNotifier{client: client, target: server + "/message", token: strings.TrimSpace(config.Token), priority: priority}, nil
+}
+
+func (n *gotifyNotifier) Send(ctx context.Context, message Message) error {
+	payload := map[string]any{
+		"title":    message.Title,
+		"message":  message.Body,
+		"priority": n.priority,
+	}
+	if message.URL != "" {
+		payload["extras"] = map[string]any{
+			"client::notification": map[string]any{"click": map[string]string{"url": message.URL}},
+		}
+	}
+
+	header := http.Header{}
+	header.Set("X-Gotify-Key", n.token)
+	return postJSON(ctx, n.client, http.MethodPost, n.target, header, payload)
+}
+
+// telegramNotifier sends messages through the Telegram Bot API
+type telegramNotifier struct {
+	client *http.Client
+	target string
+	chatID string
+}
+
+func newTelegramNotifier(raw json.RawMessage, client *http.Client) (Notifier, error) {
+	var config struct {
+		BotToken string          `json:"botToken"`
+		ChatID   json.RawMessage `json:"chatId"`
+		// APIURL overrides the Bot API server, e.g. for a self-hosted one
+		APIURL string `json:"apiUrl"`
+	}
+	if err := decodeConfig(raw, &config); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(config.BotToken) == "" {
+		return nil, ValidationError{Message: "botToken is required"}
+	}
+	// Chat ids are numbers, channel usernames strings; accept both
+	chatID := strings.Trim(strings.TrimSpace(string(config.ChatID)), `"`)
+	if chatID == "" || chatID == "null" {
+		return nil, ValidationError{Message: "chatId is required"}
+	}
+
+	if config.APIURL == "" {
+		config.APIURL = "https://api.telegram.org"
+	}
+	apiURL, err := parseServerURL(config.APIURL, "apiUrl")
+	if err != nil {
+		return nil, err
+	}
+
+	return &telegramNotifier{
+		client: client,
+		target: apiURL + "/bot" + strings.TrimSpace(config.BotToken) + "/sendMessage",
+		chatID: chatID,
+	}, nil
+}
+
+func (n *telegramNotifier) Send(ctx context.Context, message Message) error {
+	text := plainText(message)
+	if message.URL != "" {
+		text += "\n" + message.URL
+	}
+
+	err := postJSON(ctx, n.client, http.MethodPost, n.target, nil, map[string]any{
+		"chat_id":                  n.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		// The target contains the bot token; keep it out of logs and responses
+		return fmt.Errorf("telegram: %s", strings.ReplaceAll(err.Error(), n.target, "sendMessage"))
+	}
+	return nil
+}
+
+// discordNotifier posts embeds to a Discord channel webhook
+type discordNotifier struct {
+	client   *http.Client
+	target   string
+	username string
+}
+
+func newDiscordNotifier(raw json.RawMessage, client *http.Client) (Notifier, error) {
+	var config struct {
+		WebhookURL string `json:"webhookUrl"`
+		Username   string `json:"username"`
+	}
+	if err := decodeConfig(raw, &config); err != nil {
+		return nil, err
+	}
+
+	target, err := parseServerURL(config.WebhookURL, "webhookUrl")
+	if err != nil {
+		return nil, err
+	}
+
+	return &discordNotifier{client: client, target: target, username: strings.TrimSpace(config.Username)}, nil
+}
+
+// discordColors tints embeds by event type
+var discordColors = map[transmission.EventType]int{
+	transmission.EventTorrentAdded:      0x3b82f6,
+	transmission.EventDownloadCompleted: 0x22c55e,
+	transmission.EventTorrentError:      0xef4444,
+	transmission.EventTorrentRemoved:    0x6b7280,
+}
+
+func (n *discordNotifier) Send(ctx context.Context, message Message) error {
+	embed := map[string]any{
+		"title":       message.Title,
+		"description": message.Body,
+	}
+	if message.URL != "" {
+		embed["url"] = message.URL
+	}
+	if color, ok := discordColors[message.Event]; ok {
+		embed["color"] = color
+	}
+
+	payload := map[string]any{"embeds": []any{embed}}
+	if n.username != "" {
+		payload["username"] = n.username
+	}
+
+	if err := postJSON(ctx, n.client, http.MethodPost, n.target, nil, payload); err != nil {
+		// The webhook URL is a credential; keep it out of logs and responses
+		return fmt.Errorf("discord: %s", strings.ReplaceAll(err.Error(), n.target, "webhook"))
+	}
+	return nil
+}
+
+// matrixNotifier sends m.notice events to a Matrix room through the
+// client-server API
+type matrixNotifier struct {
+	client      *http.Client
+	homeserver  string
+	roomID      string
+	accessToken string
+}
+
+func newMatrixNotifier(raw json.RawMessage, client *http.Client) (Notifier, error) {
+	var config struct {
+		Homeserver  string `json:"homeserver"`
+		AccessToken string `json:"accessToken"`
+		RoomID      string `json:"roomId"`
+	}
+	if err := decodeConfig(raw, &config); err != nil {
+		return nil, err
+	}
+
+	homeserver, err := parseServerURL(config.Homeserver, "homeserver")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(config.AccessToken) == "" {
+		return nil, ValidationError{Message: "accessToken is required"}
+	}
+	roomID := strings.TrimSpace(config.RoomID)
+	// The send endpoint takes room ids only, aliases would need resolving first
+	if !strings.HasPrefix(roomID, "!") {
+		return nil, ValidationError{Message: "roomId must be a room id like !abc:example.org"}
+	}
+
+	return &matrixNotifier{
+		client:      client,
+		homeserver:  homeserver,
+		roomID:      roomID,
+		accessToken: strings.TrimSpace(config.AccessToken),
+	}, nil
+}
+
+func (n *matrixNotifier) Send(ctx context.Context, message Message) error {
+	txn := make([]byte, 12)
+	if _, err := rand.Read(txn); err != nil {
+		return fmt.Errorf("generate transaction id: %w", err)
+	}
+
+	target := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		n.homeserver, url.PathEscape(n.roomID), hex.EncodeToString(txn))
+
+	text := plainText(message)
+	if message.URL != "" {
+		text += "\n" + message.URL
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+n.accessToken)
+	return postJSON(ctx, n.client, http.MethodPut, target, header, map[string]string{
+		"msgtype": "m.notice",
+		"body":    text,
+	})
+}
@@ -0,0 +1,133 @@
+// Package notification informs users about torrent lifecycle events.
+package notification
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Email delivery modes.
+const (
+	EmailModeInstant = "instant"
+	EmailModeDigest  = "digest"
+)
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// Preferences holds a user's notification opt-ins, stored in the users
+// notifications field.
+type Preferences struct {
+	Email EmailPreferences `json:"email"`
+}
+
+// EmailPreferences controls email notifications. Everything is off by default.
+type EmailPreferences struct {
+	Completed bool `json:"completed"`
+	Failed    bool `json:"failed"`
+	// Mode is EmailModeInstant or EmailModeDigest
+	Mode string `json:"mode"`
+	// AllTorrents lets admins receive notifications for every user's torrents
+	AllTorrents bool `json:"allTorrents"`
+}
+
+// PreferencesFromRecord decodes the notification preferences of a users record.
+func PreferencesFromRecord(record *core.Record) (Preferences, error) {
+	prefs := Preferences{Email: EmailPreferences{Mode: EmailModeInstant}}
+
+	raw := strings.TrimSpace(record.GetString("notifications"))
+	if raw == "" || raw == "null" {
+		return prefs, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &prefs); err != nil {
+		return Preferences{}, err
+	}
+	if prefs.Email.Mode == "" {
+		prefs.Email.Mode = EmailModeInstant
+	}
+
+	return prefs, nil
+}
+
+// PreferencesService reads and updates users' notification preferences.
+type PreferencesService struct {
+	app core.App
+}
+
+// NewPreferencesService constructs a PreferencesService instance.
+func NewPreferencesService(app core.App) *PreferencesService {
+	return &PreferencesService{app: app}
+}
+
+func (s *PreferencesService) findUser(userID string) (*core.Record, error) {
+	record, err := s.app.FindRecordById("users", userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: "user not found"}
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	return record, nil
+}
+
+// Get returns the notification preferences of a user.
+func (s *PreferencesService) Get(userID string) (Preferences, error) {
+	record, err := s.findUser(userID)
+	if err != nil {
+		return Preferences{}, err
+	}
+
+	prefs, err := PreferencesFromRecord(record)
+	if err != nil {
+		return Preferences{}, fmt.Errorf("decode notification preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// Update replaces the notification preferences of a user.
+func (s *PreferencesService) Update(userID string, prefs Preferences) (Preferences, error) {
+	record, err := s.findUser(userID)
+	if err != nil {
+		return Preferences{}, err
+	}
+
+	switch prefs.Email.Mode {
+	case "":
+		prefs.Email.Mode = EmailModeInstant
+	case EmailModeInstant, EmailModeDigest:
+	default:
+		return Preferences{}, ValidationError{Message: "email mode must be instant or digest"}
+	}
+
+	if prefs.Email.AllTorrents && record.GetString("role") != "admin" {
+		return Preferences{}, ValidationError{Message: "only admins can receive notifications for all torrents"}
+	}
+
+	record.Set("notifications", prefs)
+	if err := s.app.Save(record); err != nil {
+		return Preferences{}, fmt.Errorf("save user: %w", err)
+	}
+
+	return prefs, nil
+}
@@ -0,0 +1,331 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/settings"
+	"backend/internal/transmission"
+	"backend/internal/webpush"
+)
+
+// SettingVAPIDKeys is the settings key holding the Web Push key pair.
+const SettingVAPIDKeys = "webpush.vapidKeys"
+
+const (
+	pushTimeout = 15 * time.Second
+	pushTTL     = 24 * time.Hour
+)
+
+// PushSubscriptionResponse represents a push subscription as exposed by the
+// API. The subscription keys are never returned.
+type PushSubscriptionResponse struct {
+	ID        string `json:"id"`
+	Endpoint  string `json:"endpoint"`
+	UserAgent string `json:"userAgent,omitempty"`
+	Created   string `json:"created"`
+}
+
+// PushPayload is the JSON message shown by the service worker.
+type PushPayload struct {
+	Event string `json:"event"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// Tag lets a later notification about the same torrent replace the earlier one
+	Tag string `json:"tag"`
+	URL string `json:"url"`
+}
+
+// PushService manages browser push subscriptions and notifies them about
+// completed and failed downloads.
+type PushService struct {
+	app      core.App
+	settings *settings.Service
+	client   *http.Client
+	// allowHTTP accepts plain http endpoints, which tests use for their
+	// stand-in push service
+	allowHTTP bool
+
+	keysMu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPushService constructs a PushService instance.
+func NewPushService(app core.App, settingsService *settings.Service) *PushService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &PushService{
+		app:      app,
+		settings: settingsService,
+		client:   &http.Client{Timeout: pushTimeout},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Stop cancels running deliveries and waits for them to finish.
+func (s *PushService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// VAPIDKeys returns the application server key pair, generating and storing
+// it on first use.
+func (s *PushService) VAPIDKeys() (webpush.VAPIDKeys, error) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	var keys webpush.VAPIDKeys
+	found, err := s.settings.Get(SettingVAPIDKeys, &keys)
+	if err != nil {
+		return webpush.VAPIDKeys{}, err
+	}
+	if found && keys.PublicKey != "" && keys.PrivateKey != "" {
+		return keys, nil
+	}
+
+	keys, err = webpush.GenerateVAPIDKeys()
+	if err != nil {
+		return webpush.VAPIDKeys{}, err
+	}
+	if err := s.settings.Set(SettingVAPIDKeys, keys); err != nil {
+		return webpush.VAPIDKeys{}, err
+	}
+
+	log.Println("[Push] Generated a new VAPID key pair")
+	return keys, nil
+}
+
+// PublicKey returns the application server key browsers subscribe with.
+func (s *PushService) PublicKey() (string, error) {
+	keys, err := s.VAPIDKeys()
+	if err != nil {
+		return "", err
+	}
+	return keys.PublicKey, nil
+}
+
+func mapPushSubscriptionRecord(record *core.Record) PushSubscriptionResponse {
+	response := PushSubscriptionResponse{
+		ID:        record.Id,
+		Endpoint:  record.GetString("endpoint"),
+		UserAgent: record.GetString("userAgent"),
+	}
+	if created := record.GetDateTime("created"); !created.IsZero() {
+		response.Created = created.Time().Format(time.RFC3339)
+	}
+	return response
+}
+
+// Subscriptions returns the push subscriptions of a user.
+func (s *PushService) Subscriptions(userID string) ([]PushSubscriptionResponse, error) {
+	records, err := s.app.FindRecordsByFilter("push_subscriptions", "user = {:user}", "-created", 0, 0, dbx.Params{"user": userID})
+	if err != nil {
+		return nil, fmt.Errorf("find push subscriptions: %w", err)
+	}
+
+	subscriptions := make([]PushSubscriptionResponse, 0, len(records))
+	for _, record := range records {
+		subscriptions = append(subscriptions, mapPushSubscriptionRecord(record))
+	}
+	return subscriptions, nil
+}
+
+// validateSubscription checks the endpoint and keys of a subscription.
+// Endpoints are requested by the server, so only https push services are
+// accepted.
+func (s *PushService) validateSubscription(sub webpush.Subscription) error {
+	endpoint, err := url.Parse(strings.TrimSpace(sub.Endpoint))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && !(s.allowHTTP && endpoint.Scheme == "http")) {
+		return ValidationError{Message: "endpoint must be an https URL"}
+	}
+
+	p256dh, err := webpush.DecodeKey(sub.Keys.P256dh)
+	if err != nil || len(p256dh) != 65 || p256dh[0] != 0x04 {
+		return ValidationError{Message: "keys.p256dh must be an uncompressed P-256 public key"}
+	}
+
+	auth, err := webpush.DecodeKey(sub.Keys.Auth)
+	if err != nil || len(auth) < 16 {
+		return ValidationError{Message: "keys.auth must be a 16 byte secret"}
+	}
+
+	return nil
+}
+
+// Subscribe stores a browser push subscription for a user. Subscribing an
+// endpoint again updates its keys, and moves it over when another account
+// signed in on the same browser.
+func (s *PushService) Subscribe(userID string, sub webpush.Subscription, userAgent string) (PushSubscriptionResponse, error) {
+	if err := s.validateSubscription(sub); err != nil {
+		return PushSubscriptionResponse{}, err
+	}
+	endpoint := strings.TrimSpace(sub.Endpoint)
+
+	record, err := s.app.FindFirstRecordByData("push_subscriptions", "endpoint", endpoint)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return PushSubscriptionResponse{}, fmt.Errorf("find push subscription: %w", err)
+		}
+
+		collection, err := s.app.FindCollectionByNameOrId("push_subscriptions")
+		if err != nil {
+			return PushSubscriptionResponse{}, fmt.Errorf("find push_subscriptions collection: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("endpoint", endpoint)
+	}
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	record.Set("user", userID)
+	record.Set("p256dh", sub.Keys.P256dh)
+	record.Set("auth", sub.Keys.Auth)
+	record.Set("userAgent", userAgent)
+
+	if err := s.app.Save(record); err != nil {
+		return PushSubscriptionResponse{}, fmt.Errorf("save push subscription: %w", err)
+	}
+
+	return mapPushSubscriptionRecord(record), nil
+}
+
+// Unsubscribe removes a push subscription of a user by its endpoint.
+func (s *PushService) Unsubscribe(userID, endpoint string) error {
+	record, err := s.app.FindFirstRecordByData("push_subscriptions", "endpoint", strings.TrimSpace(endpoint))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NotFoundError{Message: "push subscription not found"}
+		}
+		return fmt.Errorf("find push subscription: %w", err)
+	}
+	if record.GetString("user") != userID {
+		return NotFoundError{Message: "push subscription not found"}
+	}
+
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete push subscription: %w", err)
+	}
+	return nil
+}
+
+// sender builds a Sender from the stored key pair
+func (s *PushService) sender() (*webpush.Sender, error) {
+	keys, err := s.VAPIDKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := s.app.Settings().Meta
+	subject := "mailto:" + meta.SenderAddress
+	if meta.SenderAddress == "" && strings.HasPrefix(meta.AppURL, "https://") {
+		subject = meta.AppURL
+	}
+
+	return webpush.NewSender(keys, subject, s.client)
+}
+
+func (s *PushService) payload(event transmission.Event) PushPayload {
+	payload := PushPayload{
+		Event: string(event.Type),
+		Title: "Download completed",
+		Body:  event.Torrent.Name,
+		Tag:   event.Torrent.HashString,
+		URL:   strings.TrimRight(s.app.Settings().Meta.AppURL, "/") + "/",
+	}
+
+	if event.Type == transmission.EventTorrentError {
+		payload.Title = "Download failed"
+		if event.Torrent.ErrorString != "" {
+			payload.Body = event.Torrent.Name + ": " + event.Torrent.ErrorString
+		}
+	}
+
+	return payload
+}
+
+// HandleEvent pushes completed and failed downloads to the subscriptions of
+// the torrent's owner. It is meant to be registered with
+// transmission.SyncService.OnEvent.
+func (s *PushService) HandleEvent(event transmission.Event) {
+	if event.Type != transmission.EventDownloadCompleted && event.Type != transmission.EventTorrentError {
+		return
+	}
+	if event.UserID == "" {
+		return
+	}
+
+	owner, err := s.app.FindRecordById("users", event.UserID)
+	if err != nil || owner.GetBool("disabled") {
+		return
+	}
+
+	records, err := s.app.FindRecordsByFilter("push_subscriptions", "user = {:user}", "", 0, 0, dbx.Params{"user": event.UserID})
+	if err != nil {
+		log.Printf("[Push] Failed to find push subscriptions: %v", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	sender, err := s.sender()
+	if err != nil {
+		log.Printf("[Push] Failed to prepare push sender: %v", err)
+		return
+	}
+
+	body, err := json.Marshal(s.payload(event))
+	if err != nil {
+		log.Printf("[Push] Failed to encode push payload: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		s.wg.Add(1)
+		go func(record *core.Record) {
+			defer s.wg.Done()
+			s.deliver(sender, record, body)
+		}(record)
+	}
+}
+
+func (s *PushService) deliver(sender *webpush.Sender, record *core.Record, body []byte) {
+	sub := webpush.Subscription{
+		Endpoint: record.GetString("endpoint"),
+		Keys: webpush.Keys{
+			P256dh: record.GetString("p256dh"),
+			Auth:   record.GetString("auth"),
+		},
+	}
+
+	err := sender.Send(s.ctx, sub, body, webpush.Options{TTL: pushTTL, Urgency: "normal"})
+	if errors.Is(err, webpush.ErrSubscriptionGone) {
+		if err := s.app.Delete(record); err != nil {
+			log.Printf("[Push] Failed to remove expired subscription %s: %v", record.Id, err)
+			return
+		}
+		log.Printf("[Push] Removed expired subscription %s", record.Id)
+		return
+	}
+	if err != nil {
+		log.Printf("[Push] Failed to deliver to subscription %s: %v", record.Id, err)
+	}
+}
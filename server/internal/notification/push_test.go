@@ -0,0 +1,128 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+
+	"backend/internal/settings"
+	"backend/internal/testutil"
+	"backend/internal/transmission"
+	"backend/internal/webpush"
+)
+
+func TestPushDeliveryAndExpiredSubscriptions(t *testing.T) {
+	testApp, _, _ := newTestService(t)
+	service := NewPushService(testApp, settings.NewService(testApp))
+	service.allowHTTP = true
+	t.Cleanup(service.Stop)
+
+	pushServer := testutil.NewPushServer(t)
+
+	owner := createUser(t, testApp, "owner@example.com", "user", nil)
+	other := createUser(t, testApp, "other@example.com", "user", nil)
+
+	subscribe := func(userID string) string {
+		endpoint, p256dh, auth := pushServer.Subscribe(t)
+		sub := webpush.Subscription{Endpoint: endpoint, Keys: webpush.Keys{P256dh: p256dh, Auth: auth}}
+		if _, err := service.Subscribe(userID, sub, "Firefox"); err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+		return endpoint
+	}
+
+	phone := subscribe(owner.Id)
+	laptop := subscribe(owner.Id)
+	subscribe(other.Id)
+	pushServer.Expire(laptop)
+
+	service.HandleEvent(torrentEvent(transmission.EventTorrentError, owner.Id))
+	service.HandleEvent(torrentEvent(transmission.EventTorrentAdded, owner.Id))
+	service.wg.Wait()
+
+	if pushServer.Rejected() != 0 {
+		t.Fatalf("Expected the push service to accept the VAPID token and encryption, %d requests were rejected", pushServer.Rejected())
+	}
+
+	messages := pushServer.Messages()
+	if len(messages) != 1 || messages[0].Endpoint != phone {
+		t.Fatalf("Expected one message to the owner's live subscription, got %+v", messages)
+	}
+
+	var payload PushPayload
+	if err := json.Unmarshal(messages[0].Payload, &payload); err != nil {
+		t.Fatalf("Failed to decode decrypted payload: %v", err)
+	}
+	if payload.Event != "error" || payload.Title != "Download failed" || payload.Body != "Debian 12: No data found" || payload.Tag != "abcdef" {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+
+	subscriptions, err := service.Subscriptions(owner.Id)
+	if err != nil {
+		t.Fatalf("Subscriptions failed: %v", err)
+	}
+	if len(subscriptions) != 1 || subscriptions[0].Endpoint != phone {
+		t.Errorf("Expected the expired subscription to be removed, got %+v", subscriptions)
+	}
+
+	// The key pair is generated once and then reused
+	first, err := service.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey failed: %v", err)
+	}
+	second, err := service.PublicKey()
+	if err != nil || first != second {
+		t.Errorf("Expected a stable VAPID public key")
+	}
+}
+
+func TestPushSubscriptionOwnership(t *testing.T) {
+	testApp, _, _ := newTestService(t)
+	service := NewPushService(testApp, settings.NewService(testApp))
+	service.allowHTTP = true
+	t.Cleanup(service.Stop)
+
+	pushServer := testutil.NewPushServer(t)
+
+	owner := createUser(t, testApp, "owner@example.com", "user", nil)
+	other := createUser(t, testApp, "other@example.com", "user", nil)
+
+	endpoint, p256dh, auth := pushServer.Subscribe(t)
+	sub := webpush.Subscription{Endpoint: endpoint, Keys: webpush.Keys{P256dh: p256dh, Auth: auth}}
+
+	if _, err := service.Subscribe(owner.Id, webpush.Subscription{Endpoint: endpoint, Keys: webpush.Keys{P256dh: "bm9wZQ", Auth: auth}}, ""); err == nil {
+		t.Errorf("Expected an invalid p256dh key to be rejected")
+	}
+
+	// The server requests endpoints itself, so plain http is refused by default
+	service.allowHTTP = false
+	var validationErr ValidationError
+	if _, err := service.Subscribe(owner.Id, sub, ""); !errors.As(err, &validationErr) {
+		t.Errorf("Expected an http endpoint to be rejected, got %v", err)
+	}
+	service.allowHTTP = true
+
+	if _, err := service.Subscribe(owner.Id, sub, ""); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	var notFoundErr NotFoundError
+	if err := service.Unsubscribe(other.Id, endpoint); !errors.As(err, &notFoundErr) {
+		t.Errorf("Expected other users not to remove the subscription, got %v", err)
+	}
+
+	// Subscribing the same browser from another account moves the subscription
+	if _, err := service.Subscribe(other.Id, sub, ""); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	records, err := testApp.FindRecordsByFilter("push_subscriptions", "endpoint = {:endpoint}", "", 0, 0, dbx.Params{"endpoint": endpoint})
+	if err != nil || len(records) != 1 || records[0].GetString("user") != other.Id {
+		t.Fatalf("Expected a single subscription owned by the new account, got %d (%v)", len(records), err)
+	}
+
+	if err := service.Unsubscribe(other.Id, endpoint); err != nil {
+		t.Errorf("Unsubscribe failed: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Package plugin lets extensions compiled into the server hook into the
+// torrent lifecycle, vet torrents before they are added and serve their own
+// routes. Admins enable and configure them through the plugins collection.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+// Plugin is implemented by extensions. Embed Base to implement only the
+// hooks a plugin needs.
+//
+// Hooks of enabled plugins run one plugin at a time in priority order. A
+// failing or panicking plugin is logged and skipped without affecting the
+// others; hooks must honor ctx, which is cancelled after a timeout.
+type Plugin interface {
+	// Name identifies the plugin in the plugins collection and prefixes its
+	// routes. It must not change.
+	Name() string
+
+	// Configure receives the plugin's own config whenever the plugin is
+	// enabled or its config changes. Returning an error keeps the plugin
+	// disabled.
+	Configure(config json.RawMessage) error
+
+	OnTorrentAdded(ctx context.Context, event transmission.Event) error
+	OnTorrentCompleted(ctx context.Context, event transmission.Event) error
+	OnTorrentRemoved(ctx context.Context, event transmission.Event) error
+
+	// BeforeAdd runs before a torrent is added and may change req. Return an
+	// error made with Reject to refuse the torrent; any other error discards
+	// the plugin's changes and the add goes ahead.
+	BeforeAdd(ctx context.Context, req *torrent.AddTorrentRequest) error
+
+	// RegisterRoutes binds the plugin's routes below /api/plugins/{name}.
+	// They answer 404 while the plugin is disabled and are unauthenticated
+	// unless the plugin binds an auth middleware.
+	RegisterRoutes(group *router.RouterGroup[*core.RequestEvent])
+}
+
+// Base implements every hook of Plugin as a no-op.
+type Base struct{}
+
+// Configure accepts any config.
+func (Base) Configure(json.RawMessage) error { return nil }
+
+// OnTorrentAdded does nothing.
+func (Base) OnTorrentAdded(context.Context, transmission.Event) error { return nil }
+
+// OnTorrentCompleted does nothing.
+func (Base) OnTorrentCompleted(context.Context, transmission.Event) error { return nil }
+
+// OnTorrentRemoved does nothing.
+func (Base) OnTorrentRemoved(context.Context, transmission.Event) error { return nil }
+
+// BeforeAdd accepts every torrent unchanged.
+func (Base) BeforeAdd(context.Context, *torrent.AddTorrentRequest) error { return nil }
+
+// RegisterRoutes binds no routes.
+func (Base) RegisterRoutes(*router.RouterGroup[*core.RequestEvent]) {}
+
+// RejectError refuses a torrent in BeforeAdd.
+type RejectError struct {
+	// Plugin is filled in by the registry
+	Plugin string
+	Reason string
+}
+
+func (e RejectError) Error() string {
+	if e.Plugin == "" {
+		return "torrent rejected: " + e.Reason
+	}
+	return fmt.Sprintf("torrent rejected by plugin %s: %s", e.Plugin, e.Reason)
+}
+
+// Reject returns the error BeforeAdd uses to refuse a torrent.
+func Reject(format string, args ...any) error {
+	return RejectError{Reason: fmt.Sprintf(format, args...)}
+}
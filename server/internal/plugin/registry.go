@@ -0,0 +1,513 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+
+	"backend/internal/audit"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+const (
+	hookTimeout    = 30 * time.Second
+	queueSize      = 1024
+	maxErrorLength = 1000
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// Response represents a registered plugin as exposed by the API.
+type Response struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Active is false for enabled plugins whose config was rejected
+	Active    bool            `json:"active"`
+	Priority  int             `json:"priority"`
+	Config    json.RawMessage `json:"config"`
+	LastError string          `json:"lastError,omitempty"`
+	Updated   string          `json:"updated,omitempty"`
+}
+
+// Params holds the plugin settings to change. Nil fields are left untouched.
+type Params struct {
+	Enabled  *bool            `json:"enabled"`
+	Priority *int             `json:"priority"`
+	Config   *json.RawMessage `json:"config"`
+}
+
+type entry struct {
+	plugin   Plugin
+	active   bool
+	priority int
+}
+
+// Registry holds the plugins compiled into the server and runs their hooks.
+type Registry struct {
+	app   core.App
+	audit *audit.Service
+
+	mu      sync.RWMutex
+	entries map[string]*entry
+	loaded  bool
+
+	// configuring serializes changes to the plugin settings
+	configuring sync.Mutex
+
+	// events queues lifecycle events for the worker so slow plugins don't
+	// hold up the sync; pending counts the queued ones
+	events  chan transmission.Event
+	pending sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRegistry constructs an empty Registry.
+func NewRegistry(app core.App, auditService *audit.Service) *Registry {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Registry{
+		app:     app,
+		audit:   auditService,
+		entries: map[string]*entry{},
+		events:  make(chan transmission.Event, queueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Register adds a plugin. Plugins must be registered before Load.
+func (r *Registry) Register(p Plugin) error {
+	name := p.Name()
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid plugin name %q", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loaded {
+		return fmt.Errorf("plugin %s registered after load", name)
+	}
+	if _, exists := r.entries[name]; exists {
+		return fmt.Errorf("plugin %s is already registered", name)
+	}
+
+	r.entries[name] = &entry{plugin: p}
+	return nil
+}
+
+// Load reads the settings of the registered plugins, configures the enabled
+// ones and starts delivering lifecycle events. Plugins seen for the first
+// time are recorded disabled.
+func (r *Registry) Load() error {
+	r.configuring.Lock()
+	defer r.configuring.Unlock()
+
+	r.mu.Lock()
+	if r.loaded {
+		r.mu.Unlock()
+		return errors.New("plugins are already loaded")
+	}
+	r.loaded = true
+	r.mu.Unlock()
+
+	for _, name := range r.names() {
+		record, err := r.findOrCreate(name)
+		if err != nil {
+			return err
+		}
+
+		active := false
+		if record.GetBool("enabled") {
+			lastError := ""
+			if err := r.configure(name, record); err != nil {
+				log.Printf("[Plugin] Failed to configure %s: %v", name, err)
+				lastError = truncate(err.Error(), maxErrorLength)
+			} else {
+				active = true
+			}
+			if record.GetString("lastError") != lastError {
+				record.Set("lastError", lastError)
+				if err := r.app.Save(record); err != nil {
+					log.Printf("[Plugin] Failed to update %s: %v", name, err)
+				}
+			}
+		}
+
+		r.mu.Lock()
+		r.entries[name].active = active
+		r.entries[name].priority = record.GetInt("priority")
+		r.mu.Unlock()
+	}
+
+	r.wg.Add(1)
+	go r.work()
+	return nil
+}
+
+// Stop stops delivering lifecycle events once the running hook returns.
+func (r *Registry) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *Registry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// active returns the names and plugins of the active plugins in the order
+// their hooks run
+func (r *Registry) active() ([]string, []Plugin) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	for name, e := range r.entries {
+		if e.active {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := r.entries[names[i]], r.entries[names[j]]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		return names[i] < names[j]
+	})
+
+	plugins := make([]Plugin, 0, len(names))
+	for _, name := range names {
+		plugins = append(plugins, r.entries[name].plugin)
+	}
+	return names, plugins
+}
+
+func (r *Registry) isActive(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.entries[name]
+	return ok && e.active
+}
+
+func (r *Registry) findOrCreate(name string) (*core.Record, error) {
+	record, err := r.app.FindFirstRecordByData("plugins", "name", name)
+	if err == nil {
+		return record, nil
+	}
+
+	collection, err := r.app.FindCollectionByNameOrId("plugins")
+	if err != nil {
+		return nil, fmt.Errorf("find plugins collection: %w", err)
+	}
+
+	record = core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("enabled", false)
+	record.Set("priority", 0)
+	record.Set("config", map[string]any{})
+	if err := r.app.Save(record); err != nil {
+		return nil, fmt.Errorf("save plugin %s: %w", name, err)
+	}
+	return record, nil
+}
+
+func configOf(record *core.Record) json.RawMessage {
+	raw := strings.TrimSpace(record.GetString("config"))
+	if raw == "" || raw == "null" {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(raw)
+}
+
+// configure hands a plugin its config
+func (r *Registry) configure(name string, record *core.Record) error {
+	r.mu.RLock()
+	p := r.entries[name].plugin
+	r.mu.RUnlock()
+
+	return guard(func() error { return p.Configure(configOf(record)) })
+}
+
+// guard turns a panic of a plugin into an error
+func guard(call func() error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return call()
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func (r *Registry) mapRecord(name string, record *core.Record) Response {
+	return Response{
+		Name:      name,
+		Enabled:   record.GetBool("enabled"),
+		Active:    r.isActive(name),
+		Priority:  record.GetInt("priority"),
+		Config:    configOf(record),
+		LastError: record.GetString("lastError"),
+		Updated:   formatDate(record, "updated"),
+	}
+}
+
+// List returns the registered plugins in the order their hooks run when
+// enabled.
+func (r *Registry) List() ([]Response, error) {
+	plugins := []Response{}
+	for _, name := range r.names() {
+		record, err := r.findOrCreate(name)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, r.mapRecord(name, record))
+	}
+
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return plugins[i].Priority < plugins[j].Priority
+	})
+	return plugins, nil
+}
+
+// Update changes the settings of a plugin. Enabled plugins are reconfigured
+// right away; a config the plugin rejects is not saved.
+func (r *Registry) Update(ctx context.Context, name string, params Params) (Response, error) {
+	r.configuring.Lock()
+	defer r.configuring.Unlock()
+
+	r.mu.RLock()
+	_, registered := r.entries[name]
+	r.mu.RUnlock()
+	if !registered {
+		return Response{}, NotFoundError{Message: "plugin not found"}
+	}
+
+	record, err := r.findOrCreate(name)
+	if err != nil {
+		return Response{}, err
+	}
+	before := r.mapRecord(name, record)
+
+	if params.Priority != nil {
+		record.Set("priority", *params.Priority)
+	}
+	if params.Config != nil {
+		config := bytes.TrimSpace(*params.Config)
+		if len(config) == 0 || config[0] != '{' || !json.Valid(config) {
+			return Response{}, ValidationError{Message: "config must be a JSON object"}
+		}
+		record.Set("config", json.RawMessage(config))
+	}
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	active := false
+	if record.GetBool("enabled") {
+		if err := r.configure(name, record); err != nil {
+			return Response{}, ValidationError{Message: fmt.Sprintf("invalid config: %v", err)}
+		}
+		active = true
+		record.Set("lastError", "")
+	}
+
+	if err := r.app.Save(record); err != nil {
+		return Response{}, fmt.Errorf("save plugin: %w", err)
+	}
+
+	r.mu.Lock()
+	r.entries[name].active = active
+	r.entries[name].priority = record.GetInt("priority")
+	r.mu.Unlock()
+
+	response := r.mapRecord(name, record)
+	r.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionPluginUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// recordError keeps the latest failure of a plugin for admins
+func (r *Registry) recordError(name string, err error) {
+	record, findErr := r.app.FindFirstRecordByData("plugins", "name", name)
+	if findErr != nil {
+		return
+	}
+
+	record.Set("lastError", truncate(err.Error(), maxErrorLength))
+	if err := r.app.Save(record); err != nil {
+		log.Printf("[Plugin] Failed to update %s: %v", name, err)
+	}
+}
+
+// BeforeAdd runs the BeforeAdd hooks of the active plugins, each seeing the
+// changes of the previous ones. Each plugin changes its own copy of the
+// request, which is only adopted if the plugin succeeds. It is meant to be
+// registered with torrent.Service.OnBeforeAdd.
+func (r *Registry) BeforeAdd(ctx context.Context, req *torrent.AddTorrentRequest) error {
+	names, plugins := r.active()
+
+	for i, p := range plugins {
+		candidate := req.Clone()
+
+		hookCtx, cancel := context.WithTimeout(ctx, hookTimeout)
+		err := guard(func() error { return p.BeforeAdd(hookCtx, &candidate) })
+		cancel()
+		if err == nil {
+			*req = candidate
+			continue
+		}
+
+		var rejectErr RejectError
+		if errors.As(err, &rejectErr) {
+			rejectErr.Plugin = names[i]
+			return rejectErr
+		}
+
+		// A broken plugin must not block adding torrents
+		log.Printf("[Plugin] %s failed before adding a torrent: %v", names[i], err)
+		r.recordError(names[i], err)
+	}
+
+	return nil
+}
+
+// HandleEvent queues a lifecycle event for the active plugins. It is meant
+// to be registered with transmission.SyncService.OnEvent.
+func (r *Registry) HandleEvent(event transmission.Event) {
+	switch event.Type {
+	case transmission.EventTorrentAdded, transmission.EventDownloadCompleted, transmission.EventTorrentRemoved:
+	default:
+		return
+	}
+
+	r.pending.Add(1)
+	select {
+	case r.events <- event:
+	default:
+		r.pending.Done()
+		log.Printf("[Plugin] Dropped %s event of %s, too many events are queued", event.Type, event.Torrent.Name)
+	}
+}
+
+// work delivers queued events one at a time, keeping their order
+func (r *Registry) work() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case event := <-r.events:
+			r.dispatch(event)
+			r.pending.Done()
+		}
+	}
+}
+
+func (r *Registry) dispatch(event transmission.Event) {
+	names, plugins := r.active()
+
+	for i, p := range plugins {
+		ctx, cancel := context.WithTimeout(r.ctx, hookTimeout)
+		err := guard(func() error {
+			switch event.Type {
+			case transmission.EventTorrentAdded:
+				return p.OnTorrentAdded(ctx, event)
+			case transmission.EventDownloadCompleted:
+				return p.OnTorrentCompleted(ctx, event)
+			default:
+				return p.OnTorrentRemoved(ctx, event)
+			}
+		})
+		cancel()
+
+		if err != nil {
+			log.Printf("[Plugin] %s failed on %s event of %s: %v", names[i], event.Type, event.Torrent.Name, err)
+			r.recordError(names[i], err)
+		}
+	}
+}
+
+// MountRoutes binds the routes of every registered plugin below
+// /api/plugins/{name}. They answer 404 while the plugin is not active.
+func (r *Registry) MountRoutes(rt *router.Router[*core.RequestEvent]) {
+	for _, name := range r.names() {
+		r.mu.RLock()
+		p := r.entries[name].plugin
+		r.mu.RUnlock()
+
+		group := rt.Group("/api/plugins/" + name)
+		group.BindFunc(func(re *core.RequestEvent) error {
+			if !r.isActive(name) {
+				return re.JSON(http.StatusNotFound, map[string]string{"error": "plugin not enabled"})
+			}
+			return re.Next()
+		})
+
+		if err := guard(func() error { p.RegisterRoutes(group); return nil }); err != nil {
+			log.Printf("[Plugin] Failed to register routes of %s: %v", name, err)
+		}
+	}
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
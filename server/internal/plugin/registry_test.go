@@ -0,0 +1,290 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+// calls records the hooks run by the test plugins in order
+type calls struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (c *calls) add(entry string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, entry)
+}
+
+func (c *calls) list() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.entries...)
+}
+
+// recorder is a test plugin that records its hooks and misbehaves on demand
+type recorder struct {
+	Base
+	name  string
+	calls *calls
+
+	config  json.RawMessage
+	dir     string
+	reject  bool
+	panics  bool
+	failing bool
+}
+
+func (p *recorder) Name() string { return p.name }
+
+func (p *recorder) Configure(config json.RawMessage) error {
+	var decoded struct {
+		Dir     string `json:"dir"`
+		Invalid bool   `json:"invalid"`
+	}
+	if err := json.Unmarshal(config, &decoded); err != nil {
+		return err
+	}
+	if decoded.Invalid {
+		return errors.New("invalid is set")
+	}
+	p.config = config
+	p.dir = decoded.Dir
+	return nil
+}
+
+func (p *recorder) hook(event string) error {
+	p.calls.add(p.name + ":" + event)
+	if p.panics {
+		panic("boom")
+	}
+	if p.failing {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func (p *recorder) OnTorrentAdded(_ context.Context, event transmission.Event) error {
+	return p.hook("added:" + event.Torrent.Name)
+}
+
+func (p *recorder) OnTorrentCompleted(_ context.Context, event transmission.Event) error {
+	return p.hook("completed:" + event.Torrent.Name)
+}
+
+func (p *recorder) OnTorrentRemoved(_ context.Context, event transmission.Event) error {
+	return p.hook("removed:" + event.Torrent.Name)
+}
+
+func (p *recorder) BeforeAdd(_ context.Context, req *torrent.AddTorrentRequest) error {
+	dir := p.dir
+	if req.DownloadDir != nil {
+		dir = *req.DownloadDir + dir
+	}
+	req.DownloadDir = &dir
+	for i := range req.PriorityHigh {
+		req.PriorityHigh[i]++
+	}
+
+	if p.reject {
+		p.calls.add(p.name + ":reject")
+		return Reject("%s is not allowed", req.Torrent)
+	}
+	return p.hook("before")
+}
+
+func newTestRegistry(t *testing.T, plugins ...Plugin) (*tests.TestApp, *Registry, *torrent.Service) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	client := transmission.NewMockClient(testApp)
+	syncService := transmission.NewSyncService(testApp, client, 0)
+	auditService := audit.NewService(testApp)
+	torrents := torrent.NewService(&pocketbase.PocketBase{App: testApp}, client, syncService, auditService)
+
+	registry := NewRegistry(testApp, auditService)
+	for _, p := range plugins {
+		if err := registry.Register(p); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+	}
+	if err := registry.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	t.Cleanup(registry.Stop)
+	torrents.OnBeforeAdd(registry.BeforeAdd)
+
+	return testApp, registry, torrents
+}
+
+func enable(t *testing.T, registry *Registry, name string, priority int, config string) {
+	t.Helper()
+
+	enabled := true
+	raw := json.RawMessage(config)
+	if _, err := registry.Update(context.Background(), name, Params{Enabled: &enabled, Priority: &priority, Config: &raw}); err != nil {
+		t.Fatalf("Enabling %s failed: %v", name, err)
+	}
+}
+
+func event(eventType transmission.EventType, name string) transmission.Event {
+	return transmission.Event{Type: eventType, Torrent: transmission.TorrentData{Name: name}, Time: time.Now()}
+}
+
+func TestHooksRunInPriorityOrder(t *testing.T) {
+	log := &calls{}
+	first := &recorder{name: "first", calls: log}
+	second := &recorder{name: "second", calls: log}
+	disabled := &recorder{name: "disabled", calls: log}
+	_, registry, _ := newTestRegistry(t, second, first, disabled)
+
+	enable(t, registry, "second", 20, `{"dir":"/second"}`)
+	enable(t, registry, "first", 10, `{"dir":"/first"}`)
+
+	// Each plugin gets only its own config
+	if string(first.config) != `{"dir":"/first"}` || string(second.config) != `{"dir":"/second"}` || disabled.config != nil {
+		t.Errorf("Expected isolated configs, got %s, %s and %s", first.config, second.config, disabled.config)
+	}
+
+	req := torrent.AddTorrentRequest{Torrent: "magnet:?xt=urn:btih:abc"}
+	if err := registry.BeforeAdd(context.Background(), &req); err != nil {
+		t.Fatalf("BeforeAdd failed: %v", err)
+	}
+	if req.DownloadDir == nil || *req.DownloadDir != "/first/second" {
+		t.Errorf("Expected later plugins to see earlier rewrites, got %v", req.DownloadDir)
+	}
+
+	registry.HandleEvent(event(transmission.EventTorrentAdded, "a"))
+	registry.HandleEvent(event(transmission.EventTorrentError, "a"))
+	registry.HandleEvent(event(transmission.EventDownloadCompleted, "a"))
+	registry.HandleEvent(event(transmission.EventTorrentRemoved, "a"))
+	registry.pending.Wait()
+
+	expected := []string{
+		"first:before", "second:before",
+		"first:added:a", "second:added:a",
+		"first:completed:a", "second:completed:a",
+		"first:removed:a", "second:removed:a",
+	}
+	if got := log.list(); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected hooks in order %v, got %v", expected, got)
+	}
+
+	plugins, err := registry.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(plugins) != 3 || plugins[0].Name != "disabled" || plugins[1].Name != "first" || !plugins[1].Active || plugins[0].Active {
+		t.Errorf("Unexpected plugin list %+v", plugins)
+	}
+}
+
+func TestPluginErrorsAreIsolated(t *testing.T) {
+	log := &calls{}
+	panicking := &recorder{name: "panicking", calls: log, panics: true}
+	failing := &recorder{name: "failing", calls: log, failing: true}
+	healthy := &recorder{name: "healthy", calls: log}
+	testApp, registry, _ := newTestRegistry(t, panicking, failing, healthy)
+
+	enable(t, registry, "panicking", 1, `{"dir": "/panicking"}`)
+	enable(t, registry, "failing", 2, `{"dir": "/failing"}`)
+	enable(t, registry, "healthy", 3, `{"dir": "/healthy"}`)
+
+	// The broken plugins' rewrites, even those made in place, are discarded
+	// and the add goes ahead
+	req := torrent.AddTorrentRequest{Torrent: "magnet:?xt=urn:btih:abc", PriorityHigh: []int64{0}}
+	if err := registry.BeforeAdd(context.Background(), &req); err != nil {
+		t.Fatalf("Expected broken plugins not to reject the torrent, got %v", err)
+	}
+	if req.DownloadDir == nil || *req.DownloadDir != "/healthy" {
+		t.Errorf("Expected only the healthy rewrite, got %v", req.DownloadDir)
+	}
+	if len(req.PriorityHigh) != 1 || req.PriorityHigh[0] != 1 {
+		t.Errorf("Expected only the healthy plugin's priority change, got %v", req.PriorityHigh)
+	}
+
+	registry.HandleEvent(event(transmission.EventDownloadCompleted, "a"))
+	registry.pending.Wait()
+
+	if got := log.list(); len(got) != 6 || got[5] != "healthy:completed:a" {
+		t.Errorf("Expected every plugin to run despite earlier failures, got %v", got)
+	}
+
+	record, err := testApp.FindFirstRecordByData("plugins", "name", "panicking")
+	if err != nil {
+		t.Fatalf("Failed to find plugin record: %v", err)
+	}
+	if !strings.Contains(record.GetString("lastError"), "panic: boom") {
+		t.Errorf("Expected the panic to be recorded, got %q", record.GetString("lastError"))
+	}
+
+	// Rejected configs are not saved and leave the plugin as it was
+	raw := json.RawMessage(`{"invalid": true}`)
+	var validationErr ValidationError
+	if _, err := registry.Update(context.Background(), "healthy", Params{Config: &raw}); !errors.As(err, &validationErr) {
+		t.Errorf("Expected the invalid config to be rejected, got %v", err)
+	}
+	if healthy.dir != "/healthy" || !registry.isActive("healthy") {
+		t.Errorf("Expected the plugin to keep its config")
+	}
+}
+
+func TestRejectStopsAdd(t *testing.T) {
+	log := &calls{}
+	gate := &recorder{name: "gate", calls: log, reject: true}
+	later := &recorder{name: "later", calls: log}
+	testApp, registry, torrents := newTestRegistry(t, gate, later)
+
+	enable(t, registry, "gate", 1, `{}`)
+	enable(t, registry, "later", 2, `{}`)
+
+	_, err := torrents.AddTorrent(context.Background(), torrent.AddTorrentRequest{Torrent: "magnet:?xt=urn:btih:abc"})
+	var rejectErr RejectError
+	if !errors.As(err, &rejectErr) || rejectErr.Plugin != "gate" {
+		t.Fatalf("Expected the gate plugin to reject the torrent, got %v", err)
+	}
+	if got := log.list(); len(got) != 1 {
+		t.Errorf("Expected later plugins to be skipped after a rejection, got %v", got)
+	}
+
+	if records, err := testApp.FindAllRecords("torrents"); err != nil || len(records) != 0 {
+		t.Errorf("Expected nothing to be added, got %d torrents (%v)", len(records), err)
+	}
+
+	// Disabled plugins no longer run
+	disabled := false
+	if _, err := registry.Update(context.Background(), "gate", Params{Enabled: &disabled}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := torrents.AddTorrent(context.Background(), torrent.AddTorrentRequest{Torrent: "magnet:?xt=urn:btih:abc"}); err != nil {
+		t.Errorf("Expected the add to succeed without the gate, got %v", err)
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	registry := NewRegistry(nil, nil)
+
+	if err := registry.Register(&recorder{name: "one"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	for _, name := range []string{"one", "Bad Name", ""} {
+		if err := registry.Register(&recorder{name: name}); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package trackers is a built-in example plugin. It adds a configured list
+// of trackers to every magnet link before it is added, helping magnets that
+// come without trackers find peers, and lists the trackers at
+// GET /api/plugins/trackers.
+//
+// Config:
+//
+//	{"trackers": ["udp://tracker.example:1337/announce"], "rejectWithoutHash": true}
+package trackers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+
+	"backend/internal/plugin"
+	"backend/internal/torrent"
+)
+
+// Config is the config of the plugin.
+type Config struct {
+	Trackers []string `json:"trackers"`
+	// RejectWithoutHash refuses magnet links without a BitTorrent infohash
+	RejectWithoutHash bool `json:"rejectWithoutHash"`
+}
+
+// Plugin adds trackers to magnet links.
+type Plugin struct {
+	plugin.Base
+
+	mu     sync.RWMutex
+	config Config
+}
+
+// New constructs the plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// Name implements plugin.Plugin.
+func (p *Plugin) Name() string {
+	return "trackers"
+}
+
+// Configure implements plugin.Plugin.
+func (p *Plugin) Configure(raw json.RawMessage) error {
+	var config Config
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return fmt.Errorf("decode config: %w", err)
+	}
+
+	trackers := []string{}
+	for _, tracker := range config.Trackers {
+		tracker = strings.TrimSpace(tracker)
+		parsed, err := url.Parse(tracker)
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("invalid tracker %q", tracker)
+		}
+		switch parsed.Scheme {
+		case "http", "https", "udp", "wss":
+		default:
+			return fmt.Errorf("unsupported tracker scheme %q", parsed.Scheme)
+		}
+		trackers = append(trackers, tracker)
+	}
+	config.Trackers = trackers
+
+	p.mu.Lock()
+	p.config = config
+	p.mu.Unlock()
+	return nil
+}
+
+// BeforeAdd implements plugin.Plugin by appending the missing trackers to
+// magnet links. Torrent files are left alone.
+func (p *Plugin) BeforeAdd(_ context.Context, req *torrent.AddTorrentRequest) error {
+	if !strings.HasPrefix(req.Torrent, "magnet:?") {
+		return nil
+	}
+
+	p.mu.RLock()
+	config := p.config
+	p.mu.RUnlock()
+
+	params, err := url.ParseQuery(strings.TrimPrefix(req.Torrent, "magnet:?"))
+	if err != nil {
+		return plugin.Reject("invalid magnet link")
+	}
+
+	if config.RejectWithoutHash {
+		hasHash := false
+		for _, xt := range params["xt"] {
+			if strings.HasPrefix(xt, "urn:btih:") || strings.HasPrefix(xt, "urn:btmh:") {
+				hasHash = true
+			}
+		}
+		if !hasHash {
+			return plugin.Reject("magnet link has no infohash")
+		}
+	}
+
+	existing := map[string]struct{}{}
+	for _, tracker := range params["tr"] {
+		existing[tracker] = struct{}{}
+	}
+
+	magnet := req.Torrent
+	for _, tracker := range config.Trackers {
+		if _, ok := existing[tracker]; !ok {
+			magnet += "&tr=" + url.QueryEscape(tracker)
+		}
+	}
+	req.Torrent = magnet
+	return nil
+}
+
+// RegisterRoutes implements plugin.Plugin.
+func (p *Plugin) RegisterRoutes(group *router.RouterGroup[*core.RequestEvent]) {
+	group.Bind(apis.RequireAuth("users"))
+
+	group.GET("", func(re *core.RequestEvent) error {
+		p.mu.RLock()
+		trackers := append([]string{}, p.config.Trackers...)
+		p.mu.RUnlock()
+
+		return re.JSON(http.StatusOK, map[string]any{"trackers": trackers})
+	})
+}
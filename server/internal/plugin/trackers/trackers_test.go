@@ -0,0 +1,42 @@
+package trackers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"backend/internal/plugin"
+	"backend/internal/torrent"
+)
+
+func TestBeforeAddAppendsTrackers(t *testing.T) {
+	p := New()
+	if err := p.Configure(json.RawMessage(`{"trackers": ["udp://tracker.example:1337/announce", "https://tracker.example/announce"], "rejectWithoutHash": true}`)); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	req := torrent.AddTorrentRequest{Torrent: "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&tr=https%3A%2F%2Ftracker.example%2Fannounce"}
+	if err := p.BeforeAdd(context.Background(), &req); err != nil {
+		t.Fatalf("BeforeAdd failed: %v", err)
+	}
+	expected := "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&tr=https%3A%2F%2Ftracker.example%2Fannounce&tr=udp%3A%2F%2Ftracker.example%3A1337%2Fannounce"
+	if req.Torrent != expected {
+		t.Errorf("Expected only the missing tracker to be added, got %s", req.Torrent)
+	}
+
+	file := torrent.AddTorrentRequest{Torrent: "ZDQ6aW5mb2Vl"}
+	if err := p.BeforeAdd(context.Background(), &file); err != nil || file.Torrent != "ZDQ6aW5mb2Vl" {
+		t.Errorf("Expected torrent files to be left alone, got %s (%v)", file.Torrent, err)
+	}
+
+	var rejectErr plugin.RejectError
+	hashless := torrent.AddTorrentRequest{Torrent: "magnet:?dn=nothing"}
+	if err := p.BeforeAdd(context.Background(), &hashless); !errors.As(err, &rejectErr) {
+		t.Errorf("Expected magnets without an infohash to be rejected, got %v", err)
+	}
+
+	if err := p.Configure(json.RawMessage(`{"trackers": ["ftp://tracker.example"]}`)); err == nil {
+		t.Errorf("Expected unsupported trackers to be rejected")
+	}
+}
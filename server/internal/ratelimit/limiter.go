@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval controls how often idle entries are dropped from memory.
+const sweepInterval = time.Minute
+
+// Rule describes a token bucket: Burst requests at once, refilled at
+// PerMinute requests per minute.
+type Rule struct {
+	PerMinute float64
+	Burst     int
+}
+
+// Enabled reports whether the rule limits anything.
+func (r Rule) Enabled() bool {
+	return r.PerMinute > 0 && r.Burst > 0
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps an in-memory token bucket per key.
+type Limiter struct {
+	rule Rule
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter constructs a Limiter for the given rule.
+func NewLimiter(rule Rule) *Limiter {
+	return &Limiter{rule: rule, now: time.Now, buckets: map[string]*bucket{}}
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.rule.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	perSecond := l.rule.PerMinute / 60
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rule.Burst), updated: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens += now.Sub(b.updated).Seconds() * perSecond
+		if b.tokens > float64(l.rule.Burst) {
+			b.tokens = float64(l.rule.Burst)
+		}
+		b.updated = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that refilled completely; they behave like new ones.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(float64(l.rule.Burst) / (l.rule.PerMinute / 60) * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+type failures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// Lockout temporarily locks keys (accounts) after repeated failures within
+// a window.
+type Lockout struct {
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*failures
+	lastSweep time.Time
+}
+
+// NewLockout constructs a Lockout that locks a key for duration once it
+// failed threshold times within window. A threshold of 0 disables it.
+func NewLockout(threshold int, window, duration time.Duration) *Lockout {
+	return &Lockout{
+		threshold: threshold,
+		window:    window,
+		duration:  duration,
+		now:       time.Now,
+		entries:   map[string]*failures{},
+	}
+}
+
+// Locked returns how long key stays locked, or 0 if it isn't.
+func (l *Lockout) Locked(key string) time.Duration {
+	if l.threshold <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return 0
+	}
+
+	if remaining := entry.lockedUntil.Sub(l.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Fail records a failure for key. It returns the lock expiry when this
+// failure locked the key.
+func (l *Lockout) Fail(key string) (time.Time, bool) {
+	if l.threshold <= 0 {
+		return time.Time{}, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.first) > l.window {
+		entry = &failures{first: now}
+		l.entries[key] = entry
+	}
+
+	entry.count++
+	if entry.count < l.threshold {
+		return time.Time{}, false
+	}
+
+	entry.count = 0
+	entry.first = now
+	entry.lockedUntil = now.Add(l.duration)
+	return entry.lockedUntil, true
+}
+
+// Reset clears the failures of key, e.g. after a successful login.
+func (l *Lockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, entry := range l.entries {
+		if now.Sub(entry.first) > l.window && now.After(entry.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(Rule{PerMinute: 60, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("a"); !ok {
+			t.Fatalf("Expected request %d within the burst to pass", i+1)
+		}
+	}
+
+	ok, wait := limiter.Allow("a")
+	if ok || wait <= 0 || wait > time.Second {
+		t.Fatalf("Expected the empty bucket to ask for a wait up to 1s, got ok=%v wait=%v", ok, wait)
+	}
+
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Errorf("Expected other keys to have their own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Errorf("Expected a refilled token after a second")
+	}
+}
+
+func TestLockout(t *testing.T) {
+	now := time.Now()
+	lockout := NewLockout(3, time.Minute, 5*time.Minute)
+	lockout.now = func() time.Time { return now }
+
+	lockout.Fail("alice")
+	lockout.Fail("alice")
+	if lockout.Locked("alice") != 0 {
+		t.Fatalf("Expected no lock below the threshold")
+	}
+
+	// Failures outside the window start over
+	now = now.Add(2 * time.Minute)
+	lockout.Fail("alice")
+	lockout.Fail("alice")
+	if _, locked := lockout.Fail("alice"); !locked {
+		t.Fatalf("Expected the third failure within the window to lock")
+	}
+	if wait := lockout.Locked("alice"); wait != 5*time.Minute {
+		t.Errorf("Expected a 5m lock, got %v", wait)
+	}
+
+	now = now.Add(5 * time.Minute)
+	if lockout.Locked("alice") != 0 {
+		t.Errorf("Expected the lock to expire")
+	}
+}
+
+func newTestServer(t *testing.T, cfg Config) (*tests.TestApp, http.Handler) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	users, err := testApp.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+	users.MFA.Enabled = false
+	if err := testApp.Save(users); err != nil {
+		t.Fatalf("Failed to disable MFA: %v", err)
+	}
+
+	router, err := apis.NewRouter(testApp)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	se := &core.ServeEvent{App: testApp, Router: router}
+	Bind(se, cfg, audit.NewService(testApp))
+	se.Router.POST("/api/torrents/add", func(re *core.RequestEvent) error {
+		return re.NoContent(http.StatusNoContent)
+	})
+
+	mux, err := router.BuildMux()
+	if err != nil {
+		t.Fatalf("Failed to build router mux: %v", err)
+	}
+
+	return testApp, mux
+}
+
+func serve(handler http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	return serveFrom(handler, "192.0.2.1:1234", method, url, body)
+}
+
+func serveFrom(handler http.Handler, remoteAddr, method, url, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMutatingRoutesLimited(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Mutate = Rule{PerMinute: 1, Burst: 2}
+	_, handler := newTestServer(t, cfg)
+
+	for i := 0; i < 2; i++ {
+		if rec := serve(handler, http.MethodPost, "/api/torrents/add", "{}"); rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected request %d to pass, got %d", i+1, rec.Code)
+		}
+	}
+
+	rec := serve(handler, http.MethodPost, "/api/torrents/add", "{}")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+		t.Errorf("Expected a Retry-After header, got %q", retryAfter)
+	}
+}
+
+func TestFailedLoginsLockAccount(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Auth = Rule{PerMinute: 100, Burst: 100}
+	cfg.LockoutThreshold = 3
+	testApp, handler := newTestServer(t, cfg)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		return serve(handler, http.MethodPost, "/api/collections/users/auth-with-password",
+			`{"identity":"test@example.com","password":"`+password+`"}`)
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := login("wrong-password"); rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected failed login %d to be rejected with 400, got %d", i+1, rec.Code)
+		}
+	}
+
+	// The correct password is refused too while the account is locked
+	rec := login("1234567890")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected a 429 with Retry-After for the locked account, got %d", rec.Code)
+	}
+
+	// Other clients can still log in
+	rec = serveFrom(handler, "198.51.100.7:1234", http.MethodPost, "/api/collections/users/auth-with-password",
+		`{"identity":"test@example.com","password":"1234567890"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the owner to log in from another IP, got %d", rec.Code)
+	}
+
+	total, err := testApp.CountRecords("audit_log", dbx.HashExp{"action": audit.ActionAuthLockout})
+	if err != nil {
+		t.Fatalf("CountRecords failed: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("Expected 1 lockout audit entry, got %d", total)
+	}
+}
+
+func TestRejectedSecondFactorsCount(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Auth = Rule{PerMinute: 100, Burst: 100}
+	cfg.LockoutThreshold = 2
+	testApp, handler := newTestServer(t, cfg)
+
+	// Rejects the second factor the way the twofactor package does
+	testApp.OnRecordAuthRequest("users").BindFunc(func(e *core.RecordAuthRequestEvent) error {
+		return e.JSON(http.StatusUnauthorized, map[string]string{"code": "totp_invalid"})
+	})
+
+	for i := 0; i < 2; i++ {
+		if rec := serve(handler, http.MethodPost, "/api/collections/users/auth-with-password",
+			`{"identity":"test@example.com","password":"1234567890"}`); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected login %d to be rejected with 401, got %d", i+1, rec.Code)
+		}
+	}
+
+	if rec := serve(handler, http.MethodPost, "/api/collections/users/auth-with-password",
+		`{"identity":"test@example.com","password":"1234567890"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected rejected codes to lock the account, got %d", rec.Code)
+	}
+}
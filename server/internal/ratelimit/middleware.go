@@ -0,0 +1,256 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+
+	"backend/internal/audit"
+)
+
+const middlewareID = "retorrentRateLimit"
+
+// Route classes with their own limits.
+const (
+	classAuth   = "auth"
+	classMutate = "mutate"
+)
+
+// Config configures request rate limits and the account lockout.
+type Config struct {
+	Enabled bool
+	// Auth limits login, setup, invite and password routes.
+	Auth Rule
+	// Mutate limits all other API requests that change state.
+	Mutate Rule
+	// LockoutThreshold failed password logins from a client IP within
+	// LockoutWindow lock the account for that IP for LockoutDuration. 0
+	// disables the lockout.
+	LockoutThreshold int
+	LockoutWindow    time.Duration
+	LockoutDuration  time.Duration
+}
+
+// DefaultConfig returns the limits used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		Enabled:          true,
+		Auth:             Rule{PerMinute: 10, Burst: 10},
+		Mutate:           Rule{PerMinute: 120, Burst: 60},
+		LockoutThreshold: 5,
+		LockoutWindow:    15 * time.Minute,
+		LockoutDuration:  15 * time.Minute,
+	}
+}
+
+// ConfigFromEnv reads the limits from RATE_LIMIT_* and LOCKOUT_* environment
+// variables, falling back to DefaultConfig.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	if value := os.Getenv("RATE_LIMIT_ENABLED"); value != "" {
+		cfg.Enabled = value == "true"
+	}
+
+	var err error
+	if cfg.Auth.PerMinute, err = floatFromEnv("RATE_LIMIT_AUTH_PER_MINUTE", cfg.Auth.PerMinute); err != nil {
+		return cfg, err
+	}
+	if cfg.Auth.Burst, err = intFromEnv("RATE_LIMIT_AUTH_BURST", cfg.Auth.Burst); err != nil {
+		return cfg, err
+	}
+	if cfg.Mutate.PerMinute, err = floatFromEnv("RATE_LIMIT_MUTATE_PER_MINUTE", cfg.Mutate.PerMinute); err != nil {
+		return cfg, err
+	}
+	if cfg.Mutate.Burst, err = intFromEnv("RATE_LIMIT_MUTATE_BURST", cfg.Mutate.Burst); err != nil {
+		return cfg, err
+	}
+	if cfg.LockoutThreshold, err = intFromEnv("LOCKOUT_THRESHOLD", cfg.LockoutThreshold); err != nil {
+		return cfg, err
+	}
+	if cfg.LockoutWindow, err = durationFromEnv("LOCKOUT_WINDOW", cfg.LockoutWindow); err != nil {
+		return cfg, err
+	}
+	if cfg.LockoutDuration, err = durationFromEnv("LOCKOUT_DURATION", cfg.LockoutDuration); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func floatFromEnv(name string, fallback float64) (float64, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		return fallback, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+func intFromEnv(name string, fallback int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return fallback, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		return fallback, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+// classify returns the limit class of the request, or "" for requests that
+// aren't limited.
+func classify(re *core.RequestEvent) string {
+	path := re.Request.URL.Path
+	if !strings.HasPrefix(path, "/api/") {
+		return ""
+	}
+
+	switch re.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ""
+	}
+
+	if strings.HasPrefix(path, "/api/collections/") {
+		// PocketBase auth actions, e.g. /api/collections/users/auth-with-password
+		action := path[strings.LastIndex(path, "/")+1:]
+		if strings.HasPrefix(action, "auth-") || strings.HasPrefix(action, "request-") || strings.HasPrefix(action, "confirm-") {
+			return classAuth
+		}
+	}
+
+	if path == "/api/admin/setup" ||
+		path == "/api/me/password" ||
+		path == "/api/v2/auth/login" ||
+		strings.HasPrefix(path, "/api/me/2fa") ||
+		(strings.HasPrefix(path, "/api/invites/") && strings.HasSuffix(path, "/accept")) {
+		return classAuth
+	}
+
+	return classMutate
+}
+
+// tooManyRequests writes a 429 response with Retry-After in whole seconds.
+func tooManyRequests(re *core.RequestEvent, wait time.Duration, message string) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	re.Response.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	// Answer PocketBase's own routes in the error format its SDK understands
+	if strings.HasPrefix(re.Request.URL.Path, "/api/collections/") {
+		return re.TooManyRequestsError(message, nil)
+	}
+
+	return re.JSON(http.StatusTooManyRequests, map[string]string{"error": message})
+}
+
+// Bind limits auth and mutating API requests per client IP and per user, and
+// temporarily locks accounts for a client IP after repeated failed password
+// logins from it.
+func Bind(se *core.ServeEvent, cfg Config, auditService *audit.Service) {
+	if !cfg.Enabled {
+		return
+	}
+
+	limiters := map[string]*Limiter{
+		classAuth:   NewLimiter(cfg.Auth),
+		classMutate: NewLimiter(cfg.Mutate),
+	}
+
+	se.Router.Bind(&hook.Handler[*core.RequestEvent]{
+		Id: middlewareID,
+		// Run once the auth token is loaded so requests can be keyed by user
+		Priority: apis.DefaultLoadAuthTokenMiddlewarePriority + 3,
+		Func: func(re *core.RequestEvent) error {
+			class := classify(re)
+			if class == "" {
+				return re.Next()
+			}
+
+			keys := []string{class + ":ip:" + re.RealIP()}
+			if re.Auth != nil {
+				keys = append(keys, class+":user:"+re.Auth.Collection().Name+":"+re.Auth.Id)
+			}
+
+			for _, key := range keys {
+				if ok, wait := limiters[class].Allow(key); !ok {
+					return tooManyRequests(re, wait, "too many requests, please try again later")
+				}
+			}
+
+			return re.Next()
+		},
+	})
+
+	lockout := NewLockout(cfg.LockoutThreshold, cfg.LockoutWindow, cfg.LockoutDuration)
+
+	se.App.OnRecordAuthWithPasswordRequest().BindFunc(func(e *core.RecordAuthWithPasswordRequestEvent) error {
+		// Failures are counted per client IP, so others guessing an
+		// account's password can't lock its owner out
+		key := e.Collection.Name + ":" + strings.ToLower(strings.TrimSpace(e.Identity)) + ":" + e.RealIP()
+
+		if wait := lockout.Locked(key); wait > 0 {
+			return tooManyRequests(e.RequestEvent, wait, "account temporarily locked after too many failed logins")
+		}
+
+		err := e.Next()
+
+		// MFA challenges aren't failures, the password was correct. Rejected
+		// two-factor codes are answered without an error, so the status
+		// tells them apart from successful logins.
+		if errors.Is(err, apis.ErrMFA) || (err == nil && e.Status() < http.StatusBadRequest) {
+			if e.Status() == http.StatusOK {
+				lockout.Reset(key)
+			}
+			return err
+		}
+
+		if lockedUntil, locked := lockout.Fail(key); locked {
+			entry := audit.Entry{
+				Action: audit.ActionAuthLockout,
+				Details: map[string]any{
+					"collection":  e.Collection.Name,
+					"identity":    e.Identity,
+					"lockedUntil": lockedUntil.UTC().Format(time.RFC3339),
+				},
+			}
+			if e.Record != nil && e.Collection.Name == "users" {
+				entry.Targets = []string{e.Record.Id}
+			}
+			auditService.Record(audit.WithActor(e.Request.Context(), audit.Actor{IP: e.RealIP()}), entry)
+		}
+
+		return err
+	})
+}
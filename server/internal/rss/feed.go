@@ -0,0 +1,246 @@
+// Package rss downloads torrents from RSS and Atom feeds according to
+// admin-defined filter rules.
+package rss
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Item is a torrent offered by a feed.
+type Item struct {
+	// GUID identifies the item within its feed; the link is used when the
+	// feed has no ids
+	GUID  string `json:"guid"`
+	Title string `json:"title"`
+	// Link is a magnet link or the URL of a .torrent file
+	Link string `json:"link"`
+	// Size is the content size in bytes, 0 when the feed doesn't say
+	Size      int64     `json:"size"`
+	Published time.Time `json:"published,omitempty"`
+}
+
+// rssDocument covers RSS 2.0 including the common torrent extensions
+type rssDocument struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	GUID      string `xml:"guid"`
+	PubDate   string `xml:"pubDate"`
+	Enclosure *struct {
+		URL    string `xml:"url,attr"`
+		Length string `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	// http://xmlns.ezrss.it/0.1/ as used by many trackers
+	MagnetURI     string `xml:"magnetURI"`
+	ContentLength string `xml:"contentLength"`
+	// Torznab and Newznab attributes, e.g. <torznab:attr name="size" value="..."/>
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+	// nyaa:size style human readable sizes
+	Size string `xml:"size"`
+}
+
+type atomDocument struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string `xml:"title"`
+	ID        string `xml:"id"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+	Links     []struct {
+		Href   string `xml:"href,attr"`
+		Rel    string `xml:"rel,attr"`
+		Type   string `xml:"type,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"link"`
+}
+
+// ParseFeed reads the items of an RSS 2.0 or Atom document. Items without a
+// link are left out.
+func ParseFeed(data []byte) ([]Item, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Feeds commonly declare encodings like ISO-8859-1; titles are matched
+	// with regular expressions, so passing the bytes through is good enough
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("parse feed: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "rss":
+			var doc rssDocument
+			if err := decoder.DecodeElement(&doc, &start); err != nil {
+				return nil, fmt.Errorf("parse rss feed: %w", err)
+			}
+			return rssItems(doc), nil
+		case "feed":
+			var doc atomDocument
+			if err := decoder.DecodeElement(&doc, &start); err != nil {
+				return nil, fmt.Errorf("parse atom feed: %w", err)
+			}
+			return atomItems(doc), nil
+		default:
+			return nil, errors.New("not an RSS or Atom feed")
+		}
+	}
+}
+
+func rssItems(doc rssDocument) []Item {
+	items := make([]Item, 0, len(doc.Channel.Items))
+	for _, entry := range doc.Channel.Items {
+		item := Item{Title: strings.TrimSpace(entry.Title)}
+
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(entry.MagnetURI), "magnet:"):
+			item.Link = strings.TrimSpace(entry.MagnetURI)
+		case entry.Enclosure != nil && isTorrentLink(entry.Enclosure.URL, entry.Enclosure.Type):
+			item.Link = strings.TrimSpace(entry.Enclosure.URL)
+		case isTorrentLink(entry.Link, ""):
+			item.Link = strings.TrimSpace(entry.Link)
+		case entry.Enclosure != nil:
+			item.Link = strings.TrimSpace(entry.Enclosure.URL)
+		default:
+			item.Link = strings.TrimSpace(entry.Link)
+		}
+
+		item.Size = parseSize(entry.ContentLength)
+		for _, attr := range entry.Attrs {
+			if item.Size == 0 && attr.Name == "size" {
+				item.Size = parseSize(attr.Value)
+			}
+		}
+		if item.Size == 0 && entry.Enclosure != nil {
+			item.Size = parseSize(entry.Enclosure.Length)
+		}
+		if item.Size == 0 {
+			item.Size = parseSize(entry.Size)
+		}
+
+		item.GUID = strings.TrimSpace(entry.GUID)
+		if item.GUID == "" {
+			item.GUID = item.Link
+		}
+		item.Published = parseTime(entry.PubDate)
+
+		if item.Link != "" && item.GUID != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func atomItems(doc atomDocument) []Item {
+	items := make([]Item, 0, len(doc.Entries))
+	for _, entry := range doc.Entries {
+		item := Item{Title: strings.TrimSpace(entry.Title), GUID: strings.TrimSpace(entry.ID)}
+
+		for _, link := range entry.Links {
+			if isTorrentLink(link.Href, link.Type) || (link.Rel == "enclosure" && item.Link == "") {
+				item.Link = strings.TrimSpace(link.Href)
+				item.Size = parseSize(link.Length)
+				if isTorrentLink(link.Href, link.Type) {
+					break
+				}
+			}
+		}
+		if item.Link == "" && len(entry.Links) > 0 {
+			item.Link = strings.TrimSpace(entry.Links[0].Href)
+		}
+
+		if item.GUID == "" {
+			item.GUID = item.Link
+		}
+		item.Published = parseTime(entry.Published)
+		if item.Published.IsZero() {
+			item.Published = parseTime(entry.Updated)
+		}
+
+		if item.Link != "" && item.GUID != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func isTorrentLink(link, mimeType string) bool {
+	link = strings.TrimSpace(link)
+	if strings.HasPrefix(link, "magnet:") || mimeType == "application/x-bittorrent" {
+		return true
+	}
+	path, _, _ := strings.Cut(link, "?")
+	return strings.HasSuffix(strings.ToLower(path), ".torrent")
+}
+
+var sizeUnits = map[string]float64{
+	"b":   1,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": 1 << 40,
+}
+
+// parseSize reads byte counts as well as human readable sizes like "1.4 GiB"
+func parseSize(value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return size
+	}
+
+	number := strings.TrimRightFunc(value, func(r rune) bool {
+		return r == ' ' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	})
+	unit := strings.ToLower(strings.TrimSpace(value[len(number):]))
+	factor, ok := sizeUnits[unit]
+	if !ok {
+		return 0
+	}
+	size, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(size * factor)
+}
+
+func parseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
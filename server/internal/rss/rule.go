@@ -0,0 +1,127 @@
+package rss
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Rule is a compiled auto-download rule.
+type Rule struct {
+	ID      string
+	Name    string
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+	minSize int64
+	maxSize int64
+	// episodeDedupe grabs every episode only once
+	episodeDedupe bool
+	// feeds the rule applies to; empty means every feed
+	feeds       map[string]struct{}
+	downloadDir string
+	owner       string
+	addPaused   bool
+}
+
+// compilePattern compiles a title pattern, matching case-insensitively
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// ruleFromRecord compiles an rss_rules record
+func ruleFromRecord(record *core.Record) (*Rule, error) {
+	include, err := compilePattern(record.GetString("include"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	exclude, err := compilePattern(record.GetString("exclude"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+
+	feeds := map[string]struct{}{}
+	for _, id := range record.GetStringSlice("feeds") {
+		feeds[id] = struct{}{}
+	}
+
+	return &Rule{
+		ID:            record.Id,
+		Name:          record.GetString("name"),
+		include:       include,
+		exclude:       exclude,
+		minSize:       int64(record.GetInt("minSize")),
+		maxSize:       int64(record.GetInt("maxSize")),
+		episodeDedupe: record.GetBool("episodeDedupe"),
+		feeds:         feeds,
+		downloadDir:   record.GetString("downloadDir"),
+		owner:         record.GetString("owner"),
+		addPaused:     record.GetBool("addPaused"),
+	}, nil
+}
+
+// AppliesTo reports whether the rule watches a feed.
+func (r *Rule) AppliesTo(feedID string) bool {
+	if len(r.feeds) == 0 {
+		return true
+	}
+	_, ok := r.feeds[feedID]
+	return ok
+}
+
+// Match checks an item against the title patterns and size bounds. When the
+// item doesn't match, the reason says why.
+func (r *Rule) Match(item Item) (bool, string) {
+	if r.include != nil && !r.include.MatchString(item.Title) {
+		return false, "does not match the include pattern"
+	}
+	if r.exclude != nil && r.exclude.MatchString(item.Title) {
+		return false, "matches the exclude pattern"
+	}
+
+	if r.minSize > 0 || r.maxSize > 0 {
+		// Without a size the bounds can't be honoured, so play it safe
+		if item.Size <= 0 {
+			return false, "size unknown"
+		}
+		if r.minSize > 0 && item.Size < r.minSize {
+			return false, "smaller than the minimum size"
+		}
+		if r.maxSize > 0 && item.Size > r.maxSize {
+			return false, "larger than the maximum size"
+		}
+	}
+
+	return true, ""
+}
+
+var episodePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bs(\d{1,3})[ ._-]?e(\d{1,4})`),
+	regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`),
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// EpisodeKey returns a normalized "show|s01e02" key for titles naming an
+// episode, or an empty string. Releases of the same episode in different
+// qualities share a key.
+func EpisodeKey(title string) string {
+	for _, pattern := range episodePatterns {
+		match := pattern.FindStringSubmatchIndex(title)
+		if match == nil {
+			continue
+		}
+
+		season, _ := strconv.Atoi(title[match[2]:match[3]])
+		episode, _ := strconv.Atoi(title[match[4]:match[5]])
+		show := strings.TrimSpace(nonAlphanumeric.ReplaceAllString(strings.ToLower(title[:match[0]]), " "))
+
+		return fmt.Sprintf("%s|s%02de%02d", show, season, episode)
+	}
+	return ""
+}
@@ -0,0 +1,1011 @@
+package rss
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+	"backend/internal/metainfo"
+	"backend/internal/torrent"
+)
+
+// Item statuses stored in the rss_items collection.
+const (
+	StatusSkipped = "skipped"
+	StatusAdded   = "added"
+	StatusFailed  = "failed"
+)
+
+const (
+	defaultInterval = 30
+	minInterval     = 5
+	requestTimeout  = 30 * time.Second
+	maxFeedSize     = 5 << 20
+	maxTorrentSize  = 10 << 20
+	maxErrorLength  = 1000
+	defaultLogLimit = 50
+	maxLogLimit     = 500
+)
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// FetchError indicates that a feed could not be downloaded or parsed.
+type FetchError struct {
+	Message string
+}
+
+func (e FetchError) Error() string {
+	return e.Message
+}
+
+// FeedResponse represents a feed as exposed by the API.
+type FeedResponse struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	Interval      int    `json:"interval"`
+	Enabled       bool   `json:"enabled"`
+	LastCheckedAt string `json:"lastCheckedAt,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
+	Created       string `json:"created"`
+	Updated       string `json:"updated"`
+}
+
+// FeedParams holds the fields of a feed to create or update. Nil fields are
+// left untouched on update.
+type FeedParams struct {
+	Name *string `json:"name"`
+	URL  *string `json:"url"`
+	// Interval is the number of minutes between polls
+	Interval *int  `json:"interval"`
+	Enabled  *bool `json:"enabled"`
+}
+
+// RuleResponse represents a rule as exposed by the API.
+type RuleResponse struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Feeds         []string `json:"feeds"`
+	Include       string   `json:"include"`
+	Exclude       string   `json:"exclude"`
+	MinSize       int64    `json:"minSize"`
+	MaxSize       int64    `json:"maxSize"`
+	EpisodeDedupe bool     `json:"episodeDedupe"`
+	DownloadDir   string   `json:"downloadDir"`
+	Owner         string   `json:"owner"`
+	AddPaused     bool     `json:"addPaused"`
+	Enabled       bool     `json:"enabled"`
+	LastMatchAt   string   `json:"lastMatchAt,omitempty"`
+	Created       string   `json:"created"`
+	Updated       string   `json:"updated"`
+}
+
+// RuleParams holds the fields of a rule to create or update. Nil fields are
+// left untouched on update.
+type RuleParams struct {
+	Name *string `json:"name"`
+	// Feeds limits the rule to some feeds; empty means every feed
+	Feeds *[]string `json:"feeds"`
+	// Include and Exclude are case-insensitive regular expressions
+	Include *string `json:"include"`
+	Exclude *string `json:"exclude"`
+	// MinSize and MaxSize are in bytes; 0 means unbounded
+	MinSize       *int64  `json:"minSize"`
+	MaxSize       *int64  `json:"maxSize"`
+	EpisodeDedupe *bool   `json:"episodeDedupe"`
+	DownloadDir   *string `json:"downloadDir"`
+	Owner         *string `json:"owner"`
+	AddPaused     *bool   `json:"addPaused"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// ItemResponse represents a seen feed item.
+type ItemResponse struct {
+	ID      string `json:"id"`
+	Feed    string `json:"feed"`
+	GUID    string `json:"guid"`
+	Title   string `json:"title"`
+	Link    string `json:"link"`
+	Size    int64  `json:"size"`
+	Rule    string `json:"rule,omitempty"`
+	Episode string `json:"episode,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Created string `json:"created"`
+}
+
+// CheckResult summarizes a poll of a feed.
+type CheckResult struct {
+	Items  int `json:"items"`
+	New    int `json:"new"`
+	Added  int `json:"added"`
+	Failed int `json:"failed"`
+}
+
+// DryRunItem tells what a rule would do with a feed item.
+type DryRunItem struct {
+	Feed     string `json:"feed"`
+	FeedName string `json:"feedName"`
+	Item
+	Episode   string `json:"episode,omitempty"`
+	Matched   bool   `json:"matched"`
+	Seen      bool   `json:"seen"`
+	WouldGrab bool   `json:"wouldGrab"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Service manages feeds and rules and polls the feeds for new torrents.
+type Service struct {
+	app      core.App
+	torrents *torrent.Service
+	audit    *audit.Service
+	client   *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// polling keeps scheduled polls from overlapping
+	polling sync.Mutex
+}
+
+// NewService constructs a Service instance.
+func NewService(app core.App, torrentService *torrent.Service, auditService *audit.Service) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		app:      app,
+		torrents: torrentService,
+		audit:    auditService,
+		client:   &http.Client{Timeout: requestTimeout},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Stop aborts a running poll and waits for it to return.
+func (s *Service) Stop() {
+	s.cancel()
+	s.polling.Lock()
+	defer s.polling.Unlock()
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
+
+func feedInterval(record *core.Record) int {
+	if interval := record.GetInt("interval"); interval > 0 {
+		return interval
+	}
+	return defaultInterval
+}
+
+func mapFeedRecord(record *core.Record) FeedResponse {
+	return FeedResponse{
+		ID:            record.Id,
+		Name:          record.GetString("name"),
+		URL:           record.GetString("url"),
+		Interval:      feedInterval(record),
+		Enabled:       record.GetBool("enabled"),
+		LastCheckedAt: formatDate(record, "lastCheckedAt"),
+		LastError:     record.GetString("lastError"),
+		Created:       formatDate(record, "created"),
+		Updated:       formatDate(record, "updated"),
+	}
+}
+
+func mapRuleRecord(record *core.Record) RuleResponse {
+	feeds := record.GetStringSlice("feeds")
+	if feeds == nil {
+		feeds = []string{}
+	}
+
+	return RuleResponse{
+		ID:            record.Id,
+		Name:          record.GetString("name"),
+		Feeds:         feeds,
+		Include:       record.GetString("include"),
+		Exclude:       record.GetString("exclude"),
+		MinSize:       int64(record.GetInt("minSize")),
+		MaxSize:       int64(record.GetInt("maxSize")),
+		EpisodeDedupe: record.GetBool("episodeDedupe"),
+		DownloadDir:   record.GetString("downloadDir"),
+		Owner:         record.GetString("owner"),
+		AddPaused:     record.GetBool("addPaused"),
+		Enabled:       record.GetBool("enabled"),
+		LastMatchAt:   formatDate(record, "lastMatchAt"),
+		Created:       formatDate(record, "created"),
+		Updated:       formatDate(record, "updated"),
+	}
+}
+
+func mapItemRecord(record *core.Record) ItemResponse {
+	return ItemResponse{
+		ID:      record.Id,
+		Feed:    record.GetString("feed"),
+		GUID:    record.GetString("guid"),
+		Title:   record.GetString("title"),
+		Link:    record.GetString("link"),
+		Size:    int64(record.GetInt("size")),
+		Rule:    record.GetString("rule"),
+		Episode: record.GetString("episode"),
+		Status:  record.GetString("status"),
+		Error:   record.GetString("error"),
+		Created: formatDate(record, "created"),
+	}
+}
+
+// ListFeeds returns all feeds.
+func (s *Service) ListFeeds() ([]FeedResponse, error) {
+	records, err := s.app.FindRecordsByFilter("rss_feeds", "", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find feeds: %w", err)
+	}
+
+	feeds := make([]FeedResponse, 0, len(records))
+	for _, record := range records {
+		feeds = append(feeds, mapFeedRecord(record))
+	}
+	return feeds, nil
+}
+
+// CreateFeed adds a feed. Feeds are enabled unless stated otherwise.
+func (s *Service) CreateFeed(ctx context.Context, params FeedParams) (FeedResponse, error) {
+	collection, err := s.app.FindCollectionByNameOrId("rss_feeds")
+	if err != nil {
+		return FeedResponse{}, fmt.Errorf("find rss_feeds collection: %w", err)
+	}
+
+	if params.Name == nil || params.URL == nil {
+		return FeedResponse{}, ValidationError{Message: "name and url are required"}
+	}
+	if params.Enabled == nil {
+		enabled := true
+		params.Enabled = &enabled
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("interval", defaultInterval)
+	if err := applyFeedParams(record, params); err != nil {
+		return FeedResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return FeedResponse{}, fmt.Errorf("save feed: %w", err)
+	}
+
+	response := mapFeedRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionRSSFeedCreate,
+		Targets: []string{record.Id},
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// UpdateFeed changes a feed.
+func (s *Service) UpdateFeed(ctx context.Context, id string, params FeedParams) (FeedResponse, error) {
+	record, err := s.findRecord("rss_feeds", id, "feed")
+	if err != nil {
+		return FeedResponse{}, err
+	}
+
+	before := mapFeedRecord(record)
+	if err := applyFeedParams(record, params); err != nil {
+		return FeedResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return FeedResponse{}, fmt.Errorf("save feed: %w", err)
+	}
+
+	response := mapFeedRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionRSSFeedUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// DeleteFeed removes a feed together with its seen items. Rules that only
+// watched this feed are disabled rather than left watching every feed.
+func (s *Service) DeleteFeed(ctx context.Context, id string) error {
+	record, err := s.findRecord("rss_feeds", id, "feed")
+	if err != nil {
+		return err
+	}
+
+	rules, err := s.app.FindRecordsByFilter("rss_rules", "feeds ~ {:feed}", "", 0, 0, dbx.Params{"feed": id})
+	if err != nil {
+		return fmt.Errorf("find rules of feed: %w", err)
+	}
+
+	before := mapFeedRecord(record)
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		for _, rule := range rules {
+			if feeds := rule.GetStringSlice("feeds"); len(feeds) == 1 && feeds[0] == id {
+				rule.Set("enabled", false)
+				if err := txApp.Save(rule); err != nil {
+					return err
+				}
+			}
+		}
+		return txApp.Delete(record)
+	})
+	if err != nil {
+		return fmt.Errorf("delete feed: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionRSSFeedDelete,
+		Targets: []string{id},
+		Before:  before,
+	})
+
+	return nil
+}
+
+// Items returns the most recently seen items of a feed.
+func (s *Service) Items(feedID string, limit int) ([]ItemResponse, error) {
+	if _, err := s.findRecord("rss_feeds", feedID, "feed"); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	records, err := s.app.FindRecordsByFilter("rss_items", "feed = {:feed}", "-created", limit, 0, dbx.Params{"feed": feedID})
+	if err != nil {
+		return nil, fmt.Errorf("find feed items: %w", err)
+	}
+
+	items := make([]ItemResponse, 0, len(records))
+	for _, record := range records {
+		items = append(items, mapItemRecord(record))
+	}
+	return items, nil
+}
+
+// ListRules returns all rules.
+func (s *Service) ListRules() ([]RuleResponse, error) {
+	records, err := s.app.FindRecordsByFilter("rss_rules", "", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find rules: %w", err)
+	}
+
+	rules := make([]RuleResponse, 0, len(records))
+	for _, record := range records {
+		rules = append(rules, mapRuleRecord(record))
+	}
+	return rules, nil
+}
+
+// CreateRule adds a rule. Rules are enabled unless stated otherwise.
+func (s *Service) CreateRule(ctx context.Context, params RuleParams) (RuleResponse, error) {
+	collection, err := s.app.FindCollectionByNameOrId("rss_rules")
+	if err != nil {
+		return RuleResponse{}, fmt.Errorf("find rss_rules collection: %w", err)
+	}
+
+	if params.Name == nil {
+		return RuleResponse{}, ValidationError{Message: "name is required"}
+	}
+	if params.Enabled == nil {
+		enabled := true
+		params.Enabled = &enabled
+	}
+
+	record := core.NewRecord(collection)
+	if err := s.applyRuleParams(record, params); err != nil {
+		return RuleResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return RuleResponse{}, fmt.Errorf("save rule: %w", err)
+	}
+
+	response := mapRuleRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionRSSRuleCreate,
+		Targets: []string{record.Id},
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// UpdateRule changes a rule.
+func (s *Service) UpdateRule(ctx context.Context, id string, params RuleParams) (RuleResponse, error) {
+	record, err := s.findRecord("rss_rules", id, "rule")
+	if err != nil {
+		return RuleResponse{}, err
+	}
+
+	before := mapRuleRecord(record)
+	if err := s.applyRuleParams(record, params); err != nil {
+		return RuleResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return RuleResponse{}, fmt.Errorf("save rule: %w", err)
+	}
+
+	response := mapRuleRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionRSSRuleUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// DeleteRule removes a rule.
+func (s *Service) DeleteRule(ctx context.Context, id string) error {
+	record, err := s.findRecord("rss_rules", id, "rule")
+	if err != nil {
+		return err
+	}
+
+	before := mapRuleRecord(record)
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete rule: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionRSSRuleDelete,
+		Targets: []string{id},
+		Before:  before,
+	})
+
+	return nil
+}
+
+func (s *Service) findRecord(collection, id, label string) (*core.Record, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ValidationError{Message: label + " id is required"}
+	}
+
+	record, err := s.app.FindRecordById(collection, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: label + " not found"}
+		}
+		return nil, fmt.Errorf("find %s: %w", label, err)
+	}
+	return record, nil
+}
+
+// applyFeedParams validates params and sets them on record
+func applyFeedParams(record *core.Record, params FeedParams) error {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" {
+			return ValidationError{Message: "name cannot be empty"}
+		}
+		record.Set("name", name)
+	}
+
+	if params.URL != nil {
+		parsed, err := url.Parse(strings.TrimSpace(*params.URL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return ValidationError{Message: "url must be an http or https URL"}
+		}
+		record.Set("url", parsed.String())
+	}
+
+	if params.Interval != nil {
+		if *params.Interval < minInterval {
+			return ValidationError{Message: fmt.Sprintf("interval must be at least %d minutes", minInterval)}
+		}
+		record.Set("interval", *params.Interval)
+	}
+
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	return nil
+}
+
+// applyRuleParams validates params and sets them on record
+func (s *Service) applyRuleParams(record *core.Record, params RuleParams) error {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" {
+			return ValidationError{Message: "name cannot be empty"}
+		}
+		record.Set("name", name)
+	}
+
+	if params.Feeds != nil {
+		feeds := make([]string, 0, len(*params.Feeds))
+		for _, id := range *params.Feeds {
+			if _, err := s.findRecord("rss_feeds", id, "feed"); err != nil {
+				var notFoundErr NotFoundError
+				if errors.As(err, &notFoundErr) {
+					return ValidationError{Message: fmt.Sprintf("feed %s not found", id)}
+				}
+				return err
+			}
+			feeds = append(feeds, id)
+		}
+		record.Set("feeds", feeds)
+	}
+
+	for field, value := range map[string]*string{"include": params.Include, "exclude": params.Exclude} {
+		if value == nil {
+			continue
+		}
+		if _, err := compilePattern(*value); err != nil {
+			return ValidationError{Message: fmt.Sprintf("invalid %s pattern: %v", field, err)}
+		}
+		record.Set(field, strings.TrimSpace(*value))
+	}
+
+	if params.MinSize != nil {
+		if *params.MinSize < 0 {
+			return ValidationError{Message: "minSize cannot be negative"}
+		}
+		record.Set("minSize", *params.MinSize)
+	}
+	if params.MaxSize != nil {
+		if *params.MaxSize < 0 {
+			return ValidationError{Message: "maxSize cannot be negative"}
+		}
+		record.Set("maxSize", *params.MaxSize)
+	}
+	if minSize, maxSize := record.GetInt("minSize"), record.GetInt("maxSize"); maxSize > 0 && minSize > maxSize {
+		return ValidationError{Message: "minSize cannot exceed maxSize"}
+	}
+
+	if params.EpisodeDedupe != nil {
+		record.Set("episodeDedupe", *params.EpisodeDedupe)
+	}
+
+	if params.DownloadDir != nil {
+		record.Set("downloadDir", strings.TrimSpace(*params.DownloadDir))
+	}
+
+	if params.Owner != nil {
+		owner := strings.TrimSpace(*params.Owner)
+		if owner != "" {
+			if _, err := s.app.FindRecordById("users", owner); err != nil {
+				return ValidationError{Message: "owner not found"}
+			}
+		}
+		record.Set("owner", owner)
+	}
+
+	if params.AddPaused != nil {
+		record.Set("addPaused", *params.AddPaused)
+	}
+
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	return nil
+}
+
+// fetch downloads a URL with a size limit
+func (s *Service) fetch(ctx context.Context, target string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Retorrent")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("responded with %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return data, nil
+}
+
+func (s *Service) fetchFeed(ctx context.Context, feed *core.Record) ([]Item, error) {
+	data, err := s.fetch(ctx, feed.GetString("url"), maxFeedSize)
+	if err != nil {
+		return nil, FetchError{Message: fmt.Sprintf("fetch feed %s: %v", feed.GetString("name"), err)}
+	}
+
+	items, err := ParseFeed(data)
+	if err != nil {
+		return nil, FetchError{Message: fmt.Sprintf("feed %s: %v", feed.GetString("name"), err)}
+	}
+	return items, nil
+}
+
+// rulesFor returns the enabled rules watching a feed
+func (s *Service) rulesFor(feedID string) ([]*Rule, error) {
+	records, err := s.app.FindRecordsByFilter("rss_rules", "enabled = true", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find rules: %w", err)
+	}
+
+	rules := make([]*Rule, 0, len(records))
+	for _, record := range records {
+		rule, err := ruleFromRecord(record)
+		if err != nil {
+			log.Printf("[RSS] Skipping rule %s: %v", record.GetString("name"), err)
+			continue
+		}
+		if rule.AppliesTo(feedID) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (s *Service) seen(feedID, guid string) (bool, error) {
+	_, err := s.app.FindFirstRecordByFilter("rss_items", "feed = {:feed} && guid = {:guid}", dbx.Params{"feed": feedID, "guid": guid})
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *Service) episodeGrabbed(ruleID, episode string) (bool, error) {
+	_, err := s.app.FindFirstRecordByFilter("rss_items", "rule = {:rule} && episode = {:episode} && status = {:status}",
+		dbx.Params{"rule": ruleID, "episode": episode, "status": StatusAdded})
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return false, err
+}
+
+// evaluate picks the first rule that would grab an item. grabbed holds
+// episodes grabbed earlier in the same run, keyed by rule and episode.
+func (s *Service) evaluate(rules []*Rule, item Item, episode string, grabbed map[string]bool) (*Rule, string, error) {
+	reason := "no rule matches"
+	if len(rules) == 0 {
+		reason = "no enabled rule watches this feed"
+	}
+
+	for _, rule := range rules {
+		ok, why := rule.Match(item)
+		if !ok {
+			if len(rules) == 1 {
+				reason = why
+			}
+			continue
+		}
+
+		if rule.episodeDedupe && episode != "" {
+			duplicate := grabbed[rule.ID+"|"+episode]
+			if !duplicate {
+				var err error
+				if duplicate, err = s.episodeGrabbed(rule.ID, episode); err != nil {
+					return nil, "", err
+				}
+			}
+			if duplicate {
+				reason = "episode already grabbed"
+				continue
+			}
+		}
+
+		return rule, "", nil
+	}
+
+	return nil, reason, nil
+}
+
+// torrentSource turns an item link into what AddTorrent accepts: magnet
+// links as they are, .torrent files base64 encoded
+func (s *Service) torrentSource(ctx context.Context, link string) (string, error) {
+	if strings.HasPrefix(link, "magnet:") {
+		return link, nil
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", fmt.Errorf("unsupported link %q", link)
+	}
+
+	data, err := s.fetch(ctx, link, maxTorrentSize)
+	if err != nil {
+		return "", fmt.Errorf("download torrent file: %w", err)
+	}
+	source, err := metainfo.Encode(data)
+	if err != nil {
+		return "", fmt.Errorf("link did not return a torrent file: %w", err)
+	}
+
+	return source, nil
+}
+
+// grab adds the torrent of an item on behalf of the rule's owner
+func (s *Service) grab(ctx context.Context, rule *Rule, item Item) error {
+	source, err := s.torrentSource(ctx, item.Link)
+	if err != nil {
+		return err
+	}
+
+	autoStart := !rule.addPaused
+	req := torrent.AddTorrentRequest{
+		Torrent:   source,
+		AutoStart: &autoStart,
+		UserID:    rule.owner,
+	}
+	if rule.downloadDir != "" {
+		downloadDir := rule.downloadDir
+		req.DownloadDir = &downloadDir
+	}
+
+	ctx = audit.WithActor(ctx, audit.Actor{UserID: rule.owner})
+	if _, err := s.torrents.AddTorrent(ctx, req); err != nil {
+		return err
+	}
+
+	if record, err := s.app.FindRecordById("rss_rules", rule.ID); err == nil {
+		record.Set("lastMatchAt", time.Now())
+		if err := s.app.Save(record); err != nil {
+			log.Printf("[RSS] Failed to update rule %s: %v", rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) saveItem(feedID string, item Item, rule *Rule, episode, status string, itemErr error) error {
+	collection, err := s.app.FindCollectionByNameOrId("rss_items")
+	if err != nil {
+		return fmt.Errorf("find rss_items collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("feed", feedID)
+	record.Set("guid", truncate(item.GUID, 2000))
+	record.Set("title", truncate(item.Title, 1000))
+	record.Set("link", truncate(item.Link, 5000))
+	record.Set("size", item.Size)
+	record.Set("episode", truncate(episode, 500))
+	record.Set("status", status)
+	if rule != nil {
+		record.Set("rule", rule.ID)
+	}
+	if itemErr != nil {
+		record.Set("error", truncate(itemErr.Error(), maxErrorLength))
+	}
+
+	return s.app.Save(record)
+}
+
+// CheckFeed polls a feed right away, grabbing new items that match a rule.
+func (s *Service) CheckFeed(ctx context.Context, id string) (CheckResult, error) {
+	feed, err := s.findRecord("rss_feeds", id, "feed")
+	if err != nil {
+		return CheckResult{}, err
+	}
+	return s.check(ctx, feed)
+}
+
+func (s *Service) check(ctx context.Context, feed *core.Record) (CheckResult, error) {
+	result, err := s.process(ctx, feed)
+
+	feed.Set("lastCheckedAt", time.Now())
+	if err != nil {
+		feed.Set("lastError", truncate(err.Error(), maxErrorLength))
+	} else {
+		feed.Set("lastError", "")
+	}
+	if saveErr := s.app.Save(feed); saveErr != nil {
+		log.Printf("[RSS] Failed to update feed %s: %v", feed.GetString("name"), saveErr)
+	}
+
+	return result, err
+}
+
+func (s *Service) process(ctx context.Context, feed *core.Record) (CheckResult, error) {
+	items, err := s.fetchFeed(ctx, feed)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	rules, err := s.rulesFor(feed.Id)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	result := CheckResult{Items: len(items)}
+	grabbed := map[string]bool{}
+
+	// Feeds list the newest items first; handle them in publishing order
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+
+		alreadySeen, err := s.seen(feed.Id, item.GUID)
+		if err != nil {
+			return result, fmt.Errorf("check seen items: %w", err)
+		}
+		if alreadySeen {
+			continue
+		}
+		result.New++
+
+		episode := EpisodeKey(item.Title)
+		rule, _, err := s.evaluate(rules, item, episode, grabbed)
+		if err != nil {
+			return result, fmt.Errorf("evaluate rules: %w", err)
+		}
+
+		status := StatusSkipped
+		var grabErr error
+		if rule != nil {
+			if grabErr = s.grab(ctx, rule, item); grabErr != nil {
+				status = StatusFailed
+				result.Failed++
+				log.Printf("[RSS] Failed to add %q from %s: %v", item.Title, feed.GetString("name"), grabErr)
+			} else {
+				status = StatusAdded
+				result.Added++
+				grabbed[rule.ID+"|"+episode] = true
+				log.Printf("[RSS] Added %q from %s by rule %s", item.Title, feed.GetString("name"), rule.Name)
+			}
+		}
+
+		if err := s.saveItem(feed.Id, item, rule, episode, status, grabErr); err != nil {
+			return result, fmt.Errorf("remember item: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Poll checks every enabled feed whose interval has passed. Overlapping
+// calls return right away.
+func (s *Service) Poll() {
+	ctx := s.ctx
+	if !s.polling.TryLock() {
+		return
+	}
+	defer s.polling.Unlock()
+
+	feeds, err := s.app.FindRecordsByFilter("rss_feeds", "enabled = true", "", 0, 0)
+	if err != nil {
+		log.Printf("[RSS] Failed to find feeds: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, feed := range feeds {
+		if ctx.Err() != nil {
+			return
+		}
+
+		lastChecked := feed.GetDateTime("lastCheckedAt")
+		interval := time.Duration(feedInterval(feed)) * time.Minute
+		if !lastChecked.IsZero() && now.Sub(lastChecked.Time()) < interval {
+			continue
+		}
+
+		if _, err := s.check(ctx, feed); err != nil {
+			log.Printf("[RSS] Failed to check feed %s: %v", feed.GetString("name"), err)
+		}
+	}
+}
+
+// DryRun fetches the feeds a rule watches and reports what the rule would
+// grab, without adding anything or remembering items.
+func (s *Service) DryRun(ctx context.Context, ruleID string) ([]DryRunItem, error) {
+	record, err := s.findRecord("rss_rules", ruleID, "rule")
+	if err != nil {
+		return nil, err
+	}
+	rule, err := ruleFromRecord(record)
+	if err != nil {
+		return nil, ValidationError{Message: err.Error()}
+	}
+
+	feeds, err := s.app.FindRecordsByFilter("rss_feeds", "", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find feeds: %w", err)
+	}
+
+	results := []DryRunItem{}
+	grabbed := map[string]bool{}
+	for _, feed := range feeds {
+		if !rule.AppliesTo(feed.Id) {
+			continue
+		}
+
+		items, err := s.fetchFeed(ctx, feed)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := len(items) - 1; i >= 0; i-- {
+			item := items[i]
+			entry := DryRunItem{Feed: feed.Id, FeedName: feed.GetString("name"), Item: item, Episode: EpisodeKey(item.Title)}
+
+			if entry.Seen, err = s.seen(feed.Id, item.GUID); err != nil {
+				return nil, fmt.Errorf("check seen items: %w", err)
+			}
+
+			var match *Rule
+			if match, entry.Reason, err = s.evaluate([]*Rule{rule}, item, entry.Episode, grabbed); err != nil {
+				return nil, fmt.Errorf("evaluate rule: %w", err)
+			}
+			entry.Matched = match != nil || entry.Reason == "episode already grabbed"
+
+			switch {
+			case match == nil:
+			case entry.Seen:
+				entry.Reason = "already seen"
+			default:
+				entry.WouldGrab = true
+				grabbed[rule.ID+"|"+entry.Episode] = true
+			}
+
+			results = append(results, entry)
+		}
+	}
+
+	return results, nil
+}
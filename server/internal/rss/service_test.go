@@ -0,0 +1,415 @@
+package rss
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+// feedServer serves the fixture feeds from testdata with links pointing back
+// at itself, as well as a .torrent file
+type feedServer struct {
+	*httptest.Server
+
+	downloads atomic.Int32
+}
+
+func newFeedServer(t *testing.T) *feedServer {
+	t.Helper()
+
+	server := &feedServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/files/s01e01.torrent":
+			server.downloads.Add(1)
+			w.Header().Set("Content-Type", "application/x-bittorrent")
+			w.Write([]byte("d8:announce31:http://tracker.example/announce4:infod6:lengthi1e4:name6:s01e0112:piece lengthi16384e6:pieces20:" + strings.Repeat("x", 20) + "ee"))
+		case strings.HasPrefix(r.URL.Path, "/feeds/"):
+			data, err := os.ReadFile(filepath.Join("testdata", strings.TrimPrefix(r.URL.Path, "/feeds/")))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(strings.ReplaceAll(string(data), "{{server}}", server.URL)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTestService(t *testing.T) (*tests.TestApp, *Service, *feedServer) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	client := transmission.NewMockClient(testApp)
+	syncService := transmission.NewSyncService(testApp, client, 0)
+	auditService := audit.NewService(testApp)
+	torrents := torrent.NewService(&pocketbase.PocketBase{App: testApp}, client, syncService, auditService)
+	if err := torrents.ForceSync(); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	service := NewService(testApp, torrents, auditService)
+	t.Cleanup(service.Stop)
+
+	return testApp, service, newFeedServer(t)
+}
+
+func createFeed(t *testing.T, service *Service, server *feedServer, fixture string) FeedResponse {
+	t.Helper()
+
+	name := fixture
+	url := server.URL + "/feeds/" + fixture
+	feed, err := service.CreateFeed(context.Background(), FeedParams{Name: &name, URL: &url})
+	if err != nil {
+		t.Fatalf("CreateFeed failed: %v", err)
+	}
+	return feed
+}
+
+// createShowRule grabs 1080p releases of "Show Name" once per episode
+func createShowRule(t *testing.T, service *Service, feedID, ownerID string) RuleResponse {
+	t.Helper()
+
+	name := "Show Name"
+	feeds := []string{feedID}
+	include := `^show.name\b`
+	exclude := `\bcam\b`
+	minSize := int64(500_000_000)
+	maxSize := int64(20_000_000_000)
+	dedupe := true
+	downloadDir := "/downloads/tv"
+	rule, err := service.CreateRule(context.Background(), RuleParams{
+		Name:          &name,
+		Feeds:         &feeds,
+		Include:       &include,
+		Exclude:       &exclude,
+		MinSize:       &minSize,
+		MaxSize:       &maxSize,
+		EpisodeDedupe: &dedupe,
+		DownloadDir:   &downloadDir,
+		Owner:         &ownerID,
+	})
+	if err != nil {
+		t.Fatalf("CreateRule failed: %v", err)
+	}
+	return rule
+}
+
+func itemStatuses(t *testing.T, service *Service, feedID string) map[string]string {
+	t.Helper()
+
+	items, err := service.Items(feedID, 0)
+	if err != nil {
+		t.Fatalf("Items failed: %v", err)
+	}
+
+	statuses := map[string]string{}
+	for _, item := range items {
+		statuses[item.GUID] = item.Status
+	}
+	return statuses
+}
+
+func ownedTorrents(t *testing.T, app core.App, ownerID string) []*core.Record {
+	t.Helper()
+
+	records, err := app.FindRecordsByFilter("torrents", "user = {:user}", "", 0, 0, dbx.Params{"user": ownerID})
+	if err != nil {
+		t.Fatalf("Failed to find torrents: %v", err)
+	}
+	return records
+}
+
+func TestParseFeedFixtures(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "tv.rss"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	items, err := ParseFeed(data)
+	if err != nil {
+		t.Fatalf("ParseFeed failed: %v", err)
+	}
+	if len(items) != 6 {
+		t.Fatalf("Expected 6 rss items, got %d", len(items))
+	}
+	if items[4].Link != "magnet:?xt=urn:btih:2222222222222222222222222222222222222222&dn=e02" || items[4].Size != 1503238553 {
+		t.Errorf("Expected the magnetURI and human readable size to be used, got %+v", items[4])
+	}
+	if items[5].Link != "{{server}}/files/s01e01.torrent" || items[5].Size != 1500000000 || items[5].Published.IsZero() {
+		t.Errorf("Expected the torrent enclosure to be used, got %+v", items[5])
+	}
+	if items[1].Size != 40000000000 {
+		t.Errorf("Expected the torznab size, got %d", items[1].Size)
+	}
+
+	data, err = os.ReadFile(filepath.Join("testdata", "tv.atom"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	items, err = ParseFeed(data)
+	if err != nil {
+		t.Fatalf("ParseFeed failed: %v", err)
+	}
+	if len(items) != 2 || items[0].GUID != "urn:example:tv:6" || items[0].Link != "{{server}}/files/missing.torrent" {
+		t.Fatalf("Unexpected atom items: %+v", items)
+	}
+	if !strings.HasPrefix(items[1].Link, "magnet:") || items[1].Size != 1500000000 || items[1].Published.IsZero() {
+		t.Errorf("Expected the magnet enclosure of the second entry, got %+v", items[1])
+	}
+
+	if _, err := ParseFeed([]byte("<html><body>Login required</body></html>")); err == nil {
+		t.Errorf("Expected non-feed documents to be rejected")
+	}
+}
+
+func TestEpisodeKey(t *testing.T) {
+	cases := map[string]string{
+		"Show Name S01E02 1080p WEB":   "show name|s01e02",
+		"Show.Name.s1e2.720p":          "show name|s01e02",
+		"show_name - 1x02 - Title":     "show name|s01e02",
+		"Show Name S01E02E03 2160p":    "show name|s01e02",
+		"Some Movie 2024 1080p BluRay": "",
+	}
+
+	for title, expected := range cases {
+		if got := EpisodeKey(title); got != expected {
+			t.Errorf("EpisodeKey(%q) = %q, want %q", title, got, expected)
+		}
+	}
+}
+
+func TestPollAddsMatchingItemsOnce(t *testing.T) {
+	testApp, service, server := newTestService(t)
+	owner := testutil.CreateUser(t, testApp, "tv@example.com", "user")
+	feed := createFeed(t, service, server, "tv.rss")
+	rule := createShowRule(t, service, feed.ID, owner.Id)
+
+	service.Poll()
+
+	statuses := itemStatuses(t, service, feed.ID)
+	expected := map[string]string{
+		"tv-1": StatusAdded,   // .torrent enclosure
+		"tv-2": StatusAdded,   // magnet
+		"tv-3": StatusSkipped, // other show
+		"tv-4": StatusSkipped, // excluded
+		"tv-5": StatusSkipped, // too large
+		"tv-6": StatusSkipped, // episode already grabbed
+	}
+	for guid, status := range expected {
+		if statuses[guid] != status {
+			t.Errorf("Expected %s to be %s, got %q", guid, status, statuses[guid])
+		}
+	}
+
+	if got := server.downloads.Load(); got != 1 {
+		t.Errorf("Expected the .torrent file to be downloaded once, got %d", got)
+	}
+	if torrents := ownedTorrents(t, testApp, owner.Id); len(torrents) != 2 {
+		t.Errorf("Expected 2 torrents owned by the rule owner, got %d", len(torrents))
+	}
+
+	feeds, err := service.ListFeeds()
+	if err != nil {
+		t.Fatalf("ListFeeds failed: %v", err)
+	}
+	if feeds[0].LastCheckedAt == "" || feeds[0].LastError != "" {
+		t.Errorf("Expected a successful check to be recorded, got %+v", feeds[0])
+	}
+	rules, err := service.ListRules()
+	if err != nil {
+		t.Fatalf("ListRules failed: %v", err)
+	}
+	if rules[0].ID != rule.ID || rules[0].LastMatchAt == "" {
+		t.Errorf("Expected the rule match to be recorded, got %+v", rules[0])
+	}
+
+	// The feed isn't due again, and a manual check finds nothing new
+	service.Poll()
+	result, err := service.CheckFeed(context.Background(), feed.ID)
+	if err != nil {
+		t.Fatalf("CheckFeed failed: %v", err)
+	}
+	if result.Items != 6 || result.New != 0 || result.Added != 0 {
+		t.Errorf("Expected every item to be remembered, got %+v", result)
+	}
+	if torrents := ownedTorrents(t, testApp, owner.Id); len(torrents) != 2 {
+		t.Errorf("Expected no torrents to be added twice, got %d", len(torrents))
+	}
+}
+
+func TestCheckFeedRecordsFailures(t *testing.T) {
+	testApp, service, server := newTestService(t)
+	owner := testutil.CreateUser(t, testApp, "tv@example.com", "user")
+	rssFeed := createFeed(t, service, server, "tv.rss")
+	atom := createFeed(t, service, server, "tv.atom")
+	createShowRule(t, service, atom.ID, owner.Id)
+
+	// The rule only watches the atom feed
+	result, err := service.CheckFeed(context.Background(), rssFeed.ID)
+	if err != nil {
+		t.Fatalf("CheckFeed failed: %v", err)
+	}
+	if result.New != 6 || result.Added != 0 {
+		t.Errorf("Expected items of unwatched feeds to be skipped, got %+v", result)
+	}
+
+	result, err = service.CheckFeed(context.Background(), atom.ID)
+	if err != nil {
+		t.Fatalf("CheckFeed failed: %v", err)
+	}
+	if result.Added != 1 || result.Failed != 1 {
+		t.Errorf("Expected one added and one failed item, got %+v", result)
+	}
+
+	items, err := service.Items(atom.ID, 0)
+	if err != nil {
+		t.Fatalf("Items failed: %v", err)
+	}
+	for _, item := range items {
+		if item.GUID == "urn:example:tv:6" && (item.Status != StatusFailed || !strings.Contains(item.Error, "404")) {
+			t.Errorf("Expected the missing torrent file to be recorded as failed, got %+v", item)
+		}
+	}
+
+	url := server.URL + "/feeds/missing.rss"
+	if _, err := service.UpdateFeed(context.Background(), rssFeed.ID, FeedParams{URL: &url}); err != nil {
+		t.Fatalf("UpdateFeed failed: %v", err)
+	}
+	var fetchErr FetchError
+	if _, err := service.CheckFeed(context.Background(), rssFeed.ID); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Expected a fetch error, got %v", err)
+	} else if !errors.As(err, &fetchErr) {
+		t.Errorf("Expected a FetchError, got %T", err)
+	}
+
+	feeds, err := service.ListFeeds()
+	if err != nil {
+		t.Fatalf("ListFeeds failed: %v", err)
+	}
+	for _, feed := range feeds {
+		if feed.ID == rssFeed.ID && feed.LastError == "" {
+			t.Errorf("Expected the fetch error to be recorded on the feed")
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	testApp, service, server := newTestService(t)
+	owner := testutil.CreateUser(t, testApp, "tv@example.com", "user")
+	feed := createFeed(t, service, server, "tv.rss")
+	rule := createShowRule(t, service, feed.ID, owner.Id)
+
+	items, err := service.DryRun(context.Background(), rule.ID)
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	if len(items) != 6 {
+		t.Fatalf("Expected 6 items, got %d", len(items))
+	}
+
+	reasons := map[string]string{}
+	var grabbed []string
+	for _, item := range items {
+		reasons[item.GUID] = item.Reason
+		if item.WouldGrab {
+			grabbed = append(grabbed, item.GUID)
+		}
+	}
+	if strings.Join(grabbed, ",") != "tv-1,tv-2" {
+		t.Errorf("Expected tv-1 and tv-2 to be grabbed, got %v", grabbed)
+	}
+	if reasons["tv-5"] != "larger than the maximum size" || reasons["tv-6"] != "episode already grabbed" || reasons["tv-4"] != "matches the exclude pattern" {
+		t.Errorf("Unexpected reasons: %v", reasons)
+	}
+
+	// A dry run neither adds torrents nor remembers items
+	if torrents := ownedTorrents(t, testApp, owner.Id); len(torrents) != 0 {
+		t.Errorf("Expected no torrents to be added, got %d", len(torrents))
+	}
+	if statuses := itemStatuses(t, service, feed.ID); len(statuses) != 0 {
+		t.Errorf("Expected no items to be remembered, got %v", statuses)
+	}
+
+	service.Poll()
+	items, err = service.DryRun(context.Background(), rule.ID)
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	for _, item := range items {
+		if item.WouldGrab || !item.Seen {
+			t.Errorf("Expected seen items not to be grabbed again, got %+v", item)
+		}
+	}
+}
+
+func TestRuleValidationAndFeedDeletion(t *testing.T) {
+	testApp, service, server := newTestService(t)
+	owner := testutil.CreateUser(t, testApp, "tv@example.com", "user")
+	feed := createFeed(t, service, server, "tv.rss")
+	other := createFeed(t, service, server, "tv.atom")
+	rule := createShowRule(t, service, feed.ID, owner.Id)
+
+	invalid := "show (name"
+	if _, err := service.UpdateRule(context.Background(), rule.ID, RuleParams{Include: &invalid}); err == nil {
+		t.Errorf("Expected invalid patterns to be rejected")
+	}
+	minSize := int64(30_000_000_000)
+	if _, err := service.UpdateRule(context.Background(), rule.ID, RuleParams{MinSize: &minSize}); err == nil {
+		t.Errorf("Expected a minimum above the maximum size to be rejected")
+	}
+	interval := 1
+	if _, err := service.UpdateFeed(context.Background(), feed.ID, FeedParams{Interval: &interval}); err == nil {
+		t.Errorf("Expected intervals below %d minutes to be rejected", minInterval)
+	}
+
+	name := "Both feeds"
+	feeds := []string{feed.ID, other.ID}
+	both, err := service.CreateRule(context.Background(), RuleParams{Name: &name, Feeds: &feeds, Owner: &owner.Id})
+	if err != nil {
+		t.Fatalf("CreateRule failed: %v", err)
+	}
+
+	if err := service.DeleteFeed(context.Background(), feed.ID); err != nil {
+		t.Fatalf("DeleteFeed failed: %v", err)
+	}
+
+	rules, err := service.ListRules()
+	if err != nil {
+		t.Fatalf("ListRules failed: %v", err)
+	}
+	for _, r := range rules {
+		switch r.ID {
+		case rule.ID:
+			if r.Enabled {
+				t.Errorf("Expected the rule of the deleted feed to be disabled rather than watch every feed")
+			}
+		case both.ID:
+			if !r.Enabled || len(r.Feeds) != 1 || r.Feeds[0] != other.ID {
+				t.Errorf("Expected the rule to keep watching the other feed, got %+v", r)
+			}
+		}
+	}
+}
@@ -0,0 +1,590 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+const (
+	defaultTimeout = 15
+	maxTimeout     = 120
+	maxErrorLength = 1000
+	maxQueryLength = 500
+	// keyPlaceholder replaces provider API keys in links handed to users
+	keyPlaceholder = "{apikey}"
+)
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// ProviderError indicates that a provider could not be reached or returned
+// something unusable.
+type ProviderError struct {
+	Message string
+}
+
+func (e ProviderError) Error() string {
+	return e.Message
+}
+
+// ProviderResponse represents a search provider as exposed by the API. The
+// API key is never returned.
+type ProviderResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	HasAPIKey  bool   `json:"hasApiKey"`
+	Categories []int  `json:"categories"`
+	Timeout    int    `json:"timeout"`
+	Enabled    bool   `json:"enabled"`
+	LastError  string `json:"lastError,omitempty"`
+	Created    string `json:"created"`
+	Updated    string `json:"updated"`
+}
+
+// ProviderParams holds the fields of a provider to create or update. Nil
+// fields are left untouched on update.
+type ProviderParams struct {
+	Name   *string `json:"name"`
+	URL    *string `json:"url"`
+	APIKey *string `json:"apiKey"`
+	// Categories are searched when a search names none
+	Categories *[]int `json:"categories"`
+	// Timeout is in seconds
+	Timeout *int  `json:"timeout"`
+	Enabled *bool `json:"enabled"`
+}
+
+// ProviderFailure reports a provider left out of the results.
+type ProviderFailure struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name"`
+	Error    string `json:"error"`
+}
+
+// Response holds the merged results of a search.
+type Response struct {
+	Results  []Result          `json:"results"`
+	Failures []ProviderFailure `json:"failures"`
+}
+
+// AddParams identifies the result to add, using either its magnet link or
+// its provider and link as returned by Search.
+type AddParams struct {
+	Provider    string  `json:"provider"`
+	Link        string  `json:"link"`
+	MagnetURI   string  `json:"magnetUri"`
+	DownloadDir *string `json:"downloadDir,omitempty"`
+	AutoStart   *bool   `json:"autoStart,omitempty"`
+}
+
+// Service manages search providers and searches them.
+type Service struct {
+	app      core.App
+	torrents *torrent.Service
+	audit    *audit.Service
+	client   *http.Client
+}
+
+// NewService constructs a Service instance.
+func NewService(app core.App, torrentService *torrent.Service, auditService *audit.Service) *Service {
+	return &Service{
+		app:      app,
+		torrents: torrentService,
+		audit:    auditService,
+		// Every request is bounded by the timeout of its provider
+		client: &http.Client{},
+	}
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
+
+func providerCategories(record *core.Record) []int {
+	categories := []int{}
+	if err := record.UnmarshalJSONField("categories", &categories); err != nil || categories == nil {
+		return []int{}
+	}
+	return categories
+}
+
+func providerTimeout(record *core.Record) int {
+	if timeout := record.GetInt("timeout"); timeout > 0 {
+		return timeout
+	}
+	return defaultTimeout
+}
+
+func mapProviderRecord(record *core.Record) ProviderResponse {
+	return ProviderResponse{
+		ID:         record.Id,
+		Name:       record.GetString("name"),
+		URL:        record.GetString("url"),
+		HasAPIKey:  record.GetString("apiKey") != "",
+		Categories: providerCategories(record),
+		Timeout:    providerTimeout(record),
+		Enabled:    record.GetBool("enabled"),
+		LastError:  record.GetString("lastError"),
+		Created:    formatDate(record, "created"),
+		Updated:    formatDate(record, "updated"),
+	}
+}
+
+// ListProviders returns all search providers.
+func (s *Service) ListProviders() ([]ProviderResponse, error) {
+	records, err := s.app.FindRecordsByFilter("search_providers", "", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find search providers: %w", err)
+	}
+
+	providers := make([]ProviderResponse, 0, len(records))
+	for _, record := range records {
+		providers = append(providers, mapProviderRecord(record))
+	}
+	return providers, nil
+}
+
+// CreateProvider adds a search provider. Providers are enabled unless stated
+// otherwise.
+func (s *Service) CreateProvider(ctx context.Context, params ProviderParams) (ProviderResponse, error) {
+	collection, err := s.app.FindCollectionByNameOrId("search_providers")
+	if err != nil {
+		return ProviderResponse{}, fmt.Errorf("find search_providers collection: %w", err)
+	}
+
+	if params.Name == nil || params.URL == nil {
+		return ProviderResponse{}, ValidationError{Message: "name and url are required"}
+	}
+	if params.Enabled == nil {
+		enabled := true
+		params.Enabled = &enabled
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("categories", []int{})
+	record.Set("timeout", defaultTimeout)
+	if err := applyProviderParams(record, params); err != nil {
+		return ProviderResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return ProviderResponse{}, fmt.Errorf("save search provider: %w", err)
+	}
+
+	response := mapProviderRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionProviderCreate,
+		Targets: []string{record.Id},
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// UpdateProvider changes a search provider.
+func (s *Service) UpdateProvider(ctx context.Context, id string, params ProviderParams) (ProviderResponse, error) {
+	record, err := s.findProvider(id)
+	if err != nil {
+		return ProviderResponse{}, err
+	}
+
+	before := mapProviderRecord(record)
+	if err := applyProviderParams(record, params); err != nil {
+		return ProviderResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return ProviderResponse{}, fmt.Errorf("save search provider: %w", err)
+	}
+
+	response := mapProviderRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionProviderUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// DeleteProvider removes a search provider.
+func (s *Service) DeleteProvider(ctx context.Context, id string) error {
+	record, err := s.findProvider(id)
+	if err != nil {
+		return err
+	}
+
+	before := mapProviderRecord(record)
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete search provider: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionProviderDelete,
+		Targets: []string{id},
+		Before:  before,
+	})
+
+	return nil
+}
+
+func (s *Service) findProvider(id string) (*core.Record, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ValidationError{Message: "provider id is required"}
+	}
+
+	record, err := s.app.FindRecordById("search_providers", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: "provider not found"}
+		}
+		return nil, fmt.Errorf("find search provider: %w", err)
+	}
+	return record, nil
+}
+
+// applyProviderParams validates params and sets them on record
+func applyProviderParams(record *core.Record, params ProviderParams) error {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" {
+			return ValidationError{Message: "name cannot be empty"}
+		}
+		record.Set("name", name)
+	}
+
+	if params.URL != nil {
+		parsed, err := url.Parse(strings.TrimSpace(*params.URL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return ValidationError{Message: "url must be an http or https URL"}
+		}
+		record.Set("url", parsed.String())
+	}
+
+	if params.APIKey != nil {
+		record.Set("apiKey", strings.TrimSpace(*params.APIKey))
+	}
+
+	if params.Categories != nil {
+		categories := []int{}
+		for _, category := range *params.Categories {
+			if category <= 0 {
+				return ValidationError{Message: fmt.Sprintf("invalid category: %d", category)}
+			}
+			categories = append(categories, category)
+		}
+		record.Set("categories", categories)
+	}
+
+	if params.Timeout != nil {
+		if *params.Timeout < 1 || *params.Timeout > maxTimeout {
+			return ValidationError{Message: fmt.Sprintf("timeout must be between 1 and %d seconds", maxTimeout)}
+		}
+		record.Set("timeout", *params.Timeout)
+	}
+
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	return nil
+}
+
+// ParseCategories reads a comma-separated list of Torznab categories.
+func ParseCategories(value string) ([]int, error) {
+	categories := []int{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		category, err := strconv.Atoi(part)
+		if err != nil || category <= 0 {
+			return nil, ValidationError{Message: fmt.Sprintf("invalid category: %s", part)}
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+func (s *Service) newClient(provider *core.Record) *Client {
+	return NewClient(provider.GetString("url"), provider.GetString("apiKey"), s.client)
+}
+
+// Search queries every enabled provider at once and merges the results.
+// Providers that fail or don't answer within their timeout are reported in
+// Failures rather than failing the search.
+func (s *Service) Search(ctx context.Context, query string, categories []int) (Response, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return Response{}, ValidationError{Message: "query is required"}
+	}
+	if len(query) > maxQueryLength {
+		return Response{}, ValidationError{Message: "query is too long"}
+	}
+
+	providers, err := s.app.FindRecordsByFilter("search_providers", "enabled = true", "name", 0, 0)
+	if err != nil {
+		return Response{}, fmt.Errorf("find search providers: %w", err)
+	}
+
+	type outcome struct {
+		results []Result
+		err     error
+	}
+	outcomes := make([]outcome, len(providers))
+
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider *core.Record) {
+			defer wg.Done()
+
+			providerCtx, cancel := context.WithTimeout(ctx, time.Duration(providerTimeout(provider))*time.Second)
+			defer cancel()
+
+			searched := categories
+			if len(searched) == 0 {
+				searched = providerCategories(provider)
+			}
+
+			results, err := s.newClient(provider).Search(providerCtx, query, searched)
+			if err != nil && errors.Is(providerCtx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("timed out after %ds", providerTimeout(provider))
+			}
+			outcomes[i] = outcome{results: results, err: err}
+		}(i, provider)
+	}
+	wg.Wait()
+
+	response := Response{Results: []Result{}, Failures: []ProviderFailure{}}
+	var found [][]Result
+	for i, provider := range providers {
+		s.recordOutcome(provider, outcomes[i].err)
+
+		if err := outcomes[i].err; err != nil {
+			response.Failures = append(response.Failures, ProviderFailure{
+				Provider: provider.Id,
+				Name:     provider.GetString("name"),
+				Error:    err.Error(),
+			})
+			continue
+		}
+
+		results := outcomes[i].results
+		for j := range results {
+			results[j].Provider = provider.Id
+			results[j].Providers = []string{provider.GetString("name")}
+			results[j].Link = redactKey(results[j].Link, provider.GetString("apiKey"))
+		}
+		found = append(found, results)
+	}
+
+	response.Results = merge(found)
+	return response, nil
+}
+
+// recordOutcome keeps the latest error of a provider for admins
+func (s *Service) recordOutcome(provider *core.Record, err error) {
+	lastError := ""
+	if err != nil {
+		lastError = truncate(err.Error(), maxErrorLength)
+	}
+	if provider.GetString("lastError") == lastError {
+		return
+	}
+
+	provider.Set("lastError", lastError)
+	if err := s.app.Save(provider); err != nil {
+		log.Printf("[Search] Failed to update provider %s: %v", provider.GetString("name"), err)
+	}
+}
+
+// merge combines the results of all providers, collapsing torrents found by
+// several of them, and orders them by seeders
+func merge(found [][]Result) []Result {
+	merged := []Result{}
+	index := map[string]int{}
+
+	for _, results := range found {
+		for _, result := range results {
+			key := dedupeKey(result)
+			position, ok := index[key]
+			if !ok {
+				index[key] = len(merged)
+				merged = append(merged, result)
+				continue
+			}
+
+			existing := &merged[position]
+			existing.Providers = appendUnique(existing.Providers, result.Providers...)
+			if result.Seeders > existing.Seeders {
+				existing.Seeders = result.Seeders
+				existing.Peers = result.Peers
+			}
+			if existing.MagnetURI == "" {
+				existing.MagnetURI = result.MagnetURI
+			}
+			if existing.Link == "" {
+				existing.Link = result.Link
+				existing.Provider = result.Provider
+			}
+			if existing.Size == 0 {
+				existing.Size = result.Size
+			}
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Seeders > merged[j].Seeders
+	})
+	return merged
+}
+
+// dedupeKey identifies a torrent by infohash; without one the title and size
+// have to do
+func dedupeKey(result Result) string {
+	if result.InfoHash != "" {
+		return "hash:" + result.InfoHash
+	}
+	return fmt.Sprintf("title:%s|%d", strings.ToLower(result.Title), result.Size)
+}
+
+func appendUnique(values []string, additions ...string) []string {
+	for _, addition := range additions {
+		found := false
+		for _, value := range values {
+			if value == addition {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, addition)
+		}
+	}
+	return values
+}
+
+// redactKey keeps provider API keys, which Jackett and Prowlarr put into
+// download links, away from users
+func redactKey(link, apiKey string) string {
+	if link == "" || apiKey == "" {
+		return link
+	}
+	return strings.ReplaceAll(link, apiKey, keyPlaceholder)
+}
+
+// Add adds a search result as userID. Links are only downloaded from the
+// host of the provider that returned them.
+func (s *Service) Add(ctx context.Context, userID string, params AddParams) (*transmission.TorrentData, error) {
+	source, err := s.resolve(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	torrentData, err := s.torrents.AddTorrent(ctx, torrent.AddTorrentRequest{
+		Torrent:     source,
+		DownloadDir: params.DownloadDir,
+		AutoStart:   params.AutoStart,
+		UserID:      userID,
+	})
+	var duplicateErr torrent.DuplicateError
+	var clientErr torrent.ClientError
+	switch {
+	case errors.As(err, &duplicateErr), errors.As(err, &clientErr):
+		return nil, err
+	case err != nil:
+		// Rejections such as quotas are reported like /api/torrents/add does
+		return nil, ValidationError{Message: err.Error()}
+	}
+	return torrentData, nil
+}
+
+// resolve turns a result into what AddTorrent accepts
+func (s *Service) resolve(ctx context.Context, params AddParams) (string, error) {
+	if magnet := strings.TrimSpace(params.MagnetURI); magnet != "" {
+		if !strings.HasPrefix(magnet, "magnet:?") {
+			return "", ValidationError{Message: "invalid magnet link"}
+		}
+		return magnet, nil
+	}
+
+	if strings.TrimSpace(params.Link) == "" {
+		return "", ValidationError{Message: "magnetUri or provider and link are required"}
+	}
+
+	provider, err := s.findProvider(params.Provider)
+	if err != nil {
+		return "", err
+	}
+
+	link, err := url.Parse(strings.TrimSpace(params.Link))
+	if err != nil {
+		return "", ValidationError{Message: "invalid link"}
+	}
+	endpoint, err := url.Parse(provider.GetString("url"))
+	if err != nil {
+		return "", fmt.Errorf("parse provider url: %w", err)
+	}
+	if link.Scheme != endpoint.Scheme || !strings.EqualFold(link.Host, endpoint.Host) {
+		return "", ValidationError{Message: "link does not belong to the provider"}
+	}
+
+	target := strings.ReplaceAll(link.String(), url.PathEscape(keyPlaceholder), keyPlaceholder)
+	target = strings.ReplaceAll(target, url.QueryEscape(keyPlaceholder), keyPlaceholder)
+	target = strings.ReplaceAll(target, keyPlaceholder, provider.GetString("apiKey"))
+
+	downloadCtx, cancel := context.WithTimeout(ctx, time.Duration(providerTimeout(provider))*time.Second)
+	defer cancel()
+
+	source, err := s.newClient(provider).Download(downloadCtx, target)
+	if err != nil {
+		return "", ProviderError{Message: fmt.Sprintf("download from %s: %v", provider.GetString("name"), err)}
+	}
+	return source, nil
+}
@@ -0,0 +1,254 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+const debianHash = "0123456789abcdef0123456789abcdef01234567"
+
+// torznabXMLItem renders an item the way Jackett does
+func torznabXMLItem(title, link, hash string, size int64, seeders int) string {
+	return fmt.Sprintf(`<item>
+  <title>%s</title>
+  <link>%s</link>
+  <size>%d</size>
+  <pubDate>Mon, 02 Jun 2025 10:00:00 +0000</pubDate>
+  <jackettindexer id="public">Public</jackettindexer>
+  <torznab:attr name="category" value="2000"/>
+  <torznab:attr name="seeders" value="%d"/>
+  <torznab:attr name="peers" value="%d"/>
+  <torznab:attr name="infohash" value="%s"/>
+</item>`, title, link, size, seeders, seeders+5, hash)
+}
+
+// torznabServer stands in for a Torznab indexer. It records the queries it
+// receives and answers them with the items rendered by items.
+type torznabServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	queries []map[string]string
+}
+
+func newTorznabServer(t *testing.T, items func(server string) []string) *torznabServer {
+	t.Helper()
+
+	stub := &torznabServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		stub.mu.Lock()
+		stub.queries = append(stub.queries, map[string]string{"q": query.Get("q"), "cat": query.Get("cat"), "apikey": query.Get("apikey")})
+		stub.mu.Unlock()
+
+		if query.Get("apikey") != "secret" {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><error code="100" description="Invalid API Key"/>`)
+			return
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed"><channel>%s</channel></rss>`, strings.Join(items(stub.URL), "\n"))
+	})
+	mux.HandleFunc("/dl/debian.torrent", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("apikey") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "d8:announce31:http://tracker.example/announce4:infod6:lengthi1e4:name6:debian12:piece lengthi16384e6:pieces20:"+strings.Repeat("x", 20)+"ee")
+	})
+	mux.HandleFunc("/dl/magnet", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "magnet:?xt=urn:btih:"+debianHash+"&dn=debian", http.StatusFound)
+	})
+	mux.HandleFunc("/slow/api", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	stub.Server = httptest.NewServer(mux)
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *torznabServer) received() []map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]string(nil), s.queries...)
+}
+
+func newTestService(t *testing.T) (*tests.TestApp, *Service) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	client := transmission.NewMockClient(testApp)
+	syncService := transmission.NewSyncService(testApp, client, 0)
+	auditService := audit.NewService(testApp)
+	torrents := torrent.NewService(&pocketbase.PocketBase{App: testApp}, client, syncService, auditService)
+	if err := torrents.ForceSync(); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	return testApp, NewService(testApp, torrents, auditService)
+}
+
+func createProvider(t *testing.T, service *Service, name, endpoint, apiKey string, params ProviderParams) ProviderResponse {
+	t.Helper()
+
+	params.Name = &name
+	params.URL = &endpoint
+	params.APIKey = &apiKey
+
+	provider, err := service.CreateProvider(context.Background(), params)
+	if err != nil {
+		t.Fatalf("CreateProvider failed: %v", err)
+	}
+	return provider
+}
+
+func TestSearchMergesProviders(t *testing.T) {
+	_, service := newTestService(t)
+
+	jackett := newTorznabServer(t, func(server string) []string {
+		return []string{
+			torznabXMLItem("Debian 12", server+"/dl/debian.torrent?apikey=secret", debianHash, 600, 40),
+			torznabXMLItem("Ubuntu 24.04", server+"/dl/ubuntu.torrent?apikey=secret", "", 900, 10),
+		}
+	})
+	prowlarr := newTorznabServer(t, func(server string) []string {
+		// The same torrent with its infohash in base32 and more seeders
+		return []string{torznabXMLItem("Debian 12 netinst", "magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH&amp;dn=debian", "", 600, 55)}
+	})
+
+	movies := []int{2000}
+	createProvider(t, service, "Jackett", jackett.URL+"/api", "secret", ProviderParams{Categories: &movies})
+	createProvider(t, service, "Prowlarr", prowlarr.URL+"/api", "secret", ProviderParams{})
+	broken := createProvider(t, service, "Broken", prowlarr.URL+"/api", "wrong", ProviderParams{})
+	timeout := 1
+	slow := createProvider(t, service, "Slow", prowlarr.URL+"/slow/api", "secret", ProviderParams{Timeout: &timeout})
+	disabled := false
+	createProvider(t, service, "Disabled", jackett.URL+"/api", "secret", ProviderParams{Enabled: &disabled})
+
+	started := time.Now()
+	response, err := service.Search(context.Background(), "debian", nil)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("Expected the slow provider to be cut off, search took %s", elapsed)
+	}
+
+	if len(response.Results) != 2 {
+		t.Fatalf("Expected 2 merged results, got %+v", response.Results)
+	}
+	debian := response.Results[0]
+	if debian.InfoHash != debianHash || debian.Seeders != 55 || len(debian.Providers) != 2 {
+		t.Errorf("Expected the duplicates to merge with the highest seeders, got %+v", debian)
+	}
+	if debian.MagnetURI == "" || debian.Link == "" {
+		t.Errorf("Expected the merged result to keep both the magnet and the link, got %+v", debian)
+	}
+	for _, result := range response.Results {
+		if strings.Contains(result.Link, "secret") {
+			t.Errorf("Expected the API key to be redacted, got %q", result.Link)
+		}
+	}
+
+	failures := map[string]string{}
+	for _, failure := range response.Failures {
+		failures[failure.Provider] = failure.Error
+	}
+	if len(failures) != 2 || !strings.Contains(failures[broken.ID], "Invalid API Key") || !strings.Contains(failures[slow.ID], "timed out") {
+		t.Errorf("Expected the broken and slow providers to fail, got %+v", response.Failures)
+	}
+
+	providers, err := service.ListProviders()
+	if err != nil {
+		t.Fatalf("ListProviders failed: %v", err)
+	}
+	for _, provider := range providers {
+		if provider.ID == broken.ID && provider.LastError == "" {
+			t.Errorf("Expected the provider error to be recorded")
+		}
+	}
+
+	// Requested categories replace the provider defaults
+	if _, err := service.Search(context.Background(), "debian", []int{5000, 5030}); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	queries := jackett.received()
+	if len(queries) != 2 || queries[0]["cat"] != "2000" || queries[1]["cat"] != "5000,5030" || queries[0]["q"] != "debian" {
+		t.Errorf("Expected the disabled duplicate provider to be skipped and categories to be sent, got: %+v", queries)
+	}
+
+	if _, err := service.Search(context.Background(), " ", nil); err == nil {
+		t.Errorf("Expected an empty query to be rejected")
+	}
+}
+
+func TestAddResultAsUser(t *testing.T) {
+	testApp, service := newTestService(t)
+	user := testutil.CreateUser(t, testApp, "searcher@example.com", "user")
+
+	stub := newTorznabServer(t, func(server string) []string {
+		return []string{torznabXMLItem("Debian 12", server+"/dl/debian.torrent?apikey=secret", debianHash, 600, 40)}
+	})
+	provider := createProvider(t, service, "Jackett", stub.URL+"/api", "secret", ProviderParams{})
+
+	response, err := service.Search(context.Background(), "debian", nil)
+	if err != nil || len(response.Results) != 1 {
+		t.Fatalf("Expected one result, got %+v (%v)", response, err)
+	}
+	result := response.Results[0]
+
+	if _, err := service.Add(context.Background(), user.Id, AddParams{Provider: result.Provider, Link: result.Link}); err != nil {
+		t.Fatalf("Adding a .torrent link failed: %v", err)
+	}
+	if _, err := service.Add(context.Background(), user.Id, AddParams{Provider: provider.ID, Link: stub.URL + "/dl/magnet"}); err != nil {
+		t.Fatalf("Adding a magnet redirect failed: %v", err)
+	}
+
+	records, err := testApp.FindRecordsByFilter("torrents", "user = {:user}", "", 0, 0, dbx.Params{"user": user.Id})
+	if err != nil {
+		t.Fatalf("Failed to find torrents: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expected 2 torrents owned by the user, got %d", len(records))
+	}
+
+	// Links are only fetched from the provider that returned them
+	var validationErr ValidationError
+	if _, err := service.Add(context.Background(), user.Id, AddParams{Provider: provider.ID, Link: "http://169.254.169.254/latest"}); !errors.As(err, &validationErr) {
+		t.Errorf("Expected foreign links to be rejected, got %v", err)
+	}
+	if _, err := service.Add(context.Background(), user.Id, AddParams{MagnetURI: "javascript:alert(1)"}); !errors.As(err, &validationErr) {
+		t.Errorf("Expected invalid magnets to be rejected, got %v", err)
+	}
+
+	// The mock makes up hashes, so give a torrent the real one; adding it
+	// again reports the duplicate rather than a rejection
+	records[0].Set("hash", debianHash)
+	if err := testApp.Save(records[0]); err != nil {
+		t.Fatalf("Failed to update torrent: %v", err)
+	}
+	var duplicateErr torrent.DuplicateError
+	if _, err := service.Add(context.Background(), user.Id, AddParams{MagnetURI: "magnet:?xt=urn:btih:" + debianHash}); !errors.As(err, &duplicateErr) || duplicateErr.ID != records[0].Id {
+		t.Errorf("Expected a duplicate error, got %v", err)
+	}
+}
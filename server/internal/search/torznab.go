@@ -0,0 +1,300 @@
+// Package search queries Torznab indexers such as Jackett and Prowlarr on
+// behalf of users.
+package search
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/metainfo"
+)
+
+const (
+	maxResponseSize = 10 << 20
+	maxTorrentSize  = 10 << 20
+	// resultLimit is the number of results asked from every provider
+	resultLimit = 100
+)
+
+// Result is a torrent found by a provider.
+type Result struct {
+	Title string `json:"title"`
+	// InfoHash is the lowercase hex v1 infohash, if known
+	InfoHash string `json:"infoHash,omitempty"`
+	// Link downloads the .torrent file through the provider
+	Link       string    `json:"link,omitempty"`
+	MagnetURI  string    `json:"magnetUri,omitempty"`
+	Size       int64     `json:"size"`
+	Seeders    int       `json:"seeders"`
+	Peers      int       `json:"peers"`
+	Categories []int     `json:"categories"`
+	Indexer    string    `json:"indexer,omitempty"`
+	Published  time.Time `json:"published"`
+	// Provider is the id of the provider Link belongs to
+	Provider string `json:"provider"`
+	// Providers names every provider that returned the torrent
+	Providers []string `json:"providers"`
+}
+
+// Client queries a Torznab API endpoint.
+type Client struct {
+	endpoint string
+	apiKey   string
+	http     *http.Client
+}
+
+// NewClient constructs a Client for endpoint.
+func NewClient(endpoint, apiKey string, httpClient *http.Client) *Client {
+	return &Client{endpoint: endpoint, apiKey: apiKey, http: httpClient}
+}
+
+type torznabFeed struct {
+	XMLName xml.Name
+	// Set on <error code="100" description="Invalid API Key"/> responses
+	Code        string `xml:"code,attr"`
+	Description string `xml:"description,attr"`
+	Channel     struct {
+		Items []torznabItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type torznabItem struct {
+	Title     string `xml:"title"`
+	GUID      string `xml:"guid"`
+	Link      string `xml:"link"`
+	PubDate   string `xml:"pubDate"`
+	Size      string `xml:"size"`
+	Enclosure *struct {
+		URL    string `xml:"url,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"enclosure"`
+	JackettIndexer  string `xml:"jackettindexer"`
+	ProwlarrIndexer string `xml:"prowlarrindexer"`
+	Attrs           []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+}
+
+// Search runs a Torznab search; empty categories search all of them.
+func (c *Client) Search(ctx context.Context, query string, categories []int) ([]Result, error) {
+	target, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+
+	params := target.Query()
+	params.Set("t", "search")
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(resultLimit))
+	if c.apiKey != "" {
+		params.Set("apikey", c.apiKey)
+	}
+	if len(categories) > 0 {
+		values := make([]string, 0, len(categories))
+		for _, category := range categories {
+			values = append(values, strconv.Itoa(category))
+		}
+		params.Set("cat", strings.Join(values, ","))
+	}
+	target.RawQuery = params.Encode()
+
+	data, _, err := c.get(ctx, target.String(), maxResponseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed torznabFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if feed.XMLName.Local == "error" {
+		return nil, fmt.Errorf("provider error %s: %s", feed.Code, feed.Description)
+	}
+	if feed.XMLName.Local != "rss" {
+		return nil, errors.New("response is not a Torznab feed")
+	}
+
+	results := make([]Result, 0, len(feed.Channel.Items))
+	for _, item := range feed.Channel.Items {
+		if result, ok := parseItem(item); ok {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func parseItem(item torznabItem) (Result, bool) {
+	result := Result{
+		Title:      strings.TrimSpace(item.Title),
+		Categories: []int{},
+		Indexer:    strings.TrimSpace(item.JackettIndexer),
+	}
+	if result.Indexer == "" {
+		result.Indexer = strings.TrimSpace(item.ProwlarrIndexer)
+	}
+
+	link := strings.TrimSpace(item.Link)
+	if item.Enclosure != nil && item.Enclosure.URL != "" {
+		link = strings.TrimSpace(item.Enclosure.URL)
+	}
+	if strings.HasPrefix(link, "magnet:") {
+		result.MagnetURI = link
+	} else {
+		result.Link = link
+	}
+
+	result.Size, _ = strconv.ParseInt(strings.TrimSpace(item.Size), 10, 64)
+	if result.Size == 0 && item.Enclosure != nil {
+		result.Size, _ = strconv.ParseInt(strings.TrimSpace(item.Enclosure.Length), 10, 64)
+	}
+
+	for _, attr := range item.Attrs {
+		value := strings.TrimSpace(attr.Value)
+		switch attr.Name {
+		case "seeders":
+			result.Seeders, _ = strconv.Atoi(value)
+		case "peers":
+			result.Peers, _ = strconv.Atoi(value)
+		case "infohash":
+			if hash, ok := normalizeInfoHash(value); ok {
+				result.InfoHash = hash
+			}
+		case "magneturl":
+			if result.MagnetURI == "" && strings.HasPrefix(value, "magnet:") {
+				result.MagnetURI = value
+			}
+		case "size":
+			if result.Size == 0 {
+				result.Size, _ = strconv.ParseInt(value, 10, 64)
+			}
+		case "category":
+			if category, err := strconv.Atoi(value); err == nil {
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+
+	if result.InfoHash == "" && result.MagnetURI != "" {
+		result.InfoHash = magnetInfoHash(result.MagnetURI)
+	}
+
+	if value := strings.TrimSpace(item.PubDate); value != "" {
+		for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				result.Published = parsed
+				break
+			}
+		}
+	}
+
+	return result, result.Title != "" && (result.Link != "" || result.MagnetURI != "")
+}
+
+// normalizeInfoHash returns a v1 infohash as lowercase hex, accepting hex
+// and base32 encodings
+func normalizeInfoHash(value string) (string, bool) {
+	switch len(value) {
+	case 40:
+		if _, err := hex.DecodeString(value); err == nil {
+			return strings.ToLower(value), true
+		}
+	case 32:
+		if decoded, err := base32.StdEncoding.DecodeString(strings.ToUpper(value)); err == nil {
+			return hex.EncodeToString(decoded), true
+		}
+	}
+	return "", false
+}
+
+// magnetInfoHash returns the v1 infohash of a magnet link, if it has one
+func magnetInfoHash(magnet string) string {
+	parsed, err := url.Parse(magnet)
+	if err != nil {
+		return ""
+	}
+	for _, xt := range parsed.Query()["xt"] {
+		if value, ok := strings.CutPrefix(xt, "urn:btih:"); ok {
+			if hash, ok := normalizeInfoHash(value); ok {
+				return hash
+			}
+		}
+	}
+	return ""
+}
+
+// Download fetches a result link and returns what AddTorrent accepts: the
+// base64 encoded .torrent file, or the magnet link the provider redirects to.
+func (c *Client) Download(ctx context.Context, link string) (string, error) {
+	data, magnet, err := c.get(ctx, link, maxTorrentSize)
+	if err != nil {
+		return "", err
+	}
+	if magnet != "" {
+		return magnet, nil
+	}
+
+	source, err := metainfo.Encode(data)
+	if err != nil {
+		return "", fmt.Errorf("link did not return a torrent file: %w", err)
+	}
+	return source, nil
+}
+
+// get fetches target with a size limit. Redirects to magnet links, as
+// providers send for magnet-only indexers, are returned instead of followed.
+func (c *Client) get(ctx context.Context, target string, limit int64) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Retorrent")
+
+	client := *c.http
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme == "magnet" {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Don't leak the API key in the query through the URL in the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 && strings.HasPrefix(location, "magnet:") {
+		return nil, location, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", fmt.Errorf("provider responded with %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("read response: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, "", fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return data, "", nil
+}
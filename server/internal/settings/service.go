@@ -0,0 +1,70 @@
+package settings
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Service reads and writes server-side application settings kept in the
+// settings collection.
+type Service struct {
+	app core.App
+}
+
+// NewService constructs a Service instance.
+func NewService(app core.App) *Service {
+	return &Service{app: app}
+}
+
+// Get decodes the value stored under key into dest. It reports false when the
+// key has never been set, leaving dest untouched.
+func (s *Service) Get(key string, dest any) (bool, error) {
+	record, err := s.app.FindFirstRecordByData("settings", "key", key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("find setting %s: %w", key, err)
+	}
+
+	raw, err := json.Marshal(record.Get("value"))
+	if err != nil {
+		return false, fmt.Errorf("encode setting %s: %w", key, err)
+	}
+
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return false, fmt.Errorf("decode setting %s: %w", key, err)
+	}
+
+	return true, nil
+}
+
+// Set stores value under key, replacing any previous value.
+func (s *Service) Set(key string, value any) error {
+	record, err := s.app.FindFirstRecordByData("settings", "key", key)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("find setting %s: %w", key, err)
+		}
+
+		collection, err := s.app.FindCollectionByNameOrId("settings")
+		if err != nil {
+			return fmt.Errorf("find settings collection: %w", err)
+		}
+
+		record = core.NewRecord(collection)
+		record.Set("key", key)
+	}
+
+	record.Set("value", value)
+
+	if err := s.app.Save(record); err != nil {
+		return fmt.Errorf("save setting %s: %w", key, err)
+	}
+
+	return nil
+}
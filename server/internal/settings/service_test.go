@@ -0,0 +1,43 @@
+package settings
+
+import (
+	"testing"
+
+	"backend/internal/testutil"
+)
+
+func TestGetSet(t *testing.T) {
+	testApp := testutil.NewTestApp(t)
+
+	service := NewService(testApp)
+
+	var value struct {
+		Enabled bool `json:"enabled"`
+	}
+	found, err := service.Get("feature", &value)
+	if err != nil || found {
+		t.Fatalf("Expected missing key, got found=%v err=%v", found, err)
+	}
+
+	for _, enabled := range []bool{true, false} {
+		if err := service.Set("feature", map[string]any{"enabled": enabled}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+
+		found, err = service.Get("feature", &value)
+		if err != nil || !found {
+			t.Fatalf("Expected stored key, got found=%v err=%v", found, err)
+		}
+		if value.Enabled != enabled {
+			t.Errorf("Expected enabled=%v, got %v", enabled, value.Enabled)
+		}
+	}
+
+	total, err := testApp.CountRecords("settings")
+	if err != nil {
+		t.Fatalf("CountRecords failed: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("Expected a single settings record, got %d", total)
+	}
+}
@@ -0,0 +1,51 @@
+package testutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	_ "backend/migrations"
+)
+
+// Password is the password of the users created by CreateUser.
+const Password = "supersecret"
+
+// NewTestApp creates a PocketBase test app with the migrations applied and
+// removes it when the test ends.
+func NewTestApp(t testing.TB) *tests.TestApp {
+	t.Helper()
+
+	testApp, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatalf("Failed to create test app: %v", err)
+	}
+	t.Cleanup(testApp.Cleanup)
+
+	return testApp
+}
+
+// CreateUser creates a verified user with role, named after the local part
+// of email, who signs in with Password.
+func CreateUser(t testing.TB, app core.App, email, role string) *core.Record {
+	t.Helper()
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+
+	user := core.NewRecord(users)
+	user.SetEmail(email)
+	user.SetVerified(true)
+	user.SetPassword(Password)
+	user.Set("name", strings.Split(email, "@")[0])
+	user.Set("role", role)
+	if err := app.Save(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	return user
+}
@@ -0,0 +1,295 @@
+package testutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// PushMessage is a message received and decrypted by the push service stand-in.
+type PushMessage struct {
+	Endpoint string
+	Payload  []byte
+	TTL      string
+	Urgency  string
+}
+
+// pushSubscriber holds the browser side keys of a stand-in subscription
+type pushSubscriber struct {
+	key        *ecdh.PrivateKey
+	authSecret []byte
+	expired    bool
+}
+
+// PushServer is a Web Push service stand-in. It verifies the VAPID token,
+// decrypts aes128gcm messages with the subscriber keys it handed out and
+// answers 410 Gone for expired subscriptions.
+type PushServer struct {
+	URL string
+
+	mu          sync.Mutex
+	subscribers map[string]*pushSubscriber
+	messages    []PushMessage
+	rejected    int
+}
+
+// NewPushServer starts a push service stand-in. It is shut down automatically
+// when the test finishes.
+func NewPushServer(t *testing.T) *PushServer {
+	t.Helper()
+
+	server := &PushServer{subscribers: map[string]*pushSubscriber{}}
+	httpServer := httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	server.URL = httpServer.URL
+	t.Cleanup(httpServer.Close)
+
+	return server
+}
+
+// Subscribe creates a browser subscription and returns its endpoint together
+// with the base64url encoded p256dh key and auth secret.
+func (s *PushServer) Subscribe(t *testing.T) (endpoint, p256dh, auth string) {
+	t.Helper()
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate subscriber key: %v", err)
+	}
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	endpoint = fmt.Sprintf("%s/push/%x", s.URL, id)
+
+	s.mu.Lock()
+	s.subscribers[endpoint] = &pushSubscriber{key: key, authSecret: authSecret}
+	s.mu.Unlock()
+
+	return endpoint, base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), base64.RawURLEncoding.EncodeToString(authSecret)
+}
+
+// Expire makes the push service answer 410 Gone for an endpoint.
+func (s *PushServer) Expire(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if subscriber, ok := s.subscribers[endpoint]; ok {
+		subscriber.expired = true
+	}
+}
+
+// Messages returns a copy of all messages received so far.
+func (s *PushServer) Messages() []PushMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]PushMessage(nil), s.messages...)
+}
+
+// Rejected returns how many requests failed VAPID or decryption checks.
+func (s *PushServer) Rejected() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rejected
+}
+
+func (s *PushServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := s.URL + r.URL.Path
+
+	s.mu.Lock()
+	subscriber, ok := s.subscribers[endpoint]
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if subscriber.expired {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	reject := func(status int, err error) {
+		s.mu.Lock()
+		s.rejected++
+		s.mu.Unlock()
+		http.Error(w, err.Error(), status)
+	}
+
+	if err := verifyVAPID(r.Header.Get("Authorization"), s.URL); err != nil {
+		reject(http.StatusUnauthorized, err)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		reject(http.StatusBadRequest, errors.New("missing content encoding or TTL"))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		reject(http.StatusBadRequest, err)
+		return
+	}
+
+	payload, err := decryptPush(subscriber, body)
+	if err != nil {
+		reject(http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, PushMessage{
+		Endpoint: endpoint,
+		Payload:  payload,
+		TTL:      r.Header.Get("TTL"),
+		Urgency:  r.Header.Get("Urgency"),
+	})
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// verifyVAPID checks a "vapid t=<jwt>, k=<key>" authorization header
+func verifyVAPID(header, audience string) error {
+	if !strings.HasPrefix(header, "vapid ") {
+		return errors.New("missing vapid authorization")
+	}
+
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+
+	rawKey, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("invalid vapid key: %w", err)
+	}
+	publicKey, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), rawKey)
+	if err != nil {
+		return fmt.Errorf("invalid vapid key: %w", err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed vapid token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return errors.New("malformed vapid signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, sig := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(publicKey, digest[:], r, sig) {
+		return errors.New("invalid vapid signature")
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return errors.New("malformed vapid claims")
+	}
+	var claims struct {
+		Aud string `json:"aud"`
+		Sub string `json:"sub"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return errors.New("malformed vapid claims")
+	}
+	if claims.Aud != audience || claims.Sub == "" || claims.Exp == 0 {
+		return fmt.Errorf("unexpected vapid claims %+v", claims)
+	}
+
+	return nil
+}
+
+// hkdfSHA256 is a single block HKDF, kept separate from the production code
+// so the stand-in checks the key schedule independently
+func hkdfSHA256(salt, secret, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
+
+// decryptPush decrypts a single record aes128gcm message (RFC 8188, RFC 8291)
+func decryptPush(subscriber *pushSubscriber, body []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("message too short")
+	}
+	salt := body[:16]
+	recordSize := binary.BigEndian.Uint32(body[16:20])
+	keyIDLength := int(body[20])
+	if len(body) < 21+keyIDLength || recordSize < 18 {
+		return nil, errors.New("malformed header")
+	}
+	senderKey, err := ecdh.P256().NewPublicKey(body[21 : 21+keyIDLength])
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender key: %w", err)
+	}
+	ciphertext := body[21+keyIDLength:]
+	if uint32(len(ciphertext)) > recordSize {
+		return nil, errors.New("message spans multiple records")
+	}
+
+	sharedSecret, err := subscriber.key.ECDH(senderKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := append([]byte("WebPush: info\x00"), subscriber.key.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, senderKey.Bytes()...)
+	ikm := hkdfSHA256(subscriber.authSecret, sharedSecret, keyInfo, 32)
+	cek := hkdfSHA256(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdfSHA256(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt message: %w", err)
+	}
+
+	// Strip the padding; the last record ends with a 0x02 delimiter
+	end := len(plaintext) - 1
+	for end >= 0 && plaintext[end] == 0 {
+		end--
+	}
+	if end < 0 || plaintext[end] != 0x02 {
+		return nil, errors.New("missing last record delimiter")
+	}
+
+	return plaintext[:end], nil
+}
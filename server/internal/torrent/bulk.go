@@ -0,0 +1,126 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"backend/internal/metainfo"
+)
+
+// BulkParallelism bounds how many torrents of a bulk add are added at once
+const BulkParallelism = 4
+
+// BulkStatus is the outcome of one item of a bulk add
+type BulkStatus string
+
+const (
+	BulkAdded     BulkStatus = "added"
+	BulkDuplicate BulkStatus = "duplicate"
+	BulkError     BulkStatus = "error"
+)
+
+// BulkItem is one torrent of a bulk add
+type BulkItem struct {
+	// Source names the item in its result, e.g. the uploaded file name
+	Source  string
+	Request AddTorrentRequest
+	// Err marks an item that could not be read; it is reported as is
+	Err error
+}
+
+// BulkResult is the result of one item of a bulk add
+type BulkResult struct {
+	Index          int             `json:"index"`
+	Source         string          `json:"source"`
+	Status         BulkStatus      `json:"status"`
+	Name           string          `json:"name,omitempty"`
+	Hash           string          `json:"hash,omitempty"`
+	TransmissionID int64           `json:"transmissionId,omitempty"`
+	Duplicate      *DuplicateError `json:"duplicate,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// AddTorrents adds many torrents, at most BulkParallelism at a time. Every
+// item gets a result, in the order of the items.
+func (s *Service) AddTorrents(ctx context.Context, items []BulkItem) []BulkResult {
+	results := make([]BulkResult, len(items))
+
+	// Items of the same torrent would race past the duplicate check, so
+	// only the first of them is added
+	seen := map[string]int{}
+	pending := make([]int, 0, len(items))
+	for i, item := range items {
+		results[i] = BulkResult{Index: i, Source: item.Source}
+		if item.Err != nil {
+			results[i].Status = BulkError
+			results[i].Error = item.Err.Error()
+			continue
+		}
+
+		if meta, err := metainfo.Read(item.Request.Torrent); err == nil {
+			hash := meta.InfoHash
+			if hash == "" {
+				hash = meta.InfoHashV2
+			}
+			if first, dup := seen[hash]; dup {
+				results[i].Status = BulkDuplicate
+				results[i].Error = fmt.Sprintf("same torrent as item %d", first)
+				continue
+			}
+			seen[hash] = i
+		}
+		pending = append(pending, i)
+	}
+
+	slots := make(chan struct{}, BulkParallelism)
+	var wg sync.WaitGroup
+	for _, i := range pending {
+		if ctx.Err() != nil {
+			results[i].Status = BulkError
+			results[i].Error = ctx.Err().Error()
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			results[i] = s.addBulkItem(ctx, results[i], items[i].Request)
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (s *Service) addBulkItem(ctx context.Context, result BulkResult, req AddTorrentRequest) BulkResult {
+	added, err := s.AddTorrent(ctx, req)
+
+	var duplicateErr DuplicateError
+	switch {
+	case errors.As(err, &duplicateErr):
+		result.Status = BulkDuplicate
+		result.Name = duplicateErr.Name
+		result.Hash = duplicateErr.Hash
+		result.TransmissionID = duplicateErr.TransmissionID
+		result.Duplicate = &duplicateErr
+		result.Error = err.Error()
+	case err != nil:
+		result.Status = BulkError
+		result.Error = err.Error()
+	case added == nil:
+		result.Status = BulkError
+		result.Error = "failed to add torrent"
+	default:
+		result.Status = BulkAdded
+		result.Name = added.Name
+		result.Hash = added.HashString
+		result.TransmissionID = added.ID
+	}
+
+	return result
+}
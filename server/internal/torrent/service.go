@@ -2,11 +2,22 @@ package torrent
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 
+	"backend/internal/audit"
+	"backend/internal/metainfo"
 	"backend/internal/transmission"
 )
 
@@ -15,14 +26,19 @@ type Service struct {
 	app                *pocketbase.PocketBase
 	transmissionClient transmission.TransmissionClient
 	syncService        *transmission.SyncService
+	audit              *audit.Service
+
+	mu         sync.RWMutex
+	beforeAdds []BeforeAddHook
 }
 
 // NewService creates a new torrent service instance
-func NewService(app *pocketbase.PocketBase, transmissionClient transmission.TransmissionClient, syncService *transmission.SyncService) *Service {
+func NewService(app *pocketbase.PocketBase, transmissionClient transmission.TransmissionClient, syncService *transmission.SyncService, auditService *audit.Service) *Service {
 	return &Service{
 		app:                app,
 		transmissionClient: transmissionClient,
 		syncService:        syncService,
+		audit:              auditService,
 	}
 }
 
@@ -31,18 +47,112 @@ type AddTorrentRequest struct {
 	Torrent     string  `json:"torrent"`
 	DownloadDir *string `json:"downloadDir,omitempty"`
 	AutoStart   *bool   `json:"autoStart,omitempty"`
+	// Label is set as the torrent's first label
+	Label string `json:"label,omitempty"`
+	// FilesUnwanted and the priority lists hold file indices, as listed by
+	// Preview, and require a .torrent file
+	FilesUnwanted []int64 `json:"filesUnwanted,omitempty"`
+	PriorityHigh  []int64 `json:"priorityHigh,omitempty"`
+	PriorityLow   []int64 `json:"priorityLow,omitempty"`
+	// MergeTrackers adds the trackers of a duplicate to the existing torrent,
+	// if the user owns it or is an admin
+	MergeTrackers bool `json:"mergeTrackers,omitempty"`
+	// UserID is the user adding the torrent; their personal defaults
+	// fill in omitted fields
+	UserID string `json:"-"`
+}
+
+// Clone returns a copy of the request that shares no slices or pointers
+// with it
+func (r AddTorrentRequest) Clone() AddTorrentRequest {
+	if r.DownloadDir != nil {
+		dir := *r.DownloadDir
+		r.DownloadDir = &dir
+	}
+	if r.AutoStart != nil {
+		autoStart := *r.AutoStart
+		r.AutoStart = &autoStart
+	}
+	r.FilesUnwanted = slices.Clone(r.FilesUnwanted)
+	r.PriorityHigh = slices.Clone(r.PriorityHigh)
+	r.PriorityLow = slices.Clone(r.PriorityLow)
+	return r
+}
+
+// DuplicateError is returned when a torrent being added is already in
+// Transmission. It names the existing record and its owner.
+type DuplicateError struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Hash           string `json:"hash"`
+	TransmissionID int64  `json:"transmissionId"`
+	OwnerID        string `json:"ownerId,omitempty"`
+	OwnerName      string `json:"ownerName,omitempty"`
+	// TrackersAdded counts the trackers merged into the existing torrent
+	TrackersAdded int `json:"trackersAdded"`
+}
+
+func (e DuplicateError) Error() string {
+	return fmt.Sprintf("torrent already exists: %s", e.Name)
+}
+
+// ClientError is returned when Transmission fails to add a torrent, as
+// opposed to the torrent being rejected
+type ClientError struct {
+	Err error
+}
+
+func (e ClientError) Error() string {
+	return fmt.Sprintf("failed to add torrent: %v", e.Err)
+}
+
+func (e ClientError) Unwrap() error {
+	return e.Err
+}
+
+// BeforeAddHook inspects a torrent about to be added. It may change the
+// request or return an error to reject it.
+type BeforeAddHook func(ctx context.Context, req *AddTorrentRequest) error
+
+// OnBeforeAdd registers a hook run before every torrent is added. Hooks run
+// in registration order, after the user's defaults are applied.
+func (s *Service) OnBeforeAdd(hook BeforeAddHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.beforeAdds = append(s.beforeAdds, hook)
+}
+
+// Defaults holds a user's personal defaults for adding torrents
+type Defaults struct {
+	DownloadDir *string `json:"downloadDir,omitempty"`
+	AutoStart   *bool   `json:"autoStart,omitempty"`
 }
 
 // RemoveTorrentRequest represents the request to remove torrents
 type RemoveTorrentRequest struct {
 	IDs             []int64 `json:"ids"`
 	DeleteLocalData *bool   `json:"deleteLocalData,omitempty"`
+	// UserID, if set, limits the request to torrents the user may change
+	UserID string `json:"-"`
 }
 
 // ActionRequest represents the request for torrent actions
 type ActionRequest struct {
 	Action string                 `json:"action"`
 	Params map[string]interface{} `json:"params,omitempty"`
+	// UserID, if set, limits the request to torrents the user may change
+	UserID string `json:"-"`
+}
+
+// ForbiddenError is returned when a user asks to change a torrent that is
+// neither theirs nor may be changed by them as an admin
+type ForbiddenError struct {
+	TransmissionID int64
+}
+
+func (e ForbiddenError) Error() string {
+	return fmt.Sprintf("not allowed to change torrent %d", e.TransmissionID)
 }
 
 // AddTorrent adds a new torrent
@@ -55,10 +165,67 @@ func (s *Service) AddTorrent(ctx context.Context, req AddTorrentRequest) (*trans
 		return nil, fmt.Errorf("torrent data is required")
 	}
 
+	s.applyUserDefaults(&req)
+
+	s.mu.RLock()
+	hooks := append([]BeforeAddHook(nil), s.beforeAdds...)
+	s.mu.RUnlock()
+	for _, hook := range hooks {
+		if err := hook(ctx, &req); err != nil {
+			s.audit.Record(ctx, audit.Entry{
+				Action:  audit.ActionTorrentAdd,
+				Details: map[string]interface{}{"source": torrentSource(req.Torrent)},
+				Err:     err,
+			})
+			return nil, err
+		}
+	}
+	if req.Torrent == "" {
+		return nil, fmt.Errorf("torrent data is required")
+	}
+
+	// Sources that can't be parsed are left for Transmission to judge
+	meta, _ := metainfo.Read(req.Torrent)
+
+	options, err := addOptions(req, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{
+		"source":      torrentSource(req.Torrent),
+		"downloadDir": req.DownloadDir,
+		"autoStart":   req.AutoStart,
+	}
+	if req.Label != "" {
+		details["label"] = req.Label
+	}
+	if len(req.FilesUnwanted) > 0 {
+		details["filesUnwanted"] = req.FilesUnwanted
+	}
+
+	if meta != nil {
+		if err := s.checkDuplicate(ctx, meta, req); err != nil {
+			s.audit.Record(ctx, audit.Entry{Action: audit.ActionTorrentAdd, Details: details, Err: err})
+			return nil, err
+		}
+	}
+
 	// Add torrent
-	torrentData, err := s.transmissionClient.AddTorrent(ctx, req.Torrent, req.DownloadDir)
+	torrentData, err := s.transmissionClient.AddTorrent(ctx, req.Torrent, options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add torrent: %w", err)
+		s.audit.Record(ctx, audit.Entry{Action: audit.ActionTorrentAdd, Details: details, Err: err})
+		return nil, ClientError{Err: err}
+	}
+
+	if torrentData != nil {
+		details["name"] = torrentData.Name
+		details["transmissionId"] = torrentData.ID
+		s.audit.Record(ctx, audit.Entry{
+			Action:  audit.ActionTorrentAdd,
+			Targets: []string{torrentTarget(torrentData.HashString, torrentData.ID)},
+			Details: details,
+		})
 	}
 
 	// Auto start if requested
@@ -69,14 +236,298 @@ func (s *Service) AddTorrent(ctx context.Context, req AddTorrentRequest) (*trans
 		}
 	}
 
+	// Let the sync create the record with its owner
+	if req.UserID != "" && torrentData != nil {
+		s.syncService.AssignOwner(torrentData.HashString, req.UserID)
+	}
+
 	// Force sync to update the database
 	if err := s.syncService.ForceSync(); err != nil {
 		log.Printf("Failed to sync after adding torrent: %v", err)
 	}
 
+	if req.UserID != "" && torrentData != nil {
+		s.assignOwner(torrentData.HashString, req.UserID)
+	}
+
 	return torrentData, nil
 }
 
+// Preview parses a torrent, given as a magnet link or base64 encoded
+// .torrent file, without adding it.
+func (s *Service) Preview(torrent string) (*metainfo.MetaInfo, error) {
+	if strings.TrimSpace(torrent) == "" {
+		return nil, fmt.Errorf("torrent data is required")
+	}
+
+	return metainfo.Read(torrent)
+}
+
+// addOptions validates the label and file selection of a request against
+// the parsed torrent, which is nil if it could not be parsed
+func addOptions(req AddTorrentRequest, meta *metainfo.MetaInfo) (transmission.AddOptions, error) {
+	options := transmission.AddOptions{
+		DownloadDir:   req.DownloadDir,
+		FilesUnwanted: req.FilesUnwanted,
+		PriorityHigh:  req.PriorityHigh,
+		PriorityLow:   req.PriorityLow,
+	}
+
+	if label := strings.TrimSpace(req.Label); label != "" {
+		// Transmission stores labels comma separated
+		if strings.Contains(label, ",") {
+			return options, fmt.Errorf("label must not contain commas")
+		}
+		options.Labels = []string{label}
+	}
+
+	if len(req.FilesUnwanted) == 0 && len(req.PriorityHigh) == 0 && len(req.PriorityLow) == 0 {
+		return options, nil
+	}
+
+	// Magnets have no file list until their metadata is fetched, so an
+	// unchecked selection could start the unwanted files
+	if meta == nil || meta.Magnet {
+		return options, fmt.Errorf("file selection requires a valid torrent file")
+	}
+
+	unwanted := make(map[int64]bool, len(req.FilesUnwanted))
+	for _, index := range req.FilesUnwanted {
+		if index < 0 || index >= int64(len(meta.Files)) {
+			return options, fmt.Errorf("file index %d out of range", index)
+		}
+		unwanted[index] = true
+	}
+	if len(unwanted) == len(meta.Files) {
+		return options, fmt.Errorf("at least one file must be wanted")
+	}
+
+	high := make(map[int64]bool, len(req.PriorityHigh))
+	for _, index := range req.PriorityHigh {
+		if index < 0 || index >= int64(len(meta.Files)) {
+			return options, fmt.Errorf("file index %d out of range", index)
+		}
+		high[index] = true
+	}
+	for _, index := range req.PriorityLow {
+		if index < 0 || index >= int64(len(meta.Files)) {
+			return options, fmt.Errorf("file index %d out of range", index)
+		}
+		if high[index] {
+			return options, fmt.Errorf("file %d cannot have both high and low priority", index)
+		}
+	}
+
+	return options, nil
+}
+
+// checkDuplicate returns a DuplicateError if a torrent with the infohash of
+// meta is already synced, optionally merging its trackers into the existing one
+func (s *Service) checkDuplicate(ctx context.Context, meta *metainfo.MetaInfo, req AddTorrentRequest) error {
+	hashes := []string{}
+	if meta.InfoHash != "" {
+		hashes = append(hashes, meta.InfoHash)
+	}
+	// Transmission identifies v2 only torrents by their truncated v2 infohash
+	if meta.InfoHashV2 != "" {
+		hashes = append(hashes, meta.InfoHashV2[:40])
+	}
+
+	for _, hash := range hashes {
+		record, err := s.app.FindFirstRecordByData("torrents", "hash", hash)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check for duplicates: %w", err)
+		}
+
+		duplicate := DuplicateError{
+			ID:             record.Id,
+			Name:           record.GetString("name"),
+			Hash:           hash,
+			TransmissionID: int64(record.GetInt("transmissionId")),
+			OwnerID:        record.GetString("user"),
+		}
+		if duplicate.OwnerID != "" {
+			if owner, err := s.app.FindRecordById("users", duplicate.OwnerID); err == nil {
+				duplicate.OwnerName = owner.GetString("name")
+			}
+		}
+
+		// The trackers of private torrents carry passkeys, which must not
+		// be announced alongside another torrent's trackers
+		if req.MergeTrackers && !meta.Private && len(meta.Trackers) > 0 && s.mayChange(req.UserID, duplicate.OwnerID) {
+			added, err := s.mergeTrackers(ctx, duplicate.TransmissionID, meta.Trackers)
+			if err != nil {
+				log.Printf("Failed to merge trackers into torrent %d: %v", duplicate.TransmissionID, err)
+			}
+			duplicate.TrackersAdded = added
+		}
+
+		return duplicate
+	}
+
+	return nil
+}
+
+// mayChange reports whether the user may change a torrent owned by ownerID:
+// only its owner and admins may
+func (s *Service) mayChange(userID, ownerID string) bool {
+	if userID == "" {
+		return false
+	}
+	if userID == ownerID {
+		return true
+	}
+
+	user, err := s.app.FindRecordById("users", userID)
+	return err == nil && user.GetString("role") == "admin"
+}
+
+// checkChangeable returns a ForbiddenError for the first of ids userID may
+// not change. An empty userID is a trusted caller and may change any torrent.
+func (s *Service) checkChangeable(userID string, ids []int64) error {
+	if userID == "" {
+		return nil
+	}
+
+	for _, id := range ids {
+		// Torrents that aren't synced yet have no owner, so only admins may
+		// change them
+		var ownerID string
+		record, err := s.app.FindFirstRecordByData("torrents", "transmissionId", id)
+		switch {
+		case err == nil:
+			ownerID = record.GetString("user")
+		case !errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("failed to find torrent %d: %w", id, err)
+		}
+
+		if !s.mayChange(userID, ownerID) {
+			return ForbiddenError{TransmissionID: id}
+		}
+	}
+	return nil
+}
+
+// mergeTrackers adds the trackers a torrent doesn't announce to yet, each in
+// a tier of its own, and returns how many were added. Private torrents are
+// left alone, as other trackers must not learn of them.
+func (s *Service) mergeTrackers(ctx context.Context, id int64, trackers []string) (int, error) {
+	torrents, err := s.transmissionClient.GetTorrents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var existing *transmission.TorrentData
+	for _, t := range torrents {
+		if t.ID == id {
+			existing = t
+			break
+		}
+	}
+	if existing == nil {
+		return 0, fmt.Errorf("torrent %d not found", id)
+	}
+	if existing.IsPrivate {
+		return 0, nil
+	}
+
+	known := make(map[string]bool, len(existing.TrackerList))
+	for _, tracker := range existing.TrackerList {
+		known[tracker] = true
+	}
+
+	list := append([]string(nil), existing.TrackerList...)
+	added := 0
+	for _, tracker := range trackers {
+		if known[tracker] {
+			continue
+		}
+		if len(list) > 0 {
+			list = append(list, "")
+		}
+		list = append(list, tracker)
+		known[tracker] = true
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	if err := s.UpdateTorrents(ctx, []int64{id}, transmission.TorrentSettings{TrackerList: list}); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// assignOwner tags the synced record of a newly added torrent with the user
+// who added it, unless it already has an owner, e.g. when the background sync
+// created the record first
+func (s *Service) assignOwner(hash, userID string) {
+	if hash == "" {
+		return
+	}
+
+	record, err := s.app.FindFirstRecordByData("torrents", "hash", hash)
+	if err != nil {
+		log.Printf("Failed to find torrent %s to assign its owner: %v", hash, err)
+		return
+	}
+
+	if record.GetString("user") != "" {
+		return
+	}
+
+	record.Set("user", userID)
+	if err := s.app.Save(record); err != nil {
+		log.Printf("Failed to assign owner of torrent %s: %v", hash, err)
+	}
+}
+
+// DefaultsFromRecord decodes the personal defaults stored on a user record
+func DefaultsFromRecord(record *core.Record) (Defaults, error) {
+	var defaults Defaults
+
+	raw := strings.TrimSpace(record.GetString("defaults"))
+	if raw == "" || raw == "null" {
+		return defaults, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &defaults); err != nil {
+		return Defaults{}, err
+	}
+
+	return defaults, nil
+}
+
+// applyUserDefaults fills omitted request fields from the user's personal defaults
+func (s *Service) applyUserDefaults(req *AddTorrentRequest) {
+	if req.UserID == "" || (req.DownloadDir != nil && req.AutoStart != nil) {
+		return
+	}
+
+	record, err := s.app.FindRecordById("users", req.UserID)
+	if err != nil {
+		log.Printf("Failed to load defaults of user %s: %v", req.UserID, err)
+		return
+	}
+
+	defaults, err := DefaultsFromRecord(record)
+	if err != nil {
+		log.Printf("Failed to decode defaults of user %s: %v", req.UserID, err)
+		return
+	}
+
+	if req.DownloadDir == nil {
+		req.DownloadDir = defaults.DownloadDir
+	}
+	if req.AutoStart == nil {
+		req.AutoStart = defaults.AutoStart
+	}
+}
+
 // RemoveTorrents removes torrents
 func (s *Service) RemoveTorrents(ctx context.Context, req RemoveTorrentRequest) error {
 	if s.transmissionClient == nil {
@@ -87,17 +538,34 @@ func (s *Service) RemoveTorrents(ctx context.Context, req RemoveTorrentRequest)
 		return fmt.Errorf("at least one torrent ID is required")
 	}
 
+	if err := s.checkChangeable(req.UserID, req.IDs); err != nil {
+		return err
+	}
+
 	// Default to false if not specified
 	deleteLocalData := false
 	if req.DeleteLocalData != nil {
 		deleteLocalData = *req.DeleteLocalData
 	}
 
+	// Capture what is being removed before the sync drops the records
+	entry := audit.Entry{
+		Action:  audit.ActionTorrentRemove,
+		Targets: transmissionTargets(req.IDs),
+		Details: map[string]interface{}{
+			"deleteLocalData": deleteLocalData,
+			"torrents":        s.describeTorrents(req.IDs),
+		},
+	}
+
 	// Remove torrents
 	log.Printf("Removing torrents with IDs: %v, deleteLocalData: %v", req.IDs, deleteLocalData)
 	if err := s.transmissionClient.RemoveTorrents(ctx, req.IDs, deleteLocalData); err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
 		return fmt.Errorf("failed to remove torrents: %w", err)
 	}
+	s.audit.Record(ctx, entry)
 
 	// Force sync to update the database
 	if err := s.syncService.ForceSync(); err != nil {
@@ -136,13 +604,31 @@ func (s *Service) PerformAction(ctx context.Context, torrentID string, req Actio
 		}
 	}
 
+	if err := s.checkChangeable(req.UserID, []int64{id}); err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{
+		"torrents": s.describeTorrents([]int64{id}),
+	}
+	entry := audit.Entry{
+		Targets: transmissionTargets([]int64{id}),
+		Details: details,
+	}
+
 	switch req.Action {
 	case "start":
+		entry.Action = audit.ActionTorrentStart
 		if err := s.transmissionClient.StartTorrents(ctx, []int64{id}); err != nil {
+			entry.Err = err
+			s.audit.Record(ctx, entry)
 			return fmt.Errorf("failed to start torrent: %w", err)
 		}
 	case "stop":
+		entry.Action = audit.ActionTorrentStop
 		if err := s.transmissionClient.StopTorrents(ctx, []int64{id}); err != nil {
+			entry.Err = err
+			s.audit.Record(ctx, entry)
 			return fmt.Errorf("failed to stop torrent: %w", err)
 		}
 	case "remove":
@@ -153,13 +639,19 @@ func (s *Service) PerformAction(ctx context.Context, torrentID string, req Actio
 				deleteLocalData = val
 			}
 		}
+		entry.Action = audit.ActionTorrentRemove
+		details["deleteLocalData"] = deleteLocalData
 		if err := s.transmissionClient.RemoveTorrents(ctx, []int64{id}, deleteLocalData); err != nil {
+			entry.Err = err
+			s.audit.Record(ctx, entry)
 			return fmt.Errorf("failed to remove torrent: %w", err)
 		}
 	default:
 		return fmt.Errorf("invalid action: %s", req.Action)
 	}
 
+	s.audit.Record(ctx, entry)
+
 	// Force sync to update the database
 	if err := s.syncService.ForceSync(); err != nil {
 		log.Printf("Failed to sync after %s action: %v", req.Action, err)
@@ -168,6 +660,114 @@ func (s *Service) PerformAction(ctx context.Context, torrentID string, req Actio
 	return nil
 }
 
+// ListTorrents returns the torrent records visible to the given user.
+// Admins see every torrent, regular users only the ones they own.
+func (s *Service) ListTorrents(userID string, isAdmin bool) ([]*core.Record, error) {
+	collection, err := s.app.FindCollectionByNameOrId("torrents")
+	if err != nil {
+		return nil, fmt.Errorf("torrents collection not found: %w", err)
+	}
+
+	if isAdmin {
+		return s.app.FindRecordsByFilter(collection, "", "-updated", 0, 0, nil)
+	}
+
+	return s.app.FindRecordsByFilter(collection, "user = {:user}", "-updated", 0, 0, dbx.Params{"user": userID})
+}
+
+// VisibleTorrents returns the live torrent data from the download client that
+// the given user may see. Admins see every torrent, regular users only the
+// ones they own.
+func (s *Service) VisibleTorrents(ctx context.Context, userID string, isAdmin bool) ([]*transmission.TorrentData, error) {
+	if s.transmissionClient == nil {
+		return nil, fmt.Errorf("transmission client not available")
+	}
+
+	torrents, err := s.transmissionClient.GetTorrents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get torrents: %w", err)
+	}
+
+	if isAdmin {
+		return torrents, nil
+	}
+
+	records, err := s.ListTorrents(userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[string]struct{}, len(records))
+	for _, record := range records {
+		owned[strings.ToLower(record.GetString("hash"))] = struct{}{}
+	}
+
+	visible := make([]*transmission.TorrentData, 0, len(owned))
+	for _, t := range torrents {
+		if _, ok := owned[strings.ToLower(t.HashString)]; ok {
+			visible = append(visible, t)
+		}
+	}
+
+	return visible, nil
+}
+
+// UpdateTorrents changes settings such as labels or seeding limits of torrents
+func (s *Service) UpdateTorrents(ctx context.Context, ids []int64, settings transmission.TorrentSettings) error {
+	if s.transmissionClient == nil {
+		return fmt.Errorf("transmission client not available")
+	}
+
+	if len(ids) == 0 {
+		return fmt.Errorf("at least one torrent ID is required")
+	}
+
+	entry := audit.Entry{
+		Action:  audit.ActionTorrentUpdate,
+		Targets: transmissionTargets(ids),
+		After:   settings,
+		Details: map[string]interface{}{"torrents": s.describeTorrents(ids)},
+	}
+
+	if err := s.transmissionClient.SetTorrents(ctx, ids, settings); err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return fmt.Errorf("failed to update torrents: %w", err)
+	}
+	s.audit.Record(ctx, entry)
+
+	if err := s.syncService.ForceSync(); err != nil {
+		log.Printf("Failed to sync after updating torrents: %v", err)
+	}
+
+	return nil
+}
+
+// SessionSettings returns the download client's session settings
+func (s *Service) SessionSettings(ctx context.Context) (map[string]interface{}, error) {
+	if s.transmissionClient == nil {
+		return nil, fmt.Errorf("transmission client not available")
+	}
+
+	raw, err := s.transmissionClient.GetSessionSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Normalize the client specific type to the RPC field names
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("encode session settings: %w", err)
+	}
+
+	settings := map[string]interface{}{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("decode session settings: %w", err)
+	}
+
+	return settings, nil
+}
+
 // ForceSync triggers an immediate synchronization
 func (s *Service) ForceSync() error {
 	if s.syncService == nil {
@@ -179,4 +779,52 @@ func (s *Service) ForceSync() error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// describeTorrents looks up the stored records for the given Transmission IDs
+// so audit entries keep the name, hash and owner after the records are gone.
+func (s *Service) describeTorrents(ids []int64) []map[string]interface{} {
+	descriptions := make([]map[string]interface{}, 0, len(ids))
+
+	collection, err := s.app.FindCollectionByNameOrId("torrents")
+	if err != nil {
+		return descriptions
+	}
+
+	for _, id := range ids {
+		description := map[string]interface{}{"transmissionId": id}
+		if rec, err := s.app.FindFirstRecordByData(collection, "transmissionId", id); err == nil {
+			description["id"] = rec.Id
+			description["name"] = rec.GetString("name")
+			description["hash"] = rec.GetString("hash")
+			description["user"] = rec.GetString("user")
+		}
+		descriptions = append(descriptions, description)
+	}
+
+	return descriptions
+}
+
+// torrentSource reports whether the add payload is a magnet link or a torrent file
+func torrentSource(torrent string) string {
+	if strings.HasPrefix(torrent, "magnet:") {
+		return "magnet"
+	}
+	return "file"
+}
+
+// torrentTarget returns the identifier used for a torrent in audit entries
+func torrentTarget(hash string, id int64) string {
+	if hash != "" {
+		return hash
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+func transmissionTargets(ids []int64) []string {
+	targets := make([]string, 0, len(ids))
+	for _, id := range ids {
+		targets = append(targets, strconv.FormatInt(id, 10))
+	}
+	return targets
+}
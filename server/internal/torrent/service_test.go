@@ -0,0 +1,188 @@
+package torrent
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/transmission"
+)
+
+// twoFiles is a base64 encoded .torrent file holding a.mkv and b.nfo
+var twoFiles = base64.StdEncoding.EncodeToString([]byte(
+	"d4:infod5:filesld6:lengthi100e4:pathl5:a.mkveed6:lengthi1e4:pathl5:b.nfoeee" +
+		"4:name4:Show12:piece lengthi16384e6:pieces20:" + strings.Repeat("x", 20) + "ee"))
+
+func newTestService(t *testing.T) (*tests.TestApp, *transmission.MockClient, *Service) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	client := transmission.NewMockClient(testApp)
+	syncService := transmission.NewSyncService(testApp, client, 0)
+	service := NewService(&pocketbase.PocketBase{App: testApp}, client, syncService, audit.NewService(testApp))
+
+	return testApp, client, service
+}
+
+func TestAddTorrentWithFileSelection(t *testing.T) {
+	_, client, service := newTestService(t)
+
+	preview, err := service.Preview(twoFiles)
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if preview.Name != "Show" || len(preview.Files) != 2 || preview.Files[1].Path != "b.nfo" {
+		t.Fatalf("Unexpected preview %+v", preview)
+	}
+
+	added, err := service.AddTorrent(context.Background(), AddTorrentRequest{
+		Torrent:       twoFiles,
+		Label:         "tv",
+		FilesUnwanted: []int64{1},
+		PriorityHigh:  []int64{0},
+	})
+	if err != nil {
+		t.Fatalf("AddTorrent failed: %v", err)
+	}
+
+	options, ok := client.AddedWith(added.HashString)
+	if !ok || len(options.FilesUnwanted) != 1 || options.FilesUnwanted[0] != 1 || len(options.Labels) != 1 || options.Labels[0] != "tv" {
+		t.Errorf("Expected the selection and label to reach Transmission, got %+v", options)
+	}
+
+	invalid := []AddTorrentRequest{
+		{Torrent: twoFiles, FilesUnwanted: []int64{2}},
+		{Torrent: twoFiles, FilesUnwanted: []int64{0, 1}},
+		{Torrent: twoFiles, PriorityHigh: []int64{0}, PriorityLow: []int64{0}},
+		{Torrent: "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", FilesUnwanted: []int64{0}},
+		{Torrent: twoFiles, Label: "a,b"},
+	}
+	for _, req := range invalid {
+		if _, err := service.AddTorrent(context.Background(), req); err == nil {
+			t.Errorf("Expected %+v to be rejected", req)
+		}
+	}
+}
+
+func TestAddTorrentRejectsDuplicates(t *testing.T) {
+	testApp, client, service := newTestService(t)
+
+	owner := testutil.CreateUser(t, testApp, "owner@example.com", "user")
+
+	hash := "0123456789abcdef0123456789abcdef01234567"
+	added, err := service.AddTorrent(context.Background(), AddTorrentRequest{
+		Torrent: "magnet:?xt=urn:btih:" + hash + "&tr=https%3A%2F%2Fa.example%2Fannounce",
+		UserID:  owner.Id,
+	})
+	if err != nil {
+		t.Fatalf("AddTorrent failed: %v", err)
+	}
+
+	// The mock makes up hashes, so give the torrent and its record the real one
+	record, err := testApp.FindFirstRecordByData("torrents", "hash", added.HashString)
+	if err != nil {
+		t.Fatalf("Failed to find synced torrent: %v", err)
+	}
+	added.HashString = hash
+	record.Set("hash", hash)
+	if err := testApp.Save(record); err != nil {
+		t.Fatalf("Failed to update torrent: %v", err)
+	}
+	if err := client.SetTorrents(context.Background(), []int64{added.ID}, transmission.TorrentSettings{TrackerList: []string{"https://a.example/announce"}}); err != nil {
+		t.Fatalf("SetTorrents failed: %v", err)
+	}
+
+	// The same infohash in base32, with one new tracker
+	addAgain := func(userID string) DuplicateError {
+		t.Helper()
+
+		_, err := service.AddTorrent(context.Background(), AddTorrentRequest{
+			Torrent:       "magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH&tr=https%3A%2F%2Fa.example%2Fannounce&tr=udp%3A%2F%2Fb.example%3A80",
+			MergeTrackers: true,
+			UserID:        userID,
+		})
+		var duplicateErr DuplicateError
+		if !errors.As(err, &duplicateErr) {
+			t.Fatalf("Expected a duplicate error, got %v", err)
+		}
+		return duplicateErr
+	}
+
+	// Other users may not change the torrent
+	if duplicate := addAgain(testutil.CreateUser(t, testApp, "other@example.com", "user").Id); duplicate.TrackersAdded != 0 {
+		t.Errorf("Expected other users not to merge trackers, got %+v", duplicate)
+	}
+
+	duplicate := addAgain(owner.Id)
+	if duplicate.ID != record.Id || duplicate.OwnerID != owner.Id || duplicate.OwnerName != "owner" || duplicate.TrackersAdded != 1 {
+		t.Errorf("Unexpected duplicate %+v", duplicate)
+	}
+
+	torrents, err := client.GetTorrents(context.Background())
+	if err != nil {
+		t.Fatalf("GetTorrents failed: %v", err)
+	}
+	var existing *transmission.TorrentData
+	for _, t := range torrents {
+		if t.ID == added.ID {
+			existing = t
+		}
+	}
+	if strings.Join(existing.TrackerList, ",") != "https://a.example/announce,,udp://b.example:80" {
+		t.Errorf("Expected the new tracker in a tier of its own, got %q", existing.TrackerList)
+	}
+	if len(torrents) != int(added.ID) {
+		t.Errorf("Expected the duplicate not to be added, got %d torrents", len(torrents))
+	}
+
+	// Private torrents keep their trackers, even for their owner
+	existing.IsPrivate = true
+	existing.TrackerList = []string{"https://a.example/announce"}
+	if duplicate := addAgain(owner.Id); duplicate.TrackersAdded != 0 || len(existing.TrackerList) != 1 {
+		t.Errorf("Expected private torrents not to get new trackers, got %+v", duplicate)
+	}
+}
+
+func TestAddTorrentsReportsEachItem(t *testing.T) {
+	_, client, service := newTestService(t)
+
+	items := []BulkItem{
+		{Source: "show.torrent", Request: AddTorrentRequest{Torrent: twoFiles, FilesUnwanted: []int64{1}}},
+		{Source: "again.torrent", Request: AddTorrentRequest{Torrent: twoFiles}},
+		{Source: "broken.torrent", Err: errors.New("torrent file exceeds 10 bytes")},
+		{Source: "labelled", Request: AddTorrentRequest{Torrent: "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", Label: "a,b"}},
+	}
+	for i := 0; i < 6; i++ {
+		magnet := "magnet:?xt=urn:btih:" + strings.Repeat(string(rune('a'+i)), 40)
+		items = append(items, BulkItem{Source: magnet, Request: AddTorrentRequest{Torrent: magnet}})
+	}
+
+	results := service.AddTorrents(context.Background(), items)
+	if len(results) != len(items) {
+		t.Fatalf("Expected a result per item, got %d", len(results))
+	}
+
+	expected := []BulkStatus{BulkAdded, BulkDuplicate, BulkError, BulkError}
+	for i, status := range expected {
+		if results[i].Index != i || results[i].Source != items[i].Source || results[i].Status != status {
+			t.Errorf("Expected item %d to be %s, got %+v", i, status, results[i])
+		}
+	}
+	for _, result := range results[4:] {
+		if result.Status != BulkAdded || result.TransmissionID == 0 {
+			t.Errorf("Expected %s to be added, got %+v", result.Source, result)
+		}
+	}
+
+	if options, ok := client.AddedWith(results[0].Hash); !ok || len(options.FilesUnwanted) != 1 {
+		t.Errorf("Expected the item's own options to be used, got %+v", options)
+	}
+}
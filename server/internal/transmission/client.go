@@ -45,6 +45,40 @@ type TorrentData struct {
 	DoneDate       *time.Time    `json:"doneDate,omitempty"`
 	Error          string        `json:"error,omitempty"`
 	ErrorString    string        `json:"errorString,omitempty"`
+	DownloadDir    string        `json:"downloadDir,omitempty"`
+	Labels         []string      `json:"labels,omitempty"`
+	// TrackerList holds the announce URLs, with an empty entry between tiers
+	TrackerList []string `json:"trackerList,omitempty"`
+	IsPrivate   bool     `json:"isPrivate,omitempty"`
+}
+
+// TorrentSettings holds per-torrent settings to change. Nil fields are left untouched.
+type TorrentSettings struct {
+	Labels            []string `json:"labels,omitempty"`
+	Location          *string  `json:"location,omitempty"`
+	BandwidthPriority *int64   `json:"bandwidthPriority,omitempty"`
+	QueuePosition     *int64   `json:"queuePosition,omitempty"`
+	DownloadLimit     *int64   `json:"downloadLimit,omitempty"`
+	DownloadLimited   *bool    `json:"downloadLimited,omitempty"`
+	UploadLimit       *int64   `json:"uploadLimit,omitempty"`
+	UploadLimited     *bool    `json:"uploadLimited,omitempty"`
+	SeedRatioLimit    *float64 `json:"seedRatioLimit,omitempty"`
+	SeedRatioMode     *int64   `json:"seedRatioMode,omitempty"`
+	// SeedIdleLimit is in minutes
+	SeedIdleLimit *int64 `json:"seedIdleLimit,omitempty"`
+	SeedIdleMode  *int64 `json:"seedIdleMode,omitempty"`
+	// TrackerList replaces the announce URLs, with an empty entry between tiers
+	TrackerList []string `json:"trackerList,omitempty"`
+}
+
+// AddOptions holds the settings a torrent is added with. FilesUnwanted and
+// the priority lists hold file indices of .torrent files.
+type AddOptions struct {
+	DownloadDir   *string  `json:"downloadDir,omitempty"`
+	Labels        []string `json:"labels,omitempty"`
+	FilesUnwanted []int64  `json:"filesUnwanted,omitempty"`
+	PriorityHigh  []int64  `json:"priorityHigh,omitempty"`
+	PriorityLow   []int64  `json:"priorityLow,omitempty"`
 }
 
 // Client wraps the Transmission RPC client
@@ -183,6 +217,17 @@ func (c *Client) GetTorrents(ctx context.Context) ([]*TorrentData, error) {
 			torrentData.ErrorString = *t.ErrorString
 		}
 
+		if t.DownloadDir != nil {
+			torrentData.DownloadDir = *t.DownloadDir
+		}
+		if t.TrackerList != nil && *t.TrackerList != "" {
+			torrentData.TrackerList = strings.Split(strings.TrimRight(*t.TrackerList, "\n"), "\n")
+		}
+		if t.IsPrivate != nil {
+			torrentData.IsPrivate = *t.IsPrivate
+		}
+		torrentData.Labels = t.Labels
+
 		result = append(result, torrentData)
 	}
 
@@ -212,10 +257,14 @@ func mapTransmissionStatus(status transmissionrpc.TorrentStatus) TorrentStatus {
 }
 
 // AddTorrent adds a new torrent by magnet link or base64-encoded torrent file
-func (c *Client) AddTorrent(ctx context.Context, torrentData string, downloadDir *string) (*TorrentData, error) {
+func (c *Client) AddTorrent(ctx context.Context, torrentData string, options AddOptions) (*TorrentData, error) {
 	// Create TorrentAddPayload
 	payload := transmissionrpc.TorrentAddPayload{
-		DownloadDir: downloadDir,
+		DownloadDir:   options.DownloadDir,
+		Labels:        options.Labels,
+		FilesUnwanted: options.FilesUnwanted,
+		PriorityHigh:  options.PriorityHigh,
+		PriorityLow:   options.PriorityLow,
 	}
 
 	// Check if it's a magnet link or base64 torrent data
@@ -319,9 +368,48 @@ func (c *Client) AddTorrent(ctx context.Context, torrentData string, downloadDir
 		result.ErrorString = *t.ErrorString
 	}
 
+	if t.DownloadDir != nil {
+		result.DownloadDir = *t.DownloadDir
+	}
+	result.Labels = t.Labels
+
 	return result, nil
 }
 
+// SetTorrents changes settings of the specified torrents
+func (c *Client) SetTorrents(ctx context.Context, ids []int64, settings TorrentSettings) error {
+	payload := transmissionrpc.TorrentSetPayload{
+		IDs:               ids,
+		Labels:            settings.Labels,
+		Location:          settings.Location,
+		BandwidthPriority: settings.BandwidthPriority,
+		QueuePosition:     settings.QueuePosition,
+		DownloadLimit:     settings.DownloadLimit,
+		DownloadLimited:   settings.DownloadLimited,
+		UploadLimit:       settings.UploadLimit,
+		UploadLimited:     settings.UploadLimited,
+		SeedRatioLimit:    settings.SeedRatioLimit,
+		SeedIdleMode:      settings.SeedIdleMode,
+		TrackerList:       settings.TrackerList,
+	}
+
+	if settings.SeedRatioMode != nil {
+		mode := transmissionrpc.SeedRatioMode(*settings.SeedRatioMode)
+		payload.SeedRatioMode = &mode
+	}
+
+	if settings.SeedIdleLimit != nil {
+		limit := time.Duration(*settings.SeedIdleLimit) * time.Minute
+		payload.SeedIdleLimit = &limit
+	}
+
+	if err := c.client.TorrentSet(ctx, payload); err != nil {
+		return fmt.Errorf("failed to set torrents: %w", err)
+	}
+
+	return nil
+}
+
 // StartTorrents starts the specified torrents
 func (c *Client) StartTorrents(ctx context.Context, ids []int64) error {
 	err := c.client.TorrentStartIDs(ctx, ids)
@@ -0,0 +1,128 @@
+package transmission
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// EventType names a torrent lifecycle transition detected by the sync
+type EventType string
+
+const (
+	EventTorrentAdded      EventType = "added"
+	EventDownloadCompleted EventType = "completed"
+	EventTorrentError      EventType = "error"
+	EventTorrentRemoved    EventType = "removed"
+)
+
+// EventTypes lists all lifecycle event types
+var EventTypes = []EventType{EventTorrentAdded, EventDownloadCompleted, EventTorrentError, EventTorrentRemoved}
+
+// Event is a torrent lifecycle transition
+type Event struct {
+	Type EventType `json:"type"`
+	// Torrent is the torrent as of the transition; for removed torrents it is
+	// the last synced state
+	Torrent TorrentData `json:"torrent"`
+	// RecordID is the id of the torrents record
+	RecordID string `json:"recordId"`
+	// UserID is the owner of the torrent, if any
+	UserID string    `json:"userId,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// EventHandler receives lifecycle events. Handlers run synchronously after
+// each sync, so they must hand slow work off to goroutines.
+type EventHandler func(Event)
+
+// OnEvent registers a handler for torrent lifecycle events
+func (s *SyncService) OnEvent(handler EventHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers = append(s.handlers, handler)
+}
+
+// AssignOwner remembers the owner of a torrent that is about to be added so
+// the sync creates its record with the owner already set
+func (s *SyncService) AssignOwner(hash, userID string) {
+	if hash == "" || userID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.owners == nil {
+		s.owners = map[string]string{}
+	}
+	s.owners[hash] = userID
+}
+
+// takeOwner returns and forgets the pending owner of a torrent
+func (s *SyncService) takeOwner(hash string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID := s.owners[hash]
+	delete(s.owners, hash)
+	return userID
+}
+
+// emit delivers events to the registered handlers
+func (s *SyncService) emit(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	s.mu.RLock()
+	handlers := append([]EventHandler(nil), s.handlers...)
+	s.mu.RUnlock()
+
+	for _, event := range events {
+		for _, handler := range handlers {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("[Sync] Event handler panicked on %s event: %v", event.Type, r)
+					}
+				}()
+				handler(event)
+			}()
+		}
+	}
+}
+
+// newEvent builds an event for a torrent and its record
+func newEvent(eventType EventType, record *core.Record, torrent *TorrentData) Event {
+	return Event{
+		Type:     eventType,
+		Torrent:  *torrent,
+		RecordID: record.Id,
+		UserID:   record.GetString("user"),
+		Time:     time.Now(),
+	}
+}
+
+// torrentFromRecord restores the last synced torrent data of a record
+func torrentFromRecord(record *core.Record) *TorrentData {
+	torrent := &TorrentData{}
+	if raw, err := json.Marshal(record.Get("transmissionData")); err == nil {
+		_ = json.Unmarshal(raw, torrent)
+	}
+
+	if torrent.ID == 0 {
+		torrent.ID = int64(record.GetInt("transmissionId"))
+	}
+	if torrent.Name == "" {
+		torrent.Name = record.GetString("name")
+	}
+	if torrent.HashString == "" {
+		torrent.HashString = record.GetString("hash")
+	}
+
+	return torrent
+}
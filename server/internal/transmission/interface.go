@@ -7,10 +7,11 @@ import (
 // TransmissionClient defines the interface for both real and mock clients
 type TransmissionClient interface {
 	GetTorrents(ctx context.Context) ([]*TorrentData, error)
-	AddTorrent(ctx context.Context, torrentData string, downloadDir *string) (*TorrentData, error)
+	AddTorrent(ctx context.Context, torrentData string, options AddOptions) (*TorrentData, error)
 	StartTorrents(ctx context.Context, ids []int64) error
 	StopTorrents(ctx context.Context, ids []int64) error
 	RemoveTorrents(ctx context.Context, ids []int64, deleteLocalData bool) error
+	SetTorrents(ctx context.Context, ids []int64, settings TorrentSettings) error
 	GetSessionStats(ctx context.Context) (interface{}, error)
 	GetSessionSettings(ctx context.Context) (interface{}, error)
 	SetSessionSettings(ctx context.Context, settings map[string]interface{}) error
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/pocketbase/pocketbase/core"
@@ -14,6 +15,9 @@ type MockClient struct {
 	app        core.App
 	torrents   []*TorrentData
 	lastUpdate time.Time
+	// added holds the options each torrent was added with, by hash
+	added map[string]AddOptions
+	mu    sync.Mutex
 }
 
 // NewMockClient creates a new mock Transmission client
@@ -22,11 +26,15 @@ func NewMockClient(app core.App) *MockClient {
 		app:        app,
 		torrents:   generateMockTorrents(),
 		lastUpdate: time.Now(),
+		added:      make(map[string]AddOptions),
 	}
 }
 
 // GetTorrents returns mock torrent data with simulated progress updates
 func (m *MockClient) GetTorrents(ctx context.Context) ([]*TorrentData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	// Simulate progress updates
 	now := time.Now()
 	if now.Sub(m.lastUpdate) > 2*time.Second {
@@ -38,7 +46,10 @@ func (m *MockClient) GetTorrents(ctx context.Context) ([]*TorrentData, error) {
 }
 
 // AddTorrent simulates adding a new torrent
-func (m *MockClient) AddTorrent(ctx context.Context, torrentData string, downloadDir *string) (*TorrentData, error) {
+func (m *MockClient) AddTorrent(ctx context.Context, torrentData string, options AddOptions) (*TorrentData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	newTorrent := &TorrentData{
 		ID:             int64(len(m.torrents) + 1),
 		Name:           fmt.Sprintf("New Torrent %d", len(m.torrents)+1),
@@ -55,13 +66,30 @@ func (m *MockClient) AddTorrent(ctx context.Context, torrentData string, downloa
 		UploadedEver:   0,
 		AddedDate:      time.Now(),
 	}
+	if options.DownloadDir != nil {
+		newTorrent.DownloadDir = *options.DownloadDir
+	}
+	newTorrent.Labels = options.Labels
 
 	m.torrents = append(m.torrents, newTorrent)
+	m.added[newTorrent.HashString] = options
 	return newTorrent, nil
 }
 
+// AddedWith returns the options the torrent with the given hash was added with
+func (m *MockClient) AddedWith(hash string) (AddOptions, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	options, ok := m.added[hash]
+	return options, ok
+}
+
 // StartTorrents simulates starting torrents
 func (m *MockClient) StartTorrents(ctx context.Context, ids []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for _, id := range ids {
 		for _, t := range m.torrents {
 			if t.ID == id {
@@ -77,6 +105,9 @@ func (m *MockClient) StartTorrents(ctx context.Context, ids []int64) error {
 
 // StopTorrents simulates stopping torrents
 func (m *MockClient) StopTorrents(ctx context.Context, ids []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for _, id := range ids {
 		for _, t := range m.torrents {
 			if t.ID == id {
@@ -91,6 +122,9 @@ func (m *MockClient) StopTorrents(ctx context.Context, ids []int64) error {
 
 // RemoveTorrents simulates removing torrents
 func (m *MockClient) RemoveTorrents(ctx context.Context, ids []int64, deleteLocalData bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	// Mark as removed rather than actually removing from slice for demo
 	for _, id := range ids {
 		for _, t := range m.torrents {
@@ -102,6 +136,30 @@ func (m *MockClient) RemoveTorrents(ctx context.Context, ids []int64, deleteLoca
 	return nil
 }
 
+// SetTorrents simulates changing torrent settings; only labels, location and trackers are kept
+func (m *MockClient) SetTorrents(ctx context.Context, ids []int64, settings TorrentSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		for _, t := range m.torrents {
+			if t.ID != id {
+				continue
+			}
+			if settings.Labels != nil {
+				t.Labels = settings.Labels
+			}
+			if settings.Location != nil {
+				t.DownloadDir = *settings.Location
+			}
+			if settings.TrackerList != nil {
+				t.TrackerList = settings.TrackerList
+			}
+		}
+	}
+	return nil
+}
+
 // GetSessionStats returns mock session statistics
 func (m *MockClient) GetSessionStats(ctx context.Context) (interface{}, error) {
 	return map[string]interface{}{
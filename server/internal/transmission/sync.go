@@ -20,6 +20,11 @@ type SyncService struct {
 	mu        sync.RWMutex
 	lastSync  time.Time
 	isRunning bool
+	handlers  []EventHandler
+	// owners holds the owners of torrents being added, keyed by hash
+	owners map[string]string
+	// syncMu serializes syncs, so concurrent adds don't create a record twice
+	syncMu sync.Mutex
 }
 
 // NewSyncService creates a new sync service
@@ -112,6 +117,7 @@ func (s *SyncService) syncOnce() error {
 	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
 	defer cancel()
 
+	s.syncMu.Lock()
 	// Get torrents from Transmission
 	torrents, err := s.client.GetTorrents(ctx)
 
@@ -119,11 +125,14 @@ func (s *SyncService) syncOnce() error {
 	log.Println("Error", err)
 
 	if err != nil {
+		s.syncMu.Unlock()
 		return fmt.Errorf("failed to get torrents from Transmission: %w", err)
 	}
 
 	// Update PocketBase with torrent data
-	if err := s.updateTorrentsInDB(torrents); err != nil {
+	events, err := s.updateTorrentsInDB(torrents)
+	s.syncMu.Unlock()
+	if err != nil {
 		return fmt.Errorf("failed to update torrents in database: %w", err)
 	}
 
@@ -131,16 +140,19 @@ func (s *SyncService) syncOnce() error {
 	s.lastSync = time.Now()
 	s.mu.Unlock()
 
+	s.emit(events)
+
 	log.Printf("Sync completed successfully. Updated %d torrents", len(torrents))
 	return nil
 }
 
-// updateTorrentsInDB updates the torrents collection in PocketBase
-func (s *SyncService) updateTorrentsInDB(torrents []*TorrentData) error {
+// updateTorrentsInDB updates the torrents collection in PocketBase and
+// returns the lifecycle events of the changes
+func (s *SyncService) updateTorrentsInDB(torrents []*TorrentData) ([]Event, error) {
 	log.Println("Updating torrents in DB...")
 	collection, err := s.app.FindCollectionByNameOrId("torrents")
 	if err != nil {
-		return fmt.Errorf("torrents collection not found: %w", err)
+		return nil, fmt.Errorf("torrents collection not found: %w", err)
 	}
 
 	log.Println("Fetching existing torrent records from database...")
@@ -151,7 +163,7 @@ func (s *SyncService) updateTorrentsInDB(torrents []*TorrentData) error {
 
 	records, err := s.app.FindRecordsByFilter(collection, "", "", 0, 0, nil)
 	if err != nil {
-		return fmt.Errorf("failed to fetch existing torrents: %w", err)
+		return nil, fmt.Errorf("failed to fetch existing torrents: %w", err)
 	}
 	log.Printf("Fetched %d existing torrent records.", len(records))
 
@@ -170,6 +182,7 @@ func (s *SyncService) updateTorrentsInDB(torrents []*TorrentData) error {
 
 	// Track current transmission torrent hashes
 	currentHashes := make(map[string]bool)
+	var events []Event
 
 	log.Println("Processing torrents from Transmission...")
 	// Update or create torrents
@@ -190,6 +203,9 @@ func (s *SyncService) updateTorrentsInDB(torrents []*TorrentData) error {
 		}
 
 		if exists {
+			wasDone := !record.GetDateTime("doneDate").IsZero()
+			hadError := record.GetString("errorString") != ""
+
 			// Update existing record
 			if err := s.updateTorrentRecord(record, torrent); err != nil {
 				log.Printf("Failed to update torrent %s: %v", torrent.Name, err)
@@ -197,12 +213,28 @@ func (s *SyncService) updateTorrentsInDB(torrents []*TorrentData) error {
 			}
 
 			delete(existingRecords, record.Id)
+
+			// The record predates the add, the caller assigns the owner itself
+			s.takeOwner(torrent.HashString)
+
+			if !wasDone && torrent.DoneDate != nil {
+				events = append(events, newEvent(EventDownloadCompleted, record, torrent))
+			}
+			if !hadError && torrent.ErrorString != "" {
+				events = append(events, newEvent(EventTorrentError, record, torrent))
+			}
 		} else {
 			// Create new record
-			if err := s.createTorrentRecord(collection, torrent); err != nil {
+			record, err := s.createTorrentRecord(collection, torrent)
+			if err != nil {
 				log.Printf("Failed to create torrent %s: %v", torrent.Name, err)
 				continue
 			}
+
+			events = append(events, newEvent(EventTorrentAdded, record, torrent))
+			if torrent.ErrorString != "" {
+				events = append(events, newEvent(EventTorrentError, record, torrent))
+			}
 		}
 	}
 	log.Println("Finished processing torrents from Transmission.")
@@ -219,12 +251,15 @@ func (s *SyncService) updateTorrentsInDB(torrents []*TorrentData) error {
 				} else {
 					log.Printf("Failed to delete torrent record (id: %s): %v", record.Id, err)
 				}
+				continue
 			}
+
+			events = append(events, newEvent(EventTorrentRemoved, record, torrentFromRecord(record)))
 		}
 	}
 	log.Println("Finished checking for removed torrents.")
 
-	return nil
+	return events, nil
 }
 
 // updateTorrentRecord updates an existing torrent record
@@ -289,10 +324,15 @@ func (s *SyncService) updateTorrentRecord(record *core.Record, torrent *TorrentD
 	record.Set("downloadedEver", torrent.DownloadedEver)
 	record.Set("uploadedEver", torrent.UploadedEver)
 	record.Set("error", torrent.Error)
-	record.Set("errorString", torrent.ErrorString)
 	record.Set("transmissionData", torrent)
 	record.Set("updated", time.Now())
 
+	// Errors are lifecycle events, so persist them right away
+	if record.GetString("errorString") != torrent.ErrorString {
+		record.Set("errorString", torrent.ErrorString)
+		changed = true
+	}
+
 	if torrent.DoneDate != nil && record.GetDateTime("doneDate").IsZero() {
 		record.Set("doneDate", *torrent.DoneDate)
 		changed = true
@@ -314,7 +354,7 @@ func (s *SyncService) updateTorrentRecord(record *core.Record, torrent *TorrentD
 }
 
 // createTorrentRecord creates a new torrent record
-func (s *SyncService) createTorrentRecord(collection *core.Collection, torrent *TorrentData) error {
+func (s *SyncService) createTorrentRecord(collection *core.Collection, torrent *TorrentData) (*core.Record, error) {
 	record := core.NewRecord(collection)
 
 	name := torrent.Name
@@ -358,13 +398,17 @@ func (s *SyncService) createTorrentRecord(collection *core.Collection, torrent *
 		record.Set("doneDate", *torrent.DoneDate)
 	}
 
+	if owner := s.takeOwner(torrent.HashString); owner != "" {
+		record.Set("user", owner)
+	}
+
 	log.Printf("[Sync] Creating new torrent record: %s (Transmission ID: %d)", name, torrent.ID)
 	if err := s.app.Save(record); err != nil {
 		log.Printf("[Sync] Failed to create torrent: %v", err)
-		return err
+		return nil, err
 	}
 	log.Printf("[Sync] Successfully created torrent: %s (PocketBase ID: %s)", name, record.Id)
-	return nil
+	return record, nil
 }
 
 // ForceSync triggers an immediate synchronization
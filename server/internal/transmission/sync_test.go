@@ -1,15 +1,17 @@
 package transmission
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/pocketbase/pocketbase/core"
-	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/testutil"
 )
 
 func TestUpdateTorrentRecordMetadata(t *testing.T) {
-	testApp, _ := tests.NewTestApp()
-	defer testApp.Cleanup()
+	testApp := testutil.NewTestApp(t)
 
 	// Create a basic collection for testing
 	collection := core.NewBaseCollection("test_torrents")
@@ -110,3 +112,52 @@ func TestUpdateTorrentRecordMetadata(t *testing.T) {
 		t.Errorf("Hash was not updated. Expected: 'abcdef1234567890', got: '%s'", record.GetString("hash"))
 	}
 }
+
+func TestSyncEmitsLifecycleEvents(t *testing.T) {
+	testApp := testutil.NewTestApp(t)
+
+	mockClient := NewMockClient(testApp)
+	syncService := NewSyncService(testApp, mockClient, 0)
+	if err := syncService.ForceSync(); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	owner := testutil.CreateUser(t, testApp, "owner@example.com", "user")
+
+	var events []Event
+	syncService.OnEvent(func(e Event) { events = append(events, e) })
+
+	added, err := mockClient.AddTorrent(context.Background(), "magnet:?xt=urn:btih:abc", AddOptions{})
+	if err != nil {
+		t.Fatalf("AddTorrent failed: %v", err)
+	}
+	syncService.AssignOwner(added.HashString, owner.Id)
+	if err := syncService.ForceSync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventTorrentAdded || events[0].UserID != owner.Id {
+		t.Fatalf("Expected an added event for the owner, got %+v", events)
+	}
+
+	now := time.Now()
+	added.DoneDate = &now
+	added.ErrorString = "No data found"
+	if err := syncService.ForceSync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	// Unchanged state must not repeat the events
+	if err := syncService.ForceSync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(events) != 3 || events[1].Type != EventDownloadCompleted || events[2].Type != EventTorrentError {
+		t.Fatalf("Expected completed and error events once, got %+v", events)
+	}
+
+	mockClient.torrents = mockClient.torrents[:len(mockClient.torrents)-1]
+	if err := syncService.ForceSync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(events) != 4 || events[3].Type != EventTorrentRemoved || events[3].Torrent.HashString != added.HashString {
+		t.Fatalf("Expected a removed event, got %+v", events)
+	}
+}
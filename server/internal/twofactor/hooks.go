@@ -0,0 +1,115 @@
+package twofactor
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// Error codes returned to clients so the login form can react.
+const (
+	CodeRequired           = "totp_required"
+	CodeInvalid            = "totp_invalid"
+	CodeEnrollmentRequired = "totp_enrollment_required"
+)
+
+const enforceMiddlewareID = "retorrentTwoFactor"
+
+// Body fields that carry the second factor on PocketBase auth requests.
+const (
+	bodyFieldCode         = "totpCode"
+	bodyFieldRecoveryCode = "recoveryCode"
+)
+
+func errorResponse(re *core.RequestEvent, status int, code, message string) error {
+	return re.JSON(status, map[string]any{
+		"status":  status,
+		"code":    code,
+		"message": message,
+		"data":    map[string]any{},
+	})
+}
+
+// Bind enforces two-factor authentication server-side:
+//
+//   - password and email OTP logins of enrolled users must include a valid
+//     totpCode or recoveryCode in the auth request body. Logins through SSO or
+//     the trusted proxy leave the second factor to the identity provider.
+//   - while admins are required to use 2FA, API requests of admins that haven't
+//     enrolled yet are refused except for the enrollment routes.
+func (s *Service) Bind(se *core.ServeEvent) {
+	se.App.OnRecordAuthRequest("users").BindFunc(func(e *core.RecordAuthRequestEvent) error {
+		if e.AuthMethod != core.MFAMethodPassword && e.AuthMethod != core.MFAMethodOTP {
+			return e.Next()
+		}
+
+		enabled, err := s.IsEnabled(e.Record.Id)
+		if err != nil {
+			return e.InternalServerError("Failed to load two-factor settings.", err)
+		}
+		if !enabled {
+			return e.Next()
+		}
+
+		info, err := e.RequestInfo()
+		if err != nil {
+			return e.BadRequestError("Failed to read the request body.", err)
+		}
+
+		code, _ := info.Body[bodyFieldCode].(string)
+		recoveryCode, _ := info.Body[bodyFieldRecoveryCode].(string)
+		if strings.TrimSpace(code) == "" && strings.TrimSpace(recoveryCode) == "" {
+			return errorResponse(e.RequestEvent, http.StatusUnauthorized, CodeRequired, "Two-factor authentication code required.")
+		}
+
+		if err := s.Verify(e.Record.Id, code, recoveryCode); err != nil {
+			if errors.Is(err, ErrInvalidCode) {
+				return errorResponse(e.RequestEvent, http.StatusUnauthorized, CodeInvalid, "Invalid two-factor authentication code.")
+			}
+			return e.InternalServerError("Failed to verify the two-factor code.", err)
+		}
+
+		return e.Next()
+	})
+
+	se.Router.Bind(&hook.Handler[*core.RequestEvent]{
+		Id: enforceMiddlewareID,
+		// Run after the auth token and any trusted proxy identity are loaded
+		Priority: apis.DefaultLoadAuthTokenMiddlewarePriority + 2,
+		Func: func(re *core.RequestEvent) error {
+			if re.Auth == nil || re.Auth.Collection().Name != "users" || re.Auth.GetString("role") != "admin" {
+				return re.Next()
+			}
+
+			path := re.Request.URL.Path
+			if !strings.HasPrefix(path, "/api/") ||
+				strings.HasPrefix(path, "/api/me/2fa") ||
+				strings.HasPrefix(path, "/api/auth/") ||
+				strings.HasPrefix(path, "/api/collections/users/auth-") {
+				return re.Next()
+			}
+
+			required, err := s.RequiredForAdmins()
+			if err != nil {
+				return re.InternalServerError("Failed to load security settings.", err)
+			}
+			if !required {
+				return re.Next()
+			}
+
+			enabled, err := s.IsEnabled(re.Auth.Id)
+			if err != nil {
+				return re.InternalServerError("Failed to load two-factor settings.", err)
+			}
+			if !enabled {
+				return errorResponse(re, http.StatusForbidden, CodeEnrollmentRequired, "Admins must set up two-factor authentication first.")
+			}
+
+			return re.Next()
+		},
+	})
+}
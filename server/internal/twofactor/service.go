@@ -0,0 +1,408 @@
+package twofactor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+
+	"backend/internal/audit"
+	"backend/internal/settings"
+)
+
+// SettingRequireAdmin is the settings key holding whether admins must use 2FA.
+const SettingRequireAdmin = "security.requireAdminTwoFactor"
+
+const (
+	period            = 30
+	skew              = 1
+	recoveryCodeCount = 10
+	qrCodeSize        = 256
+)
+
+var (
+	ErrInvalidCode      = errors.New("invalid verification code")
+	ErrNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrEnrollmentNeeded = errors.New("start enrollment before confirming a code")
+)
+
+// Service manages TOTP two-factor authentication for users.
+type Service struct {
+	app      core.App
+	audit    *audit.Service
+	settings *settings.Service
+}
+
+// NewService constructs a Service instance.
+func NewService(app core.App, auditService *audit.Service, settingsService *settings.Service) *Service {
+	return &Service{app: app, audit: auditService, settings: settingsService}
+}
+
+// Status describes a user's two-factor state.
+type Status struct {
+	Enabled                bool `json:"enabled"`
+	Pending                bool `json:"pending"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+	// Required is true when the user's role must use two-factor authentication.
+	Required bool `json:"required"`
+}
+
+// Enrollment carries the secret to add to an authenticator app.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// provisioning URI encoded in the QR code.
+	URI string `json:"uri"`
+	// QRCode is a PNG data URL of the provisioning URI.
+	QRCode string `json:"qrCode"`
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+		code := encoded[:4] + "-" + encoded[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// matchStep returns the time step the code belongs to, allowing for clock skew.
+// Codes from lastStep or earlier are refused so a code can't be replayed.
+func matchStep(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != 6 {
+		return 0, false
+	}
+
+	current := now.Unix() / period
+	for offset := int64(-skew); offset <= skew; offset++ {
+		step := current + offset
+		if step <= lastStep {
+			continue
+		}
+
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*period, 0), totp.ValidateOpts{
+			Period:    period,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func (s *Service) findRecord(app core.App, userID string) (*core.Record, error) {
+	record, err := app.FindFirstRecordByData("user_totp", "user", userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("find two-factor settings: %w", err)
+	}
+	return record, nil
+}
+
+// IsEnabled reports whether the user has confirmed a TOTP enrollment.
+func (s *Service) IsEnabled(userID string) (bool, error) {
+	record, err := s.findRecord(s.app, userID)
+	if err != nil {
+		return false, err
+	}
+	return record != nil && record.GetBool("enabled"), nil
+}
+
+// RequiredForAdmins reports whether admins must use two-factor authentication.
+func (s *Service) RequiredForAdmins() (bool, error) {
+	var required bool
+	if _, err := s.settings.Get(SettingRequireAdmin, &required); err != nil {
+		return false, err
+	}
+	return required, nil
+}
+
+// SetRequiredForAdmins changes whether admins must use two-factor authentication.
+func (s *Service) SetRequiredForAdmins(ctx context.Context, required bool) error {
+	before, err := s.RequiredForAdmins()
+	if err != nil {
+		return err
+	}
+
+	entry := audit.Entry{
+		Action: audit.ActionSecurityUpdate,
+		Before: map[string]any{"requireAdminTwoFactor": before},
+		After:  map[string]any{"requireAdminTwoFactor": required},
+	}
+
+	if err := s.settings.Set(SettingRequireAdmin, required); err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return err
+	}
+
+	s.audit.Record(ctx, entry)
+
+	return nil
+}
+
+// Status returns the two-factor state of the given user.
+func (s *Service) Status(user *core.Record) (Status, error) {
+	record, err := s.findRecord(s.app, user.Id)
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{}
+	if record != nil {
+		status.Enabled = record.GetBool("enabled")
+		status.Pending = !status.Enabled
+		if status.Enabled {
+			status.RecoveryCodesRemaining = len(record.GetStringSlice("recoveryCodes"))
+		}
+	}
+
+	if user.GetString("role") == "admin" {
+		if status.Required, err = s.RequiredForAdmins(); err != nil {
+			return Status{}, err
+		}
+	}
+
+	return status, nil
+}
+
+// Enroll starts a new enrollment with a fresh secret. The enrollment only
+// takes effect once Confirm succeeds.
+func (s *Service) Enroll(user *core.Record) (Enrollment, error) {
+	record, err := s.findRecord(s.app, user.Id)
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	if record != nil && record.GetBool("enabled") {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+
+	issuer := s.app.Settings().Meta.AppName
+	if issuer == "" {
+		issuer = "Retorrent"
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: user.Email(),
+		Period:      period,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("generate totp secret: %w", err)
+	}
+
+	if record == nil {
+		collection, err := s.app.FindCollectionByNameOrId("user_totp")
+		if err != nil {
+			return Enrollment{}, fmt.Errorf("find user_totp collection: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("user", user.Id)
+	}
+
+	record.Set("secret", key.Secret())
+	record.Set("enabled", false)
+	record.Set("recoveryCodes", []string{})
+	record.Set("lastUsedStep", 0)
+
+	if err := s.app.Save(record); err != nil {
+		return Enrollment{}, fmt.Errorf("save two-factor settings: %w", err)
+	}
+
+	image, err := key.Image(qrCodeSize, qrCodeSize)
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("render qr code: %w", err)
+	}
+
+	var qrCode bytes.Buffer
+	if err := png.Encode(&qrCode, image); err != nil {
+		return Enrollment{}, fmt.Errorf("encode qr code: %w", err)
+	}
+
+	return Enrollment{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode.Bytes()),
+	}, nil
+}
+
+// Confirm verifies the first code from the authenticator app, enables
+// two-factor authentication and returns the one-time recovery codes.
+func (s *Service) Confirm(ctx context.Context, user *core.Record, code string) ([]string, error) {
+	record, err := s.findRecord(s.app, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		return nil, ErrEnrollmentNeeded
+	}
+
+	if record.GetBool("enabled") {
+		return nil, ErrAlreadyEnabled
+	}
+
+	step, ok := matchStep(record.GetString("secret"), code, 0, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("generate recovery codes: %w", err)
+	}
+
+	record.Set("enabled", true)
+	record.Set("enabledAt", time.Now())
+	record.Set("lastUsedStep", step)
+	record.Set("recoveryCodes", hashes)
+
+	entry := audit.Entry{Action: audit.ActionTwoFactorEnable, Targets: []string{user.Id}}
+	if err := s.app.Save(record); err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return nil, fmt.Errorf("save two-factor settings: %w", err)
+	}
+
+	s.audit.Record(ctx, entry)
+
+	return codes, nil
+}
+
+// Verify checks a TOTP or recovery code for the user. Accepted TOTP codes
+// can't be reused and recovery codes are consumed.
+func (s *Service) Verify(userID, code, recoveryCode string) error {
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := s.findRecord(txApp, userID)
+		if err != nil {
+			return err
+		}
+
+		if record == nil || !record.GetBool("enabled") {
+			return ErrNotEnabled
+		}
+
+		if strings.TrimSpace(recoveryCode) != "" {
+			hash := hashRecoveryCode(recoveryCode)
+			remaining := record.GetStringSlice("recoveryCodes")
+			for i, candidate := range remaining {
+				if subtle.ConstantTimeCompare([]byte(candidate), []byte(hash)) == 1 {
+					record.Set("recoveryCodes", append(remaining[:i:i], remaining[i+1:]...))
+					return txApp.Save(record)
+				}
+			}
+			return ErrInvalidCode
+		}
+
+		step, ok := matchStep(record.GetString("secret"), code, int64(record.GetInt("lastUsedStep")), time.Now())
+		if !ok {
+			return ErrInvalidCode
+		}
+
+		record.Set("lastUsedStep", step)
+		return txApp.Save(record)
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after verifying a code.
+func (s *Service) RegenerateRecoveryCodes(user *core.Record, code string) ([]string, error) {
+	if err := s.Verify(user.Id, code, ""); err != nil {
+		return nil, err
+	}
+
+	record, err := s.findRecord(s.app, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("generate recovery codes: %w", err)
+	}
+
+	record.Set("recoveryCodes", hashes)
+	if err := s.app.Save(record); err != nil {
+		return nil, fmt.Errorf("save two-factor settings: %w", err)
+	}
+
+	return codes, nil
+}
+
+// Disable turns off two-factor authentication after verifying a TOTP or
+// recovery code.
+func (s *Service) Disable(ctx context.Context, user *core.Record, code, recoveryCode string) error {
+	if err := s.Verify(user.Id, code, recoveryCode); err != nil {
+		return err
+	}
+
+	return s.remove(ctx, user.Id, audit.ActionTwoFactorDisable)
+}
+
+// Reset removes another user's two-factor enrollment, e.g. after a lost device.
+func (s *Service) Reset(ctx context.Context, userID string) error {
+	return s.remove(ctx, userID, audit.ActionTwoFactorReset)
+}
+
+func (s *Service) remove(ctx context.Context, userID, action string) error {
+	record, err := s.findRecord(s.app, userID)
+	if err != nil {
+		return err
+	}
+
+	if record == nil {
+		return ErrNotEnabled
+	}
+
+	entry := audit.Entry{Action: action, Targets: []string{userID}}
+	if err := s.app.Delete(record); err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return fmt.Errorf("delete two-factor settings: %w", err)
+	}
+
+	s.audit.Record(ctx, entry)
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package twofactor
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+
+	"backend/internal/settings"
+	"backend/internal/testutil"
+)
+
+func newTestApp(t testing.TB) *tests.TestApp {
+	t.Helper()
+
+	testApp, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatalf("Failed to create test app: %v", err)
+	}
+
+	// The bundled test data turns on PocketBase's own MFA for users
+	users, err := testApp.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+	users.MFA.Enabled = false
+	if err := testApp.Save(users); err != nil {
+		t.Fatalf("Failed to disable MFA: %v", err)
+	}
+
+	return testApp
+}
+
+func codeAt(t testing.TB, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+		Period:    period,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	return code
+}
+
+// enroll enables 2FA for the user and returns the secret and recovery codes.
+func enroll(t testing.TB, service *Service, user *core.Record) (string, []string) {
+	t.Helper()
+
+	enrollment, err := service.Enroll(user)
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,") {
+		t.Fatalf("Unexpected enrollment: %+v", enrollment)
+	}
+
+	// Confirm with the previous step's code so the current one is still usable
+	codes, err := service.Confirm(context.Background(), user, codeAt(t, enrollment.Secret, time.Now().Add(-period*time.Second)))
+	if err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	return enrollment.Secret, codes
+}
+
+func TestVerify(t *testing.T) {
+	testApp := newTestApp(t)
+	defer testApp.Cleanup()
+
+	service := NewService(testApp, nil, settings.NewService(testApp))
+	user := testutil.CreateUser(t, testApp, "alice@example.com", "user")
+
+	if _, err := service.Confirm(context.Background(), user, "123456"); err != ErrEnrollmentNeeded {
+		t.Fatalf("Expected ErrEnrollmentNeeded, got %v", err)
+	}
+
+	secret, recoveryCodes := enroll(t, service, user)
+
+	code := codeAt(t, secret, time.Now())
+	if err := service.Verify(user.Id, code, ""); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if err := service.Verify(user.Id, code, ""); err != ErrInvalidCode {
+		t.Errorf("Expected a replayed code to be rejected, got %v", err)
+	}
+
+	if err := service.Verify(user.Id, "", strings.ToLower(recoveryCodes[0])); err != nil {
+		t.Fatalf("Verify with recovery code failed: %v", err)
+	}
+	if err := service.Verify(user.Id, "", recoveryCodes[0]); err != ErrInvalidCode {
+		t.Errorf("Expected a used recovery code to be rejected, got %v", err)
+	}
+
+	status, err := service.Status(user)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !status.Enabled || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	if err := service.Disable(context.Background(), user, "", recoveryCodes[1]); err != nil {
+		t.Fatalf("Disable failed: %v", err)
+	}
+	if enabled, _ := service.IsEnabled(user.Id); enabled {
+		t.Errorf("Expected 2FA to be disabled")
+	}
+}
+
+func TestLoginEnforcement(t *testing.T) {
+	var secret string
+	var recoveryCodes []string
+
+	factory := func(t testing.TB) *tests.TestApp {
+		testApp := newTestApp(t)
+		service := NewService(testApp, nil, settings.NewService(testApp))
+		user := testutil.CreateUser(t, testApp, "alice@example.com", "user")
+		secret, recoveryCodes = enroll(t, service, user)
+		testutil.CreateUser(t, testApp, "bob@example.com", "admin")
+		return testApp
+	}
+
+	before := func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+		service := NewService(app, nil, settings.NewService(app))
+		service.Bind(e)
+	}
+
+	login := func(email, extra string) *strings.Reader {
+		return strings.NewReader(`{"identity":"` + email + `","password":"` + testutil.Password + `"` + extra + `}`)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:               "password alone is not enough once enrolled",
+			Method:             http.MethodPost,
+			URL:                "/api/collections/users/auth-with-password",
+			Body:               login("alice@example.com", ""),
+			ExpectedStatus:     http.StatusUnauthorized,
+			ExpectedContent:    []string{`"code":"` + CodeRequired + `"`},
+			NotExpectedContent: []string{`"token":`},
+			TestAppFactory:     factory,
+			BeforeTestFunc:     before,
+		},
+		{
+			Name:            "wrong code is rejected",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-password",
+			Body:            login("alice@example.com", `,"totpCode":"000000"`),
+			ExpectedStatus:  http.StatusUnauthorized,
+			ExpectedContent: []string{`"code":"` + CodeInvalid + `"`},
+			TestAppFactory:  factory,
+			BeforeTestFunc:  before,
+		},
+		{
+			Name:   "valid code completes the login",
+			Method: http.MethodPost,
+			URL:    "/api/collections/users/auth-with-password",
+			Body: &lazyBody{build: func() string {
+				return `{"identity":"alice@example.com","password":"` + testutil.Password + `","totpCode":"` + codeAt(t, secret, time.Now()) + `"}`
+			}},
+			TestAppFactory:  factory,
+			BeforeTestFunc:  before,
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"token":`},
+		},
+		{
+			Name:   "recovery code completes the login",
+			Method: http.MethodPost,
+			URL:    "/api/collections/users/auth-with-password",
+			Body: &lazyBody{build: func() string {
+				return `{"identity":"alice@example.com","password":"` + testutil.Password + `","recoveryCode":"` + recoveryCodes[0] + `"}`
+			}},
+			TestAppFactory:  factory,
+			BeforeTestFunc:  before,
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"token":`},
+		},
+		{
+			Name:            "users without 2FA log in with a password",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-password",
+			Body:            login("bob@example.com", ""),
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"token":`},
+			TestAppFactory:  factory,
+			BeforeTestFunc:  before,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestAdminEnrollmentRequired(t *testing.T) {
+	// Filled in by the factory once the admin exists
+	headers := map[string]string{}
+
+	factory := func(t testing.TB) *tests.TestApp {
+		testApp := newTestApp(t)
+
+		admin := testutil.CreateUser(t, testApp, "root@example.com", "admin")
+		token, err := admin.NewAuthToken()
+		if err != nil {
+			t.Fatalf("Failed to create auth token: %v", err)
+		}
+		headers["Authorization"] = token
+
+		service := NewService(testApp, nil, settings.NewService(testApp))
+		if err := service.SetRequiredForAdmins(context.Background(), true); err != nil {
+			t.Fatalf("SetRequiredForAdmins failed: %v", err)
+		}
+
+		return testApp
+	}
+
+	before := func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+		service := NewService(app, nil, settings.NewService(app))
+		service.Bind(e)
+		e.Router.GET("/api/test/protected", func(re *core.RequestEvent) error {
+			return re.NoContent(http.StatusNoContent)
+		})
+		e.Router.GET("/api/me/2fa", func(re *core.RequestEvent) error {
+			status, err := service.Status(re.Auth)
+			if err != nil {
+				return err
+			}
+			return re.JSON(http.StatusOK, status)
+		})
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "admins without 2FA are blocked",
+			Method:          http.MethodGet,
+			URL:             "/api/test/protected",
+			Headers:         headers,
+			ExpectedStatus:  http.StatusForbidden,
+			ExpectedContent: []string{`"code":"` + CodeEnrollmentRequired + `"`},
+			TestAppFactory:  factory,
+			BeforeTestFunc:  before,
+		},
+		{
+			Name:            "enrollment routes stay reachable",
+			Method:          http.MethodGet,
+			URL:             "/api/me/2fa",
+			Headers:         headers,
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"required":true`},
+			TestAppFactory:  factory,
+			BeforeTestFunc:  before,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+// lazyBody defers building a request body until the scenario sends it, after
+// the app factory has generated the data it depends on.
+type lazyBody struct {
+	build  func() string
+	reader *strings.Reader
+}
+
+func (b *lazyBody) Read(p []byte) (int, error) {
+	if b.reader == nil {
+		b.reader = strings.NewReader(b.build())
+	}
+	return b.reader.Read(p)
+}
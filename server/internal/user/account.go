@@ -0,0 +1,137 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+	"backend/internal/torrent"
+)
+
+// ErrInvalidPassword is returned when the current password doesn't match.
+var ErrInvalidPassword = errors.New("current password is incorrect")
+
+// MeResponse is the current user's own account, including personal settings.
+type MeResponse struct {
+	Response
+	Defaults torrent.Defaults `json:"defaults"`
+}
+
+// ProfileParams holds the account fields users can change themselves. The
+// email is not among them: proxy and OIDC logins find accounts by email, so
+// a new address must be confirmed through PocketBase's request-email-change
+// and confirm-email-change endpoints.
+type ProfileParams struct {
+	Name *string
+}
+
+func mapMeRecord(record *core.Record) (MeResponse, error) {
+	defaults, err := torrent.DefaultsFromRecord(record)
+	if err != nil {
+		return MeResponse{}, fmt.Errorf("decode defaults: %w", err)
+	}
+
+	return MeResponse{Response: mapUserRecord(record), Defaults: defaults}, nil
+}
+
+func (s *Service) findUser(id string) (*core.Record, error) {
+	record, err := s.app.FindRecordById("users", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: "user not found"}
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	return record, nil
+}
+
+// Me returns the account of the given user.
+func (s *Service) Me(userID string) (MeResponse, error) {
+	record, err := s.findUser(userID)
+	if err != nil {
+		return MeResponse{}, err
+	}
+
+	return mapMeRecord(record)
+}
+
+// UpdateProfile changes the name of the user's own account.
+func (s *Service) UpdateProfile(ctx context.Context, userID string, params ProfileParams) (MeResponse, error) {
+	if _, err := s.Update(ctx, userID, UpdateParams{Name: params.Name}); err != nil {
+		return MeResponse{}, err
+	}
+
+	return s.Me(userID)
+}
+
+// ChangePassword sets a new password after verifying the current one. All
+// other sessions are signed out; the returned record carries the new token
+// key so the session of keepToken can be issued a fresh token.
+func (s *Service) ChangePassword(ctx context.Context, userID, currentPassword, newPassword, keepToken string) (*core.Record, error) {
+	record, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	newPassword = strings.TrimSpace(newPassword)
+	if len(newPassword) < 8 {
+		return nil, ValidationError{Message: "password must be at least 8 characters long"}
+	}
+
+	entry := audit.Entry{Action: audit.ActionPasswordChange, Targets: []string{userID}}
+
+	if !record.ValidatePassword(currentPassword) {
+		entry.Err = ErrInvalidPassword
+		s.audit.Record(ctx, entry)
+		return nil, ErrInvalidPassword
+	}
+
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		// Also refreshes the token key, which invalidates every issued token
+		record.SetPassword(newPassword)
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("save user: %w", err)
+		}
+
+		_, err := revokeSessions(txApp, userID, keepToken)
+		return err
+	})
+	if err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return nil, err
+	}
+
+	s.audit.Record(ctx, entry)
+
+	return record, nil
+}
+
+// UpdateDefaults replaces the user's personal defaults for adding torrents.
+func (s *Service) UpdateDefaults(userID string, defaults torrent.Defaults) (MeResponse, error) {
+	record, err := s.findUser(userID)
+	if err != nil {
+		return MeResponse{}, err
+	}
+
+	if defaults.DownloadDir != nil {
+		dir := strings.TrimSpace(*defaults.DownloadDir)
+		if dir == "" {
+			defaults.DownloadDir = nil
+		} else {
+			defaults.DownloadDir = &dir
+		}
+	}
+
+	record.Set("defaults", defaults)
+	if err := s.app.Save(record); err != nil {
+		return MeResponse{}, fmt.Errorf("save user: %w", err)
+	}
+
+	return mapMeRecord(record)
+}
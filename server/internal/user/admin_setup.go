@@ -3,13 +3,13 @@
 package user
 
 import (
-	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
 // CreatePocketbaseAdmin creates a superuser using the provided email/password
 // without requiring the models package, so it works without any build tags.
-func CreatePocketbaseAdmin(app *pocketbase.PocketBase, email, password string) error {
+// Pass a transaction app to create it together with other records.
+func CreatePocketbaseAdmin(app core.App, email, password string) error {
 	collection, err := app.FindCollectionByNameOrId(core.CollectionNameSuperusers)
 	if err != nil {
 		return err
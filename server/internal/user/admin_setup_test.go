@@ -0,0 +1,113 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestSetupInitialAdminToken(t *testing.T) {
+	testApp := newAuthTestApp(t)
+	defer testApp.Cleanup()
+
+	service := NewService(&pocketbase.PocketBase{App: testApp}, nil, nil)
+
+	token, err := service.RequireSetupToken()
+	if err != nil || token == "" {
+		t.Fatalf("Expected a setup token, got %q (%v)", token, err)
+	}
+
+	params := AdminSetupParams{Name: "Root", Email: "root@example.com", Password: "supersecret"}
+	if err := service.SetupInitialAdmin(context.Background(), params); !errors.Is(err, ErrInvalidSetupToken) {
+		t.Fatalf("Expected ErrInvalidSetupToken without a token, got %v", err)
+	}
+
+	params.SetupToken = token
+	if err := service.SetupInitialAdmin(context.Background(), params); err != nil {
+		t.Fatalf("SetupInitialAdmin failed: %v", err)
+	}
+
+	if service.SetupTokenRequired() {
+		t.Errorf("Expected the setup token to be used up")
+	}
+	if token, _ := service.RequireSetupToken(); token != "" {
+		t.Errorf("Expected no new token once an admin exists")
+	}
+}
+
+func TestSetupInitialAdminRollsBack(t *testing.T) {
+	testApp := newAuthTestApp(t)
+	defer testApp.Cleanup()
+
+	service := NewService(&pocketbase.PocketBase{App: testApp}, nil, nil)
+
+	// A superuser with the same email makes the second step fail
+	if err := CreatePocketbaseAdmin(testApp, "root@example.com", "supersecret"); err != nil {
+		t.Fatalf("Failed to create superuser: %v", err)
+	}
+
+	err := service.SetupInitialAdmin(context.Background(), AdminSetupParams{Name: "Root", Email: "root@example.com", Password: "supersecret"})
+	if err == nil {
+		t.Fatalf("Expected the setup to fail")
+	}
+
+	if _, err := testApp.FindAuthRecordByEmail("users", "root@example.com"); err == nil {
+		t.Errorf("Expected the users record to be rolled back")
+	}
+}
+
+func TestSetupInitialAdminConcurrent(t *testing.T) {
+	testApp := newAuthTestApp(t)
+	defer testApp.Cleanup()
+
+	service := NewService(&pocketbase.PocketBase{App: testApp}, nil, nil)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = service.SetupInitialAdmin(context.Background(), AdminSetupParams{
+				Name:     "Root",
+				Email:    fmt.Sprintf("root%d@example.com", i),
+				Password: "supersecret",
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, ErrAdminAlreadyExists) {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("Expected exactly one setup to succeed, got %d", succeeded)
+	}
+
+	total, err := testApp.CountRecords("users", dbx.HashExp{"role": "admin"})
+	if err != nil {
+		t.Fatalf("CountRecords failed: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("Expected 1 admin, got %d", total)
+	}
+
+	superusers, err := testApp.FindAllRecords(core.CollectionNameSuperusers, dbx.Like("email", "root"))
+	if err != nil {
+		t.Fatalf("Failed to find superusers: %v", err)
+	}
+	if len(superusers) != 1 {
+		t.Errorf("Expected 1 new superuser, got %d", len(superusers))
+	}
+}
@@ -0,0 +1,78 @@
+package user
+
+import (
+	"context"
+	"log"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+)
+
+// GroupRoles maps groups reported by an external identity provider to
+// Retorrent roles. Members of any AdminGroups become admins. When UserGroups
+// is empty every other user gets the user role, otherwise membership is
+// required to sign in.
+type GroupRoles struct {
+	AdminGroups []string
+	UserGroups  []string
+}
+
+// RoleFor maps the user's groups to a role. It returns false when the user is
+// not a member of any allowed group.
+func (g GroupRoles) RoleFor(groups []string) (string, bool) {
+	member := func(allowed []string) bool {
+		for _, group := range groups {
+			for _, candidate := range allowed {
+				if group == candidate {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if member(g.AdminGroups) {
+		return "admin", true
+	}
+
+	if len(g.UserGroups) == 0 || member(g.UserGroups) {
+		return "user", true
+	}
+
+	return "", false
+}
+
+// syncGroupRole updates the record's role to the one derived from its groups.
+// Demoting the last enabled admin is refused and the current role is kept.
+func syncGroupRole(ctx context.Context, app core.App, auditService *audit.Service, record *core.Record, role, source string) {
+	current := record.GetString("role")
+	if current == role || record.GetBool("disabled") {
+		return
+	}
+
+	entry := audit.Entry{
+		Action:  audit.ActionUserUpdate,
+		Targets: []string{record.Id},
+		Before:  map[string]any{"role": current},
+		After:   map[string]any{"role": role},
+		Details: map[string]any{"provider": source},
+	}
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		if current == "admin" {
+			if err := ensureOtherActiveAdmin(txApp, record.Id); err != nil {
+				return err
+			}
+		}
+		record.Set("role", role)
+		return txApp.Save(record)
+	})
+	if err != nil {
+		record.Set("role", current)
+		entry.Err = err
+		log.Printf("[Auth] Keeping role %q for user %s: %v", current, record.Id, err)
+	}
+
+	auditService.Record(ctx, entry)
+}
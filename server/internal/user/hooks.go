@@ -0,0 +1,17 @@
+package user
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// BindAuthHooks rejects PocketBase auth requests (password, OAuth2, refresh)
+// for users that have been disabled.
+func BindAuthHooks(app core.App) {
+	app.OnRecordAuthRequest("users").BindFunc(func(e *core.RecordAuthRequestEvent) error {
+		if e.Record.GetBool("disabled") {
+			return e.ForbiddenError("This account has been disabled.", nil)
+		}
+
+		return e.Next()
+	})
+}
@@ -0,0 +1,386 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+
+	"backend/internal/audit"
+)
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+	inviteTokenSize  = 32
+)
+
+// Invitation status values.
+const (
+	InviteStatusPending  = "pending"
+	InviteStatusAccepted = "accepted"
+	InviteStatusExpired  = "expired"
+	InviteStatusRevoked  = "revoked"
+)
+
+// ErrInviteInvalid is returned for unknown, used, revoked or expired invite tokens.
+var ErrInviteInvalid = errors.New("invitation is invalid or has expired")
+
+// InviteResponse represents the invitation information exposed by the API.
+type InviteResponse struct {
+	ID           string `json:"id"`
+	Email        string `json:"email,omitempty"`
+	Role         string `json:"role"`
+	Status       string `json:"status"`
+	ExpiresAt    string `json:"expiresAt"`
+	AcceptedAt   string `json:"acceptedAt,omitempty"`
+	AcceptedUser string `json:"acceptedUser,omitempty"`
+	CreatedBy    string `json:"createdBy,omitempty"`
+	Created      string `json:"created"`
+}
+
+// CreateInviteResult is returned once when an invite is created and carries
+// the one-time token and the link to share with the invitee.
+type CreateInviteResult struct {
+	InviteResponse
+	Token     string `json:"token"`
+	Link      string `json:"link"`
+	EmailSent bool   `json:"emailSent"`
+}
+
+// CreateInviteParams holds the data required to create an invitation.
+type CreateInviteParams struct {
+	Email     string
+	Role      string
+	ExpiresIn time.Duration
+	SendEmail bool
+}
+
+// AcceptInviteParams holds the data the invitee provides when accepting.
+type AcceptInviteParams struct {
+	Name     string
+	Email    string
+	Password string
+}
+
+var inviteEmailTemplate = template.Must(template.New("invite").Parse(`<p>Hello,</p>
+<p>You have been invited to join <strong>{{.AppName}}</strong> as {{.Role}}.</p>
+<p><a href="{{.Link}}">Accept the invitation</a> to choose your name and password.</p>
+<p>This invitation expires on {{.ExpiresAt}}.</p>`))
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func formatOptionalDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func inviteStatus(record *core.Record) string {
+	switch {
+	case !record.GetDateTime("acceptedAt").IsZero():
+		return InviteStatusAccepted
+	case !record.GetDateTime("revokedAt").IsZero():
+		return InviteStatusRevoked
+	case time.Now().After(record.GetDateTime("expiresAt").Time()):
+		return InviteStatusExpired
+	default:
+		return InviteStatusPending
+	}
+}
+
+func mapInviteRecord(record *core.Record) InviteResponse {
+	return InviteResponse{
+		ID:           record.Id,
+		Email:        record.GetString("email"),
+		Role:         record.GetString("role"),
+		Status:       inviteStatus(record),
+		ExpiresAt:    formatOptionalDate(record, "expiresAt"),
+		AcceptedAt:   formatOptionalDate(record, "acceptedAt"),
+		AcceptedUser: record.GetString("acceptedUser"),
+		CreatedBy:    record.GetString("createdBy"),
+		Created:      formatOptionalDate(record, "created"),
+	}
+}
+
+func (s *Service) inviteLink(token string) string {
+	return strings.TrimRight(s.app.Settings().Meta.AppURL, "/") + "/invite/" + token
+}
+
+// CreateInvite creates a one-time invitation for a new user with the given role
+// and optionally emails the invite link through the configured mailer.
+func (s *Service) CreateInvite(ctx context.Context, params CreateInviteParams) (CreateInviteResult, error) {
+	email := strings.TrimSpace(params.Email)
+	if email != "" {
+		if _, err := mail.ParseAddress(email); err != nil {
+			return CreateInviteResult{}, ValidationError{Message: "invalid email address"}
+		}
+	}
+
+	if params.SendEmail && email == "" {
+		return CreateInviteResult{}, ValidationError{Message: "email is required to send the invitation"}
+	}
+
+	roleValue, ok := normalizeRole(params.Role)
+	if !ok {
+		return CreateInviteResult{}, ValidationError{Message: "invalid role provided"}
+	}
+
+	ttl := params.ExpiresIn
+	if ttl == 0 {
+		ttl = defaultInviteTTL
+	}
+	if ttl < 0 || ttl > maxInviteTTL {
+		return CreateInviteResult{}, ValidationError{Message: "invitation expiry must be between now and 30 days"}
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId("invitations")
+	if err != nil {
+		return CreateInviteResult{}, fmt.Errorf("find invitations collection: %w", err)
+	}
+
+	secret := make([]byte, inviteTokenSize)
+	if _, err := rand.Read(secret); err != nil {
+		return CreateInviteResult{}, fmt.Errorf("generate invite token: %w", err)
+	}
+	token := hex.EncodeToString(secret)
+	expiresAt := time.Now().Add(ttl)
+
+	record := core.NewRecord(collection)
+	record.Set("email", email)
+	record.Set("role", roleValue)
+	record.Set("tokenHash", hashInviteToken(token))
+	record.Set("expiresAt", expiresAt)
+	record.Set("createdBy", audit.ActorFromContext(ctx).UserID)
+
+	entry := audit.Entry{
+		Action: audit.ActionInviteCreate,
+		After:  map[string]any{"email": email, "role": roleValue, "expiresAt": expiresAt.Format(time.RFC3339)},
+	}
+
+	if err := s.app.Save(record); err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return CreateInviteResult{}, fmt.Errorf("save invitation: %w", err)
+	}
+	entry.Targets = []string{record.Id}
+
+	result := CreateInviteResult{
+		InviteResponse: mapInviteRecord(record),
+		Token:          token,
+		Link:           s.inviteLink(token),
+	}
+
+	if params.SendEmail {
+		if err := s.sendInviteEmail(email, roleValue, result.Link, expiresAt); err != nil {
+			// An invite nobody received is useless; don't leave it behind
+			if delErr := s.app.Delete(record); delErr != nil {
+				err = errors.Join(err, delErr)
+			}
+			entry.Err = err
+			s.audit.Record(ctx, entry)
+			return CreateInviteResult{}, fmt.Errorf("send invitation email: %w", err)
+		}
+		result.EmailSent = true
+	}
+
+	s.audit.Record(ctx, entry)
+
+	return result, nil
+}
+
+func (s *Service) sendInviteEmail(email, role, link string, expiresAt time.Time) error {
+	meta := s.app.Settings().Meta
+
+	var body bytes.Buffer
+	err := inviteEmailTemplate.Execute(&body, map[string]string{
+		"AppName":   meta.AppName,
+		"Role":      role,
+		"Link":      link,
+		"ExpiresAt": expiresAt.Format(time.RFC1123),
+	})
+	if err != nil {
+		return fmt.Errorf("render invitation email: %w", err)
+	}
+
+	message := &mailer.Message{
+		From:    mail.Address{Name: meta.SenderName, Address: meta.SenderAddress},
+		To:      []mail.Address{{Address: email}},
+		Subject: fmt.Sprintf("You're invited to %s", meta.AppName),
+		HTML:    body.String(),
+	}
+
+	return s.app.NewMailClient().Send(message)
+}
+
+// ListInvites returns all invitations, newest first.
+func (s *Service) ListInvites() ([]InviteResponse, error) {
+	records, err := s.app.FindRecordsByFilter("invitations", "1=1", "-created", 0, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("find invitations: %w", err)
+	}
+
+	responses := make([]InviteResponse, 0, len(records))
+	for _, record := range records {
+		responses = append(responses, mapInviteRecord(record))
+	}
+
+	return responses, nil
+}
+
+// RevokeInvite marks a pending invitation as revoked so it can no longer be accepted.
+func (s *Service) RevokeInvite(ctx context.Context, id string) error {
+	record, err := s.app.FindRecordById("invitations", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NotFoundError{Message: "invitation not found"}
+		}
+		return fmt.Errorf("find invitation: %w", err)
+	}
+
+	if status := inviteStatus(record); status != InviteStatusPending {
+		return ValidationError{Message: fmt.Sprintf("invitation is already %s", status)}
+	}
+
+	record.Set("revokedAt", time.Now())
+
+	entry := audit.Entry{Action: audit.ActionInviteRevoke, Targets: []string{record.Id}}
+	if err := s.app.Save(record); err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return fmt.Errorf("save invitation: %w", err)
+	}
+
+	s.audit.Record(ctx, entry)
+
+	return nil
+}
+
+// FindInvite returns the pending invitation matching the token.
+func (s *Service) FindInvite(token string) (InviteResponse, error) {
+	record, err := findPendingInvite(s.app, token)
+	if err != nil {
+		return InviteResponse{}, err
+	}
+
+	return mapInviteRecord(record), nil
+}
+
+func findPendingInvite(app core.App, token string) (*core.Record, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrInviteInvalid
+	}
+
+	record, err := app.FindFirstRecordByData("invitations", "tokenHash", hashInviteToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInviteInvalid
+		}
+		return nil, fmt.Errorf("find invitation: %w", err)
+	}
+
+	if inviteStatus(record) != InviteStatusPending {
+		return nil, ErrInviteInvalid
+	}
+
+	return record, nil
+}
+
+// AcceptInvite creates the invited user with their chosen name and password
+// and consumes the invitation in a single transaction.
+func (s *Service) AcceptInvite(ctx context.Context, token string, params AcceptInviteParams) (Response, error) {
+	name := strings.TrimSpace(params.Name)
+	password := strings.TrimSpace(params.Password)
+
+	if name == "" || password == "" {
+		return Response{}, ValidationError{Message: "name and password are required"}
+	}
+
+	if len(password) < 8 {
+		return Response{}, ValidationError{Message: "password must be at least 8 characters long"}
+	}
+
+	collection, err := s.userCollection()
+	if err != nil {
+		return Response{}, fmt.Errorf("find users collection: %w", err)
+	}
+
+	var created *core.Record
+	var inviteID string
+
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		invite, err := findPendingInvite(txApp, token)
+		if err != nil {
+			return err
+		}
+		inviteID = invite.Id
+
+		email := invite.GetString("email")
+		requested := strings.TrimSpace(params.Email)
+		switch {
+		case email == "":
+			email = requested
+		case requested != "" && !strings.EqualFold(requested, email):
+			return ValidationError{Message: "this invitation was issued for a different email address"}
+		}
+		if email == "" {
+			return ValidationError{Message: "email is required"}
+		}
+
+		record := core.NewRecord(collection)
+		record.Set("name", name)
+		record.Set("email", email)
+		record.Set("role", invite.GetString("role"))
+		// Only invitations sent to an address prove ownership of it
+		record.Set("verified", invite.GetString("email") != "")
+		record.Set("emailVisibility", false)
+		record.SetPassword(password)
+
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("save user: %w", err)
+		}
+
+		invite.Set("acceptedAt", time.Now())
+		invite.Set("acceptedUser", record.Id)
+		if err := txApp.Save(invite); err != nil {
+			return fmt.Errorf("save invitation: %w", err)
+		}
+
+		created = record
+		return nil
+	})
+
+	entry := audit.Entry{Action: audit.ActionInviteAccept}
+	if inviteID != "" {
+		entry.Targets = []string{inviteID}
+	}
+
+	if err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return Response{}, err
+	}
+
+	entry.Targets = append(entry.Targets, created.Id)
+	entry.After = map[string]any{"name": name, "email": created.Email(), "role": created.GetString("role")}
+	s.audit.Record(ctx, entry)
+
+	return mapUserRecord(created), nil
+}
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+
+	"backend/internal/testutil"
+)
+
+func newInviteTestService(t *testing.T) (*tests.TestApp, *Service) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	return testApp, NewService(&pocketbase.PocketBase{App: testApp}, nil, nil)
+}
+
+func TestInviteEmailAndAccept(t *testing.T) {
+	testApp, service := newInviteTestService(t)
+
+	smtpServer := testutil.NewSMTPServer(t)
+	// Route mail through the SMTP stand-in instead of the test app's in-memory mailer
+	testApp.OnMailerSend().BindFunc(func(e *core.MailerEvent) error {
+		e.Mailer = &mailer.SMTPClient{Host: smtpServer.Host, Port: smtpServer.Port}
+		return e.Next()
+	})
+
+	created, err := service.CreateInvite(context.Background(), CreateInviteParams{
+		Email:     "newbie@example.com",
+		Role:      "admin",
+		SendEmail: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateInvite failed: %v", err)
+	}
+	if !created.EmailSent || created.Status != InviteStatusPending {
+		t.Fatalf("Unexpected invite: %+v", created)
+	}
+
+	messages := smtpServer.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(messages))
+	}
+	if len(messages[0].To) != 1 || messages[0].To[0] != "newbie@example.com" {
+		t.Errorf("Unexpected recipients: %v", messages[0].To)
+	}
+	// Undo quoted-printable soft line breaks before looking for the token
+	body := strings.ReplaceAll(messages[0].Data, "=\r\n", "")
+	if !strings.Contains(body, created.Token) {
+		t.Errorf("Expected email to contain the invite link")
+	}
+
+	if _, err := service.AcceptInvite(context.Background(), created.Token, AcceptInviteParams{
+		Name:     "Newbie",
+		Email:    "someone-else@example.com",
+		Password: "supersecret",
+	}); err == nil {
+		t.Fatalf("Expected a mismatching email to be rejected")
+	}
+
+	userResp, err := service.AcceptInvite(context.Background(), created.Token, AcceptInviteParams{
+		Name:     "Newbie",
+		Password: "supersecret",
+	})
+	if err != nil {
+		t.Fatalf("AcceptInvite failed: %v", err)
+	}
+	if userResp.Email != "newbie@example.com" || userResp.Role != "admin" || !userResp.Verified {
+		t.Errorf("Unexpected user: %+v", userResp)
+	}
+
+	// Tokens are single use
+	if _, err := service.AcceptInvite(context.Background(), created.Token, AcceptInviteParams{
+		Name:     "Again",
+		Password: "supersecret",
+	}); !errors.Is(err, ErrInviteInvalid) {
+		t.Errorf("Expected ErrInviteInvalid on reuse, got %v", err)
+	}
+}
+
+func TestRevokedInviteCannotBeAccepted(t *testing.T) {
+	_, service := newInviteTestService(t)
+
+	created, err := service.CreateInvite(context.Background(), CreateInviteParams{Role: "user"})
+	if err != nil {
+		t.Fatalf("CreateInvite failed: %v", err)
+	}
+
+	if err := service.RevokeInvite(context.Background(), created.ID); err != nil {
+		t.Fatalf("RevokeInvite failed: %v", err)
+	}
+
+	if _, err := service.AcceptInvite(context.Background(), created.Token, AcceptInviteParams{
+		Name:     "Late",
+		Email:    "late@example.com",
+		Password: "supersecret",
+	}); !errors.Is(err, ErrInviteInvalid) {
+		t.Errorf("Expected ErrInviteInvalid, got %v", err)
+	}
+
+	invites, err := service.ListInvites()
+	if err != nil {
+		t.Fatalf("ListInvites failed: %v", err)
+	}
+	if len(invites) != 1 || invites[0].Status != InviteStatusRevoked {
+		t.Errorf("Expected one revoked invite, got %+v", invites)
+	}
+}
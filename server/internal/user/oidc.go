@@ -0,0 +1,220 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+)
+
+// OIDCProviderName is the PocketBase OAuth2 provider used for single sign-on.
+const OIDCProviderName = "oidc"
+
+const defaultGroupsClaim = "groups"
+
+// OIDCConfig describes the generic OpenID Connect provider used for single
+// sign-on and how its group claim maps to Retorrent roles.
+type OIDCConfig struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	// JWKSURL enables ID token signature validation when set.
+	JWKSURL     string
+	Issuer      string
+	DisplayName string
+	// GroupsClaim is the ID token claim holding the user's groups.
+	GroupsClaim string
+	Roles       GroupRoles
+	// DisablePasswordLogin rejects password logins for users once the first
+	// admin exists. PocketBase superusers are not affected.
+	DisablePasswordLogin bool
+}
+
+// Enabled reports whether enough settings are present to use the provider.
+func (c OIDCConfig) Enabled() bool {
+	return c.ClientID != "" && c.ClientSecret != "" && c.AuthURL != "" && c.TokenURL != ""
+}
+
+// OIDCConfigFromEnv reads the OIDC settings from OIDC_* environment variables.
+func OIDCConfigFromEnv() OIDCConfig {
+	return OIDCConfig{
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		AuthURL:      os.Getenv("OIDC_AUTH_URL"),
+		TokenURL:     os.Getenv("OIDC_TOKEN_URL"),
+		JWKSURL:      os.Getenv("OIDC_JWKS_URL"),
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		DisplayName:  os.Getenv("OIDC_DISPLAY_NAME"),
+		GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+		Roles: GroupRoles{
+			AdminGroups: splitList(os.Getenv("OIDC_ADMIN_GROUPS")),
+			UserGroups:  splitList(os.Getenv("OIDC_USER_GROUPS")),
+		},
+		DisablePasswordLogin: os.Getenv("OIDC_DISABLE_PASSWORD_LOGIN") == "true",
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ConfigureOIDC registers the provider on the users collection so the
+// standard PocketBase OAuth2 flow can be used to sign in.
+func ConfigureOIDC(app core.App, cfg OIDCConfig) error {
+	collection, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return fmt.Errorf("find users collection: %w", err)
+	}
+
+	extra := map[string]any{}
+	if cfg.JWKSURL != "" {
+		extra["jwksURL"] = cfg.JWKSURL
+	}
+	if cfg.Issuer != "" {
+		extra["issuers"] = []string{cfg.Issuer}
+	}
+
+	displayName := cfg.DisplayName
+	if displayName == "" {
+		displayName = "SSO"
+	}
+
+	// The ID token carries the group claim, so no userinfo endpoint is used
+	provider := core.OAuth2ProviderConfig{
+		Name:         OIDCProviderName,
+		ClientId:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		AuthURL:      cfg.AuthURL,
+		TokenURL:     cfg.TokenURL,
+		DisplayName:  displayName,
+		Extra:        extra,
+	}
+
+	providers := make([]core.OAuth2ProviderConfig, 0, len(collection.OAuth2.Providers)+1)
+	for _, existing := range collection.OAuth2.Providers {
+		if existing.Name != OIDCProviderName {
+			providers = append(providers, existing)
+		}
+	}
+
+	collection.OAuth2.Enabled = true
+	collection.OAuth2.Providers = append(providers, provider)
+	collection.OAuth2.MappedFields.Name = "name"
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("save users collection: %w", err)
+	}
+
+	return nil
+}
+
+// groupsFromClaims reads the group claim, which providers send either as a
+// list or as a single space or comma separated string.
+func (c OIDCConfig) groupsFromClaims(claims map[string]any) []string {
+	claim := c.GroupsClaim
+	if claim == "" {
+		claim = defaultGroupsClaim
+	}
+
+	switch value := claims[claim].(type) {
+	case []any:
+		groups := make([]string, 0, len(value))
+		for _, item := range value {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	case []string:
+		return value
+	case string:
+		return strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' })
+	default:
+		return nil
+	}
+}
+
+func adminExists(app core.App) (bool, error) {
+	total, err := app.CountRecords("users", dbx.HashExp{"role": "admin"})
+	if err != nil {
+		return false, fmt.Errorf("count admin users: %w", err)
+	}
+	return total > 0, nil
+}
+
+// BindOIDCHooks applies the group to role mapping on every OIDC login and,
+// when configured, blocks password logins once the first admin exists.
+func BindOIDCHooks(app core.App, cfg OIDCConfig, auditService *audit.Service) {
+	app.OnRecordAuthWithOAuth2Request("users").BindFunc(func(e *core.RecordAuthWithOAuth2RequestEvent) error {
+		if e.ProviderName != OIDCProviderName {
+			return e.Next()
+		}
+
+		role, ok := cfg.Roles.RoleFor(cfg.groupsFromClaims(e.OAuth2User.RawUser))
+		if !ok {
+			return e.ForbiddenError("Your account is not a member of an allowed group.", nil)
+		}
+
+		if e.Record == nil {
+			// Always override, never trust a role submitted with createData
+			if e.CreateData == nil {
+				e.CreateData = map[string]any{}
+			}
+			e.CreateData["role"] = role
+
+			if err := e.Next(); err != nil {
+				return err
+			}
+
+			ctx := oidcAuditContext(e)
+			auditService.Record(ctx, audit.Entry{
+				Action:  audit.ActionUserCreate,
+				Targets: []string{e.Record.Id},
+				After:   map[string]any{"name": e.Record.GetString("name"), "email": e.Record.Email(), "role": role},
+				Details: map[string]any{"provider": OIDCProviderName},
+			})
+			return nil
+		}
+
+		syncGroupRole(oidcAuditContext(e), e.App, auditService, e.Record, role, OIDCProviderName)
+
+		return e.Next()
+	})
+
+	if !cfg.DisablePasswordLogin {
+		return
+	}
+
+	app.OnRecordAuthWithPasswordRequest("users").BindFunc(func(e *core.RecordAuthWithPasswordRequestEvent) error {
+		exists, err := adminExists(e.App)
+		if err != nil {
+			return e.InternalServerError("Failed to check login settings.", err)
+		}
+
+		if exists {
+			return e.ForbiddenError("Password login is disabled. Sign in with SSO instead.", nil)
+		}
+
+		return e.Next()
+	})
+}
+
+func oidcAuditContext(e *core.RecordAuthWithOAuth2RequestEvent) context.Context {
+	return audit.WithActor(e.Request.Context(), audit.Actor{
+		UserID: e.Record.Id,
+		Email:  e.Record.Email(),
+		IP:     e.RealIP(),
+	})
+}
@@ -0,0 +1,292 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/testutil"
+)
+
+const (
+	testOIDCClientID = "retorrent"
+	testOIDCKeyID    = "test-key"
+)
+
+// oidcProvider is a minimal stand-in OpenID provider. The authorization code
+// sent to its token endpoint selects which claims the issued ID token carries.
+type oidcProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]jwt.MapClaims
+}
+
+func newOIDCProvider(t *testing.T) *oidcProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	p := &oidcProvider{key: key, claims: map[string]jwt.MapClaims{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		claims, ok := p.claims[r.PostForm.Get("code")]
+		if !ok {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		claims["iss"] = p.server.URL
+		claims["aud"] = testOIDCClientID
+		claims["iat"] = time.Now().Unix()
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = testOIDCKeyID
+		idToken, err := token.SignedString(p.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access-" + r.PostForm.Get("code"),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": testOIDCKeyID,
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	})
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *oidcProvider) config() OIDCConfig {
+	return OIDCConfig{
+		ClientID:     testOIDCClientID,
+		ClientSecret: "secret",
+		AuthURL:      p.server.URL + "/authorize",
+		TokenURL:     p.server.URL + "/token",
+		JWKSURL:      p.server.URL + "/jwks",
+		Issuer:       p.server.URL,
+		Roles: GroupRoles{
+			AdminGroups: []string{"retorrent-admins"},
+			UserGroups:  []string{"retorrent-users"},
+		},
+		DisablePasswordLogin: true,
+	}
+}
+
+func (p *oidcProvider) appFactory(setup func(t testing.TB, app *tests.TestApp)) func(t testing.TB) *tests.TestApp {
+	return func(t testing.TB) *tests.TestApp {
+		testApp := newAuthTestApp(t)
+
+		cfg := p.config()
+		if err := ConfigureOIDC(testApp, cfg); err != nil {
+			t.Fatalf("ConfigureOIDC failed: %v", err)
+		}
+		BindOIDCHooks(testApp, cfg, nil)
+
+		if setup != nil {
+			setup(t, testApp)
+		}
+
+		return testApp
+	}
+}
+
+// newAuthTestApp returns a test app whose bundled test data neither
+// requires MFA nor already has an admin.
+func newAuthTestApp(t testing.TB) *tests.TestApp {
+	t.Helper()
+
+	testApp, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatalf("Failed to create test app: %v", err)
+	}
+
+	users, err := testApp.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("Failed to find users collection: %v", err)
+	}
+	users.MFA.Enabled = false
+	if err := testApp.Save(users); err != nil {
+		t.Fatalf("Failed to disable MFA: %v", err)
+	}
+	if _, err := testApp.DB().Update("users", dbx.Params{"role": "user"}, nil).Execute(); err != nil {
+		t.Fatalf("Failed to reset roles: %v", err)
+	}
+
+	return testApp
+}
+
+func oauth2Body(code string) *strings.Reader {
+	return strings.NewReader(`{"provider":"oidc","code":"` + code + `","codeVerifier":"verifier","redirectURL":"http://localhost/callback"}`)
+}
+
+func expectRole(t testing.TB, app core.App, email, role string) {
+	t.Helper()
+
+	record, err := app.FindAuthRecordByEmail("users", email)
+	if err != nil {
+		t.Fatalf("Failed to find user %s: %v", email, err)
+	}
+	if got := record.GetString("role"); got != role {
+		t.Errorf("Expected %s to have role %q, got %q", email, role, got)
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newOIDCProvider(t)
+	provider.claims["new-admin"] = jwt.MapClaims{
+		"sub": "1", "email": "ops@example.com", "email_verified": true, "name": "Ops",
+		"groups": []string{"retorrent-admins", "retorrent-users"},
+	}
+	provider.claims["promoted"] = jwt.MapClaims{
+		"sub": "2", "email": "alice@example.com", "email_verified": true, "name": "Alice",
+		"groups": []string{"retorrent-admins"},
+	}
+	provider.claims["demoted"] = jwt.MapClaims{
+		"sub": "3", "email": "bob@example.com", "email_verified": true, "name": "Bob",
+		"groups": "retorrent-users",
+	}
+	provider.claims["outsider"] = jwt.MapClaims{
+		"sub": "4", "email": "eve@example.com", "email_verified": true, "name": "Eve",
+		"groups": []string{"guests"},
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "new user is created with the mapped role",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-oauth2",
+			Body:            oauth2Body("new-admin"),
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"token":`, `"isNew":true`, `"role":"admin"`},
+			TestAppFactory:  provider.appFactory(nil),
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				expectRole(t, app, "ops@example.com", "admin")
+			},
+		},
+		{
+			Name:            "existing user role follows the group claim",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-oauth2",
+			Body:            oauth2Body("promoted"),
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"isNew":false`, `"role":"admin"`},
+			TestAppFactory: provider.appFactory(func(t testing.TB, app *tests.TestApp) {
+				testutil.CreateUser(t, app, "alice@example.com", "user")
+			}),
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				expectRole(t, app, "alice@example.com", "admin")
+			},
+		},
+		{
+			Name:            "admin is demoted when another admin remains",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-oauth2",
+			Body:            oauth2Body("demoted"),
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"role":"user"`},
+			TestAppFactory: provider.appFactory(func(t testing.TB, app *tests.TestApp) {
+				testutil.CreateUser(t, app, "root@example.com", "admin")
+				testutil.CreateUser(t, app, "bob@example.com", "admin")
+			}),
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				expectRole(t, app, "bob@example.com", "user")
+			},
+		},
+		{
+			Name:            "last admin keeps the admin role",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-oauth2",
+			Body:            oauth2Body("demoted"),
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"role":"admin"`},
+			TestAppFactory: provider.appFactory(func(t testing.TB, app *tests.TestApp) {
+				testutil.CreateUser(t, app, "bob@example.com", "admin")
+			}),
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				expectRole(t, app, "bob@example.com", "admin")
+			},
+		},
+		{
+			Name:            "users outside the allowed groups are rejected",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-oauth2",
+			Body:            oauth2Body("outsider"),
+			ExpectedStatus:  http.StatusForbidden,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  provider.appFactory(nil),
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				if _, err := app.FindAuthRecordByEmail("users", "eve@example.com"); err == nil {
+					t.Errorf("Expected no user to be created")
+				}
+			},
+		},
+		{
+			Name:            "password login works before the first admin exists",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-password",
+			Body:            strings.NewReader(`{"identity":"carol@example.com","password":"supersecret"}`),
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"token":`},
+			TestAppFactory: provider.appFactory(func(t testing.TB, app *tests.TestApp) {
+				testutil.CreateUser(t, app, "carol@example.com", "user")
+			}),
+		},
+		{
+			Name:            "password login is disabled once an admin exists",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/users/auth-with-password",
+			Body:            strings.NewReader(`{"identity":"carol@example.com","password":"supersecret"}`),
+			ExpectedStatus:  http.StatusForbidden,
+			ExpectedContent: []string{"Password login is disabled"},
+			TestAppFactory: provider.appFactory(func(t testing.TB, app *tests.TestApp) {
+				testutil.CreateUser(t, app, "root@example.com", "admin")
+				testutil.CreateUser(t, app, "carol@example.com", "user")
+			}),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -0,0 +1,249 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/security"
+
+	"backend/internal/audit"
+)
+
+// ProxyAuthMethod is the auth method reported for users signed in by a
+// trusted reverse proxy.
+const ProxyAuthMethod = "proxy"
+
+const (
+	proxyAuthMiddlewareID = "retorrentProxyAuth"
+	requestKeyProxyAuth   = "proxyAuth"
+)
+
+// ProxyAuthConfig configures authentication through identity headers set by a
+// trusted reverse proxy (e.g. Caddy forward_auth in front of Authelia).
+type ProxyAuthConfig struct {
+	Enabled bool
+	// TrustedProxies lists the networks the headers are accepted from. Requests
+	// from anywhere else are treated as if the headers were absent.
+	TrustedProxies []*net.IPNet
+	UserHeader     string
+	EmailHeader    string
+	NameHeader     string
+	GroupsHeader   string
+	// EmailDomain builds an email address from the user header when the proxy
+	// doesn't send one.
+	EmailDomain string
+	Roles       GroupRoles
+}
+
+// ProxyAuthConfigFromEnv reads the proxy auth settings from PROXY_AUTH_*
+// environment variables.
+func ProxyAuthConfigFromEnv() (ProxyAuthConfig, error) {
+	cfg := ProxyAuthConfig{
+		Enabled:      os.Getenv("PROXY_AUTH_ENABLED") == "true",
+		UserHeader:   headerOrDefault("PROXY_AUTH_USER_HEADER", "Remote-User"),
+		EmailHeader:  headerOrDefault("PROXY_AUTH_EMAIL_HEADER", "Remote-Email"),
+		NameHeader:   headerOrDefault("PROXY_AUTH_NAME_HEADER", "Remote-Name"),
+		GroupsHeader: headerOrDefault("PROXY_AUTH_GROUPS_HEADER", "Remote-Groups"),
+		EmailDomain:  strings.TrimSpace(os.Getenv("PROXY_AUTH_EMAIL_DOMAIN")),
+		Roles: GroupRoles{
+			AdminGroups: splitList(os.Getenv("PROXY_AUTH_ADMIN_GROUPS")),
+			UserGroups:  splitList(os.Getenv("PROXY_AUTH_USER_GROUPS")),
+		},
+	}
+
+	if !cfg.Enabled {
+		return cfg, nil
+	}
+
+	for _, value := range splitList(os.Getenv("PROXY_AUTH_TRUSTED_PROXIES")) {
+		network, err := parseNetwork(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid PROXY_AUTH_TRUSTED_PROXIES entry %q: %w", value, err)
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, network)
+	}
+
+	if len(cfg.TrustedProxies) == 0 {
+		return cfg, errors.New("PROXY_AUTH_TRUSTED_PROXIES is required when proxy auth is enabled")
+	}
+
+	return cfg, nil
+}
+
+func headerOrDefault(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// parseNetwork accepts a CIDR or a single IP address.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, errors.New("not an IP address or CIDR")
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+// trusted reports whether the direct peer of the connection is a trusted
+// proxy. Forwarded-for headers are deliberately ignored since they can be
+// set by anyone.
+func (c ProxyAuthConfig) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range c.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BindProxyAuth installs a router middleware that authenticates requests from
+// trusted proxies as the user named in the identity headers, provisioning the
+// users record on first sight. It runs right after PocketBase loads the auth
+// token, so both custom route guards and collection rules see the user.
+//
+// It also registers GET /api/auth/proxy, which exchanges the proxy identity
+// for a regular PocketBase auth token the SPA can store.
+func BindProxyAuth(se *core.ServeEvent, cfg ProxyAuthConfig, auditService *audit.Service) {
+	se.Router.Bind(&hook.Handler[*core.RequestEvent]{
+		Id:       proxyAuthMiddlewareID,
+		Priority: apis.DefaultLoadAuthTokenMiddlewarePriority + 1,
+		Func: func(re *core.RequestEvent) error {
+			username := strings.TrimSpace(re.Request.Header.Get(cfg.UserHeader))
+			if re.Auth != nil || username == "" || !cfg.trusted(re.Request.RemoteAddr) {
+				return re.Next()
+			}
+
+			record, err := resolveProxyUser(re, cfg, auditService, username)
+			if err != nil {
+				return err
+			}
+
+			re.Auth = record
+			re.Set(requestKeyProxyAuth, true)
+
+			return re.Next()
+		},
+	})
+
+	se.Router.GET("/api/auth/proxy", func(re *core.RequestEvent) error {
+		if proxied, _ := re.Get(requestKeyProxyAuth).(bool); !proxied {
+			return re.UnauthorizedError("The request was not authenticated by a trusted proxy.", nil)
+		}
+
+		return apis.RecordAuthResponse(re, re.Auth, ProxyAuthMethod, nil)
+	})
+}
+
+func resolveProxyUser(re *core.RequestEvent, cfg ProxyAuthConfig, auditService *audit.Service, username string) (*core.Record, error) {
+	role, ok := cfg.Roles.RoleFor(splitList(re.Request.Header.Get(cfg.GroupsHeader)))
+	if !ok {
+		return nil, re.ForbiddenError("Your account is not a member of an allowed group.", nil)
+	}
+
+	email := strings.TrimSpace(re.Request.Header.Get(cfg.EmailHeader))
+	switch {
+	case email != "":
+	case strings.Contains(username, "@"):
+		email = username
+	case cfg.EmailDomain != "":
+		email = username + "@" + cfg.EmailDomain
+	default:
+		return nil, re.ForbiddenError("The proxy did not provide an email address for the user.", nil)
+	}
+
+	record, err := re.App.FindAuthRecordByEmail("users", email)
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		record, err = provisionProxyUser(re, cfg, auditService, username, email, role)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, re.InternalServerError("Failed to load the proxy user.", err)
+	}
+
+	if record.GetBool("disabled") {
+		return nil, re.ForbiddenError("This account has been disabled.", nil)
+	}
+
+	syncGroupRole(proxyAuditContext(re, record), re.App, auditService, record, role, ProxyAuthMethod)
+
+	return record, nil
+}
+
+func provisionProxyUser(re *core.RequestEvent, cfg ProxyAuthConfig, auditService *audit.Service, username, email, role string) (*core.Record, error) {
+	collection, err := re.App.FindCollectionByNameOrId("users")
+	if err != nil {
+		return nil, re.InternalServerError("Failed to find the users collection.", err)
+	}
+
+	name := strings.TrimSpace(re.Request.Header.Get(cfg.NameHeader))
+	if name == "" {
+		name = username
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("email", email)
+	record.Set("role", role)
+	record.Set("verified", true)
+	record.Set("emailVisibility", false)
+	// The proxy is the only way in; nobody knows this password
+	record.SetPassword(security.RandomString(40))
+
+	if err := re.App.Save(record); err != nil {
+		// A concurrent request may have provisioned the same user
+		if existing, findErr := re.App.FindAuthRecordByEmail("users", email); findErr == nil {
+			return existing, nil
+		}
+		return nil, re.InternalServerError("Failed to provision the proxy user.", err)
+	}
+
+	auditService.Record(proxyAuditContext(re, record), audit.Entry{
+		Action:  audit.ActionUserCreate,
+		Targets: []string{record.Id},
+		After:   map[string]any{"name": name, "email": email, "role": role},
+		Details: map[string]any{"provider": ProxyAuthMethod},
+	})
+
+	return record, nil
+}
+
+func proxyAuditContext(re *core.RequestEvent, record *core.Record) context.Context {
+	return audit.WithActor(re.Request.Context(), audit.Actor{
+		UserID: record.Id,
+		Email:  record.Email(),
+		IP:     re.RealIP(),
+	})
+}
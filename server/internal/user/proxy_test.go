@@ -0,0 +1,157 @@
+package user
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func proxyAuthScenario(trustedCIDR string) (func(t testing.TB) *tests.TestApp, func(t testing.TB, app *tests.TestApp, e *core.ServeEvent)) {
+	factory := func(t testing.TB) *tests.TestApp {
+		testApp := newAuthTestApp(t)
+
+		// Same list rule PocketBase creates for a fresh users collection
+		users, err := testApp.FindCollectionByNameOrId("users")
+		if err != nil {
+			t.Fatalf("Failed to find users collection: %v", err)
+		}
+		users.ListRule = types.Pointer("id = @request.auth.id")
+		if err := testApp.Save(users); err != nil {
+			t.Fatalf("Failed to update users list rule: %v", err)
+		}
+
+		return testApp
+	}
+
+	before := func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+		_, network, err := net.ParseCIDR(trustedCIDR)
+		if err != nil {
+			t.Fatalf("Invalid CIDR: %v", err)
+		}
+
+		BindProxyAuth(e, ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []*net.IPNet{network},
+			UserHeader:     "Remote-User",
+			EmailHeader:    "Remote-Email",
+			NameHeader:     "Remote-Name",
+			GroupsHeader:   "Remote-Groups",
+			EmailDomain:    "home.lan",
+			Roles: GroupRoles{
+				AdminGroups: []string{"admins"},
+				UserGroups:  []string{"media"},
+			},
+		}, nil)
+
+		e.Router.GET("/api/test/admin", func(re *core.RequestEvent) error {
+			if re.Auth.GetString("role") != "admin" {
+				return re.ForbiddenError("admin role required", nil)
+			}
+			return re.NoContent(http.StatusNoContent)
+		}).Bind(apis.RequireAuth("users"))
+	}
+
+	return factory, before
+}
+
+func TestProxyAuth(t *testing.T) {
+	// httptest requests come from 192.0.2.1
+	trustedFactory, trustedBefore := proxyAuthScenario("192.0.2.0/24")
+	untrustedFactory, untrustedBefore := proxyAuthScenario("10.0.0.0/8")
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "trusted proxy user is provisioned and passes collection rules",
+			Method: http.MethodGet,
+			URL:    "/api/collections/users/records",
+			Headers: map[string]string{
+				"Remote-User":   "dave",
+				"Remote-Name":   "Dave",
+				"Remote-Groups": "media",
+			},
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"totalItems":1`, `"email":"dave@home.lan"`, `"name":"Dave"`},
+			TestAppFactory:  trustedFactory,
+			BeforeTestFunc:  trustedBefore,
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				expectRole(t, app, "dave@home.lan", "user")
+			},
+		},
+		{
+			Name:   "mapped admin passes the custom route guard",
+			Method: http.MethodGet,
+			URL:    "/api/test/admin",
+			Headers: map[string]string{
+				"Remote-User":   "root",
+				"Remote-Email":  "root@example.com",
+				"Remote-Groups": "media,admins",
+			},
+			ExpectedStatus: http.StatusNoContent,
+			TestAppFactory: trustedFactory,
+			BeforeTestFunc: trustedBefore,
+		},
+		{
+			Name:   "headers from untrusted peers are ignored",
+			Method: http.MethodGet,
+			URL:    "/api/test/admin",
+			Headers: map[string]string{
+				"Remote-User":   "root",
+				"Remote-Email":  "root@example.com",
+				"Remote-Groups": "admins",
+			},
+			ExpectedStatus:  http.StatusUnauthorized,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  untrustedFactory,
+			BeforeTestFunc:  untrustedBefore,
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				if _, err := app.FindAuthRecordByEmail("users", "root@example.com"); err == nil {
+					t.Errorf("Expected no user to be provisioned")
+				}
+			},
+		},
+		{
+			Name:   "users outside the allowed groups are rejected",
+			Method: http.MethodGet,
+			URL:    "/api/collections/users/records",
+			Headers: map[string]string{
+				"Remote-User":   "eve",
+				"Remote-Groups": "guests",
+			},
+			ExpectedStatus:  http.StatusForbidden,
+			ExpectedContent: []string{"not a member of an allowed group"},
+			TestAppFactory:  trustedFactory,
+			BeforeTestFunc:  trustedBefore,
+		},
+		{
+			Name:   "proxy identity is exchanged for an auth token",
+			Method: http.MethodGet,
+			URL:    "/api/auth/proxy",
+			Headers: map[string]string{
+				"Remote-User":   "dave",
+				"Remote-Groups": "media",
+			},
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"token":`, `"email":"dave@home.lan"`},
+			TestAppFactory:  trustedFactory,
+			BeforeTestFunc:  trustedBefore,
+		},
+		{
+			Name:            "token exchange requires a proxied request",
+			Method:          http.MethodGet,
+			URL:             "/api/auth/proxy",
+			ExpectedStatus:  http.StatusUnauthorized,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  trustedFactory,
+			BeforeTestFunc:  trustedBefore,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -1,14 +1,22 @@
 package user
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+
+	"backend/internal/audit"
+	"backend/internal/torrent"
 )
 
 var allowedRoles = map[string]struct{}{
@@ -18,12 +26,17 @@ var allowedRoles = map[string]struct{}{
 
 // Service provides higher level helpers around PocketBase's user collection.
 type Service struct {
-	app *pocketbase.PocketBase
+	app      *pocketbase.PocketBase
+	audit    *audit.Service
+	torrents *torrent.Service
+
+	setupMu    sync.Mutex
+	setupToken string
 }
 
 // NewService constructs a Service instance.
-func NewService(app *pocketbase.PocketBase) *Service {
-	return &Service{app: app}
+func NewService(app *pocketbase.PocketBase, auditService *audit.Service, torrentService *torrent.Service) *Service {
+	return &Service{app: app, audit: auditService, torrents: torrentService}
 }
 
 // Response represents the subset of user information exposed by the API.
@@ -34,6 +47,7 @@ type Response struct {
 	Role            string `json:"role"`
 	Verified        bool   `json:"verified"`
 	EmailVisibility bool   `json:"emailVisibility"`
+	Disabled        bool   `json:"disabled"`
 	Created         string `json:"created"`
 	Updated         string `json:"updated"`
 }
@@ -58,6 +72,24 @@ type UpdateParams struct {
 	Role            *string
 	Verified        *bool
 	EmailVisibility *bool
+	Disabled        *bool
+}
+
+// Torrent dispositions available when deleting a user.
+const (
+	TorrentsReassign = "reassign"
+	TorrentsRemove   = "remove"
+)
+
+// DeleteParams controls what happens to the torrents owned by a deleted user.
+type DeleteParams struct {
+	// Torrents is either TorrentsReassign or TorrentsRemove. It is only
+	// required when the user owns torrents.
+	Torrents string
+	// ReassignTo is the id of the user receiving the torrents when reassigning.
+	ReassignTo string
+	// DeleteLocalData also deletes downloaded data when removing torrents.
+	DeleteLocalData bool
 }
 
 // AdminSetupParams contains the payload for creating the initial admin user.
@@ -66,6 +98,8 @@ type AdminSetupParams struct {
 	Username string
 	Email    string
 	Password string
+	// SetupToken must match the token from the server log when one is required.
+	SetupToken string
 }
 
 // ValidationError indicates that the provided data is invalid for the requested action.
@@ -88,6 +122,13 @@ func (e NotFoundError) Error() string {
 
 var ErrAdminAlreadyExists = errors.New("admin account already exists")
 
+// ErrInvalidSetupToken is returned when the initial setup is attempted without
+// the required setup token.
+var ErrInvalidSetupToken = errors.New("invalid setup token")
+
+// ErrLastAdmin is returned when an action would leave no enabled admin.
+var ErrLastAdmin = errors.New("at least one enabled admin account is required")
+
 func normalizeRole(role string) (string, bool) {
 	cleaned := strings.ToLower(strings.TrimSpace(role))
 	if cleaned == "" {
@@ -114,6 +155,7 @@ func mapUserRecord(record *core.Record) Response {
 		Role:            roleValue,
 		Verified:        record.GetBool("verified"),
 		EmailVisibility: record.GetBool("emailVisibility"),
+		Disabled:        record.GetBool("disabled"),
 		Created:         created.Format(time.RFC3339),
 		Updated:         updated.Format(time.RFC3339),
 	}
@@ -144,7 +186,7 @@ func (s *Service) List() ([]Response, error) {
 }
 
 // Create inserts a new user record.
-func (s *Service) Create(params CreateParams) (Response, error) {
+func (s *Service) Create(ctx context.Context, params CreateParams) (Response, error) {
 	name := strings.TrimSpace(params.Name)
 	if name == "" {
 		name = strings.TrimSpace(params.Username)
@@ -180,14 +222,25 @@ func (s *Service) Create(params CreateParams) (Response, error) {
 	record.SetPassword(password)
 
 	if err := s.app.Save(record); err != nil {
+		s.audit.Record(ctx, audit.Entry{
+			Action: audit.ActionUserCreate,
+			After:  map[string]any{"name": name, "email": email, "role": roleValue},
+			Err:    err,
+		})
 		return Response{}, fmt.Errorf("save user: %w", err)
 	}
 
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionUserCreate,
+		Targets: []string{record.Id},
+		After:   map[string]any{"name": name, "email": email, "role": roleValue},
+	})
+
 	return mapUserRecord(record), nil
 }
 
 // Update applies partial updates to a user record by ID.
-func (s *Service) Update(id string, params UpdateParams) (Response, error) {
+func (s *Service) Update(ctx context.Context, id string, params UpdateParams) (Response, error) {
 	if strings.TrimSpace(id) == "" {
 		return Response{}, ValidationError{Message: "user id is required"}
 	}
@@ -205,6 +258,8 @@ func (s *Service) Update(id string, params UpdateParams) (Response, error) {
 		return Response{}, fmt.Errorf("find user: %w", err)
 	}
 
+	before := mapUserRecord(record)
+
 	if params.Name != nil || params.Username != nil {
 		var name string
 		if params.Name != nil {
@@ -254,37 +309,266 @@ func (s *Service) Update(id string, params UpdateParams) (Response, error) {
 		record.Set("emailVisibility", *params.EmailVisibility)
 	}
 
-	if err := s.app.Save(record); err != nil {
-		return Response{}, fmt.Errorf("save user: %w", err)
+	if params.Disabled != nil {
+		record.Set("disabled", *params.Disabled)
+		if *params.Disabled && !before.Disabled {
+			// Invalidate all auth tokens issued to the user
+			record.RefreshTokenKey()
+		}
+	}
+
+	after := mapUserRecord(record)
+	changedBefore, changedAfter := diffUsers(before, after)
+	if params.Password != nil && strings.TrimSpace(*params.Password) != "" {
+		// Never store password values, only the fact that it changed
+		changedAfter["password"] = "changed"
 	}
 
+	entry := audit.Entry{
+		Action:  audit.ActionUserUpdate,
+		Targets: []string{record.Id},
+		Before:  changedBefore,
+		After:   changedAfter,
+	}
+
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		if isActiveAdmin(before) && !isActiveAdmin(after) {
+			if err := ensureOtherActiveAdmin(txApp, record.Id); err != nil {
+				return err
+			}
+		}
+
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("save user: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return Response{}, err
+	}
+
+	s.audit.Record(ctx, entry)
+
 	return mapUserRecord(record), nil
 }
 
-// AdminExists determines whether an admin user already exists.
-func (s *Service) AdminExists() (bool, error) {
+// Delete removes a user record by ID. Torrents owned by the user are either
+// reassigned to another user or removed from the download client once the
+// user is deleted.
+func (s *Service) Delete(ctx context.Context, id string, params DeleteParams) error {
+	if strings.TrimSpace(id) == "" {
+		return ValidationError{Message: "user id is required"}
+	}
+
 	collection, err := s.userCollection()
 	if err != nil {
-		return false, fmt.Errorf("find users collection: %w", err)
+		return fmt.Errorf("find users collection: %w", err)
+	}
+
+	record, err := s.app.FindRecordById(collection, id, nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NotFoundError{Message: "user not found"}
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+
+	owned, err := s.app.FindRecordsByFilter("torrents", "user = {:user}", "", 0, 0, dbx.Params{"user": record.Id})
+	if err != nil {
+		return fmt.Errorf("find user torrents: %w", err)
+	}
+
+	entry := audit.Entry{
+		Action:  audit.ActionUserDelete,
+		Targets: []string{record.Id},
+		Before:  mapUserRecord(record),
+		Details: map[string]any{
+			"torrents":        len(owned),
+			"disposition":     params.Torrents,
+			"reassignTo":      params.ReassignTo,
+			"deleteLocalData": params.DeleteLocalData,
+		},
+	}
+
+	fail := func(err error) error {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return err
+	}
+
+	if len(owned) > 0 {
+		switch params.Torrents {
+		case TorrentsReassign:
+			if params.ReassignTo == "" || params.ReassignTo == record.Id {
+				return fail(ValidationError{Message: "reassignTo must reference another user"})
+			}
+			if _, err := s.app.FindRecordById(collection, params.ReassignTo, nil); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return fail(ValidationError{Message: "reassignTo user not found"})
+				}
+				return fail(fmt.Errorf("find reassign target: %w", err))
+			}
+		case TorrentsRemove:
+		default:
+			return fail(ValidationError{Message: "user owns torrents; torrents must be either 'reassign' or 'remove'"})
+		}
+	}
+
+	if isActiveAdmin(mapUserRecord(record)) {
+		if err := ensureOtherActiveAdmin(s.app, record.Id); err != nil {
+			return fail(err)
+		}
+	}
+
+	var removeIDs []int64
+	if params.Torrents == TorrentsRemove {
+		for _, rec := range owned {
+			if transmissionID := rec.GetInt("transmissionId"); transmissionID != 0 {
+				removeIDs = append(removeIDs, int64(transmissionID))
+			}
+		}
+	}
+
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		// Re-check inside the transaction so concurrent requests can't remove every admin
+		if isActiveAdmin(mapUserRecord(record)) {
+			if err := ensureOtherActiveAdmin(txApp, record.Id); err != nil {
+				return err
+			}
+		}
+
+		for _, rec := range owned {
+			if params.Torrents == TorrentsReassign {
+				rec.Set("user", params.ReassignTo)
+				if err := txApp.Save(rec); err != nil {
+					return fmt.Errorf("reassign torrent %s: %w", rec.Id, err)
+				}
+				continue
+			}
+
+			// The sync drops removed torrents too, but don't leave orphans behind meanwhile
+			if err := txApp.Delete(rec); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("delete torrent record %s: %w", rec.Id, err)
+			}
+		}
+
+		if err := txApp.Delete(record); err != nil {
+			return fmt.Errorf("delete user: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	s.audit.Record(ctx, entry)
+
+	// Torrents and their data can't be restored, so they are only removed
+	// once the user is gone for certain. If this fails, the sync brings the
+	// torrents back without an owner.
+	if len(removeIDs) > 0 {
+		deleteLocalData := params.DeleteLocalData
+		if err := s.torrents.RemoveTorrents(ctx, torrent.RemoveTorrentRequest{IDs: removeIDs, DeleteLocalData: &deleteLocalData}); err != nil {
+			return fmt.Errorf("user deleted, but removing their torrents failed: %w", err)
+		}
 	}
 
-	records, err := s.app.FindRecordsByFilter(collection, "role = 'admin'", "", 1, 0, nil)
+	return nil
+}
+
+// isActiveAdmin reports whether the user is an admin that can still log in.
+func isActiveAdmin(user Response) bool {
+	return user.Role == "admin" && !user.Disabled
+}
+
+// ensureOtherActiveAdmin returns ErrLastAdmin unless an enabled admin other
+// than excludeID exists.
+func ensureOtherActiveAdmin(app core.App, excludeID string) error {
+	total, err := app.CountRecords("users",
+		dbx.HashExp{"role": "admin", "disabled": false},
+		dbx.Not(dbx.HashExp{"id": excludeID}),
+	)
 	if err != nil {
-		return false, fmt.Errorf("find admin users: %w", err)
+		return fmt.Errorf("count admin users: %w", err)
+	}
+
+	if total == 0 {
+		return ErrLastAdmin
 	}
 
-	return len(records) > 0, nil
+	return nil
 }
 
-// SetupInitialAdmin creates the first admin user and PocketBase superuser.
-func (s *Service) SetupInitialAdmin(params AdminSetupParams) error {
+// diffUsers returns the before and after values of the fields that differ.
+func diffUsers(before, after Response) (map[string]any, map[string]any) {
+	changedBefore := map[string]any{}
+	changedAfter := map[string]any{}
+
+	compare := func(field string, oldValue, newValue any) {
+		if oldValue != newValue {
+			changedBefore[field] = oldValue
+			changedAfter[field] = newValue
+		}
+	}
+
+	compare("name", before.Name, after.Name)
+	compare("email", before.Email, after.Email)
+	compare("role", before.Role, after.Role)
+	compare("verified", before.Verified, after.Verified)
+	compare("emailVisibility", before.EmailVisibility, after.EmailVisibility)
+	compare("disabled", before.Disabled, after.Disabled)
+
+	return changedBefore, changedAfter
+}
+
+// AdminExists determines whether an admin user already exists.
+func (s *Service) AdminExists() (bool, error) {
+	return adminExists(s.app)
+}
+
+// RequireSetupToken makes the initial admin setup require a one-time token
+// and returns it so it can be shown in the server log. No token is generated
+// once an admin exists.
+func (s *Service) RequireSetupToken() (string, error) {
 	exists, err := s.AdminExists()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if exists {
-		return ErrAdminAlreadyExists
+		return "", nil
+	}
+
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	s.setupToken = security.RandomString(32)
+
+	return s.setupToken, nil
+}
+
+// SetupTokenRequired reports whether the initial setup needs a setup token.
+func (s *Service) SetupTokenRequired() bool {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	return s.setupToken != ""
+}
+
+// SetupInitialAdmin creates the first admin user and PocketBase superuser.
+// Both are created in one transaction, so concurrent requests can't create
+// more than one admin and a failed superuser creation leaves no user behind.
+func (s *Service) SetupInitialAdmin(ctx context.Context, params AdminSetupParams) error {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	if s.setupToken != "" && subtle.ConstantTimeCompare([]byte(s.setupToken), []byte(strings.TrimSpace(params.SetupToken))) != 1 {
+		s.audit.Record(ctx, audit.Entry{Action: audit.ActionAdminSetup, Err: ErrInvalidSetupToken})
+		return ErrInvalidSetupToken
 	}
 
 	name := strings.TrimSpace(params.Name)
@@ -316,13 +600,42 @@ func (s *Service) SetupInitialAdmin(params AdminSetupParams) error {
 	record.Set("verified", true)
 	record.SetPassword(password)
 
-	if err := s.app.Save(record); err != nil {
-		return fmt.Errorf("save admin user: %w", err)
+	entry := audit.Entry{
+		Action: audit.ActionAdminSetup,
+		After:  map[string]any{"name": name, "email": email, "role": "admin"},
 	}
 
-	if err := CreatePocketbaseAdmin(s.app, email, password); err != nil {
-		return fmt.Errorf("create pocketbase admin: %w", err)
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		exists, err := adminExists(txApp)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return ErrAdminAlreadyExists
+		}
+
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("save admin user: %w", err)
+		}
+
+		if err := CreatePocketbaseAdmin(txApp, email, password); err != nil {
+			return fmt.Errorf("create pocketbase admin: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return err
 	}
 
+	entry.Targets = []string{record.Id}
+	s.audit.Record(ctx, entry)
+
+	// The token is single use
+	s.setupToken = ""
+
 	return nil
 }
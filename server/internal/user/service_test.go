@@ -0,0 +1,81 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+func TestDeleteKeepsTorrentsWhenDeleteFails(t *testing.T) {
+	testApp := testutil.NewTestApp(t)
+
+	client := transmission.NewMockClient(testApp)
+	syncService := transmission.NewSyncService(testApp, client, 0)
+	auditService := audit.NewService(testApp)
+	app := &pocketbase.PocketBase{App: testApp}
+	service := NewService(app, auditService, torrent.NewService(app, client, syncService, auditService))
+
+	owner := testutil.CreateUser(t, testApp, "leaving@example.com", "user")
+
+	if err := syncService.ForceSync(); err != nil {
+		t.Fatalf("ForceSync failed: %v", err)
+	}
+	record, err := testApp.FindFirstRecordByData("torrents", "transmissionId", 1)
+	if err != nil {
+		t.Fatalf("Failed to find synced torrent: %v", err)
+	}
+	record.Set("user", owner.Id)
+	if err := testApp.Save(record); err != nil {
+		t.Fatalf("Failed to assign torrent: %v", err)
+	}
+
+	countTorrents := func() int {
+		torrents, err := client.GetTorrents(context.Background())
+		if err != nil {
+			t.Fatalf("GetTorrents failed: %v", err)
+		}
+		// The mock marks removed torrents rather than dropping them
+		count := 0
+		for _, t := range torrents {
+			if t.Status != "removed" {
+				count++
+			}
+		}
+		return count
+	}
+	before := countTorrents()
+
+	// Fail the delete inside the transaction
+	failID := testApp.OnRecordDelete("users").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.Id == owner.Id {
+			return errors.New("delete failed")
+		}
+		return e.Next()
+	})
+
+	if err := service.Delete(context.Background(), owner.Id, DeleteParams{Torrents: TorrentsRemove, DeleteLocalData: true}); err == nil {
+		t.Fatalf("Expected the delete to fail")
+	}
+	if after := countTorrents(); after != before {
+		t.Errorf("Expected the torrents to be kept, got %d of %d", after, before)
+	}
+	if _, err := testApp.FindRecordById("users", owner.Id); err != nil {
+		t.Errorf("Expected the user to be kept: %v", err)
+	}
+
+	testApp.OnRecordDelete("users").Unbind(failID)
+	if err := service.Delete(context.Background(), owner.Id, DeleteParams{Torrents: TorrentsRemove}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if after := countTorrents(); after != before-1 {
+		t.Errorf("Expected the torrent to be removed after the user, got %d of %d", after, before)
+	}
+}
@@ -0,0 +1,360 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"backend/internal/audit"
+)
+
+const sessionMiddlewareID = "retorrentSessions"
+
+// lastSeenInterval throttles how often a session's lastSeenAt is written.
+const lastSeenInterval = 5 * time.Minute
+
+// Session describes an issued user auth token.
+type Session struct {
+	ID         string `json:"id"`
+	Method     string `json:"method"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"userAgent"`
+	LastSeenAt string `json:"lastSeenAt,omitempty"`
+	ExpiresAt  string `json:"expiresAt"`
+	Created    string `json:"created"`
+	// Current is true for the session making the request.
+	Current bool `json:"current"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestToken returns the auth token of the request the same way
+// PocketBase reads it.
+func RequestToken(re *core.RequestEvent) string {
+	token := re.Request.Header.Get("Authorization")
+	return strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+}
+
+func formatSessionDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func mapSessionRecord(record *core.Record, currentHash string) Session {
+	return Session{
+		ID:         record.Id,
+		Method:     record.GetString("method"),
+		IP:         record.GetString("ip"),
+		UserAgent:  record.GetString("userAgent"),
+		LastSeenAt: formatSessionDate(record, "lastSeenAt"),
+		ExpiresAt:  formatSessionDate(record, "expiresAt"),
+		Created:    formatSessionDate(record, "created"),
+		Current:    currentHash != "" && record.GetString("tokenHash") == currentHash,
+	}
+}
+
+func findSession(app core.App, tokenHash string) (*core.Record, error) {
+	record, err := app.FindFirstRecordByData("auth_sessions", "tokenHash", tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("find session: %w", err)
+	}
+	return record, nil
+}
+
+// trackSession stores the token issued by an auth response. Token refreshes
+// (and re-issued tokens, e.g. after a password change) carry over the session
+// of the token that was presented instead of creating a new one.
+func trackSession(e *core.RecordAuthRequestEvent) error {
+	var record *core.Record
+
+	if e.AuthMethod == "" {
+		if previous := RequestToken(e.RequestEvent); previous != "" {
+			existing, err := findSession(e.App, hashToken(previous))
+			if err != nil {
+				return err
+			}
+			if existing != nil && existing.GetString("user") == e.Record.Id && existing.GetDateTime("revokedAt").IsZero() {
+				record = existing
+			}
+		}
+	}
+
+	if record == nil {
+		// Tokens of the same user issued within the same second are identical
+		existing, err := findSession(e.App, hashToken(e.Token))
+		if err != nil {
+			return err
+		}
+		record = existing
+	}
+
+	if record == nil {
+		collection, err := e.App.FindCollectionByNameOrId("auth_sessions")
+		if err != nil {
+			return fmt.Errorf("find auth_sessions collection: %w", err)
+		}
+
+		method := e.AuthMethod
+		if method == "" {
+			method = "token"
+		}
+
+		record = core.NewRecord(collection)
+		record.Set("user", e.Record.Id)
+		record.Set("method", method)
+	}
+
+	userAgent := e.Request.UserAgent()
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	now := time.Now()
+	record.Set("tokenHash", hashToken(e.Token))
+	record.Set("ip", e.RealIP())
+	record.Set("userAgent", userAgent)
+	record.Set("lastSeenAt", now)
+	record.Set("expiresAt", now.Add(time.Duration(e.Collection.AuthToken.Duration)*time.Second))
+
+	return e.App.Save(record)
+}
+
+// BindSessionTracking records every user auth token PocketBase issues so users
+// can review their sessions, and refuses tokens of revoked sessions. Tokens
+// issued before tracking was enabled keep working until they expire.
+func BindSessionTracking(se *core.ServeEvent) {
+	se.App.OnRecordAuthRequest("users").BindFunc(func(e *core.RecordAuthRequestEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		// Other hooks may have answered with an error response instead of the token
+		if e.Status() != 0 && e.Status() != 200 {
+			return nil
+		}
+
+		if err := trackSession(e); err != nil {
+			e.App.Logger().Warn("Failed to record auth session", "user", e.Record.Id, "error", err)
+		}
+
+		return nil
+	})
+
+	se.Router.Bind(&hook.Handler[*core.RequestEvent]{
+		Id: sessionMiddlewareID,
+		// Run right after PocketBase loaded the auth token
+		Priority: apis.DefaultLoadAuthTokenMiddlewarePriority + 1,
+		Func: func(re *core.RequestEvent) error {
+			if re.Auth == nil || re.Auth.Collection().Name != "users" {
+				return re.Next()
+			}
+
+			token := RequestToken(re)
+			if token == "" {
+				return re.Next()
+			}
+
+			record, err := findSession(re.App, hashToken(token))
+			if err != nil {
+				return re.InternalServerError("Failed to load the auth session.", err)
+			}
+			if record == nil {
+				return re.Next()
+			}
+
+			if !record.GetDateTime("revokedAt").IsZero() {
+				re.Auth = nil
+				return re.Next()
+			}
+
+			if time.Since(record.GetDateTime("lastSeenAt").Time()) > lastSeenInterval {
+				record.Set("lastSeenAt", time.Now())
+				if err := re.App.Save(record); err != nil {
+					re.App.Logger().Warn("Failed to update auth session", "session", record.Id, "error", err)
+				}
+			}
+
+			return re.Next()
+		},
+	})
+}
+
+// activeSessions returns the sessions of the user that are neither revoked nor expired.
+func activeSessions(app core.App, userID string) ([]*core.Record, error) {
+	records, err := app.FindRecordsByFilter(
+		"auth_sessions",
+		"user = {:user} && revokedAt = '' && expiresAt > {:now}",
+		"-lastSeenAt",
+		0,
+		0,
+		dbx.Params{"user": userID, "now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find sessions: %w", err)
+	}
+	return records, nil
+}
+
+// revokeSessions marks the user's active sessions as revoked, except the
+// session of keepToken.
+func revokeSessions(app core.App, userID, keepToken string) (int, error) {
+	records, err := activeSessions(app, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	keepHash := ""
+	if keepToken != "" {
+		keepHash = hashToken(keepToken)
+	}
+
+	revoked := 0
+	for _, record := range records {
+		if record.GetString("tokenHash") == keepHash {
+			continue
+		}
+		record.Set("revokedAt", time.Now())
+		if err := app.Save(record); err != nil {
+			return revoked, fmt.Errorf("revoke session %s: %w", record.Id, err)
+		}
+		revoked++
+	}
+
+	return revoked, nil
+}
+
+// ListSessions returns the active sessions of the user. The session of
+// currentToken is flagged as current.
+func (s *Service) ListSessions(userID, currentToken string) ([]Session, error) {
+	records, err := activeSessions(s.app, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	currentHash := ""
+	if currentToken != "" {
+		currentHash = hashToken(currentToken)
+	}
+
+	sessions := make([]Session, 0, len(records))
+	for _, record := range records {
+		sessions = append(sessions, mapSessionRecord(record, currentHash))
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes one of the user's sessions.
+func (s *Service) RevokeSession(ctx context.Context, userID, id string) error {
+	record, err := s.app.FindRecordById("auth_sessions", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NotFoundError{Message: "session not found"}
+		}
+		return fmt.Errorf("find session: %w", err)
+	}
+
+	// Don't reveal the existence of sessions that belong to other users
+	if record.GetString("user") != userID || !record.GetDateTime("revokedAt").IsZero() {
+		return NotFoundError{Message: "session not found"}
+	}
+
+	entry := audit.Entry{
+		Action:  audit.ActionSessionRevoke,
+		Targets: []string{userID},
+		Details: map[string]any{"session": record.Id},
+	}
+
+	record.Set("revokedAt", time.Now())
+	if err := s.app.Save(record); err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return fmt.Errorf("revoke session: %w", err)
+	}
+
+	s.audit.Record(ctx, entry)
+
+	return nil
+}
+
+// RevokeOtherSessions signs the user out everywhere by invalidating all of
+// their auth tokens, including untracked ones. The returned record carries
+// the new token key so the caller can be issued a fresh token.
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, currentToken string) (*core.Record, error) {
+	record, err := s.app.FindRecordById("users", userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: "user not found"}
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+
+	entry := audit.Entry{
+		Action:  audit.ActionSessionRevoke,
+		Targets: []string{userID},
+		Details: map[string]any{"session": "others"},
+	}
+
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		record.RefreshTokenKey()
+		if err := txApp.Save(record); err != nil {
+			return fmt.Errorf("save user: %w", err)
+		}
+
+		_, err := revokeSessions(txApp, userID, currentToken)
+		return err
+	})
+	if err != nil {
+		entry.Err = err
+		s.audit.Record(ctx, entry)
+		return nil, err
+	}
+
+	s.audit.Record(ctx, entry)
+
+	return record, nil
+}
+
+// PruneSessions deletes sessions that expired or were revoked before the
+// given age, returning how many were removed.
+func (s *Service) PruneSessions(olderThan time.Duration) (int64, error) {
+	cutoff, err := types.ParseDateTime(time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, fmt.Errorf("parse cutoff date: %w", err)
+	}
+
+	result, err := s.app.NonconcurrentDB().Delete("auth_sessions", dbx.Or(
+		dbx.NewExp("expiresAt < {:cutoff}", dbx.Params{"cutoff": cutoff.String()}),
+		dbx.NewExp("revokedAt != '' AND revokedAt < {:cutoff}", dbx.Params{"cutoff": cutoff.String()}),
+	)).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count deleted sessions: %w", err)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,167 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/testutil"
+)
+
+// createSession stores a session for a fresh token of the user and returns the
+// token. Tokens are only unique per second, so the validity tells them apart.
+func createSession(t testing.TB, app core.App, email string, validity time.Duration, revoked bool) string {
+	t.Helper()
+
+	record, err := app.FindAuthRecordByEmail("users", email)
+	if err != nil {
+		t.Fatalf("Failed to find user %s: %v", email, err)
+	}
+
+	token, err := record.NewStaticAuthToken(validity)
+	if err != nil {
+		t.Fatalf("Failed to create auth token: %v", err)
+	}
+
+	collection, err := app.FindCollectionByNameOrId("auth_sessions")
+	if err != nil {
+		t.Fatalf("Failed to find auth_sessions collection: %v", err)
+	}
+
+	session := core.NewRecord(collection)
+	session.Set("user", record.Id)
+	session.Set("tokenHash", hashToken(token))
+	session.Set("method", "password")
+	session.Set("lastSeenAt", time.Now())
+	session.Set("expiresAt", time.Now().Add(validity))
+	if revoked {
+		session.Set("revokedAt", time.Now())
+	}
+	if err := app.Save(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	return token
+}
+
+func TestSessionTracking(t *testing.T) {
+	// Filled in by the factories once the sessions exist
+	headers := map[string]string{}
+
+	before := func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+		BindSessionTracking(e)
+		e.Router.GET("/api/test/protected", func(re *core.RequestEvent) error {
+			return re.NoContent(http.StatusNoContent)
+		}).Bind(apis.RequireAuth("users"))
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "logins are recorded as sessions",
+			Method: http.MethodPost,
+			URL:    "/api/collections/users/auth-with-password",
+			Body:   strings.NewReader(`{"identity":"alice@example.com","password":"supersecret"}`),
+			TestAppFactory: func(t testing.TB) *tests.TestApp {
+				testApp := newAuthTestApp(t)
+				testutil.CreateUser(t, testApp, "alice@example.com", "user")
+				return testApp
+			},
+			BeforeTestFunc:  before,
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"token":`},
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				sessions, err := app.FindAllRecords("auth_sessions")
+				if err != nil {
+					t.Fatalf("Failed to find sessions: %v", err)
+				}
+				if len(sessions) != 1 || sessions[0].GetString("method") != core.MFAMethodPassword {
+					t.Fatalf("Expected one password session, got %d", len(sessions))
+				}
+			},
+		},
+		{
+			Name:    "tokens of active sessions are accepted",
+			Method:  http.MethodGet,
+			URL:     "/api/test/protected",
+			Headers: headers,
+			TestAppFactory: func(t testing.TB) *tests.TestApp {
+				testApp := newAuthTestApp(t)
+				testutil.CreateUser(t, testApp, "alice@example.com", "user")
+				headers["Authorization"] = createSession(t, testApp, "alice@example.com", time.Hour, false)
+				return testApp
+			},
+			BeforeTestFunc: before,
+			ExpectedStatus: http.StatusNoContent,
+		},
+		{
+			Name:    "tokens of revoked sessions are refused",
+			Method:  http.MethodGet,
+			URL:     "/api/test/protected",
+			Headers: headers,
+			TestAppFactory: func(t testing.TB) *tests.TestApp {
+				testApp := newAuthTestApp(t)
+				testutil.CreateUser(t, testApp, "alice@example.com", "user")
+				headers["Authorization"] = createSession(t, testApp, "alice@example.com", time.Hour, true)
+				return testApp
+			},
+			BeforeTestFunc:  before,
+			ExpectedStatus:  http.StatusUnauthorized,
+			ExpectedContent: []string{`"data":{}`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	testApp := newAuthTestApp(t)
+	defer testApp.Cleanup()
+
+	service := NewService(&pocketbase.PocketBase{App: testApp}, nil, nil)
+	testutil.CreateUser(t, testApp, "alice@example.com", "user")
+	current := createSession(t, testApp, "alice@example.com", time.Hour, false)
+	createSession(t, testApp, "alice@example.com", 2*time.Hour, false)
+
+	alice, err := testApp.FindAuthRecordByEmail("users", "alice@example.com")
+	if err != nil {
+		t.Fatalf("Failed to find user: %v", err)
+	}
+
+	if _, err := service.ChangePassword(context.Background(), alice.Id, "wrong-password", "new-password", current); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Expected ErrInvalidPassword, got %v", err)
+	}
+
+	var validationErr ValidationError
+	if _, err := service.ChangePassword(context.Background(), alice.Id, "supersecret", "short", current); !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+
+	record, err := service.ChangePassword(context.Background(), alice.Id, "supersecret", "new-password", current)
+	if err != nil {
+		t.Fatalf("ChangePassword failed: %v", err)
+	}
+	if !record.ValidatePassword("new-password") {
+		t.Errorf("Expected the new password to be set")
+	}
+	if record.TokenKey() == alice.TokenKey() {
+		t.Errorf("Expected the token key to be refreshed")
+	}
+
+	sessions, err := service.ListSessions(alice.Id, current)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("Expected only the current session to remain, got %+v", sessions)
+	}
+}
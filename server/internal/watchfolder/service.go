@@ -0,0 +1,697 @@
+// Package watchfolder adds torrents from .torrent and .magnet files dropped
+// into watched directories.
+package watchfolder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+	"backend/internal/metainfo"
+	"backend/internal/torrent"
+)
+
+// Subdirectories imported files are moved to.
+const (
+	AddedDir  = "added"
+	FailedDir = "failed"
+)
+
+// Import statuses.
+const (
+	StatusAdded  = "added"
+	StatusFailed = "failed"
+)
+
+const (
+	// settleDelay is how long a file must stay untouched before it is
+	// imported, so half-written files are left alone
+	settleDelay    = 2 * time.Second
+	maxFileSize    = 10 << 20
+	maxErrorLength = 1000
+	// errorSuffix names the sidecar written next to failed files
+	errorSuffix = ".error"
+)
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// FolderResponse represents a watch folder as exposed by the API.
+type FolderResponse struct {
+	ID           string `json:"id"`
+	Path         string `json:"path"`
+	Owner        string `json:"owner"`
+	DownloadDir  string `json:"downloadDir"`
+	AutoStart    bool   `json:"autoStart"`
+	Enabled      bool   `json:"enabled"`
+	LastImportAt string `json:"lastImportAt,omitempty"`
+	LastError    string `json:"lastError,omitempty"`
+	Created      string `json:"created"`
+	Updated      string `json:"updated"`
+}
+
+// FolderParams holds the fields of a watch folder to create or update. Nil
+// fields are left untouched on update.
+type FolderParams struct {
+	Path        *string `json:"path"`
+	Owner       *string `json:"owner"`
+	DownloadDir *string `json:"downloadDir"`
+	AutoStart   *bool   `json:"autoStart"`
+	Enabled     *bool   `json:"enabled"`
+}
+
+// ImportResult describes what became of a dropped file.
+type ImportResult struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+	Name   string `json:"name,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Service manages watch folders and imports the files dropped into them.
+// fsnotify reports new files right away; a periodic scan catches anything it
+// misses, e.g. on network shares.
+type Service struct {
+	app          core.App
+	torrents     *torrent.Service
+	audit        *audit.Service
+	pollInterval time.Duration
+	settleDelay  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// watcher is nil when fsnotify is unavailable
+	watcher *fsnotify.Watcher
+	// folders maps watched paths to watch folder ids
+	folders map[string]string
+	// pending debounces fsnotify events per file
+	pending map[string]*time.Timer
+	running bool
+
+	// importing serializes imports so events and scans never race on a file
+	importing sync.Mutex
+}
+
+// NewService constructs a Service that scans the watch folders every
+// pollInterval in addition to watching them.
+func NewService(app core.App, torrentService *torrent.Service, auditService *audit.Service, pollInterval time.Duration) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Service{
+		app:          app,
+		torrents:     torrentService,
+		audit:        auditService,
+		pollInterval: pollInterval,
+		settleDelay:  settleDelay,
+		ctx:          ctx,
+		cancel:       cancel,
+		folders:      map[string]string{},
+		pending:      map[string]*time.Timer{},
+	}
+}
+
+// Start watches the enabled folders and begins the periodic scan, which
+// also imports files dropped while the server was down.
+func (s *Service) Start() error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("watch folder service is already running")
+	}
+	s.running = true
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("[WatchFolder] fsnotify unavailable, relying on polling: %v", err)
+	} else {
+		s.watcher = watcher
+		s.wg.Add(1)
+		go s.watchLoop(watcher)
+	}
+	s.mu.Unlock()
+
+	s.reload()
+
+	s.wg.Add(1)
+	go s.pollLoop()
+
+	return nil
+}
+
+// Stop ends watching and waits for running imports to finish.
+func (s *Service) Stop() {
+	s.cancel()
+
+	s.mu.Lock()
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
+	for file, timer := range s.pending {
+		timer.Stop()
+		delete(s.pending, file)
+	}
+	s.running = false
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	// Wait for an import started by a debounce timer
+	s.importing.Lock()
+	defer s.importing.Unlock()
+}
+
+func (s *Service) pollLoop() {
+	defer s.wg.Done()
+
+	s.scanAll()
+
+	if s.pollInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.scanAll()
+		}
+	}
+}
+
+func (s *Service) watchLoop(watcher *fsnotify.Watcher) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				s.schedule(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[WatchFolder] fsnotify error: %v", err)
+		}
+	}
+}
+
+// schedule imports a file once it has been left alone for settleDelay;
+// every further write pushes the import back
+func (s *Service) schedule(file string) {
+	if !isImportable(file) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	folderID, ok := s.folders[filepath.Dir(file)]
+	if !ok || s.ctx.Err() != nil {
+		return
+	}
+
+	if timer, ok := s.pending[file]; ok {
+		timer.Reset(s.settleDelay)
+		return
+	}
+
+	s.pending[file] = time.AfterFunc(s.settleDelay, func() {
+		s.mu.Lock()
+		delete(s.pending, file)
+		s.mu.Unlock()
+
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		folder, err := s.app.FindRecordById("watch_folders", folderID)
+		if err != nil || !folder.GetBool("enabled") {
+			return
+		}
+		s.importFile(folder, file)
+	})
+}
+
+// reload points the watcher at the currently enabled folders
+func (s *Service) reload() {
+	records, err := s.app.FindRecordsByFilter("watch_folders", "enabled = true", "", 0, 0)
+	if err != nil {
+		log.Printf("[WatchFolder] Failed to find watch folders: %v", err)
+		return
+	}
+
+	folders := make(map[string]string, len(records))
+	for _, record := range records {
+		folders[record.GetString("path")] = record.Id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+
+	if s.watcher != nil {
+		for path := range s.folders {
+			if _, ok := folders[path]; !ok {
+				s.watcher.Remove(path)
+			}
+		}
+		for path := range folders {
+			if _, ok := s.folders[path]; ok {
+				continue
+			}
+			// The periodic scan still covers folders fsnotify can't watch
+			if err := s.watcher.Add(path); err != nil {
+				log.Printf("[WatchFolder] Failed to watch %s, relying on polling: %v", path, err)
+			}
+		}
+	}
+
+	s.folders = folders
+}
+
+func (s *Service) scanAll() {
+	records, err := s.app.FindRecordsByFilter("watch_folders", "enabled = true", "", 0, 0)
+	if err != nil {
+		log.Printf("[WatchFolder] Failed to find watch folders: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		if s.ctx.Err() != nil {
+			return
+		}
+		if _, err := s.scan(record); err != nil {
+			log.Printf("[WatchFolder] Failed to scan %s: %v", record.GetString("path"), err)
+		}
+	}
+}
+
+// Scan imports the files waiting in a watch folder right away.
+func (s *Service) Scan(id string) ([]ImportResult, error) {
+	record, err := s.findRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.scan(record)
+}
+
+func (s *Service) scan(folder *core.Record) ([]ImportResult, error) {
+	entries, err := os.ReadDir(folder.GetString("path"))
+	if err != nil {
+		return nil, fmt.Errorf("read folder: %w", err)
+	}
+
+	results := []ImportResult{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isImportable(entry.Name()) {
+			continue
+		}
+
+		// Leave files that are still being written to the next scan
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < s.settleDelay {
+			continue
+		}
+
+		if result, ok := s.importFile(folder, filepath.Join(folder.GetString("path"), entry.Name())); ok {
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+func isImportable(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".torrent" || ext == ".magnet"
+}
+
+// readSource turns a dropped file into what AddTorrent accepts
+func readSource(file string) (string, error) {
+	handle, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer handle.Close()
+
+	data, err := io.ReadAll(io.LimitReader(handle, maxFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxFileSize {
+		return "", fmt.Errorf("file exceeds %d bytes", maxFileSize)
+	}
+
+	if strings.EqualFold(filepath.Ext(file), ".magnet") {
+		link := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(link, "magnet:?") || strings.ContainsAny(link, "\r\n") {
+			return "", errors.New("file does not contain a single magnet link")
+		}
+		return link, nil
+	}
+
+	source, err := metainfo.Encode(data)
+	if err != nil {
+		return "", fmt.Errorf("file is not a torrent file: %w", err)
+	}
+	return source, nil
+}
+
+// importFile adds a dropped file and moves it out of the way. ok is false
+// when the file was already gone, e.g. taken by a concurrent import.
+func (s *Service) importFile(folder *core.Record, file string) (ImportResult, bool) {
+	s.importing.Lock()
+	defer s.importing.Unlock()
+
+	if _, err := os.Stat(file); err != nil {
+		return ImportResult{}, false
+	}
+
+	result := ImportResult{File: filepath.Base(file), Status: StatusAdded}
+	owner := folder.GetString("owner")
+	ctx := audit.WithActor(s.ctx, audit.Actor{UserID: owner})
+
+	source, err := readSource(file)
+	if err == nil {
+		autoStart := folder.GetBool("autoStart")
+		req := torrent.AddTorrentRequest{
+			Torrent:   source,
+			AutoStart: &autoStart,
+			UserID:    owner,
+		}
+		if downloadDir := folder.GetString("downloadDir"); downloadDir != "" {
+			req.DownloadDir = &downloadDir
+		}
+
+		added, addErr := s.torrents.AddTorrent(ctx, req)
+		if addErr != nil {
+			err = addErr
+		} else if added != nil {
+			result.Name = added.Name
+			result.Hash = added.HashString
+		}
+	}
+
+	destination := AddedDir
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		destination = FailedDir
+	}
+
+	moved, moveErr := moveFile(file, filepath.Join(filepath.Dir(file), destination))
+	if moveErr == nil && err != nil {
+		sidecar := fmt.Sprintf("%s\n%s\n", time.Now().Format(time.RFC3339), err)
+		moveErr = os.WriteFile(moved+errorSuffix, []byte(sidecar), 0o644)
+	}
+	if moveErr != nil {
+		// Leaving the file behind would retry it on every scan
+		log.Printf("[WatchFolder] Failed to move %s to %s/: %v", file, destination, moveErr)
+		if err == nil {
+			err = moveErr
+		}
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionWatchFolderImport,
+		Targets: []string{folder.Id},
+		Details: map[string]any{
+			"file":        result.File,
+			"folder":      folder.GetString("path"),
+			"destination": destination,
+			"name":        result.Name,
+			"hash":        result.Hash,
+		},
+		Err: err,
+	})
+
+	folder.Set("lastImportAt", time.Now())
+	folder.Set("lastError", "")
+	if err != nil {
+		folder.Set("lastError", truncate(fmt.Sprintf("%s: %v", result.File, err), maxErrorLength))
+	}
+	if saveErr := s.app.Save(folder); saveErr != nil {
+		log.Printf("[WatchFolder] Failed to update watch folder %s: %v", folder.GetString("path"), saveErr)
+	}
+
+	if result.Status == StatusAdded {
+		log.Printf("[WatchFolder] Added %s from %s", result.File, folder.GetString("path"))
+	} else {
+		log.Printf("[WatchFolder] Failed to add %s from %s: %s", result.File, folder.GetString("path"), result.Error)
+	}
+
+	return result, true
+}
+
+// moveFile moves file into dir, adding a timestamp to the name when a file
+// of the same name is already there, and returns the new path
+func moveFile(file, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(file)
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(dir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), time.Now().UnixNano(), ext))
+	}
+
+	if err := os.Rename(file, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func mapRecord(record *core.Record) FolderResponse {
+	return FolderResponse{
+		ID:           record.Id,
+		Path:         record.GetString("path"),
+		Owner:        record.GetString("owner"),
+		DownloadDir:  record.GetString("downloadDir"),
+		AutoStart:    record.GetBool("autoStart"),
+		Enabled:      record.GetBool("enabled"),
+		LastImportAt: formatDate(record, "lastImportAt"),
+		LastError:    record.GetString("lastError"),
+		Created:      formatDate(record, "created"),
+		Updated:      formatDate(record, "updated"),
+	}
+}
+
+func (s *Service) findRecord(id string) (*core.Record, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ValidationError{Message: "watch folder id is required"}
+	}
+
+	record, err := s.app.FindRecordById("watch_folders", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: "watch folder not found"}
+		}
+		return nil, fmt.Errorf("find watch folder: %w", err)
+	}
+	return record, nil
+}
+
+// List returns all watch folders.
+func (s *Service) List() ([]FolderResponse, error) {
+	records, err := s.app.FindRecordsByFilter("watch_folders", "", "path", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find watch folders: %w", err)
+	}
+
+	folders := make([]FolderResponse, 0, len(records))
+	for _, record := range records {
+		folders = append(folders, mapRecord(record))
+	}
+	return folders, nil
+}
+
+// Create adds a watch folder. Folders are enabled unless stated otherwise.
+func (s *Service) Create(ctx context.Context, params FolderParams) (FolderResponse, error) {
+	collection, err := s.app.FindCollectionByNameOrId("watch_folders")
+	if err != nil {
+		return FolderResponse{}, fmt.Errorf("find watch_folders collection: %w", err)
+	}
+
+	if params.Path == nil {
+		return FolderResponse{}, ValidationError{Message: "path is required"}
+	}
+	if params.Enabled == nil {
+		enabled := true
+		params.Enabled = &enabled
+	}
+
+	record := core.NewRecord(collection)
+	if err := s.applyParams(record, params); err != nil {
+		return FolderResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return FolderResponse{}, fmt.Errorf("save watch folder: %w", err)
+	}
+	s.reload()
+
+	response := mapRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionWatchFolderCreate,
+		Targets: []string{record.Id},
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Update changes a watch folder.
+func (s *Service) Update(ctx context.Context, id string, params FolderParams) (FolderResponse, error) {
+	record, err := s.findRecord(id)
+	if err != nil {
+		return FolderResponse{}, err
+	}
+
+	before := mapRecord(record)
+	if err := s.applyParams(record, params); err != nil {
+		return FolderResponse{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return FolderResponse{}, fmt.Errorf("save watch folder: %w", err)
+	}
+	s.reload()
+
+	response := mapRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionWatchFolderUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Delete stops watching a folder. Files in it are left alone.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	record, err := s.findRecord(id)
+	if err != nil {
+		return err
+	}
+
+	before := mapRecord(record)
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete watch folder: %w", err)
+	}
+	s.reload()
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionWatchFolderDelete,
+		Targets: []string{id},
+		Before:  before,
+	})
+
+	return nil
+}
+
+// applyParams validates params and sets them on record
+func (s *Service) applyParams(record *core.Record, params FolderParams) error {
+	if params.Path != nil {
+		path := strings.TrimSpace(*params.Path)
+		if !filepath.IsAbs(path) {
+			return ValidationError{Message: "path must be absolute"}
+		}
+		path = filepath.Clean(path)
+
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			return ValidationError{Message: "path must be an existing directory"}
+		}
+
+		existing, err := s.app.FindFirstRecordByData("watch_folders", "path", path)
+		if err == nil && existing.Id != record.Id {
+			return ValidationError{Message: "path is already watched"}
+		}
+		record.Set("path", path)
+	}
+
+	if params.Owner != nil {
+		owner := strings.TrimSpace(*params.Owner)
+		if owner != "" {
+			if _, err := s.app.FindRecordById("users", owner); err != nil {
+				return ValidationError{Message: "owner not found"}
+			}
+		}
+		record.Set("owner", owner)
+	}
+
+	if params.DownloadDir != nil {
+		record.Set("downloadDir", strings.TrimSpace(*params.DownloadDir))
+	}
+
+	if params.AutoStart != nil {
+		record.Set("autoStart", *params.AutoStart)
+	}
+
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	return nil
+}
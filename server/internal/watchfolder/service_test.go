@@ -0,0 +1,211 @@
+package watchfolder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+const testMagnet = "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=debian"
+
+func newTestService(t *testing.T) (*tests.TestApp, *Service) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	client := transmission.NewMockClient(testApp)
+	syncService := transmission.NewSyncService(testApp, client, 0)
+	auditService := audit.NewService(testApp)
+	torrents := torrent.NewService(&pocketbase.PocketBase{App: testApp}, client, syncService, auditService)
+	if err := torrents.ForceSync(); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	service := NewService(testApp, torrents, auditService, 0)
+	service.settleDelay = 0
+	t.Cleanup(service.Stop)
+
+	return testApp, service
+}
+
+func createFolder(t *testing.T, app core.App, service *Service) (FolderResponse, *core.Record) {
+	t.Helper()
+
+	owner := testutil.CreateUser(t, app, "browser@example.com", "user")
+
+	path := t.TempDir()
+	downloadDir := "/downloads/dropped"
+	autoStart := true
+	folder, err := service.Create(context.Background(), FolderParams{Path: &path, Owner: &owner.Id, DownloadDir: &downloadDir, AutoStart: &autoStart})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	return folder, owner
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+func ownedTorrents(t *testing.T, app core.App, ownerID string) []*core.Record {
+	t.Helper()
+
+	records, err := app.FindRecordsByFilter("torrents", "user = {:user}", "", 0, 0, dbx.Params{"user": ownerID})
+	if err != nil {
+		t.Fatalf("Failed to find torrents: %v", err)
+	}
+	return records
+}
+
+func TestScanImportsDroppedFiles(t *testing.T) {
+	testApp, service := newTestService(t)
+	folder, owner := createFolder(t, testApp, service)
+
+	writeFile(t, folder.Path, "debian.magnet", testMagnet+"\n")
+	writeFile(t, folder.Path, "ubuntu.torrent", "d8:announce31:http://tracker.example/announce4:infod6:lengthi1e4:name6:ubuntu12:piece lengthi16384e6:pieces20:"+strings.Repeat("x", 20)+"ee")
+	writeFile(t, folder.Path, "broken.torrent", "<html>Not found</html>")
+	writeFile(t, folder.Path, "notes.txt", "not a torrent")
+
+	results, err := service.Scan(folder.ID)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	statuses := map[string]string{}
+	for _, result := range results {
+		statuses[result.File] = result.Status
+	}
+	if len(results) != 3 || statuses["debian.magnet"] != StatusAdded || statuses["ubuntu.torrent"] != StatusAdded || statuses["broken.torrent"] != StatusFailed {
+		t.Fatalf("Unexpected scan results: %+v", results)
+	}
+
+	for _, file := range []string{"added/debian.magnet", "added/ubuntu.torrent", "failed/broken.torrent", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(folder.Path, file)); err != nil {
+			t.Errorf("Expected %s to exist: %v", file, err)
+		}
+	}
+	sidecar, err := os.ReadFile(filepath.Join(folder.Path, "failed", "broken.torrent"+errorSuffix))
+	if err != nil || !strings.Contains(string(sidecar), "not a torrent file") {
+		t.Errorf("Expected an error sidecar next to the failed file, got %q (%v)", sidecar, err)
+	}
+
+	if torrents := ownedTorrents(t, testApp, owner.Id); len(torrents) != 2 {
+		t.Errorf("Expected 2 torrents owned by the folder owner, got %d", len(torrents))
+	}
+
+	entries, err := testApp.FindRecordsByFilter("audit_log", "action = {:action}", "", 0, 0, dbx.Params{"action": audit.ActionWatchFolderImport})
+	if err != nil {
+		t.Fatalf("Failed to find audit entries: %v", err)
+	}
+	failures := 0
+	for _, entry := range entries {
+		if entry.GetString("actor") != owner.Id {
+			t.Errorf("Expected imports to be attributed to the owner, got %q", entry.GetString("actor"))
+		}
+		if entry.GetString("result") == audit.ResultFailure {
+			failures++
+		}
+	}
+	if len(entries) != 3 || failures != 1 {
+		t.Errorf("Expected 3 import audit entries with 1 failure, got %d with %d", len(entries), failures)
+	}
+
+	folders, err := service.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if folders[0].LastImportAt == "" {
+		t.Errorf("Expected the import time to be recorded, got %+v", folders[0])
+	}
+
+	// Moved files are not imported again, and a name clash keeps both files
+	writeFile(t, folder.Path, "debian.magnet", testMagnet)
+	if results, err := service.Scan(folder.ID); err != nil || len(results) != 1 {
+		t.Fatalf("Expected one more import, got %+v (%v)", results, err)
+	}
+	added, err := os.ReadDir(filepath.Join(folder.Path, AddedDir))
+	if err != nil || len(added) != 3 {
+		t.Errorf("Expected 3 files in added/, got %d (%v)", len(added), err)
+	}
+}
+
+func TestWatcherImportsNewFiles(t *testing.T) {
+	testApp, service := newTestService(t)
+	service.settleDelay = 50 * time.Millisecond
+	folder, owner := createFolder(t, testApp, service)
+
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if service.watcher == nil {
+		t.Skip("fsnotify is unavailable")
+	}
+
+	writeFile(t, folder.Path, "debian.magnet", testMagnet)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(folder.Path, AddedDir, "debian.magnet")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the dropped file to be imported")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if torrents := ownedTorrents(t, testApp, owner.Id); len(torrents) != 1 {
+		t.Errorf("Expected 1 torrent owned by the folder owner, got %d", len(torrents))
+	}
+
+	// Disabled folders are no longer watched
+	enabled := false
+	if _, err := service.Update(context.Background(), folder.ID, FolderParams{Enabled: &enabled}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	writeFile(t, folder.Path, "later.magnet", testMagnet)
+	time.Sleep(200 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(folder.Path, "later.magnet")); err != nil {
+		t.Errorf("Expected files in disabled folders to be left alone: %v", err)
+	}
+}
+
+func TestFolderValidation(t *testing.T) {
+	testApp, service := newTestService(t)
+	folder, _ := createFolder(t, testApp, service)
+
+	missing := filepath.Join(folder.Path, "missing")
+	cases := map[string]FolderParams{
+		"relative path":     {Path: ptr("downloads/watch")},
+		"missing directory": {Path: &missing},
+		"watched path":      {Path: ptr(folder.Path + "/")},
+		"unknown owner":     {Path: ptr(t.TempDir()), Owner: ptr("missing")},
+	}
+
+	for name, params := range cases {
+		if _, err := service.Create(context.Background(), params); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
+
+func ptr(value string) *string {
+	return &value
+}
@@ -0,0 +1,613 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"backend/internal/audit"
+	"backend/internal/transmission"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Retorrent-Event"
+	HeaderDelivery  = "X-Retorrent-Delivery"
+	HeaderSignature = "X-Retorrent-Signature"
+)
+
+// Delivery states stored in the webhook_deliveries collection.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBaseDelay   = 2 * time.Second
+	requestTimeout     = 10 * time.Second
+	maxErrorLength     = 1000
+	defaultLogLimit    = 50
+	maxLogLimit        = 500
+)
+
+// ValidationError indicates that the provided data is invalid for the requested action.
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// NotFoundError indicates that a resource was not found.
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// Service manages webhooks and delivers torrent lifecycle events to them.
+type Service struct {
+	app    core.App
+	audit  *audit.Service
+	client *http.Client
+
+	// maxAttempts and baseDelay control the retries; the delay doubles
+	// after every failed attempt
+	maxAttempts int
+	baseDelay   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewService constructs a Service instance.
+func NewService(app core.App, auditService *audit.Service) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Service{
+		app:         app,
+		audit:       auditService,
+		client:      &http.Client{Timeout: requestTimeout},
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Stop cancels pending retries and waits for running deliveries to finish.
+func (s *Service) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Response represents a webhook as exposed by the API. The secret is never
+// returned.
+type Response struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Enabled   bool     `json:"enabled"`
+	HasSecret bool     `json:"hasSecret"`
+	Created   string   `json:"created"`
+	Updated   string   `json:"updated"`
+}
+
+// DeliveryResponse represents an entry of the delivery log.
+type DeliveryResponse struct {
+	ID             string `json:"id"`
+	Webhook        string `json:"webhook"`
+	Event          string `json:"event"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	ResponseStatus int    `json:"responseStatus,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Payload        any    `json:"payload"`
+	DeliveredAt    string `json:"deliveredAt,omitempty"`
+	Created        string `json:"created"`
+	Updated        string `json:"updated"`
+}
+
+// Params holds the fields of a webhook to create or update. Nil fields are
+// left untouched on update.
+type Params struct {
+	Name    *string   `json:"name"`
+	URL     *string   `json:"url"`
+	Events  *[]string `json:"events"`
+	Secret  *string   `json:"secret"`
+	Enabled *bool     `json:"enabled"`
+}
+
+// Payload is the JSON body posted to webhooks.
+type Payload struct {
+	Event     string         `json:"event"`
+	Timestamp string         `json:"timestamp"`
+	UserID    string         `json:"userId,omitempty"`
+	Torrent   PayloadTorrent `json:"torrent"`
+}
+
+// PayloadTorrent describes the torrent of an event.
+type PayloadTorrent struct {
+	RecordID     string   `json:"recordId"`
+	ID           int64    `json:"id"`
+	Name         string   `json:"name"`
+	Hash         string   `json:"hash"`
+	Status       string   `json:"status"`
+	PercentDone  float64  `json:"percentDone"`
+	SizeWhenDone int64    `json:"sizeWhenDone"`
+	DownloadDir  string   `json:"downloadDir,omitempty"`
+	Labels       []string `json:"labels,omitempty"`
+	ErrorString  string   `json:"errorString,omitempty"`
+	DoneDate     string   `json:"doneDate,omitempty"`
+}
+
+func formatDate(record *core.Record, field string) string {
+	value := record.GetDateTime(field)
+	if value.IsZero() {
+		return ""
+	}
+	return value.Time().Format(time.RFC3339)
+}
+
+func mapWebhookRecord(record *core.Record) Response {
+	return Response{
+		ID:        record.Id,
+		Name:      record.GetString("name"),
+		URL:       record.GetString("url"),
+		Events:    record.GetStringSlice("events"),
+		Enabled:   record.GetBool("enabled"),
+		HasSecret: record.GetString("secret") != "",
+		Created:   formatDate(record, "created"),
+		Updated:   formatDate(record, "updated"),
+	}
+}
+
+func mapDeliveryRecord(record *core.Record) DeliveryResponse {
+	return DeliveryResponse{
+		ID:             record.Id,
+		Webhook:        record.GetString("webhook"),
+		Event:          record.GetString("event"),
+		Status:         record.GetString("status"),
+		Attempts:       record.GetInt("attempts"),
+		ResponseStatus: record.GetInt("responseStatus"),
+		Error:          record.GetString("error"),
+		Payload:        record.Get("payload"),
+		DeliveredAt:    formatDate(record, "deliveredAt"),
+		Created:        formatDate(record, "created"),
+		Updated:        formatDate(record, "updated"),
+	}
+}
+
+// List returns all webhooks.
+func (s *Service) List() ([]Response, error) {
+	records, err := s.app.FindRecordsByFilter("webhooks", "", "name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find webhooks: %w", err)
+	}
+
+	webhooks := make([]Response, 0, len(records))
+	for _, record := range records {
+		webhooks = append(webhooks, mapWebhookRecord(record))
+	}
+	return webhooks, nil
+}
+
+// Create adds a webhook. Webhooks are enabled unless stated otherwise.
+func (s *Service) Create(ctx context.Context, params Params) (Response, error) {
+	collection, err := s.app.FindCollectionByNameOrId("webhooks")
+	if err != nil {
+		return Response{}, fmt.Errorf("find webhooks collection: %w", err)
+	}
+
+	if params.Name == nil || params.URL == nil || params.Events == nil {
+		return Response{}, ValidationError{Message: "name, url and events are required"}
+	}
+	if params.Enabled == nil {
+		enabled := true
+		params.Enabled = &enabled
+	}
+
+	record := core.NewRecord(collection)
+	if err := applyParams(record, params); err != nil {
+		return Response{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return Response{}, fmt.Errorf("save webhook: %w", err)
+	}
+
+	response := mapWebhookRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionWebhookCreate,
+		Targets: []string{record.Id},
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Update changes a webhook.
+func (s *Service) Update(ctx context.Context, id string, params Params) (Response, error) {
+	record, err := s.findWebhook(id)
+	if err != nil {
+		return Response{}, err
+	}
+
+	before := mapWebhookRecord(record)
+	if err := applyParams(record, params); err != nil {
+		return Response{}, err
+	}
+
+	if err := s.app.Save(record); err != nil {
+		return Response{}, fmt.Errorf("save webhook: %w", err)
+	}
+
+	response := mapWebhookRecord(record)
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionWebhookUpdate,
+		Targets: []string{record.Id},
+		Before:  before,
+		After:   response,
+	})
+
+	return response, nil
+}
+
+// Delete removes a webhook together with its delivery log.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	record, err := s.findWebhook(id)
+	if err != nil {
+		return err
+	}
+
+	before := mapWebhookRecord(record)
+	if err := s.app.Delete(record); err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Entry{
+		Action:  audit.ActionWebhookDelete,
+		Targets: []string{id},
+		Before:  before,
+	})
+
+	return nil
+}
+
+// Deliveries returns the most recent log entries of a webhook.
+func (s *Service) Deliveries(id string, limit int) ([]DeliveryResponse, error) {
+	if _, err := s.findWebhook(id); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	records, err := s.app.FindRecordsByFilter("webhook_deliveries", "webhook = {:webhook}", "-created", limit, 0, dbx.Params{"webhook": id})
+	if err != nil {
+		return nil, fmt.Errorf("find webhook deliveries: %w", err)
+	}
+
+	deliveries := make([]DeliveryResponse, 0, len(records))
+	for _, record := range records {
+		deliveries = append(deliveries, mapDeliveryRecord(record))
+	}
+	return deliveries, nil
+}
+
+// PruneDeliveries deletes delivery log entries older than retention.
+func (s *Service) PruneDeliveries(retention time.Duration) (int64, error) {
+	cutoff, err := types.ParseDateTime(time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("parse cutoff date: %w", err)
+	}
+
+	result, err := s.app.NonconcurrentDB().Delete("webhook_deliveries", dbx.NewExp("created < {:cutoff}", dbx.Params{"cutoff": cutoff.String()})).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("delete old webhook deliveries: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *Service) findWebhook(id string) (*core.Record, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ValidationError{Message: "webhook id is required"}
+	}
+
+	record, err := s.app.FindRecordById("webhooks", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, NotFoundError{Message: "webhook not found"}
+		}
+		return nil, fmt.Errorf("find webhook: %w", err)
+	}
+	return record, nil
+}
+
+// applyParams validates params and sets them on record
+func applyParams(record *core.Record, params Params) error {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" {
+			return ValidationError{Message: "name cannot be empty"}
+		}
+		record.Set("name", name)
+	}
+
+	if params.URL != nil {
+		parsed, err := url.Parse(strings.TrimSpace(*params.URL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return ValidationError{Message: "url must be an http or https URL"}
+		}
+		record.Set("url", parsed.String())
+	}
+
+	if params.Events != nil {
+		events, err := normalizeEvents(*params.Events)
+		if err != nil {
+			return err
+		}
+		record.Set("events", events)
+	}
+
+	if params.Secret != nil {
+		record.Set("secret", strings.TrimSpace(*params.Secret))
+	}
+
+	if params.Enabled != nil {
+		record.Set("enabled", *params.Enabled)
+	}
+
+	return nil
+}
+
+func normalizeEvents(values []string) ([]string, error) {
+	allowed := make(map[string]struct{}, len(transmission.EventTypes))
+	for _, eventType := range transmission.EventTypes {
+		allowed[string(eventType)] = struct{}{}
+	}
+
+	events := make([]string, 0, len(values))
+	seen := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		cleaned := strings.ToLower(strings.TrimSpace(value))
+		if _, ok := allowed[cleaned]; !ok {
+			return nil, ValidationError{Message: fmt.Sprintf("invalid event: %s", value)}
+		}
+		if _, dup := seen[cleaned]; dup {
+			continue
+		}
+		seen[cleaned] = struct{}{}
+		events = append(events, cleaned)
+	}
+
+	if len(events) == 0 {
+		return nil, ValidationError{Message: "at least one event is required"}
+	}
+	return events, nil
+}
+
+// HandleEvent queues deliveries of a lifecycle event to every enabled
+// webhook subscribed to it. It is meant to be registered with
+// transmission.SyncService.OnEvent.
+func (s *Service) HandleEvent(event transmission.Event) {
+	records, err := s.app.FindRecordsByFilter("webhooks", "enabled = true", "", 0, 0)
+	if err != nil {
+		log.Printf("[Webhook] Failed to find webhooks: %v", err)
+		return
+	}
+
+	var (
+		body    []byte
+		payload map[string]any
+	)
+	for _, record := range records {
+		if !subscribed(record, event.Type) {
+			continue
+		}
+
+		if body == nil {
+			body, err = json.Marshal(newPayload(event))
+			if err != nil {
+				log.Printf("[Webhook] Failed to encode %s event: %v", event.Type, err)
+				return
+			}
+			if err := json.Unmarshal(body, &payload); err != nil {
+				log.Printf("[Webhook] Failed to decode %s event: %v", event.Type, err)
+				return
+			}
+		}
+
+		delivery, err := s.createDelivery(record, string(event.Type), payload)
+		if err != nil {
+			log.Printf("[Webhook] Failed to log delivery to %s: %v", record.GetString("name"), err)
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(hook *core.Record) {
+			defer s.wg.Done()
+			s.deliver(hook, delivery, body)
+		}(record)
+	}
+}
+
+func subscribed(record *core.Record, eventType transmission.EventType) bool {
+	for _, value := range record.GetStringSlice("events") {
+		if value == string(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+func newPayload(event transmission.Event) Payload {
+	torrent := event.Torrent
+
+	var doneDate string
+	if torrent.DoneDate != nil {
+		doneDate = torrent.DoneDate.UTC().Format(time.RFC3339)
+	}
+
+	return Payload{
+		Event:     string(event.Type),
+		Timestamp: event.Time.UTC().Format(time.RFC3339),
+		UserID:    event.UserID,
+		Torrent: PayloadTorrent{
+			RecordID:     event.RecordID,
+			ID:           torrent.ID,
+			Name:         torrent.Name,
+			Hash:         torrent.HashString,
+			Status:       string(torrent.Status),
+			PercentDone:  torrent.PercentDone,
+			SizeWhenDone: torrent.SizeWhenDone,
+			DownloadDir:  torrent.DownloadDir,
+			Labels:       torrent.Labels,
+			ErrorString:  torrent.ErrorString,
+			DoneDate:     doneDate,
+		},
+	}
+}
+
+func (s *Service) createDelivery(hook *core.Record, event string, payload map[string]any) (*core.Record, error) {
+	collection, err := s.app.FindCollectionByNameOrId("webhook_deliveries")
+	if err != nil {
+		return nil, fmt.Errorf("find webhook_deliveries collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("webhook", hook.Id)
+	record.Set("event", event)
+	record.Set("status", StatusPending)
+	record.Set("attempts", 0)
+	record.Set("payload", payload)
+
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Sign returns the signature header value of body for secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver posts body to the webhook, retrying with exponential backoff, and
+// logs every attempt on the delivery record
+func (s *Service) deliver(hook, delivery *core.Record, body []byte) {
+	delay := s.baseDelay
+
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		status, err := s.send(hook, delivery, body)
+
+		delivery.Set("attempts", attempt)
+		delivery.Set("responseStatus", status)
+		if err == nil {
+			delivery.Set("status", StatusDelivered)
+			delivery.Set("error", "")
+			delivery.Set("deliveredAt", time.Now())
+			s.saveDelivery(delivery)
+			return
+		}
+
+		delivery.Set("error", truncate(err.Error(), maxErrorLength))
+
+		// Client errors won't go away by retrying
+		retry := status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+		if !retry || attempt == s.maxAttempts {
+			break
+		}
+		s.saveDelivery(delivery)
+
+		select {
+		case <-s.ctx.Done():
+			delivery.Set("error", truncate("delivery cancelled on shutdown: "+err.Error(), maxErrorLength))
+			delivery.Set("status", StatusFailed)
+			s.saveDelivery(delivery)
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	log.Printf("[Webhook] Delivery of %s event to %s failed: %s", delivery.GetString("event"), hook.GetString("name"), delivery.GetString("error"))
+	delivery.Set("status", StatusFailed)
+	s.saveDelivery(delivery)
+}
+
+// send makes a single delivery attempt and returns the response status
+func (s *Service) send(hook, delivery *core.Record, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.GetString("url"), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Retorrent-Webhook")
+	req.Header.Set(HeaderEvent, delivery.GetString("event"))
+	req.Header.Set(HeaderDelivery, delivery.Id)
+	if secret := hook.GetString("secret"); secret != "" {
+		req.Header.Set(HeaderSignature, Sign(secret, body))
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+func (s *Service) saveDelivery(delivery *core.Record) {
+	if err := s.app.Save(delivery); err != nil {
+		log.Printf("[Webhook] Failed to update delivery %s: %v", delivery.Id, err)
+	}
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
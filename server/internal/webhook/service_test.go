@@ -0,0 +1,192 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/transmission"
+)
+
+// receiver is an httptest webhook endpoint that fails the first failures
+// requests with a 500.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	if len(r.requests) <= r.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newTestService(t *testing.T) (*tests.TestApp, *Service) {
+	t.Helper()
+
+	testApp := testutil.NewTestApp(t)
+
+	service := NewService(testApp, audit.NewService(testApp))
+	service.baseDelay = 10 * time.Millisecond
+	t.Cleanup(service.Stop)
+
+	return testApp, service
+}
+
+func completedEvent() transmission.Event {
+	now := time.Now()
+	return transmission.Event{
+		Type: transmission.EventDownloadCompleted,
+		Torrent: transmission.TorrentData{
+			ID:          7,
+			Name:        "Ubuntu 24.04",
+			HashString:  "abcdef",
+			Status:      transmission.StatusSeed,
+			PercentDone: 1,
+			DoneDate:    &now,
+		},
+		RecordID: "record123",
+		Time:     now,
+	}
+}
+
+func createWebhook(t *testing.T, service *Service, url string, events []string, secret string) Response {
+	t.Helper()
+
+	name := "Home Assistant"
+	hook, err := service.Create(context.Background(), Params{Name: &name, URL: &url, Events: &events, Secret: &secret})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	return hook
+}
+
+func TestDeliverySignedAndRetried(t *testing.T) {
+	_, service := newTestService(t)
+
+	recv := &receiver{failures: 2}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	hook := createWebhook(t, service, server.URL, []string{"completed", "error"}, "s3cret")
+
+	service.HandleEvent(completedEvent())
+	service.wg.Wait()
+
+	if recv.count() != 3 {
+		t.Fatalf("Expected 2 failed attempts and 1 success, got %d requests", recv.count())
+	}
+
+	req, body := recv.requests[2], recv.bodies[2]
+	if req.Header.Get(HeaderEvent) != "completed" {
+		t.Errorf("Expected the completed event header, got %q", req.Header.Get(HeaderEvent))
+	}
+	if req.Header.Get(HeaderSignature) != Sign("s3cret", body) {
+		t.Errorf("Expected a valid signature, got %q", req.Header.Get(HeaderSignature))
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if payload.Event != "completed" || payload.Torrent.Hash != "abcdef" || payload.Torrent.RecordID != "record123" {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+
+	deliveries, err := service.Deliveries(hook.ID, 0)
+	if err != nil {
+		t.Fatalf("Deliveries failed: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 logged delivery, got %d", len(deliveries))
+	}
+	delivery := deliveries[0]
+	if delivery.Status != StatusDelivered || delivery.Attempts != 3 || delivery.ResponseStatus != http.StatusNoContent {
+		t.Errorf("Unexpected delivery log entry: %+v", delivery)
+	}
+	if req.Header.Get(HeaderDelivery) != delivery.ID {
+		t.Errorf("Expected the delivery id header to match the log entry")
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	_, service := newTestService(t)
+	service.maxAttempts = 3
+
+	recv := &receiver{failures: 10}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	hook := createWebhook(t, service, server.URL, []string{"completed"}, "")
+
+	service.HandleEvent(completedEvent())
+	service.wg.Wait()
+
+	if recv.count() != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", recv.count())
+	}
+	if recv.requests[0].Header.Get(HeaderSignature) != "" {
+		t.Errorf("Expected no signature without a secret")
+	}
+
+	deliveries, err := service.Deliveries(hook.ID, 0)
+	if err != nil {
+		t.Fatalf("Deliveries failed: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != StatusFailed || deliveries[0].Error == "" {
+		t.Errorf("Expected a failed delivery with an error, got %+v", deliveries)
+	}
+}
+
+func TestEventFiltering(t *testing.T) {
+	_, service := newTestService(t)
+
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	createWebhook(t, service, server.URL, []string{"added", "removed"}, "")
+	disabled := createWebhook(t, service, server.URL, []string{"completed"}, "")
+	enabled := false
+	if _, err := service.Update(context.Background(), disabled.ID, Params{Enabled: &enabled}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	service.HandleEvent(completedEvent())
+	service.wg.Wait()
+
+	if recv.count() != 0 {
+		t.Errorf("Expected no deliveries for unsubscribed or disabled webhooks, got %d", recv.count())
+	}
+
+	events := []string{"finished"}
+	if _, err := service.Update(context.Background(), disabled.ID, Params{Events: &events}); err == nil {
+		t.Errorf("Expected unknown event types to be rejected")
+	}
+}
@@ -0,0 +1,295 @@
+// Package webpush sends encrypted Web Push messages (RFC 8030, RFC 8291)
+// authenticated with VAPID (RFC 8292), using only the standard library.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// recordSize is the aes128gcm record size advertised in the header. A
+	// push message always fits into a single record.
+	recordSize = 4096
+	// MaxPayloadSize is the largest plaintext that keeps the encrypted message,
+	// header included, within the 4096 bytes push services must accept.
+	MaxPayloadSize = recordSize - 16 - 1 - 86
+	// jwtLifetime is how long a VAPID token stays valid; RFC 8292 caps it at 24h
+	jwtLifetime = 12 * time.Hour
+)
+
+// ErrSubscriptionGone is returned when the push service reports that a
+// subscription no longer exists (404 or 410), so it should be removed.
+var ErrSubscriptionGone = errors.New("push subscription has expired or was unsubscribed")
+
+// Subscription is a browser PushSubscription in its JSON form.
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     Keys   `json:"keys"`
+}
+
+// Keys are the subscriber's public key and authentication secret, both
+// base64url encoded.
+type Keys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// VAPIDKeys is an application server key pair, base64url encoded. The public
+// key is the uncompressed P-256 point, the private key the raw scalar.
+type VAPIDKeys struct {
+	PublicKey  string `json:"publicKey"`
+	PrivateKey string `json:"privateKey"`
+}
+
+// GenerateVAPIDKeys creates a new application server key pair.
+func GenerateVAPIDKeys() (VAPIDKeys, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return VAPIDKeys{}, fmt.Errorf("generate vapid key: %w", err)
+	}
+
+	privateKey, err := key.Bytes()
+	if err != nil {
+		return VAPIDKeys{}, fmt.Errorf("encode vapid private key: %w", err)
+	}
+	publicKey, err := key.PublicKey.Bytes()
+	if err != nil {
+		return VAPIDKeys{}, fmt.Errorf("encode vapid public key: %w", err)
+	}
+
+	return VAPIDKeys{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(publicKey),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(privateKey),
+	}, nil
+}
+
+// DecodeKey decodes a base64url value, tolerating padding and the standard
+// alphabet some browsers and libraries emit.
+func DecodeKey(value string) ([]byte, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "=")
+	value = strings.NewReplacer("+", "-", "/", "_").Replace(value)
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+// Options control how the push service handles a message.
+type Options struct {
+	// TTL is how long the push service keeps an undelivered message
+	TTL time.Duration
+	// Urgency is one of very-low, low, normal or high
+	Urgency string
+	// Topic replaces a pending message with the same topic
+	Topic string
+}
+
+// Sender delivers push messages signed with a VAPID key pair.
+type Sender struct {
+	keys       VAPIDKeys
+	signingKey *ecdsa.PrivateKey
+	// subject is the contact URI for the push service, mailto: or https:
+	subject string
+	client  *http.Client
+}
+
+// NewSender constructs a Sender instance.
+func NewSender(keys VAPIDKeys, subject string, client *http.Client) (*Sender, error) {
+	raw, err := DecodeKey(keys.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode vapid private key: %w", err)
+	}
+	signingKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse vapid private key: %w", err)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+
+	return &Sender{keys: keys, signingKey: signingKey, subject: subject, client: client}, nil
+}
+
+// Send encrypts payload for the subscription and posts it to its push
+// service. It returns ErrSubscriptionGone when the subscription has expired.
+func (s *Sender) Send(ctx context.Context, sub Subscription, payload []byte, opts Options) error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		return fmt.Errorf("invalid push endpoint %q", sub.Endpoint)
+	}
+
+	body, err := Encrypt(sub.Keys, payload)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.token(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build push request: %w", err)
+	}
+
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.keys.PublicKey)
+	if opts.Urgency != "" {
+		req.Header.Set("Urgency", opts.Urgency)
+	}
+	if opts.Topic != "" {
+		req.Header.Set("Topic", opts.Topic)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send push message: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("push service responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	return nil
+}
+
+// token builds the VAPID JWT for a push service origin.
+func (s *Sender) token(audience string) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": audience,
+		"exp": time.Now().Add(jwtLifetime).Unix(),
+		"sub": s.subject,
+	})
+	if err != nil {
+		return "", fmt.Errorf("encode vapid claims: %w", err)
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	r, sig, err := ecdsa.Sign(rand.Reader, s.signingKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign vapid token: %w", err)
+	}
+
+	// JWS wants the fixed-size r || s encoding rather than ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Encrypt encrypts payload for a subscriber with the aes128gcm content
+// coding of RFC 8188, keyed as described in RFC 8291.
+func Encrypt(keys Keys, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("push payload of %d bytes exceeds %d bytes", len(payload), MaxPayloadSize)
+	}
+
+	rawPublicKey, err := DecodeKey(keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("decode subscription p256dh key: %w", err)
+	}
+	subscriberKey, err := ecdh.P256().NewPublicKey(rawPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse subscription p256dh key: %w", err)
+	}
+	authSecret, err := DecodeKey(keys.Auth)
+	if err != nil || len(authSecret) == 0 {
+		return nil, errors.New("invalid subscription auth secret")
+	}
+
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate ephemeral key: %w", err)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+
+	sharedSecret, err := serverKey.ECDH(subscriberKey)
+	if err != nil {
+		return nil, fmt.Errorf("derive shared secret: %w", err)
+	}
+
+	cek, nonce, err := deriveKeys(sharedSecret, authSecret, salt, subscriberKey.Bytes(), serverKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single, final record: the payload followed by the 0x02 delimiter
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	serverPublicKey := serverKey.PublicKey().Bytes()
+	header := make([]byte, 0, 16+4+1+len(serverPublicKey))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(serverPublicKey)))
+	header = append(header, serverPublicKey...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// deriveKeys derives the content encryption key and nonce from the ECDH
+// shared secret and the subscriber's authentication secret. uaPublic and
+// asPublic are the uncompressed subscriber and sender public keys.
+func deriveKeys(sharedSecret, authSecret, salt, uaPublic, asPublic []byte) (cek, nonce []byte, err error) {
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, nil, fmt.Errorf("derive input keying material: %w", err)
+	}
+
+	cek, err = hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("derive content encryption key: %w", err)
+	}
+	nonce, err = hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, nil, fmt.Errorf("derive nonce: %w", err)
+	}
+
+	return cek, nonce, nil
+}
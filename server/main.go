@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,9 +15,24 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
 
+	"backend/internal/apikey"
+	"backend/internal/audit"
+	"backend/internal/compat"
+	"backend/internal/hook"
+	"backend/internal/mediaserver"
+	"backend/internal/notification"
+	"backend/internal/plugin"
+	"backend/internal/plugin/trackers"
+	"backend/internal/ratelimit"
+	"backend/internal/rss"
+	"backend/internal/search"
+	"backend/internal/settings"
 	"backend/internal/torrent"
 	"backend/internal/transmission"
+	"backend/internal/twofactor"
 	"backend/internal/user"
+	"backend/internal/watchfolder"
+	"backend/internal/webhook"
 	_ "backend/migrations"
 	"backend/routes"
 )
@@ -36,9 +52,21 @@ func main() {
 
 	app := pocketbase.New()
 
+	// Block PocketBase logins for disabled users
+	user.BindAuthHooks(app)
+
 	// Global variables for transmission client and sync service
 	var transmissionClient transmission.TransmissionClient
 	var syncService *transmission.SyncService
+	var webhookService *webhook.Service
+	var emailService *notification.EmailService
+	var pushService *notification.PushService
+	var channelService *notification.ChannelService
+	var rssService *rss.Service
+	var watchFolderService *watchfolder.Service
+	var hookService *hook.Service
+	var mediaServerService *mediaserver.Service
+	var pluginRegistry *plugin.Registry
 
 	// Initialize Transmission client and sync service after server starts
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
@@ -85,36 +113,236 @@ func main() {
 		syncInterval := 5 * time.Second // Sync every 5 seconds for real-time feel
 		syncService = transmission.NewSyncService(app, transmissionClient, syncInterval)
 
-		// Start sync service
-		if err := syncService.Start(); err != nil {
-			log.Printf("Failed to start sync service: %v", err)
-		} else {
-			log.Println("Transmission sync service started")
+		// Initialize audit log and schedule the daily retention cleanup
+		auditService := audit.NewService(app)
+		auditRetentionDays := 90
+		if value := os.Getenv("AUDIT_RETENTION_DAYS"); value != "" {
+			if days, err := strconv.Atoi(value); err == nil {
+				auditRetentionDays = days
+			} else {
+				log.Printf("Warning: Invalid AUDIT_RETENTION_DAYS %q, using %d", value, auditRetentionDays)
+			}
+		}
+		if auditRetentionDays > 0 {
+			retention := time.Duration(auditRetentionDays) * 24 * time.Hour
+			app.Cron().MustAdd("auditRetention", "0 3 * * *", func() {
+				removed, err := auditService.Prune(retention)
+				if err != nil {
+					log.Printf("Failed to prune audit log: %v", err)
+					return
+				}
+				log.Printf("Pruned %d audit log entries older than %d days", removed, auditRetentionDays)
+			})
+		}
+
+		// Limit auth and mutating requests and lock accounts after failed logins
+		rateLimitConfig, err := ratelimit.ConfigFromEnv()
+		if err != nil {
+			return err
 		}
+		ratelimit.Bind(se, rateLimitConfig, auditService)
+
+		// Initialize and register audit routes
+		auditRoutes := routes.NewAuditRoutes(auditService)
+		auditRoutes.RegisterRoutes(se)
 
 		// Initialize torrent service with transmission client and sync service
-		torrentService := torrent.NewService(app, transmissionClient, syncService)
+		torrentService := torrent.NewService(app, transmissionClient, syncService, auditService)
+
+		// Initialize API key service used by automation clients
+		apiKeyService := apikey.NewService(app)
 
 		// Initialize and register torrent routes
-		torrentRoutes := routes.NewTorrentRoutes(torrentService)
+		torrentRoutes := routes.NewTorrentRoutes(torrentService, apiKeyService)
 		torrentRoutes.RegisterRoutes(se)
 
+		// Initialize and register the download client compatibility routes
+		compatRoutes := routes.NewCompatRoutes(
+			compat.NewTransmissionRPC(torrentService, apiKeyService),
+			compat.NewQBittorrentAPI(torrentService, apiKeyService),
+		)
+		compatRoutes.RegisterRoutes(se)
+
+		// Initialize and register API key management routes
+		apiKeyRoutes := routes.NewAPIKeyRoutes(apiKeyService)
+		apiKeyRoutes.RegisterRoutes(se)
+
 		// Initialize and register preference routes
-		preferenceRoutes := routes.NewPreferenceRoutes(transmissionClient)
+		preferenceRoutes := routes.NewPreferenceRoutes(transmissionClient, auditService)
 		preferenceRoutes.RegisterRoutes(se)
 
-		// Add API routes for torrent operations
-		se.Router.GET("/api/torrents", func(re *core.RequestEvent) error {
-			// This will be handled by PocketBase's built-in REST API for the torrents collection
-			// But we could add custom logic here if needed
-			return re.Next()
-		})
+		// Enable OIDC single sign-on when a provider is configured
+		if oidcConfig := user.OIDCConfigFromEnv(); oidcConfig.Enabled() {
+			if err := user.ConfigureOIDC(app, oidcConfig); err != nil {
+				return err
+			}
+			user.BindOIDCHooks(app, oidcConfig, auditService)
+			log.Println("OIDC single sign-on enabled")
+		}
+
+		// Trust identity headers from the reverse proxy when configured
+		proxyAuthConfig, err := user.ProxyAuthConfigFromEnv()
+		if err != nil {
+			return err
+		}
+		if proxyAuthConfig.Enabled {
+			user.BindProxyAuth(se, proxyAuthConfig, auditService)
+			log.Printf("Reverse proxy header authentication enabled for %d trusted network(s)", len(proxyAuthConfig.TrustedProxies))
+		}
+
+		// Initialize TOTP two-factor authentication and its enforcement
+		settingsService := settings.NewService(app)
+		twoFactorService := twofactor.NewService(app, auditService, settingsService)
+		twoFactorService.Bind(se)
+		twoFactorRoutes := routes.NewTwoFactorRoutes(twoFactorService)
+		twoFactorRoutes.RegisterRoutes(se)
 
 		// Initialize and register user routes
-		userService := user.NewService(app)
+		userService := user.NewService(app, auditService, torrentService)
 		userRoutes := routes.NewUserRoutes(userService)
 		userRoutes.RegisterRoutes(se)
 
+		// Require a one-time token from the server log for the initial admin setup
+		if os.Getenv("ADMIN_SETUP_TOKEN_REQUIRED") == "true" {
+			setupToken, err := userService.RequireSetupToken()
+			if err != nil {
+				return err
+			}
+			if setupToken != "" {
+				log.Printf("Initial admin setup token: %s", setupToken)
+			}
+		}
+
+		// Track issued auth tokens so users can review and revoke their sessions
+		user.BindSessionTracking(se)
+		app.Cron().MustAdd("authSessionCleanup", "30 3 * * *", func() {
+			removed, err := userService.PruneSessions(7 * 24 * time.Hour)
+			if err != nil {
+				log.Printf("Failed to prune auth sessions: %v", err)
+				return
+			}
+			if removed > 0 {
+				log.Printf("Pruned %d expired auth sessions", removed)
+			}
+		})
+
+		// Initialize and register self-service account routes
+		meRoutes := routes.NewMeRoutes(userService, apiKeyService)
+		meRoutes.RegisterRoutes(se)
+
+		// Deliver torrent lifecycle events to outgoing webhooks
+		webhookService = webhook.NewService(app, auditService)
+		syncService.OnEvent(webhookService.HandleEvent)
+		webhookRoutes := routes.NewWebhookRoutes(webhookService)
+		webhookRoutes.RegisterRoutes(se)
+		app.Cron().MustAdd("webhookDeliveryCleanup", "15 3 * * *", func() {
+			removed, err := webhookService.PruneDeliveries(30 * 24 * time.Hour)
+			if err != nil {
+				log.Printf("Failed to prune webhook deliveries: %v", err)
+				return
+			}
+			if removed > 0 {
+				log.Printf("Pruned %d webhook deliveries", removed)
+			}
+		})
+
+		// Email users about completed and failed downloads
+		emailService = notification.NewEmailService(app)
+		syncService.OnEvent(emailService.HandleEvent)
+		// Push completed and failed downloads to subscribed browsers
+		pushService = notification.NewPushService(app, settingsService)
+		syncService.OnEvent(pushService.HandleEvent)
+		notificationRoutes := routes.NewNotificationRoutes(notification.NewPreferencesService(app), pushService)
+		notificationRoutes.RegisterRoutes(se)
+		app.Cron().MustAdd("emailDigest", "0 8 * * *", func() {
+			sent, err := emailService.SendDigests()
+			if err != nil {
+				log.Printf("Failed to send email digests: %v", err)
+				return
+			}
+			if sent > 0 {
+				log.Printf("Sent %d email digests", sent)
+			}
+		})
+
+		// Forward torrent lifecycle events to chat and push notification channels
+		channelService = notification.NewChannelService(app, auditService)
+		syncService.OnEvent(channelService.HandleEvent)
+		channelRoutes := routes.NewChannelRoutes(channelService)
+		channelRoutes.RegisterRoutes(se)
+
+		// Run post-processing commands for completed downloads
+		hookService = hook.NewService(app, auditService, 2)
+		syncService.OnEvent(hookService.HandleEvent)
+		hookRoutes := routes.NewHookRoutes(hookService)
+		hookRoutes.RegisterRoutes(se)
+		app.Cron().MustAdd("hookRunCleanup", "45 3 * * *", func() {
+			removed, err := hookService.PruneRuns(30 * 24 * time.Hour)
+			if err != nil {
+				log.Printf("Failed to prune hook runs: %v", err)
+				return
+			}
+			if removed > 0 {
+				log.Printf("Pruned %d hook runs", removed)
+			}
+		})
+
+		// Refresh media server libraries once downloads complete
+		mediaServerService = mediaserver.NewService(app, auditService)
+		syncService.OnEvent(mediaServerService.HandleEvent)
+		mediaServerRoutes := routes.NewMediaServerRoutes(mediaServerService)
+		mediaServerRoutes.RegisterRoutes(se)
+		app.Cron().MustAdd("mediaRefreshCleanup", "55 3 * * *", func() {
+			removed, err := mediaServerService.PruneRefreshes(30 * 24 * time.Hour)
+			if err != nil {
+				log.Printf("Failed to prune media refreshes: %v", err)
+				return
+			}
+			if removed > 0 {
+				log.Printf("Pruned %d media refreshes", removed)
+			}
+		})
+
+		// Add torrents from RSS feeds according to admin-defined rules
+		rssService = rss.NewService(app, torrentService, auditService)
+		rssRoutes := routes.NewRSSRoutes(rssService)
+		rssRoutes.RegisterRoutes(se)
+		// Feeds are due after their own interval; the cron only looks for due ones
+		app.Cron().MustAdd("rssPoll", "* * * * *", rssService.Poll)
+
+		// Add torrents from files dropped into watch folders
+		watchFolderService = watchfolder.NewService(app, torrentService, auditService, 30*time.Second)
+		if err := watchFolderService.Start(); err != nil {
+			log.Printf("Failed to start watch folder service: %v", err)
+		}
+		watchFolderRoutes := routes.NewWatchFolderRoutes(watchFolderService)
+		watchFolderRoutes.RegisterRoutes(se)
+
+		// Search Torznab indexers and add results as the searching user
+		searchService := search.NewService(app, torrentService, auditService)
+		searchRoutes := routes.NewSearchRoutes(searchService)
+		searchRoutes.RegisterRoutes(se)
+
+		// Load the built-in plugins; admins enable them under /api/plugins
+		pluginRegistry = plugin.NewRegistry(app, auditService)
+		if err := pluginRegistry.Register(trackers.New()); err != nil {
+			log.Printf("Failed to register plugin: %v", err)
+		}
+		if err := pluginRegistry.Load(); err != nil {
+			log.Printf("Failed to load plugins: %v", err)
+		}
+		torrentService.OnBeforeAdd(pluginRegistry.BeforeAdd)
+		syncService.OnEvent(pluginRegistry.HandleEvent)
+		pluginRoutes := routes.NewPluginRoutes(pluginRegistry)
+		pluginRoutes.RegisterRoutes(se)
+
+		// Start the sync once all lifecycle event handlers are registered
+		if err := syncService.Start(); err != nil {
+			log.Printf("Failed to start sync service: %v", err)
+		} else {
+			log.Println("Transmission sync service started")
+		}
+
 		// serves static files from the provided public dir (if exists)
 		// Note: avoid intercepting API routes with the catch-all static handler
 		se.Router.GET("/{path...}", func(re *core.RequestEvent) error {
@@ -147,6 +375,33 @@ func main() {
 		if syncService != nil {
 			syncService.Stop()
 		}
+		if webhookService != nil {
+			webhookService.Stop()
+		}
+		if emailService != nil {
+			emailService.Stop()
+		}
+		if pushService != nil {
+			pushService.Stop()
+		}
+		if channelService != nil {
+			channelService.Stop()
+		}
+		if rssService != nil {
+			rssService.Stop()
+		}
+		if watchFolderService != nil {
+			watchFolderService.Stop()
+		}
+		if hookService != nil {
+			hookService.Stop()
+		}
+		if mediaServerService != nil {
+			mediaServerService.Stop()
+		}
+		if pluginRegistry != nil {
+			pluginRegistry.Stop()
+		}
 		return te.Next()
 	})
 
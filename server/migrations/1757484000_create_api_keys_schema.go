@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("api_keys")
+
+		// API keys are managed exclusively through the custom /api/api-keys routes,
+		// so all collection rules stay locked (superusers only).
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		// Short, non-secret part of the key shown in listings to help identify it
+		collection.Fields.Add(&core.TextField{
+			Name:     "prefix",
+			Required: true,
+			Max:      32,
+		})
+
+		// SHA-256 of the full key; the plaintext is only returned once on creation
+		collection.Fields.Add(&core.TextField{
+			Name:     "keyHash",
+			Required: true,
+			Max:      64,
+			Hidden:   true,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "scopes",
+			Required:  true,
+			MaxSelect: 4,
+			Values: []string{
+				"torrents:read",
+				"torrents:add",
+				"torrents:control",
+				"torrents:remove",
+			},
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "expiresAt",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "lastUsedAt",
+			Required: false,
+		})
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "user",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  usersCollection.Id,
+		})
+
+		collection.AddIndex("idx_api_keys_key_hash", true, "keyHash", "")
+		collection.AddIndex("idx_api_keys_user", false, "user", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("api_keys")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,107 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("audit_log")
+
+		// Audit entries are written by the server and read through /api/admin/audit,
+		// so all collection rules stay locked (superusers only).
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "actor",
+			Required:      false, // System actions (sync, retention) have no actor
+			CascadeDelete: false,
+			CollectionId:  usersCollection.Id,
+		})
+
+		// Snapshot of the actor's email so entries stay readable after the user is deleted
+		collection.Fields.Add(&core.TextField{
+			Name:     "actorEmail",
+			Required: false,
+			Max:      255,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "apiKey",
+			Required: false,
+			Max:      50,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "action",
+			Required: true,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.JSONField{
+			Name:     "targets",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.JSONField{
+			Name:     "before",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.JSONField{
+			Name:     "after",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.JSONField{
+			Name:     "details",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "ip",
+			Required: false,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:     "result",
+			Required: true,
+			Values:   []string{"success", "failure"},
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "error",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+
+		collection.AddIndex("idx_audit_log_created", false, "created", "")
+		collection.AddIndex("idx_audit_log_action", false, "action", "")
+		collection.AddIndex("idx_audit_log_actor", false, "actor", "")
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("audit_log")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
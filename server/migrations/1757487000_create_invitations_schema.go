@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("invitations")
+
+		// Invitations are managed through /api/admin/invites and accepted through
+		// /api/invites/{token}, so all collection rules stay locked (superusers only).
+
+		collection.Fields.Add(&core.EmailField{
+			Name:     "email",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:     "role",
+			Required: true,
+			Values:   []string{"user", "admin"},
+		})
+
+		// SHA-256 of the one-time token; the token itself is only returned on creation
+		collection.Fields.Add(&core.TextField{
+			Name:     "tokenHash",
+			Required: true,
+			Max:      64,
+			Hidden:   true,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "expiresAt",
+			Required: true,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "acceptedAt",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "revokedAt",
+			Required: false,
+		})
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "createdBy",
+			Required:      false,
+			CascadeDelete: false,
+			CollectionId:  usersCollection.Id,
+		})
+		collection.Fields.Add(&core.RelationField{
+			Name:          "acceptedUser",
+			Required:      false,
+			CascadeDelete: false,
+			CollectionId:  usersCollection.Id,
+		})
+
+		collection.AddIndex("idx_invitations_token_hash", true, "tokenHash", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("invitations")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
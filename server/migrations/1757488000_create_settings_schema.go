@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("settings")
+
+		// Server-side application settings stored as key/value pairs. They are
+		// only changed through dedicated admin routes, so all rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "key",
+			Required: true,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.JSONField{
+			Name:     "value",
+			Required: false,
+			Hidden:   true,
+		})
+
+		collection.AddIndex("idx_settings_key", true, "key", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("settings")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
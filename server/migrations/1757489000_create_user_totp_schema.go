@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("user_totp")
+
+		// TOTP secrets and recovery codes are managed through /api/me/2fa and
+		// must never be readable by clients, so all collection rules stay locked.
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "user",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  usersCollection.Id,
+		})
+
+		// Base32 shared secret
+		collection.Fields.Add(&core.TextField{
+			Name:     "secret",
+			Required: true,
+			Max:      128,
+			Hidden:   true,
+		})
+
+		// Enrollment only counts once the first code has been confirmed
+		collection.Fields.Add(&core.BoolField{
+			Name:     "enabled",
+			Required: false,
+		})
+
+		// SHA-256 hashes of the unused one-time recovery codes
+		collection.Fields.Add(&core.JSONField{
+			Name:     "recoveryCodes",
+			Required: false,
+			Hidden:   true,
+		})
+
+		// Last accepted time step; codes from this step or earlier are rejected
+		collection.Fields.Add(&core.NumberField{
+			Name:     "lastUsedStep",
+			Required: false,
+			OnlyInt:  true,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "enabledAt",
+			Required: false,
+		})
+
+		collection.AddIndex("idx_user_totp_user", true, "user", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("user_totp")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("auth_sessions")
+
+		// One record per issued user auth token so users can review and revoke
+		// their sessions through /api/me/sessions. All collection rules stay locked.
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "user",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  usersCollection.Id,
+		})
+
+		// SHA-256 of the current auth token of the session
+		collection.Fields.Add(&core.TextField{
+			Name:     "tokenHash",
+			Required: true,
+			Max:      64,
+			Hidden:   true,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "method",
+			Required: false,
+			Max:      50,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "ip",
+			Required: false,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "userAgent",
+			Required: false,
+			Max:      500,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "lastSeenAt",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "expiresAt",
+			Required: true,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "revokedAt",
+			Required: false,
+		})
+
+		collection.AddIndex("idx_auth_sessions_token_hash", true, "tokenHash", "")
+		collection.AddIndex("idx_auth_sessions_user", false, "user", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("auth_sessions")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
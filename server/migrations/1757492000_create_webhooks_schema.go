@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("webhooks")
+
+		// Outgoing webhooks called on torrent lifecycle events. They are managed
+		// through the admin routes under /api/webhooks, so all rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.URLField{
+			Name:     "url",
+			Required: true,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "events",
+			Required:  true,
+			MaxSelect: 4,
+			Values:    []string{"added", "completed", "error", "removed"},
+		})
+
+		// Key of the HMAC-SHA256 signature sent with every delivery
+		collection.Fields.Add(&core.TextField{
+			Name:     "secret",
+			Required: false,
+			Max:      255,
+			Hidden:   true,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("webhooks")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("webhook_deliveries")
+
+		// Delivery log of the outgoing webhooks, one record per event and
+		// webhook. Admins read it through /api/webhooks/{id}/deliveries.
+
+		webhooksCollection, err := app.FindCollectionByNameOrId("webhooks")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "webhook",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  webhooksCollection.Id,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "event",
+			Required: true,
+			Max:      50,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "status",
+			Required:  true,
+			MaxSelect: 1,
+			Values:    []string{"pending", "delivered", "failed"},
+		})
+
+		collection.Fields.Add(&core.NumberField{
+			Name:    "attempts",
+			OnlyInt: true,
+		})
+
+		collection.Fields.Add(&core.NumberField{
+			Name:    "responseStatus",
+			OnlyInt: true,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "error",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.JSONField{
+			Name:     "payload",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "deliveredAt",
+			Required: false,
+		})
+
+		collection.AddIndex("idx_webhook_deliveries_webhook", false, "webhook", "")
+		collection.AddIndex("idx_webhook_deliveries_created", false, "created", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("webhook_deliveries")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
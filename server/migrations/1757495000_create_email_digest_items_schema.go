@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("email_digest_items")
+
+		// Torrent events waiting for the daily email digest of users who chose
+		// the digest mode. Items are removed once the digest is sent, so all
+		// rules stay locked.
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "user",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  usersCollection.Id,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "event",
+			Required: true,
+			Max:      50,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "torrentName",
+			Required: false,
+			Max:      500,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "torrentHash",
+			Required: false,
+			Max:      255,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "errorString",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.AddIndex("idx_email_digest_items_user", false, "user", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("email_digest_items")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("push_subscriptions")
+
+		// Browser Web Push subscriptions of users. They are managed through the
+		// /api/push routes and hold the keys messages are encrypted with, so
+		// all rules stay locked.
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "user",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  usersCollection.Id,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "endpoint",
+			Required: true,
+			Max:      2000,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "p256dh",
+			Required: true,
+			Max:      200,
+			Hidden:   true,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "auth",
+			Required: true,
+			Max:      100,
+			Hidden:   true,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "userAgent",
+			Required: false,
+			Max:      500,
+		})
+
+		collection.AddIndex("idx_push_subscriptions_endpoint", true, "endpoint", "")
+		collection.AddIndex("idx_push_subscriptions_user", false, "user", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("push_subscriptions")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,96 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("notification_channels")
+
+		// Chat and push services notified on torrent lifecycle events. They are
+		// managed through the admin routes under /api/notification-channels and
+		// hold access tokens, so all rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "provider",
+			Required:  true,
+			MaxSelect: 1,
+			Values:    []string{"ntfy", "gotify", "telegram", "discord", "matrix"},
+		})
+
+		// Provider specific settings such as server URLs, tokens and chat ids
+		collection.Fields.Add(&core.JSONField{
+			Name:     "config",
+			Required: false,
+			Hidden:   true,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "events",
+			Required:  true,
+			MaxSelect: 4,
+			Values:    []string{"added", "completed", "error", "removed"},
+		})
+
+		// Go text/template sources; empty fields use the built-in templates
+		collection.Fields.Add(&core.TextField{
+			Name:     "titleTemplate",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "bodyTemplate",
+			Required: false,
+			Max:      4000,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "lastSentAt",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "lastError",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("notification_channels")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("rss_feeds")
+
+		// RSS and Atom feeds polled by the auto-downloader. They are managed
+		// through the admin routes under /api/rss, so all rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.URLField{
+			Name:     "url",
+			Required: true,
+		})
+
+		// Minutes between polls
+		collection.Fields.Add(&core.NumberField{
+			Name:     "interval",
+			Required: false,
+			OnlyInt:  true,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "lastCheckedAt",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "lastError",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("rss_feeds")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
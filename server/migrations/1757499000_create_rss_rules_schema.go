@@ -0,0 +1,121 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("rss_rules")
+
+		// Auto-download rules matched against new feed items. They are managed
+		// through the admin routes under /api/rss, so all rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		feedsCollection, err := app.FindCollectionByNameOrId("rss_feeds")
+		if err != nil {
+			return err
+		}
+		// Feeds the rule applies to; empty means every feed
+		collection.Fields.Add(&core.RelationField{
+			Name:          "feeds",
+			Required:      false,
+			CascadeDelete: false,
+			CollectionId:  feedsCollection.Id,
+			MaxSelect:     100,
+		})
+
+		// Regular expressions matched against item titles
+		collection.Fields.Add(&core.TextField{
+			Name:     "include",
+			Required: false,
+			Max:      500,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "exclude",
+			Required: false,
+			Max:      500,
+		})
+
+		// Size bounds in bytes; 0 means unbounded
+		collection.Fields.Add(&core.NumberField{
+			Name:     "minSize",
+			Required: false,
+			OnlyInt:  true,
+		})
+
+		collection.Fields.Add(&core.NumberField{
+			Name:     "maxSize",
+			Required: false,
+			OnlyInt:  true,
+		})
+
+		// Grab every episode (S01E02, 1x02) only once
+		collection.Fields.Add(&core.BoolField{
+			Name: "episodeDedupe",
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "downloadDir",
+			Required: false,
+			Max:      1000,
+		})
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		// User the grabbed torrents belong to
+		collection.Fields.Add(&core.RelationField{
+			Name:          "owner",
+			Required:      false,
+			CascadeDelete: false,
+			CollectionId:  usersCollection.Id,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "addPaused",
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "lastMatchAt",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("rss_rules")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
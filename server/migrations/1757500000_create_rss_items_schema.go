@@ -0,0 +1,110 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("rss_items")
+
+		// Feed items the auto-downloader has already seen, with what it did
+		// about them. Written by the poller only, so all rules stay locked.
+
+		feedsCollection, err := app.FindCollectionByNameOrId("rss_feeds")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "feed",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  feedsCollection.Id,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "guid",
+			Required: true,
+			Max:      2000,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "title",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "link",
+			Required: false,
+			Max:      5000,
+		})
+
+		collection.Fields.Add(&core.NumberField{
+			Name:     "size",
+			Required: false,
+			OnlyInt:  true,
+		})
+
+		rulesCollection, err := app.FindCollectionByNameOrId("rss_rules")
+		if err != nil {
+			return err
+		}
+		// Rule that matched the item, if any
+		collection.Fields.Add(&core.RelationField{
+			Name:          "rule",
+			Required:      false,
+			CascadeDelete: false,
+			CollectionId:  rulesCollection.Id,
+		})
+
+		// Normalized episode key used by the episode dedupe
+		collection.Fields.Add(&core.TextField{
+			Name:     "episode",
+			Required: false,
+			Max:      500,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "status",
+			Required:  true,
+			MaxSelect: 1,
+			Values:    []string{"skipped", "added", "failed"},
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "error",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.AddIndex("idx_rss_items_feed_guid", true, "feed, guid", "")
+		collection.AddIndex("idx_rss_items_rule_episode", false, "rule, episode", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("rss_items")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
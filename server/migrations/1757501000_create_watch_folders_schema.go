@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("watch_folders")
+
+		// Directories scanned for dropped .torrent and .magnet files. They are
+		// server paths managed through the admin routes under /api/watch-folders,
+		// so all rules stay locked.
+
+		// Absolute path of the watched directory
+		collection.Fields.Add(&core.TextField{
+			Name:     "path",
+			Required: true,
+			Max:      1000,
+		})
+
+		usersCollection, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		// User the added torrents belong to
+		collection.Fields.Add(&core.RelationField{
+			Name:          "owner",
+			Required:      false,
+			CascadeDelete: false,
+			CollectionId:  usersCollection.Id,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "downloadDir",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "autoStart",
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "lastImportAt",
+			Required: false,
+		})
+
+		// Error of the most recent import, empty after a success
+		collection.Fields.Add(&core.TextField{
+			Name:     "lastError",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		collection.AddIndex("idx_watch_folders_path", true, "path", "")
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("watch_folders")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
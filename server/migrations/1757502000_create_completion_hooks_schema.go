@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("completion_hooks")
+
+		// Commands run on the server when a download completes. They are
+		// managed through the admin routes under /api/completion-hooks, so all
+		// rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		// Executable to run; it is started directly, without a shell
+		collection.Fields.Add(&core.TextField{
+			Name:     "command",
+			Required: true,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.JSONField{
+			Name:     "args",
+			Required: false,
+		})
+
+		// Seconds the command may run before it is killed
+		collection.Fields.Add(&core.NumberField{
+			Name:     "timeout",
+			Required: false,
+			OnlyInt:  true,
+		})
+
+		// Categories (first labels) the hook runs for; empty means every torrent
+		collection.Fields.Add(&core.JSONField{
+			Name:     "categories",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("completion_hooks")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("hook_runs")
+
+		// One entry per execution of a completion hook, including retries.
+		// Entries hold command output and are read through the admin routes,
+		// so all rules stay locked.
+
+		hooksCollection, err := app.FindCollectionByNameOrId("completion_hooks")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "hook",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  hooksCollection.Id,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "torrentHash",
+			Required: false,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "torrentName",
+			Required: false,
+			Max:      1000,
+		})
+
+		// Environment variables describing the torrent, kept for retries
+		collection.Fields.Add(&core.JSONField{
+			Name:     "env",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "status",
+			Required:  true,
+			MaxSelect: 1,
+			Values:    []string{"queued", "running", "succeeded", "failed"},
+		})
+
+		collection.Fields.Add(&core.NumberField{
+			Name:     "exitCode",
+			Required: false,
+			OnlyInt:  true,
+		})
+
+		// Combined stdout and stderr, truncated
+		collection.Fields.Add(&core.TextField{
+			Name:     "output",
+			Required: false,
+			Max:      70000,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "error",
+			Required: false,
+			Max:      1000,
+		})
+
+		// Id of the run this one retries
+		collection.Fields.Add(&core.TextField{
+			Name:     "retryOf",
+			Required: false,
+			Max:      50,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "startedAt",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "finishedAt",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		collection.AddIndex("idx_hook_runs_hook_created", false, "hook, created", "")
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("hook_runs")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("search_providers")
+
+		// Torznab endpoints such as Jackett or Prowlarr searched through
+		// /api/search. They hold API keys and are managed through the admin
+		// routes under /api/search-providers, so all rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		// Torznab API endpoint, e.g. http://jackett:9117/api/v2.0/indexers/all/results/torznab
+		collection.Fields.Add(&core.URLField{
+			Name:     "url",
+			Required: true,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "apiKey",
+			Required: false,
+			Hidden:   true,
+			Max:      500,
+		})
+
+		// Torznab categories searched when the request names none
+		collection.Fields.Add(&core.JSONField{
+			Name:     "categories",
+			Required: false,
+		})
+
+		// Seconds to wait for the provider before leaving it out of the results
+		collection.Fields.Add(&core.NumberField{
+			Name:     "timeout",
+			Required: false,
+			OnlyInt:  true,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "lastError",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("search_providers")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("media_servers")
+
+		// Jellyfin, Emby and Plex servers whose libraries are refreshed when
+		// downloads complete. They hold access tokens and are managed through
+		// the admin routes under /api/media-servers, so all rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "type",
+			Required:  true,
+			MaxSelect: 1,
+			Values:    []string{"jellyfin", "emby", "plex"},
+		})
+
+		// Base URL of the server, e.g. http://jellyfin:8096
+		collection.Fields.Add(&core.URLField{
+			Name:     "url",
+			Required: true,
+		})
+
+		// Jellyfin/Emby API key or Plex token
+		collection.Fields.Add(&core.TextField{
+			Name:     "token",
+			Required: false,
+			Hidden:   true,
+			Max:      500,
+		})
+
+		// Plex library section ids to refresh; empty refreshes all of them
+		collection.Fields.Add(&core.JSONField{
+			Name:     "sections",
+			Required: false,
+		})
+
+		// Categories and download directories of the completed torrents that
+		// trigger a refresh; both empty means every completed torrent
+		collection.Fields.Add(&core.JSONField{
+			Name:     "categories",
+			Required: false,
+		})
+		collection.Fields.Add(&core.JSONField{
+			Name:     "downloadDirs",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("media_servers")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
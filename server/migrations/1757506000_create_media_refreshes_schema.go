@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("media_refreshes")
+
+		// Result log of the library refreshes sent to media servers. Admins
+		// read it through /api/media-servers/{id}/refreshes.
+
+		serversCollection, err := app.FindCollectionByNameOrId("media_servers")
+		if err != nil {
+			return err
+		}
+		collection.Fields.Add(&core.RelationField{
+			Name:          "server",
+			Required:      true,
+			CascadeDelete: true,
+			CollectionId:  serversCollection.Id,
+		})
+
+		// The completed torrent that caused the refresh; empty for refreshes
+		// requested by an admin
+		collection.Fields.Add(&core.TextField{
+			Name:     "torrentHash",
+			Required: false,
+			Max:      100,
+		})
+		collection.Fields.Add(&core.TextField{
+			Name:     "torrentName",
+			Required: false,
+			Max:      500,
+		})
+
+		collection.Fields.Add(&core.SelectField{
+			Name:      "status",
+			Required:  true,
+			MaxSelect: 1,
+			Values:    []string{"pending", "succeeded", "failed"},
+		})
+
+		collection.Fields.Add(&core.NumberField{
+			Name:    "attempts",
+			OnlyInt: true,
+		})
+
+		collection.Fields.Add(&core.NumberField{
+			Name:    "responseStatus",
+			OnlyInt: true,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "error",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.Fields.Add(&core.DateField{
+			Name:     "finishedAt",
+			Required: false,
+		})
+
+		collection.AddIndex("idx_media_refreshes_server", false, "server", "")
+		collection.AddIndex("idx_media_refreshes_created", false, "created", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("media_refreshes")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
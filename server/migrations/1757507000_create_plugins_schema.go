@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		collection := core.NewBaseCollection("plugins")
+
+		// State of the plugins compiled into the server, one record per
+		// plugin name. Records are created disabled when a plugin is first
+		// loaded and changed through the admin routes under /api/plugins, so
+		// all rules stay locked.
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "name",
+			Required: true,
+			Max:      100,
+		})
+
+		collection.Fields.Add(&core.BoolField{
+			Name: "enabled",
+		})
+
+		// Plugins run in ascending priority, then by name
+		collection.Fields.Add(&core.NumberField{
+			Name:    "priority",
+			OnlyInt: true,
+		})
+
+		// Settings of the plugin; only the plugin itself reads them
+		collection.Fields.Add(&core.JSONField{
+			Name:     "config",
+			Required: false,
+		})
+
+		collection.Fields.Add(&core.TextField{
+			Name:     "lastError",
+			Required: false,
+			Max:      1000,
+		})
+
+		collection.AddIndex("idx_plugins_name", true, "name", "")
+
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		})
+		collection.Fields.Add(&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		})
+
+		return app.Save(collection)
+
+	}, func(app core.App) error {
+
+		collection, err := app.FindCollectionByNameOrId("plugins")
+
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+
+	})
+}
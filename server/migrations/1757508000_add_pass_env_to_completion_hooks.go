@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("completion_hooks")
+		if err != nil {
+			return err
+		}
+
+		// Names of server environment variables passed to the command on top
+		// of PATH, HOME and LANG; everything else, secrets included, is withheld
+		collection.Fields.Add(&core.JSONField{
+			Name:     "passEnv",
+			Required: false,
+		})
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("completion_hooks")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("passEnv")
+
+		return app.Save(collection)
+	})
+}
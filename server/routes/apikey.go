@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/apikey"
+)
+
+// APIKeyRoutes handles API key management routes for the authenticated user.
+type APIKeyRoutes struct {
+	service *apikey.Service
+}
+
+// NewAPIKeyRoutes constructs a new APIKeyRoutes instance.
+func NewAPIKeyRoutes(service *apikey.Service) *APIKeyRoutes {
+	return &APIKeyRoutes{service: service}
+}
+
+// RegisterRoutes binds API key routes to the router.
+func (ar *APIKeyRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/api-keys")
+	group.Bind(apis.RequireAuth("users"))
+
+	group.GET("", ar.listKeys)
+	group.POST("", ar.createKey)
+	group.DELETE("/{id}", ar.revokeKey)
+}
+
+func (ar *APIKeyRoutes) listKeys(re *core.RequestEvent) error {
+	keys, err := ar.service.List(re.Auth.Id)
+	if err != nil {
+		log.Printf("list api keys: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch api keys"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"apiKeys": keys})
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (ar *APIKeyRoutes) createKey(re *core.RequestEvent) error {
+	var req createAPIKeyRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := ar.service.Create(re.Auth.Id, apikey.CreateParams{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		return ar.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"apiKey": result})
+}
+
+func (ar *APIKeyRoutes) revokeKey(re *core.RequestEvent) error {
+	if err := ar.service.Revoke(re.Auth.Id, re.Request.PathValue("id")); err != nil {
+		return ar.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+func (ar *APIKeyRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr apikey.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr apikey.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	log.Printf("api key service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/audit"
+)
+
+// AuditRoutes exposes the audit log to admins.
+type AuditRoutes struct {
+	service *audit.Service
+}
+
+// NewAuditRoutes constructs a new AuditRoutes instance.
+func NewAuditRoutes(service *audit.Service) *AuditRoutes {
+	return &AuditRoutes{service: service}
+}
+
+// RegisterRoutes binds audit routes to the router.
+func (ar *AuditRoutes) RegisterRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/admin/audit", ar.listEntries).BindFunc(requireAdmin)
+}
+
+// listEntries handles GET /api/admin/audit?page=&perPage=&action=&actor=&target=&result=&from=&to=
+func (ar *AuditRoutes) listEntries(re *core.RequestEvent) error {
+	query := re.Request.URL.Query()
+
+	params := audit.ListParams{
+		Action:  query.Get("action"),
+		ActorID: query.Get("actor"),
+		Target:  query.Get("target"),
+		Result:  query.Get("result"),
+	}
+
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid page"})
+		}
+		params.Page = page
+	}
+
+	if value := query.Get("perPage"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid perPage"})
+		}
+		params.PerPage = perPage
+	}
+
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{"error": "from must be an RFC3339 timestamp"})
+		}
+		params.From = &from
+	}
+
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{"error": "to must be an RFC3339 timestamp"})
+		}
+		params.To = &to
+	}
+
+	result, err := ar.service.List(params)
+	if err != nil {
+		log.Printf("list audit entries: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch audit log"})
+	}
+
+	return re.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/notification"
+)
+
+// ChannelRoutes lets admins manage notification channels such as ntfy,
+// Gotify, Telegram, Discord and Matrix.
+type ChannelRoutes struct {
+	service *notification.ChannelService
+}
+
+// NewChannelRoutes constructs a new ChannelRoutes instance.
+func NewChannelRoutes(service *notification.ChannelService) *ChannelRoutes {
+	return &ChannelRoutes{service: service}
+}
+
+// RegisterRoutes binds notification channel routes to the router.
+func (cr *ChannelRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/notification-channels")
+	group.BindFunc(requireAdmin)
+
+	group.GET("", cr.listChannels)
+	group.POST("", cr.createChannel)
+	group.PATCH("/{id}", cr.updateChannel)
+	group.DELETE("/{id}", cr.deleteChannel)
+	group.POST("/{id}/test", cr.testChannel)
+}
+
+func (cr *ChannelRoutes) listChannels(re *core.RequestEvent) error {
+	channels, err := cr.service.List()
+	if err != nil {
+		log.Printf("list notification channels: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch notification channels"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{
+		"channels":  channels,
+		"providers": notification.Providers(),
+	})
+}
+
+func (cr *ChannelRoutes) createChannel(re *core.RequestEvent) error {
+	var params notification.ChannelParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := cr.service.Create(requestContext(re), params)
+	if err != nil {
+		return cr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"channel": result})
+}
+
+func (cr *ChannelRoutes) updateChannel(re *core.RequestEvent) error {
+	var params notification.ChannelParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := cr.service.Update(requestContext(re), re.Request.PathValue("id"), params)
+	if err != nil {
+		return cr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"channel": result})
+}
+
+func (cr *ChannelRoutes) deleteChannel(re *core.RequestEvent) error {
+	if err := cr.service.Delete(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return cr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+// testChannel handles POST /api/notification-channels/{id}/test by sending a
+// sample message through the channel
+func (cr *ChannelRoutes) testChannel(re *core.RequestEvent) error {
+	if err := cr.service.Test(re.Request.Context(), re.Request.PathValue("id")); err != nil {
+		return cr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]bool{"sent": true})
+}
+
+func (cr *ChannelRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr notification.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr notification.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	var deliveryErr notification.DeliveryError
+	if errors.As(err, &deliveryErr) {
+		return re.JSON(http.StatusBadGateway, map[string]string{"error": deliveryErr.Message})
+	}
+
+	log.Printf("notification channel service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/apikey"
+	"backend/internal/compat"
+)
+
+// CompatRoutes exposes the web APIs of other download clients so existing
+// automation tools can use Retorrent directly.
+type CompatRoutes struct {
+	transmission *compat.TransmissionRPC
+	qbittorrent  *compat.QBittorrentAPI
+}
+
+// NewCompatRoutes constructs a new CompatRoutes instance.
+func NewCompatRoutes(transmission *compat.TransmissionRPC, qbittorrent *compat.QBittorrentAPI) *CompatRoutes {
+	return &CompatRoutes{transmission: transmission, qbittorrent: qbittorrent}
+}
+
+// RegisterRoutes binds the compatibility endpoints to the router.
+func (cr *CompatRoutes) RegisterRoutes(se *core.ServeEvent) {
+	// Transmission RPC, authenticated with basic auth carrying an API key
+	se.Router.POST("/transmission/rpc", cr.transmission.Serve)
+
+	// qBittorrent Web API, authenticated with an API key as login password
+	qb := cr.qbittorrent
+	group := se.Router.Group("/api/v2")
+	group.POST("/auth/login", qb.Login)
+	group.POST("/auth/logout", qb.Logout)
+	group.GET("/app/version", qb.Version).BindFunc(qb.RequireScope(""))
+	group.GET("/app/webapiVersion", qb.WebAPIVersion).BindFunc(qb.RequireScope(""))
+	group.GET("/torrents/info", qb.TorrentsInfo).BindFunc(qb.RequireScope(apikey.ScopeTorrentsRead))
+	group.POST("/torrents/info", qb.TorrentsInfo).BindFunc(qb.RequireScope(apikey.ScopeTorrentsRead))
+	group.POST("/torrents/add", qb.TorrentsAdd).BindFunc(qb.RequireScope(apikey.ScopeTorrentsAdd))
+	group.POST("/torrents/delete", qb.TorrentsDelete).BindFunc(qb.RequireScope(apikey.ScopeTorrentsRemove))
+	group.POST("/torrents/pause", qb.TorrentsPause).BindFunc(qb.RequireScope(apikey.ScopeTorrentsControl))
+	group.POST("/torrents/resume", qb.TorrentsResume).BindFunc(qb.RequireScope(apikey.ScopeTorrentsControl))
+	// qBittorrent 5 names of pause and resume
+	group.POST("/torrents/stop", qb.TorrentsPause).BindFunc(qb.RequireScope(apikey.ScopeTorrentsControl))
+	group.POST("/torrents/start", qb.TorrentsResume).BindFunc(qb.RequireScope(apikey.ScopeTorrentsControl))
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/hook"
+)
+
+// HookRoutes lets admins manage completion hooks, inspect their runs and
+// retry them.
+type HookRoutes struct {
+	service *hook.Service
+}
+
+// NewHookRoutes constructs a new HookRoutes instance.
+func NewHookRoutes(service *hook.Service) *HookRoutes {
+	return &HookRoutes{service: service}
+}
+
+// RegisterRoutes binds completion hook routes to the router.
+func (hr *HookRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/completion-hooks")
+	group.BindFunc(requireAdmin)
+
+	group.GET("", hr.listHooks)
+	group.POST("", hr.createHook)
+	group.PATCH("/{id}", hr.updateHook)
+	group.DELETE("/{id}", hr.deleteHook)
+	group.GET("/{id}/runs", hr.listRuns)
+	group.POST("/{id}/runs/{runId}/retry", hr.retryRun)
+}
+
+func (hr *HookRoutes) listHooks(re *core.RequestEvent) error {
+	hooks, err := hr.service.List()
+	if err != nil {
+		log.Printf("list completion hooks: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch completion hooks"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"hooks": hooks})
+}
+
+func (hr *HookRoutes) createHook(re *core.RequestEvent) error {
+	var params hook.Params
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := hr.service.Create(requestContext(re), params)
+	if err != nil {
+		return hr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"hook": result})
+}
+
+func (hr *HookRoutes) updateHook(re *core.RequestEvent) error {
+	var params hook.Params
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := hr.service.Update(requestContext(re), re.Request.PathValue("id"), params)
+	if err != nil {
+		return hr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"hook": result})
+}
+
+func (hr *HookRoutes) deleteHook(re *core.RequestEvent) error {
+	if err := hr.service.Delete(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return hr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+// listRuns handles GET /api/completion-hooks/{id}/runs?limit=
+func (hr *HookRoutes) listRuns(re *core.RequestEvent) error {
+	var limit int
+	if value := re.Request.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		limit = parsed
+	}
+
+	runs, err := hr.service.Runs(re.Request.PathValue("id"), limit)
+	if err != nil {
+		return hr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"runs": runs})
+}
+
+// retryRun handles POST /api/completion-hooks/{id}/runs/{runId}/retry by
+// queuing a new run with the same environment
+func (hr *HookRoutes) retryRun(re *core.RequestEvent) error {
+	run, err := hr.service.Retry(requestContext(re), re.Request.PathValue("id"), re.Request.PathValue("runId"))
+	if err != nil {
+		return hr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusAccepted, map[string]any{"run": run})
+}
+
+func (hr *HookRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr hook.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr hook.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	log.Printf("completion hook service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -0,0 +1,186 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/apikey"
+	"backend/internal/torrent"
+	"backend/internal/user"
+)
+
+// MeRoutes handles the self-service account routes of the authenticated user.
+type MeRoutes struct {
+	users   *user.Service
+	apiKeys *apikey.Service
+}
+
+// NewMeRoutes constructs a new MeRoutes instance.
+func NewMeRoutes(users *user.Service, apiKeys *apikey.Service) *MeRoutes {
+	return &MeRoutes{users: users, apiKeys: apiKeys}
+}
+
+// RegisterRoutes binds self-service account routes to the router.
+func (mr *MeRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/me")
+	group.Bind(apis.RequireAuth("users"))
+
+	group.GET("", mr.getMe)
+	group.PATCH("", mr.updateMe)
+	group.POST("/password", mr.changePassword)
+	group.PUT("/defaults", mr.updateDefaults)
+
+	group.GET("/sessions", mr.listSessions)
+	group.DELETE("/sessions", mr.revokeOtherSessions)
+	group.DELETE("/sessions/{id}", mr.revokeSession)
+
+	group.GET("/api-keys", mr.listAPIKeys)
+	group.DELETE("/api-keys/{id}", mr.revokeAPIKey)
+}
+
+func (mr *MeRoutes) getMe(re *core.RequestEvent) error {
+	me, err := mr.users.Me(re.Auth.Id)
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"user": me})
+}
+
+type updateMeRequest struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+func (mr *MeRoutes) updateMe(re *core.RequestEvent) error {
+	var req updateMeRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	// New addresses have to be confirmed before they can be used to log in
+	if req.Email != nil && *req.Email != re.Auth.Email() {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "email changes must be confirmed through /api/collections/users/request-email-change"})
+	}
+
+	me, err := mr.users.UpdateProfile(requestContext(re), re.Auth.Id, user.ProfileParams{
+		Name: req.Name,
+	})
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"user": me})
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+func (mr *MeRoutes) changePassword(re *core.RequestEvent) error {
+	var req changePasswordRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	record, err := mr.users.ChangePassword(requestContext(re), re.Auth.Id, req.CurrentPassword, req.NewPassword, user.RequestToken(re))
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	// The password change invalidated every token, hand the caller a new one
+	return apis.RecordAuthResponse(re, record, "", nil)
+}
+
+func (mr *MeRoutes) updateDefaults(re *core.RequestEvent) error {
+	var req torrent.Defaults
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	me, err := mr.users.UpdateDefaults(re.Auth.Id, req)
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"user": me})
+}
+
+func (mr *MeRoutes) listSessions(re *core.RequestEvent) error {
+	sessions, err := mr.users.ListSessions(re.Auth.Id, user.RequestToken(re))
+	if err != nil {
+		log.Printf("list sessions: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch sessions"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"sessions": sessions})
+}
+
+func (mr *MeRoutes) revokeOtherSessions(re *core.RequestEvent) error {
+	record, err := mr.users.RevokeOtherSessions(requestContext(re), re.Auth.Id, user.RequestToken(re))
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	// Refreshing the token key invalidated the caller's token too
+	return apis.RecordAuthResponse(re, record, "", nil)
+}
+
+func (mr *MeRoutes) revokeSession(re *core.RequestEvent) error {
+	if err := mr.users.RevokeSession(requestContext(re), re.Auth.Id, re.Request.PathValue("id")); err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+func (mr *MeRoutes) listAPIKeys(re *core.RequestEvent) error {
+	keys, err := mr.apiKeys.List(re.Auth.Id)
+	if err != nil {
+		log.Printf("list api keys: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch api keys"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"apiKeys": keys})
+}
+
+func (mr *MeRoutes) revokeAPIKey(re *core.RequestEvent) error {
+	if err := mr.apiKeys.Revoke(re.Auth.Id, re.Request.PathValue("id")); err != nil {
+		var notFoundErr apikey.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+		}
+		log.Printf("revoke api key: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+func (mr *MeRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr user.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr user.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	if errors.Is(err, user.ErrInvalidPassword) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": user.ErrInvalidPassword.Error()})
+	}
+
+	if errors.Is(err, user.ErrLastAdmin) {
+		return re.JSON(http.StatusConflict, map[string]string{"error": user.ErrLastAdmin.Error()})
+	}
+
+	log.Printf("account service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
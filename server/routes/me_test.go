@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/apikey"
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/user"
+)
+
+func TestUpdateMeRejectsEmailChanges(t *testing.T) {
+	headers := map[string]string{}
+
+	scenario := tests.ApiScenario{
+		Name:            "email change",
+		Method:          http.MethodPatch,
+		URL:             "/api/me",
+		Body:            strings.NewReader(`{"name": "Mallory", "email": "admin@example.com"}`),
+		Headers:         headers,
+		ExpectedStatus:  http.StatusBadRequest,
+		ExpectedContent: []string{"request-email-change"},
+		TestAppFactory: func(t testing.TB) *tests.TestApp {
+			testApp, err := tests.NewTestApp()
+			if err != nil {
+				t.Fatalf("Failed to create test app: %v", err)
+			}
+
+			record := testutil.CreateUser(t, testApp, "mallory@example.com", "user")
+
+			token, err := record.NewAuthToken()
+			if err != nil {
+				t.Fatalf("Failed to create auth token: %v", err)
+			}
+			headers["Authorization"] = token
+
+			return testApp
+		},
+		BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+			NewMeRoutes(user.NewService(&pocketbase.PocketBase{App: app}, audit.NewService(app), nil), apikey.NewService(app)).RegisterRoutes(e)
+		},
+		AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+			record, err := app.FindAuthRecordByEmail("users", "mallory@example.com")
+			if err != nil || record.GetString("name") == "Mallory" {
+				t.Errorf("Expected the account to be left unchanged (%v)", err)
+			}
+		},
+	}
+
+	scenario.Test(t)
+}
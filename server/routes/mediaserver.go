@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/mediaserver"
+)
+
+// MediaServerRoutes lets admins manage the media servers refreshed on
+// completion and inspect their refresh log.
+type MediaServerRoutes struct {
+	service *mediaserver.Service
+}
+
+// NewMediaServerRoutes constructs a new MediaServerRoutes instance.
+func NewMediaServerRoutes(service *mediaserver.Service) *MediaServerRoutes {
+	return &MediaServerRoutes{service: service}
+}
+
+// RegisterRoutes binds media server routes to the router.
+func (mr *MediaServerRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/media-servers")
+	group.BindFunc(requireAdmin)
+
+	group.GET("", mr.listServers)
+	group.POST("", mr.createServer)
+	group.PATCH("/{id}", mr.updateServer)
+	group.DELETE("/{id}", mr.deleteServer)
+	group.GET("/{id}/refreshes", mr.listRefreshes)
+	group.POST("/{id}/refresh", mr.refresh)
+}
+
+func (mr *MediaServerRoutes) listServers(re *core.RequestEvent) error {
+	servers, err := mr.service.List()
+	if err != nil {
+		log.Printf("list media servers: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch media servers"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"servers": servers})
+}
+
+func (mr *MediaServerRoutes) createServer(re *core.RequestEvent) error {
+	var params mediaserver.Params
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := mr.service.Create(requestContext(re), params)
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"server": result})
+}
+
+func (mr *MediaServerRoutes) updateServer(re *core.RequestEvent) error {
+	var params mediaserver.Params
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := mr.service.Update(requestContext(re), re.Request.PathValue("id"), params)
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"server": result})
+}
+
+func (mr *MediaServerRoutes) deleteServer(re *core.RequestEvent) error {
+	if err := mr.service.Delete(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+// listRefreshes handles GET /api/media-servers/{id}/refreshes?limit=
+func (mr *MediaServerRoutes) listRefreshes(re *core.RequestEvent) error {
+	var limit int
+	if value := re.Request.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		limit = parsed
+	}
+
+	refreshes, err := mr.service.Refreshes(re.Request.PathValue("id"), limit)
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"refreshes": refreshes})
+}
+
+// refresh handles POST /api/media-servers/{id}/refresh by queuing a library
+// refresh right away
+func (mr *MediaServerRoutes) refresh(re *core.RequestEvent) error {
+	refresh, err := mr.service.Refresh(requestContext(re), re.Request.PathValue("id"))
+	if err != nil {
+		return mr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusAccepted, map[string]any{"refresh": refresh})
+}
+
+func (mr *MediaServerRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr mediaserver.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr mediaserver.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	log.Printf("media server service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/notification"
+	"backend/internal/webpush"
+)
+
+// NotificationRoutes lets users manage their notification preferences and
+// browser push subscriptions.
+type NotificationRoutes struct {
+	preferences *notification.PreferencesService
+	push        *notification.PushService
+}
+
+// NewNotificationRoutes constructs a new NotificationRoutes instance.
+func NewNotificationRoutes(preferences *notification.PreferencesService, push *notification.PushService) *NotificationRoutes {
+	return &NotificationRoutes{preferences: preferences, push: push}
+}
+
+// RegisterRoutes binds notification routes to the router.
+func (nr *NotificationRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/me/notifications")
+	group.Bind(apis.RequireAuth("users"))
+
+	group.GET("", nr.getPreferences)
+	group.PUT("", nr.updatePreferences)
+
+	push := se.Router.Group("/api/push")
+	push.Bind(apis.RequireAuth("users"))
+
+	push.GET("/public-key", nr.getPublicKey)
+	push.GET("/subscriptions", nr.listSubscriptions)
+	push.POST("/subscriptions", nr.subscribe)
+	push.DELETE("/subscriptions", nr.unsubscribe)
+}
+
+func (nr *NotificationRoutes) getPreferences(re *core.RequestEvent) error {
+	prefs, err := nr.preferences.Get(re.Auth.Id)
+	if err != nil {
+		return nr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"notifications": prefs})
+}
+
+func (nr *NotificationRoutes) updatePreferences(re *core.RequestEvent) error {
+	var req notification.Preferences
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	prefs, err := nr.preferences.Update(re.Auth.Id, req)
+	if err != nil {
+		return nr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"notifications": prefs})
+}
+
+// getPublicKey handles GET /api/push/public-key, the applicationServerKey
+// browsers subscribe with
+func (nr *NotificationRoutes) getPublicKey(re *core.RequestEvent) error {
+	publicKey, err := nr.push.PublicKey()
+	if err != nil {
+		return nr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]string{"publicKey": publicKey})
+}
+
+func (nr *NotificationRoutes) listSubscriptions(re *core.RequestEvent) error {
+	subscriptions, err := nr.push.Subscriptions(re.Auth.Id)
+	if err != nil {
+		log.Printf("list push subscriptions: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch push subscriptions"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"subscriptions": subscriptions})
+}
+
+// subscribe handles POST /api/push/subscriptions with the JSON form of a
+// browser PushSubscription
+func (nr *NotificationRoutes) subscribe(re *core.RequestEvent) error {
+	var req webpush.Subscription
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	subscription, err := nr.push.Subscribe(re.Auth.Id, req, re.Request.UserAgent())
+	if err != nil {
+		return nr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"subscription": subscription})
+}
+
+type unsubscribeRequest struct {
+	Endpoint string `json:"endpoint"`
+}
+
+func (nr *NotificationRoutes) unsubscribe(re *core.RequestEvent) error {
+	var req unsubscribeRequest
+	if err := re.BindBody(&req); err != nil || req.Endpoint == "" {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "endpoint is required"})
+	}
+
+	if err := nr.push.Unsubscribe(re.Auth.Id, req.Endpoint); err != nil {
+		return nr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+func (nr *NotificationRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr notification.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr notification.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	log.Printf("notification service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/plugin"
+)
+
+// PluginRoutes lets admins enable and configure plugins and serves the
+// routes of the plugins themselves.
+type PluginRoutes struct {
+	registry *plugin.Registry
+}
+
+// NewPluginRoutes constructs a new PluginRoutes instance.
+func NewPluginRoutes(registry *plugin.Registry) *PluginRoutes {
+	return &PluginRoutes{registry: registry}
+}
+
+// RegisterRoutes binds plugin routes to the router.
+func (pr *PluginRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/plugins")
+	group.BindFunc(requireAdmin)
+
+	group.GET("", pr.listPlugins)
+	group.PATCH("/{name}", pr.updatePlugin)
+
+	pr.registry.MountRoutes(se.Router)
+}
+
+func (pr *PluginRoutes) listPlugins(re *core.RequestEvent) error {
+	plugins, err := pr.registry.List()
+	if err != nil {
+		log.Printf("list plugins: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch plugins"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"plugins": plugins})
+}
+
+func (pr *PluginRoutes) updatePlugin(re *core.RequestEvent) error {
+	var params plugin.Params
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := pr.registry.Update(requestContext(re), re.Request.PathValue("name"), params)
+	if err != nil {
+		return pr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"plugin": result})
+}
+
+func (pr *PluginRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr plugin.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr plugin.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	log.Printf("plugin registry error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
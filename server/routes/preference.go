@@ -1,20 +1,27 @@
 package routes
 
 import (
+	"context"
+	"encoding/json"
+	"log"
+
 	"github.com/pocketbase/pocketbase/core"
 
+	"backend/internal/audit"
 	"backend/internal/transmission"
 )
 
 // PreferenceRoutes handles preference-related HTTP routes
 type PreferenceRoutes struct {
 	client transmission.TransmissionClient
+	audit  *audit.Service
 }
 
 // NewPreferenceRoutes creates a new preference routes handler
-func NewPreferenceRoutes(client transmission.TransmissionClient) *PreferenceRoutes {
+func NewPreferenceRoutes(client transmission.TransmissionClient, auditService *audit.Service) *PreferenceRoutes {
 	return &PreferenceRoutes{
 		client: client,
+		audit:  auditService,
 	}
 }
 
@@ -58,13 +65,49 @@ func (pr *PreferenceRoutes) handleSetPreferences(re *core.RequestEvent) error {
 	}
 
 	// Update settings using transmission client
-	ctx := re.Request.Context()
+	ctx := requestContext(re)
+	entry := audit.Entry{
+		Action: audit.ActionPreferencesUpdate,
+		Before: pr.currentSettings(ctx, settings),
+		After:  settings,
+	}
 	if err := pr.client.SetSessionSettings(ctx, settings); err != nil {
+		entry.Err = err
+		pr.audit.Record(ctx, entry)
 		return re.JSON(500, map[string]string{"error": err.Error()})
 	}
+	pr.audit.Record(ctx, entry)
 
 	return re.JSON(200, map[string]interface{}{
 		"success": true,
 		"message": "Preferences updated successfully",
 	})
-}
\ No newline at end of file
+}
+
+// currentSettings returns the current values of the settings about to be
+// changed so the audit log can show what they were before the update.
+func (pr *PreferenceRoutes) currentSettings(ctx context.Context, changes map[string]interface{}) map[string]interface{} {
+	before := make(map[string]interface{}, len(changes))
+
+	current, err := pr.client.GetSessionSettings(ctx)
+	if err != nil {
+		log.Printf("Failed to read preferences before update: %v", err)
+		return before
+	}
+
+	// Settings come back either as a map or as a struct with RPC json tags
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return before
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return before
+	}
+
+	for key := range changes {
+		before[key] = all[key]
+	}
+
+	return before
+}
@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/rss"
+)
+
+// RSSRoutes lets admins manage RSS feeds and the rules that pick torrents
+// from them.
+type RSSRoutes struct {
+	service *rss.Service
+}
+
+// NewRSSRoutes constructs a new RSSRoutes instance.
+func NewRSSRoutes(service *rss.Service) *RSSRoutes {
+	return &RSSRoutes{service: service}
+}
+
+// RegisterRoutes binds RSS routes to the router.
+func (rr *RSSRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/rss")
+	group.BindFunc(requireAdmin)
+
+	group.GET("/feeds", rr.listFeeds)
+	group.POST("/feeds", rr.createFeed)
+	group.PATCH("/feeds/{id}", rr.updateFeed)
+	group.DELETE("/feeds/{id}", rr.deleteFeed)
+	group.GET("/feeds/{id}/items", rr.listItems)
+	group.POST("/feeds/{id}/check", rr.checkFeed)
+
+	group.GET("/rules", rr.listRules)
+	group.POST("/rules", rr.createRule)
+	group.PATCH("/rules/{id}", rr.updateRule)
+	group.DELETE("/rules/{id}", rr.deleteRule)
+	group.POST("/rules/{id}/dry-run", rr.dryRun)
+}
+
+func (rr *RSSRoutes) listFeeds(re *core.RequestEvent) error {
+	feeds, err := rr.service.ListFeeds()
+	if err != nil {
+		log.Printf("list rss feeds: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch feeds"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"feeds": feeds})
+}
+
+func (rr *RSSRoutes) createFeed(re *core.RequestEvent) error {
+	var params rss.FeedParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := rr.service.CreateFeed(requestContext(re), params)
+	if err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"feed": result})
+}
+
+func (rr *RSSRoutes) updateFeed(re *core.RequestEvent) error {
+	var params rss.FeedParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := rr.service.UpdateFeed(requestContext(re), re.Request.PathValue("id"), params)
+	if err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"feed": result})
+}
+
+func (rr *RSSRoutes) deleteFeed(re *core.RequestEvent) error {
+	if err := rr.service.DeleteFeed(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+// listItems handles GET /api/rss/feeds/{id}/items with the items seen most
+// recently and what became of them
+func (rr *RSSRoutes) listItems(re *core.RequestEvent) error {
+	limit, _ := strconv.Atoi(re.Request.URL.Query().Get("limit"))
+
+	items, err := rr.service.Items(re.Request.PathValue("id"), limit)
+	if err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"items": items})
+}
+
+// checkFeed handles POST /api/rss/feeds/{id}/check by polling the feed
+// without waiting for its interval
+func (rr *RSSRoutes) checkFeed(re *core.RequestEvent) error {
+	result, err := rr.service.CheckFeed(requestContext(re), re.Request.PathValue("id"))
+	if err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"result": result})
+}
+
+func (rr *RSSRoutes) listRules(re *core.RequestEvent) error {
+	rules, err := rr.service.ListRules()
+	if err != nil {
+		log.Printf("list rss rules: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch rules"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"rules": rules})
+}
+
+func (rr *RSSRoutes) createRule(re *core.RequestEvent) error {
+	var params rss.RuleParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := rr.service.CreateRule(requestContext(re), params)
+	if err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"rule": result})
+}
+
+func (rr *RSSRoutes) updateRule(re *core.RequestEvent) error {
+	var params rss.RuleParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := rr.service.UpdateRule(requestContext(re), re.Request.PathValue("id"), params)
+	if err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"rule": result})
+}
+
+func (rr *RSSRoutes) deleteRule(re *core.RequestEvent) error {
+	if err := rr.service.DeleteRule(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+// dryRun handles POST /api/rss/rules/{id}/dry-run by listing the current
+// feed items and whether the rule would grab them
+func (rr *RSSRoutes) dryRun(re *core.RequestEvent) error {
+	items, err := rr.service.DryRun(re.Request.Context(), re.Request.PathValue("id"))
+	if err != nil {
+		return rr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"items": items})
+}
+
+func (rr *RSSRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr rss.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr rss.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	var fetchErr rss.FetchError
+	if errors.As(err, &fetchErr) {
+		return re.JSON(http.StatusBadGateway, map[string]string{"error": fetchErr.Message})
+	}
+
+	log.Printf("rss service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/search"
+	"backend/internal/torrent"
+)
+
+// SearchRoutes lets users search the configured Torznab providers and add
+// results, and lets admins manage the providers.
+type SearchRoutes struct {
+	service *search.Service
+}
+
+// NewSearchRoutes constructs a new SearchRoutes instance.
+func NewSearchRoutes(service *search.Service) *SearchRoutes {
+	return &SearchRoutes{service: service}
+}
+
+// RegisterRoutes binds search routes to the router.
+func (sr *SearchRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/search")
+	group.Bind(apis.RequireAuth("users"))
+
+	group.GET("", sr.search)
+	group.POST("/add", sr.addResult)
+
+	providers := se.Router.Group("/api/search-providers")
+	providers.BindFunc(requireAdmin)
+
+	providers.GET("", sr.listProviders)
+	providers.POST("", sr.createProvider)
+	providers.PATCH("/{id}", sr.updateProvider)
+	providers.DELETE("/{id}", sr.deleteProvider)
+}
+
+// search handles GET /api/search?q=&cat=
+func (sr *SearchRoutes) search(re *core.RequestEvent) error {
+	query := re.Request.URL.Query()
+
+	categories, err := search.ParseCategories(query.Get("cat"))
+	if err != nil {
+		return sr.handleServiceError(re, err)
+	}
+
+	response, err := sr.service.Search(re.Request.Context(), query.Get("q"), categories)
+	if err != nil {
+		return sr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, response)
+}
+
+// addResult handles POST /api/search/add, adding a result as the caller
+func (sr *SearchRoutes) addResult(re *core.RequestEvent) error {
+	var params search.AddParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	torrentData, err := sr.service.Add(requestContext(re), re.Auth.Id, params)
+	if err != nil {
+		return sr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{
+		"success":         true,
+		"transmission_id": torrentData.ID,
+		"message":         "Torrent added successfully",
+	})
+}
+
+func (sr *SearchRoutes) listProviders(re *core.RequestEvent) error {
+	providers, err := sr.service.ListProviders()
+	if err != nil {
+		log.Printf("list search providers: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch search providers"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"providers": providers})
+}
+
+func (sr *SearchRoutes) createProvider(re *core.RequestEvent) error {
+	var params search.ProviderParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	provider, err := sr.service.CreateProvider(requestContext(re), params)
+	if err != nil {
+		return sr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"provider": provider})
+}
+
+func (sr *SearchRoutes) updateProvider(re *core.RequestEvent) error {
+	var params search.ProviderParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	provider, err := sr.service.UpdateProvider(requestContext(re), re.Request.PathValue("id"), params)
+	if err != nil {
+		return sr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"provider": provider})
+}
+
+func (sr *SearchRoutes) deleteProvider(re *core.RequestEvent) error {
+	if err := sr.service.DeleteProvider(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return sr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+func (sr *SearchRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr search.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr search.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	var providerErr search.ProviderError
+	if errors.As(err, &providerErr) {
+		return re.JSON(http.StatusBadGateway, map[string]string{"error": providerErr.Message})
+	}
+
+	var duplicateErr torrent.DuplicateError
+	if errors.As(err, &duplicateErr) {
+		return re.JSON(http.StatusConflict, map[string]any{"error": duplicateErr.Error(), "duplicate": duplicateErr})
+	}
+
+	var clientErr torrent.ClientError
+	if errors.As(err, &clientErr) {
+		log.Printf("search add failed: %v", err)
+		return re.JSON(http.StatusBadGateway, map[string]string{"error": "failed to add torrent"})
+	}
+
+	log.Printf("search service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -1,38 +1,86 @@
 package routes
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"strconv"
+	"strings"
 
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 
+	"backend/internal/apikey"
+	"backend/internal/metainfo"
 	"backend/internal/torrent"
 )
 
 // TorrentRoutes handles torrent-related HTTP routes
 type TorrentRoutes struct {
 	service *torrent.Service
+	apiKeys *apikey.Service
 }
 
 // NewTorrentRoutes creates a new torrent routes handler
-func NewTorrentRoutes(service *torrent.Service) *TorrentRoutes {
+func NewTorrentRoutes(service *torrent.Service, apiKeys *apikey.Service) *TorrentRoutes {
 	return &TorrentRoutes{
 		service: service,
+		apiKeys: apiKeys,
 	}
 }
 
 // RegisterRoutes registers torrent-related routes
 func (tr *TorrentRoutes) RegisterRoutes(se *core.ServeEvent) {
+	// API endpoint to list the torrents visible to the caller
+	se.Router.GET("/api/torrents", tr.handleListTorrents).
+		BindFunc(apiKeyAuth(tr.apiKeys, apikey.ScopeTorrentsRead))
+
 	// Custom API endpoint to force sync
-	se.Router.POST("/api/torrents/sync", tr.handleSync)
+	se.Router.POST("/api/torrents/sync", tr.handleSync).
+		BindFunc(apiKeyAuth(tr.apiKeys, apikey.ScopeTorrentsRead))
 
 	// API endpoint to add torrents
-	se.Router.POST("/api/torrents/add", tr.handleAddTorrent)
+	se.Router.POST("/api/torrents/add", tr.handleAddTorrent).
+		BindFunc(apiKeyAuth(tr.apiKeys, apikey.ScopeTorrentsAdd))
+
+	// API endpoint to add many torrents from a multipart upload
+	se.Router.POST("/api/torrents/add/bulk", tr.handleBulkAddTorrents).
+		Bind(apis.BodyLimit(maxBulkBody)).
+		BindFunc(apiKeyAuth(tr.apiKeys, apikey.ScopeTorrentsAdd))
+
+	// API endpoint to inspect a torrent before adding it
+	se.Router.POST("/api/torrents/preview", tr.handlePreviewTorrent).
+		BindFunc(apiKeyAuth(tr.apiKeys, apikey.ScopeTorrentsAdd))
 
 	// API endpoint to remove torrents
-	se.Router.POST("/api/torrents/remove", tr.handleRemoveTorrents)
+	se.Router.POST("/api/torrents/remove", tr.handleRemoveTorrents).
+		BindFunc(apiKeyAuth(tr.apiKeys, apikey.ScopeTorrentsRemove))
 
 	// API endpoint for torrent actions (backward compatibility)
-	se.Router.POST("/api/torrents/{id}/action", tr.handleTorrentAction)
+	se.Router.POST("/api/torrents/{id}/action", tr.handleTorrentAction).
+		BindFunc(apiKeyAuth(tr.apiKeys, apikey.ScopeTorrentsControl))
+}
+
+// handleListTorrents handles list torrent requests
+func (tr *TorrentRoutes) handleListTorrents(re *core.RequestEvent) error {
+	if re.Auth == nil {
+		return re.JSON(401, map[string]string{"error": "authentication required"})
+	}
+
+	records, err := tr.service.ListTorrents(re.Auth.Id, re.Auth.GetString("role") == "admin")
+	if err != nil {
+		log.Printf("list torrents: %v", err)
+		return re.JSON(500, map[string]string{"error": "failed to fetch torrents"})
+	}
+
+	return re.JSON(200, map[string]interface{}{
+		"success":  true,
+		"torrents": records,
+	})
 }
 
 // handleSync handles sync requests
@@ -53,10 +101,18 @@ func (tr *TorrentRoutes) handleAddTorrent(re *core.RequestEvent) error {
 		return re.JSON(400, map[string]string{"error": "Invalid request body"})
 	}
 
+	if re.Auth != nil && re.Auth.Collection().Name == "users" {
+		request.UserID = re.Auth.Id
+	}
+
 	// Add torrent using service
-	ctx := re.Request.Context()
+	ctx := requestContext(re)
 	torrentData, err := tr.service.AddTorrent(ctx, request)
 	if err != nil {
+		var duplicateErr torrent.DuplicateError
+		if errors.As(err, &duplicateErr) {
+			return re.JSON(409, map[string]interface{}{"error": err.Error(), "duplicate": duplicateErr})
+		}
 		return re.JSON(400, map[string]string{"error": err.Error()})
 	}
 
@@ -67,6 +123,148 @@ func (tr *TorrentRoutes) handleAddTorrent(re *core.RequestEvent) error {
 	})
 }
 
+const (
+	// maxBulkItems bounds the torrents of one bulk add
+	maxBulkItems = 100
+	// maxBulkBody bounds the request body of a bulk add
+	maxBulkBody = 64 << 20
+)
+
+// handleBulkAddTorrents adds the .torrent files of the multipart "torrents"
+// field and the newline separated magnets of the "magnets" field. "options"
+// holds JSON options for every item and "itemOptions" a JSON object of
+// options by item index, counting files in upload order, then magnets.
+func (tr *TorrentRoutes) handleBulkAddTorrents(re *core.RequestEvent) error {
+	if err := re.Request.ParseMultipartForm(8 << 20); err != nil {
+		if errors.Is(err, apis.ErrRequestEntityTooLarge) {
+			return re.JSON(413, map[string]string{"error": fmt.Sprintf("Request exceeds %d bytes", maxBulkBody)})
+		}
+		return re.JSON(400, map[string]string{"error": "Invalid multipart form"})
+	}
+	defer re.Request.MultipartForm.RemoveAll()
+
+	shared := []byte(re.Request.FormValue("options"))
+	if _, err := bulkRequest(shared, nil); err != nil {
+		return re.JSON(400, map[string]string{"error": "Invalid options"})
+	}
+
+	var itemOptions map[string]json.RawMessage
+	if raw := re.Request.FormValue("itemOptions"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &itemOptions); err != nil {
+			return re.JSON(400, map[string]string{"error": "Invalid item options"})
+		}
+	}
+
+	var items []torrent.BulkItem
+	for _, header := range re.Request.MultipartForm.File["torrents"] {
+		source, err := readTorrentFile(header)
+		items = append(items, torrent.BulkItem{Source: header.Filename, Request: torrent.AddTorrentRequest{Torrent: source}, Err: err})
+	}
+	for _, line := range strings.Split(re.Request.FormValue("magnets"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, torrent.BulkItem{Source: line, Request: torrent.AddTorrentRequest{Torrent: line}})
+		}
+	}
+
+	if len(items) == 0 {
+		return re.JSON(400, map[string]string{"error": "No torrents to add"})
+	}
+	if len(items) > maxBulkItems {
+		return re.JSON(400, map[string]string{"error": fmt.Sprintf("At most %d torrents can be added at once", maxBulkItems)})
+	}
+
+	var userID string
+	if re.Auth != nil && re.Auth.Collection().Name == "users" {
+		userID = re.Auth.Id
+	}
+
+	for i := range items {
+		req, err := bulkRequest(shared, itemOptions[strconv.Itoa(i)])
+		if err != nil && items[i].Err == nil {
+			items[i].Err = fmt.Errorf("invalid options: %w", err)
+		}
+		req.Torrent = items[i].Request.Torrent
+		req.UserID = userID
+		items[i].Request = req
+	}
+
+	results := tr.service.AddTorrents(requestContext(re), items)
+
+	counts := map[torrent.BulkStatus]int{}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	return re.JSON(200, map[string]interface{}{
+		"results":    results,
+		"added":      counts[torrent.BulkAdded],
+		"duplicates": counts[torrent.BulkDuplicate],
+		"failed":     counts[torrent.BulkError],
+	})
+}
+
+// bulkRequest decodes the options of a bulk add item: the shared options,
+// then its own
+func bulkRequest(shared, own []byte) (torrent.AddTorrentRequest, error) {
+	var req torrent.AddTorrentRequest
+	if len(shared) > 0 {
+		if err := json.Unmarshal(shared, &req); err != nil {
+			return req, err
+		}
+	}
+
+	// File indices differ between torrents, so they are only taken per item
+	req.FilesUnwanted, req.PriorityHigh, req.PriorityLow = nil, nil, nil
+
+	if len(own) > 0 {
+		if err := json.Unmarshal(own, &req); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// readTorrentFile reads an uploaded .torrent file as base64
+func readTorrentFile(header *multipart.FileHeader) (string, error) {
+	if header.Size > metainfo.MaxSize {
+		return "", fmt.Errorf("torrent file exceeds %d bytes", metainfo.MaxSize)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to read torrent file: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, metainfo.MaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read torrent file: %w", err)
+	}
+	if len(data) > metainfo.MaxSize {
+		return "", fmt.Errorf("torrent file exceeds %d bytes", metainfo.MaxSize)
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// handlePreviewTorrent parses a torrent and returns its name, hashes and files
+func (tr *TorrentRoutes) handlePreviewTorrent(re *core.RequestEvent) error {
+	var request struct {
+		Torrent string `json:"torrent"`
+	}
+
+	if err := re.BindBody(&request); err != nil {
+		return re.JSON(400, map[string]string{"error": "Invalid request body"})
+	}
+
+	preview, err := tr.service.Preview(request.Torrent)
+	if err != nil {
+		return re.JSON(400, map[string]string{"error": err.Error()})
+	}
+
+	return re.JSON(200, map[string]interface{}{"torrent": preview})
+}
+
 // handleRemoveTorrents handles remove torrents requests
 func (tr *TorrentRoutes) handleRemoveTorrents(re *core.RequestEvent) error {
 	// Parse request body
@@ -76,10 +274,14 @@ func (tr *TorrentRoutes) handleRemoveTorrents(re *core.RequestEvent) error {
 		return re.JSON(400, map[string]string{"error": "Invalid request body"})
 	}
 
+	if re.Auth.Collection().Name == "users" {
+		request.UserID = re.Auth.Id
+	}
+
 	// Remove torrents using service
-	ctx := re.Request.Context()
+	ctx := requestContext(re)
 	if err := tr.service.RemoveTorrents(ctx, request); err != nil {
-		return re.JSON(400, map[string]string{"error": err.Error()})
+		return torrentError(re, err)
 	}
 
 	return re.JSON(200, map[string]interface{}{
@@ -100,14 +302,32 @@ func (tr *TorrentRoutes) handleTorrentAction(re *core.RequestEvent) error {
 		return re.JSON(400, map[string]string{"error": "Invalid request body"})
 	}
 
+	// Removing through an action needs the scope of the remove endpoint
+	if key, ok := re.Get(requestKeyAPIKey).(*apikey.Key); ok && request.Action == "remove" && !key.HasScope(apikey.ScopeTorrentsRemove) {
+		return re.JSON(403, map[string]string{"error": fmt.Sprintf("api key is missing the %s scope", apikey.ScopeTorrentsRemove)})
+	}
+
+	if re.Auth.Collection().Name == "users" {
+		request.UserID = re.Auth.Id
+	}
+
 	// Perform action using service
-	ctx := re.Request.Context()
+	ctx := requestContext(re)
 	if err := tr.service.PerformAction(ctx, torrentID, request); err != nil {
-		return re.JSON(400, map[string]string{"error": err.Error()})
+		return torrentError(re, err)
 	}
 
 	return re.JSON(200, map[string]interface{}{
 		"success": true,
 		"message": fmt.Sprintf("Torrent %s successful", request.Action),
 	})
-}
\ No newline at end of file
+}
+
+// torrentError reports an error of a remove or an action
+func torrentError(re *core.RequestEvent, err error) error {
+	var forbiddenErr torrent.ForbiddenError
+	if errors.As(err, &forbiddenErr) {
+		return re.JSON(403, map[string]string{"error": err.Error()})
+	}
+	return re.JSON(400, map[string]string{"error": err.Error()})
+}
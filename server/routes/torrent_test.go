@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"backend/internal/apikey"
+	"backend/internal/audit"
+	"backend/internal/testutil"
+	"backend/internal/torrent"
+	"backend/internal/transmission"
+)
+
+// torrentScenario sends body to the action route of torrent 1 with a key
+// granting scopes, or with no credentials at all if there are no scopes.
+// owned makes the key's owner the owner of the torrent.
+func torrentScenario(name, body string, owned bool, status int, content string, scopes ...string) tests.ApiScenario {
+	headers := map[string]string{}
+
+	return tests.ApiScenario{
+		Name:            name,
+		Method:          http.MethodPost,
+		URL:             "/api/torrents/1/action",
+		Body:            strings.NewReader(body),
+		Headers:         headers,
+		ExpectedStatus:  status,
+		ExpectedContent: []string{content},
+		TestAppFactory: func(t testing.TB) *tests.TestApp {
+			testApp, err := tests.NewTestApp()
+			if err != nil {
+				t.Fatalf("Failed to create test app: %v", err)
+			}
+
+			owner := testutil.CreateUser(t, testApp, "automation@example.com", "user")
+
+			if len(scopes) > 0 {
+				created, err := apikey.NewService(testApp).Create(owner.Id, apikey.CreateParams{Name: "automation", Scopes: scopes})
+				if err != nil {
+					t.Fatalf("Failed to create api key: %v", err)
+				}
+				headers[apikey.HeaderName] = created.Key
+			}
+
+			return testApp
+		},
+		BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+			client := transmission.NewMockClient(app)
+			syncService := transmission.NewSyncService(app, client, 0)
+			service := torrent.NewService(&pocketbase.PocketBase{App: app}, client, syncService, audit.NewService(app))
+			NewTorrentRoutes(service, apikey.NewService(app)).RegisterRoutes(e)
+
+			if err := service.ForceSync(); err != nil {
+				t.Fatalf("Initial sync failed: %v", err)
+			}
+			if owned {
+				owner, err := app.FindAuthRecordByEmail("users", "automation@example.com")
+				if err != nil {
+					t.Fatalf("Failed to find user: %v", err)
+				}
+				record, err := app.FindFirstRecordByData("torrents", "transmissionId", 1)
+				if err != nil {
+					t.Fatalf("Failed to find torrent: %v", err)
+				}
+				record.Set("user", owner.Id)
+				if err := app.Save(record); err != nil {
+					t.Fatalf("Failed to update torrent: %v", err)
+				}
+			}
+		},
+	}
+}
+
+func TestTorrentActionRemoveRequiresRemoveScope(t *testing.T) {
+	scenarios := []tests.ApiScenario{
+		torrentScenario("control key removing", `{"action": "remove", "params": {"deleteLocalData": true}}`, true,
+			http.StatusForbidden, apikey.ScopeTorrentsRemove, apikey.ScopeTorrentsControl),
+		torrentScenario("control key stopping", `{"action": "stop"}`, true,
+			http.StatusOK, `"success":true`, apikey.ScopeTorrentsControl),
+		torrentScenario("remove key removing", `{"action": "remove"}`, true,
+			http.StatusOK, `"success":true`, apikey.ScopeTorrentsControl, apikey.ScopeTorrentsRemove),
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestTorrentActionRequiresOwnership(t *testing.T) {
+	scenarios := []tests.ApiScenario{
+		torrentScenario("no credentials", `{"action": "stop"}`, false,
+			http.StatusUnauthorized, "authentication required"),
+		torrentScenario("another user's torrent", `{"action": "remove", "params": {"deleteLocalData": true}}`, false,
+			http.StatusForbidden, "not allowed to change torrent 1", apikey.ScopeTorrentsControl, apikey.ScopeTorrentsRemove),
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/twofactor"
+)
+
+// TwoFactorRoutes handles TOTP enrollment for the current user and the
+// related admin security settings.
+type TwoFactorRoutes struct {
+	service *twofactor.Service
+}
+
+// NewTwoFactorRoutes constructs a new TwoFactorRoutes instance.
+func NewTwoFactorRoutes(service *twofactor.Service) *TwoFactorRoutes {
+	return &TwoFactorRoutes{service: service}
+}
+
+// RegisterRoutes binds two-factor routes to the router.
+func (tr *TwoFactorRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/me/2fa")
+	group.Bind(apis.RequireAuth("users"))
+
+	group.GET("", tr.getStatus)
+	group.POST("/enroll", tr.enroll)
+	group.POST("/confirm", tr.confirm)
+	group.POST("/disable", tr.disable)
+	group.POST("/recovery-codes", tr.regenerateRecoveryCodes)
+
+	se.Router.DELETE("/api/users/{id}/2fa", tr.resetUser).BindFunc(requireAdmin)
+	se.Router.GET("/api/admin/security", tr.getSecurity).BindFunc(requireAdmin)
+	se.Router.PUT("/api/admin/security", tr.updateSecurity).BindFunc(requireAdmin)
+}
+
+type twoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+func (tr *TwoFactorRoutes) getStatus(re *core.RequestEvent) error {
+	status, err := tr.service.Status(re.Auth)
+	if err != nil {
+		return tr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, status)
+}
+
+func (tr *TwoFactorRoutes) enroll(re *core.RequestEvent) error {
+	enrollment, err := tr.service.Enroll(re.Auth)
+	if err != nil {
+		return tr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, enrollment)
+}
+
+func (tr *TwoFactorRoutes) confirm(re *core.RequestEvent) error {
+	var req twoFactorCodeRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	codes, err := tr.service.Confirm(requestContext(re), re.Auth, req.Code)
+	if err != nil {
+		return tr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"recoveryCodes": codes})
+}
+
+func (tr *TwoFactorRoutes) disable(re *core.RequestEvent) error {
+	var req twoFactorCodeRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	if err := tr.service.Disable(requestContext(re), re.Auth, req.Code, req.RecoveryCode); err != nil {
+		return tr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+func (tr *TwoFactorRoutes) regenerateRecoveryCodes(re *core.RequestEvent) error {
+	var req twoFactorCodeRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	codes, err := tr.service.RegenerateRecoveryCodes(re.Auth, req.Code)
+	if err != nil {
+		return tr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"recoveryCodes": codes})
+}
+
+func (tr *TwoFactorRoutes) resetUser(re *core.RequestEvent) error {
+	if err := tr.service.Reset(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return tr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+type securitySettingsRequest struct {
+	RequireAdminTwoFactor bool `json:"requireAdminTwoFactor"`
+}
+
+func (tr *TwoFactorRoutes) getSecurity(re *core.RequestEvent) error {
+	required, err := tr.service.RequiredForAdmins()
+	if err != nil {
+		return tr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, securitySettingsRequest{RequireAdminTwoFactor: required})
+}
+
+func (tr *TwoFactorRoutes) updateSecurity(re *core.RequestEvent) error {
+	var req securitySettingsRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	if err := tr.service.SetRequiredForAdmins(requestContext(re), req.RequireAdminTwoFactor); err != nil {
+		return tr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, req)
+}
+
+func (tr *TwoFactorRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	switch {
+	case errors.Is(err, twofactor.ErrInvalidCode),
+		errors.Is(err, twofactor.ErrEnrollmentNeeded):
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, twofactor.ErrNotEnabled):
+		return re.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, twofactor.ErrAlreadyEnabled):
+		return re.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	log.Printf("two-factor service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/pocketbase/pocketbase/core"
 
@@ -22,12 +23,20 @@ func NewUserRoutes(service *user.Service) *UserRoutes {
 
 // RegisterRoutes binds user-related routes to the router.
 func (ur *UserRoutes) RegisterRoutes(se *core.ServeEvent) {
-	se.Router.GET("/api/users", ur.listUsers)
-	se.Router.POST("/api/users", ur.createUser)
-	se.Router.PATCH("/api/users/{id}", ur.updateUser)
+	se.Router.GET("/api/users", ur.listUsers).BindFunc(requireAdmin)
+	se.Router.POST("/api/users", ur.createUser).BindFunc(requireAdmin)
+	se.Router.PATCH("/api/users/{id}", ur.updateUser).BindFunc(requireAdmin)
+	se.Router.DELETE("/api/users/{id}", ur.deleteUser).BindFunc(requireAdmin)
 
 	se.Router.GET("/api/admin/exists", ur.adminExists)
 	se.Router.POST("/api/admin/setup", ur.setupAdmin)
+
+	se.Router.GET("/api/admin/invites", ur.listInvites).BindFunc(requireAdmin)
+	se.Router.POST("/api/admin/invites", ur.createInvite).BindFunc(requireAdmin)
+	se.Router.DELETE("/api/admin/invites/{id}", ur.revokeInvite).BindFunc(requireAdmin)
+
+	se.Router.GET("/api/invites/{token}", ur.getInvite)
+	se.Router.POST("/api/invites/{token}/accept", ur.acceptInvite)
 }
 
 type createUserRequest struct {
@@ -56,7 +65,7 @@ func (ur *UserRoutes) createUser(re *core.RequestEvent) error {
 		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
 	}
 
-	userResp, err := ur.service.Create(user.CreateParams{
+	userResp, err := ur.service.Create(requestContext(re), user.CreateParams{
 		Name:            req.Name,
 		Username:        req.Username,
 		Email:           req.Email,
@@ -80,6 +89,7 @@ type updateUserRequest struct {
 	Role            *string `json:"role"`
 	Verified        *bool   `json:"verified"`
 	EmailVisibility *bool   `json:"emailVisibility"`
+	Disabled        *bool   `json:"disabled"`
 }
 
 func (ur *UserRoutes) updateUser(re *core.RequestEvent) error {
@@ -90,7 +100,7 @@ func (ur *UserRoutes) updateUser(re *core.RequestEvent) error {
 		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
 	}
 
-	userResp, err := ur.service.Update(userID, user.UpdateParams{
+	userResp, err := ur.service.Update(requestContext(re), userID, user.UpdateParams{
 		Name:            req.Name,
 		Username:        req.Username,
 		Email:           req.Email,
@@ -98,6 +108,7 @@ func (ur *UserRoutes) updateUser(re *core.RequestEvent) error {
 		Role:            req.Role,
 		Verified:        req.Verified,
 		EmailVisibility: req.EmailVisibility,
+		Disabled:        req.Disabled,
 	})
 	if err != nil {
 		return ur.handleServiceError(re, err)
@@ -106,6 +117,35 @@ func (ur *UserRoutes) updateUser(re *core.RequestEvent) error {
 	return re.JSON(http.StatusOK, map[string]any{"user": userResp})
 }
 
+type deleteUserRequest struct {
+	// Torrents is "reassign" or "remove"; required when the user owns torrents
+	Torrents        string `json:"torrents"`
+	ReassignTo      string `json:"reassignTo"`
+	DeleteLocalData bool   `json:"deleteLocalData"`
+}
+
+func (ur *UserRoutes) deleteUser(re *core.RequestEvent) error {
+	userID := re.Request.PathValue("id")
+
+	var req deleteUserRequest
+	if re.Request.ContentLength != 0 {
+		if err := re.BindBody(&req); err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+		}
+	}
+
+	err := ur.service.Delete(requestContext(re), userID, user.DeleteParams{
+		Torrents:        req.Torrents,
+		ReassignTo:      req.ReassignTo,
+		DeleteLocalData: req.DeleteLocalData,
+	})
+	if err != nil {
+		return ur.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
 func (ur *UserRoutes) adminExists(re *core.RequestEvent) error {
 	exists, err := ur.service.AdminExists()
 	if err != nil {
@@ -113,25 +153,108 @@ func (ur *UserRoutes) adminExists(re *core.RequestEvent) error {
 		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to check admin users"})
 	}
 
-	return re.JSON(http.StatusOK, map[string]bool{"adminExists": exists})
+	return re.JSON(http.StatusOK, map[string]bool{
+		"adminExists":        exists,
+		"setupTokenRequired": !exists && ur.service.SetupTokenRequired(),
+	})
 }
 
 type adminSetupRequest struct {
+	Name       string `json:"name"`
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	SetupToken string `json:"setupToken"`
+}
+
+func (ur *UserRoutes) setupAdmin(re *core.RequestEvent) error {
+	var req adminSetupRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	err := ur.service.SetupInitialAdmin(requestContext(re), user.AdminSetupParams{
+		Name:       req.Name,
+		Username:   req.Username,
+		Email:      req.Email,
+		Password:   req.Password,
+		SetupToken: req.SetupToken,
+	})
+	if err != nil {
+		return ur.handleServiceError(re, err)
+	}
+
+	log.Printf("Initial admin user created: %s (%s)", req.Name, req.Email)
+	return re.JSON(http.StatusCreated, map[string]string{"message": "Admin account created successfully"})
+}
+
+func (ur *UserRoutes) listInvites(re *core.RequestEvent) error {
+	invites, err := ur.service.ListInvites()
+	if err != nil {
+		log.Printf("list invites: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch invitations"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"invites": invites})
+}
+
+type createInviteRequest struct {
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	ExpiresInHours int    `json:"expiresInHours"`
+	SendEmail      bool   `json:"sendEmail"`
+}
+
+func (ur *UserRoutes) createInvite(re *core.RequestEvent) error {
+	var req createInviteRequest
+	if err := re.BindBody(&req); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := ur.service.CreateInvite(requestContext(re), user.CreateInviteParams{
+		Email:     req.Email,
+		Role:      req.Role,
+		ExpiresIn: time.Duration(req.ExpiresInHours) * time.Hour,
+		SendEmail: req.SendEmail,
+	})
+	if err != nil {
+		return ur.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"invite": result})
+}
+
+func (ur *UserRoutes) revokeInvite(re *core.RequestEvent) error {
+	if err := ur.service.RevokeInvite(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return ur.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+func (ur *UserRoutes) getInvite(re *core.RequestEvent) error {
+	invite, err := ur.service.FindInvite(re.Request.PathValue("token"))
+	if err != nil {
+		return ur.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"invite": invite})
+}
+
+type acceptInviteRequest struct {
 	Name     string `json:"name"`
-	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
-func (ur *UserRoutes) setupAdmin(re *core.RequestEvent) error {
-	var req adminSetupRequest
+func (ur *UserRoutes) acceptInvite(re *core.RequestEvent) error {
+	var req acceptInviteRequest
 	if err := re.BindBody(&req); err != nil {
 		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
 	}
 
-	err := ur.service.SetupInitialAdmin(user.AdminSetupParams{
+	userResp, err := ur.service.AcceptInvite(requestContext(re), re.Request.PathValue("token"), user.AcceptInviteParams{
 		Name:     req.Name,
-		Username: req.Username,
 		Email:    req.Email,
 		Password: req.Password,
 	})
@@ -139,8 +262,7 @@ func (ur *UserRoutes) setupAdmin(re *core.RequestEvent) error {
 		return ur.handleServiceError(re, err)
 	}
 
-	log.Printf("Initial admin user created: %s (%s)", req.Name, req.Email)
-	return re.JSON(http.StatusCreated, map[string]string{"message": "Admin account created successfully"})
+	return re.JSON(http.StatusCreated, map[string]any{"user": userResp})
 }
 
 func (ur *UserRoutes) handleServiceError(re *core.RequestEvent, err error) error {
@@ -154,6 +276,18 @@ func (ur *UserRoutes) handleServiceError(re *core.RequestEvent, err error) error
 		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
 	}
 
+	if errors.Is(err, user.ErrInviteInvalid) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": user.ErrInviteInvalid.Error()})
+	}
+
+	if errors.Is(err, user.ErrLastAdmin) {
+		return re.JSON(http.StatusConflict, map[string]string{"error": user.ErrLastAdmin.Error()})
+	}
+
+	if errors.Is(err, user.ErrInvalidSetupToken) {
+		return re.JSON(http.StatusForbidden, map[string]string{"error": "Invalid setup token"})
+	}
+
 	if errors.Is(err, user.ErrAdminAlreadyExists) {
 		return re.JSON(http.StatusBadRequest, map[string]string{"error": "Admin account already exists"})
 	}
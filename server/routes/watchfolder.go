@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/watchfolder"
+)
+
+// WatchFolderRoutes lets admins manage the directories watched for dropped
+// .torrent and .magnet files.
+type WatchFolderRoutes struct {
+	service *watchfolder.Service
+}
+
+// NewWatchFolderRoutes constructs a new WatchFolderRoutes instance.
+func NewWatchFolderRoutes(service *watchfolder.Service) *WatchFolderRoutes {
+	return &WatchFolderRoutes{service: service}
+}
+
+// RegisterRoutes binds watch folder routes to the router.
+func (wr *WatchFolderRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/watch-folders")
+	group.BindFunc(requireAdmin)
+
+	group.GET("", wr.listFolders)
+	group.POST("", wr.createFolder)
+	group.PATCH("/{id}", wr.updateFolder)
+	group.DELETE("/{id}", wr.deleteFolder)
+	group.POST("/{id}/scan", wr.scanFolder)
+}
+
+func (wr *WatchFolderRoutes) listFolders(re *core.RequestEvent) error {
+	folders, err := wr.service.List()
+	if err != nil {
+		log.Printf("list watch folders: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch watch folders"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"folders": folders})
+}
+
+func (wr *WatchFolderRoutes) createFolder(re *core.RequestEvent) error {
+	var params watchfolder.FolderParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := wr.service.Create(requestContext(re), params)
+	if err != nil {
+		return wr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"folder": result})
+}
+
+func (wr *WatchFolderRoutes) updateFolder(re *core.RequestEvent) error {
+	var params watchfolder.FolderParams
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := wr.service.Update(requestContext(re), re.Request.PathValue("id"), params)
+	if err != nil {
+		return wr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"folder": result})
+}
+
+func (wr *WatchFolderRoutes) deleteFolder(re *core.RequestEvent) error {
+	if err := wr.service.Delete(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return wr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+// scanFolder handles POST /api/watch-folders/{id}/scan by importing the
+// waiting files without waiting for the next scan
+func (wr *WatchFolderRoutes) scanFolder(re *core.RequestEvent) error {
+	results, err := wr.service.Scan(re.Request.PathValue("id"))
+	if err != nil {
+		return wr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"results": results})
+}
+
+func (wr *WatchFolderRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr watchfolder.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr watchfolder.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	log.Printf("watch folder service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"backend/internal/webhook"
+)
+
+// WebhookRoutes lets admins manage outgoing webhooks and inspect their deliveries.
+type WebhookRoutes struct {
+	service *webhook.Service
+}
+
+// NewWebhookRoutes constructs a new WebhookRoutes instance.
+func NewWebhookRoutes(service *webhook.Service) *WebhookRoutes {
+	return &WebhookRoutes{service: service}
+}
+
+// RegisterRoutes binds webhook routes to the router.
+func (wr *WebhookRoutes) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/webhooks")
+	group.BindFunc(requireAdmin)
+
+	group.GET("", wr.listWebhooks)
+	group.POST("", wr.createWebhook)
+	group.PATCH("/{id}", wr.updateWebhook)
+	group.DELETE("/{id}", wr.deleteWebhook)
+	group.GET("/{id}/deliveries", wr.listDeliveries)
+}
+
+func (wr *WebhookRoutes) listWebhooks(re *core.RequestEvent) error {
+	webhooks, err := wr.service.List()
+	if err != nil {
+		log.Printf("list webhooks: %v", err)
+		return re.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch webhooks"})
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"webhooks": webhooks})
+}
+
+func (wr *WebhookRoutes) createWebhook(re *core.RequestEvent) error {
+	var params webhook.Params
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := wr.service.Create(requestContext(re), params)
+	if err != nil {
+		return wr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusCreated, map[string]any{"webhook": result})
+}
+
+func (wr *WebhookRoutes) updateWebhook(re *core.RequestEvent) error {
+	var params webhook.Params
+	if err := re.BindBody(&params); err != nil {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request data"})
+	}
+
+	result, err := wr.service.Update(requestContext(re), re.Request.PathValue("id"), params)
+	if err != nil {
+		return wr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"webhook": result})
+}
+
+func (wr *WebhookRoutes) deleteWebhook(re *core.RequestEvent) error {
+	if err := wr.service.Delete(requestContext(re), re.Request.PathValue("id")); err != nil {
+		return wr.handleServiceError(re, err)
+	}
+
+	return re.NoContent(http.StatusNoContent)
+}
+
+// listDeliveries handles GET /api/webhooks/{id}/deliveries?limit=
+func (wr *WebhookRoutes) listDeliveries(re *core.RequestEvent) error {
+	var limit int
+	if value := re.Request.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		limit = parsed
+	}
+
+	deliveries, err := wr.service.Deliveries(re.Request.PathValue("id"), limit)
+	if err != nil {
+		return wr.handleServiceError(re, err)
+	}
+
+	return re.JSON(http.StatusOK, map[string]any{"deliveries": deliveries})
+}
+
+func (wr *WebhookRoutes) handleServiceError(re *core.RequestEvent, err error) error {
+	var validationErr webhook.ValidationError
+	if errors.As(err, &validationErr) {
+		return re.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Message})
+	}
+
+	var notFoundErr webhook.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return re.JSON(http.StatusNotFound, map[string]string{"error": notFoundErr.Message})
+	}
+
+	log.Printf("webhook service error: %v", err)
+	return re.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
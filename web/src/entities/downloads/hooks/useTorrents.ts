@@ -2,6 +2,10 @@ import { useEffect, useState, useCallback } from 'react'
 import pb from '@shared/lib/pocketbase'
 import type { Torrent } from '../model'
 
+function authHeaders(): Record<string, string> {
+  return pb.authStore.token ? { Authorization: pb.authStore.token } : {}
+}
+
 export function useTorrents() {
   const [torrents, setTorrents] = useState<Torrent[]>([])
   const [isLoading, setIsLoading] = useState(true)
@@ -100,6 +104,7 @@ export function useTorrents() {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
+          ...authHeaders(),
         },
       })
 
@@ -124,6 +129,7 @@ export function useTorrents() {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
+          ...authHeaders(),
         },
         body: JSON.stringify({ action }),
       })
@@ -151,6 +157,7 @@ export function useTorrents() {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
+          ...authHeaders(),
         },
         body: JSON.stringify({
           torrent,
@@ -187,6 +194,7 @@ export function useTorrents() {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
+          ...authHeaders(),
         },
         body: JSON.stringify({
           ids,
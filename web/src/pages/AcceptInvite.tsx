@@ -0,0 +1,195 @@
+import { Button } from "@shared/components/ui/button"
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardFooter,
+  CardHeader,
+  CardTitle,
+} from "@shared/components/ui/card"
+import { Input } from "@shared/components/ui/input"
+import { Label } from "@shared/components/ui/label"
+import { LoadingSpinner } from "@shared/components/LoadingSpinner"
+import { useEffect, useState } from "react"
+import { useNavigate, useParams } from "@tanstack/react-router"
+import { useAuth } from "@shared/contexts/AuthContext"
+
+interface Invite {
+  email?: string
+  role: string
+  expiresAt: string
+}
+
+export default function AcceptInvite() {
+  const { token } = useParams({ from: "/invite/$token" })
+  const [invite, setInvite] = useState<Invite | null>(null)
+  const [inviteError, setInviteError] = useState<string | null>(null)
+  const [name, setName] = useState("")
+  const [email, setEmail] = useState("")
+  const [password, setPassword] = useState("")
+  const [confirmPassword, setConfirmPassword] = useState("")
+  const [isLoading, setIsLoading] = useState(false)
+  const [error, setError] = useState<string | null>(null)
+  const { login } = useAuth()
+  const navigate = useNavigate()
+
+  useEffect(() => {
+    fetch(`/api/invites/${encodeURIComponent(token)}`)
+      .then(async (response) => {
+        const result = await response.json().catch(() => ({}))
+        if (!response.ok) {
+          throw new Error(result.error || "This invitation is invalid or has expired")
+        }
+        setInvite(result.invite)
+        setEmail(result.invite.email || "")
+      })
+      .catch((err) => setInviteError(err instanceof Error ? err.message : "Failed to load the invitation"))
+  }, [token])
+
+  const onSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setIsLoading(true)
+    setError(null)
+
+    // Client-side validation
+    if (!name || !email || !password || !confirmPassword) {
+      setError("All fields are required")
+      setIsLoading(false)
+      return
+    }
+
+    if (password !== confirmPassword) {
+      setError("Passwords do not match")
+      setIsLoading(false)
+      return
+    }
+
+    if (password.length < 8) {
+      setError("Password must be at least 8 characters long")
+      setIsLoading(false)
+      return
+    }
+
+    try {
+      const response = await fetch(`/api/invites/${encodeURIComponent(token)}/accept`, {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+        },
+        body: JSON.stringify({ name, email, password }),
+      })
+
+      const result = await response.json().catch(() => ({}))
+
+      if (!response.ok) {
+        throw new Error(result.error || "Failed to accept the invitation")
+      }
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to accept the invitation")
+      setIsLoading(false)
+      return
+    }
+
+    // The account exists now; if signing in needs more, the login page asks for it
+    try {
+      await login(email, password)
+      navigate({ to: "/" })
+    } catch {
+      navigate({ to: "/login" })
+    }
+  }
+
+  if (!invite && !inviteError) {
+    return <LoadingSpinner />
+  }
+
+  return (
+    <div className="flex min-h-screen items-center justify-center bg-gray-100 dark:bg-gray-950">
+      <Card className="w-full max-w-md">
+        <CardHeader className="text-center">
+          <CardTitle className="text-2xl">Accept Invitation</CardTitle>
+          <CardDescription>
+            {invite
+              ? `You have been invited as ${invite.role}. Choose your name and password to create your account.`
+              : "This invitation can't be used."}
+          </CardDescription>
+        </CardHeader>
+        {inviteError ? (
+          <CardContent>
+            <div className="text-red-500 text-sm text-center bg-red-50 dark:bg-red-900/20 p-3 rounded-md border border-red-200 dark:border-red-800">
+              {inviteError}
+            </div>
+          </CardContent>
+        ) : (
+          <form onSubmit={onSubmit}>
+            <CardContent className="space-y-4">
+              {error && (
+                <div className="text-red-500 text-sm text-center bg-red-50 dark:bg-red-900/20 p-3 rounded-md border border-red-200 dark:border-red-800">
+                  {error}
+                </div>
+              )}
+              <div className="grid gap-2">
+                <Label htmlFor="name">Name</Label>
+                <Input
+                  id="name"
+                  type="text"
+                  value={name}
+                  onChange={(e) => setName(e.target.value)}
+                  autoComplete="name"
+                  disabled={isLoading}
+                  required
+                />
+              </div>
+              <div className="grid gap-2">
+                <Label htmlFor="email">Email Address</Label>
+                <Input
+                  id="email"
+                  type="email"
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  autoComplete="email"
+                  placeholder="you@example.com"
+                  disabled={isLoading || Boolean(invite?.email)}
+                  required
+                />
+              </div>
+              <div className="grid gap-2">
+                <Label htmlFor="password">Password</Label>
+                <Input
+                  id="password"
+                  type="password"
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  autoComplete="new-password"
+                  placeholder="Minimum 8 characters"
+                  disabled={isLoading}
+                  required
+                  minLength={8}
+                />
+              </div>
+              <div className="grid gap-2">
+                <Label htmlFor="confirmPassword">Confirm Password</Label>
+                <Input
+                  id="confirmPassword"
+                  type="password"
+                  value={confirmPassword}
+                  onChange={(e) => setConfirmPassword(e.target.value)}
+                  autoComplete="new-password"
+                  placeholder="Re-enter password"
+                  disabled={isLoading}
+                  required
+                  minLength={8}
+                />
+              </div>
+            </CardContent>
+            <CardFooter className="mt-6">
+              <Button type="submit" className="w-full" disabled={isLoading}>
+                {isLoading ? "Creating Account..." : "Create Account"}
+              </Button>
+            </CardFooter>
+          </form>
+        )}
+      </Card>
+    </div>
+  )
+}
@@ -9,7 +9,7 @@ import {
 } from "@shared/components/ui/card"
 import { Input } from "@shared/components/ui/input"
 import { Label } from "@shared/components/ui/label"
-import { useState } from "react"
+import { useEffect, useState } from "react"
 import { useNavigate } from "@tanstack/react-router"
 import { useAuth } from "@shared/contexts/AuthContext"
 
@@ -18,11 +18,20 @@ export default function InitialSetup() {
   const [email, setEmail] = useState("")
   const [password, setPassword] = useState("")
   const [confirmPassword, setConfirmPassword] = useState("")
+  const [setupToken, setSetupToken] = useState("")
+  const [setupTokenRequired, setSetupTokenRequired] = useState(false)
   const [isLoading, setIsLoading] = useState(false)
   const [error, setError] = useState<string | null>(null)
   const { login } = useAuth()
   const navigate = useNavigate()
 
+  useEffect(() => {
+    fetch("/api/admin/exists")
+      .then((response) => response.json())
+      .then((data) => setSetupTokenRequired(Boolean(data.setupTokenRequired)))
+      .catch(() => setSetupTokenRequired(false))
+  }, [])
+
   const onSubmit = async (e: React.FormEvent) => {
     e.preventDefault()
     setIsLoading(true)
@@ -35,6 +44,12 @@ export default function InitialSetup() {
       return
     }
 
+    if (setupTokenRequired && !setupToken.trim()) {
+      setError("Enter the setup token from the server log")
+      setIsLoading(false)
+      return
+    }
+
     if (password !== confirmPassword) {
       setError("Passwords do not match")
       setIsLoading(false)
@@ -66,6 +81,7 @@ export default function InitialSetup() {
           name,
           email,
           password,
+          setupToken: setupToken.trim(),
         }),
       })
 
@@ -102,6 +118,21 @@ export default function InitialSetup() {
                 {error}
               </div>
             )}
+            {setupTokenRequired && (
+              <div className="grid gap-2">
+                <Label htmlFor="setupToken">Setup Token</Label>
+                <Input
+                  id="setupToken"
+                  type="text"
+                  value={setupToken}
+                  onChange={(e) => setSetupToken(e.target.value)}
+                  autoComplete="off"
+                  placeholder="Printed in the server log"
+                  disabled={isLoading}
+                  required
+                />
+              </div>
+            )}
             <div className="grid gap-2">
               <Label htmlFor="name">Name</Label>
               <Input
@@ -4,7 +4,8 @@ import { Label } from "@shared/components/ui/label"
 import { useAuth } from "@shared/contexts/AuthContext"
 import { useState, useEffect } from "react"
 import { useNavigate } from "@tanstack/react-router"
-import { LogIn, Loader2, Eye, EyeOff } from "lucide-react"
+import { LogIn, Loader2, Eye, EyeOff, ShieldCheck } from "lucide-react"
+import { ClientResponseError } from "pocketbase"
 import { useIsMobile } from "@shared/hooks/use-mobile"
 import { useTheme } from "@shared/contexts/ThemeContext"
 
@@ -14,6 +15,9 @@ export default function Login() {
   const [showPassword, setShowPassword] = useState(false)
   const [isLoading, setIsLoading] = useState(false)
   const [error, setError] = useState<string | null>(null)
+  const [needsSecondFactor, setNeedsSecondFactor] = useState(false)
+  const [useRecoveryCode, setUseRecoveryCode] = useState(false)
+  const [secondFactorCode, setSecondFactorCode] = useState("")
   const { login } = useAuth()
   const navigate = useNavigate()
   const isMobile = useIsMobile()
@@ -34,10 +38,23 @@ export default function Login() {
     setIsLoading(true)
     setError(null)
     try {
-      await login(username, password)
+      const code = secondFactorCode.trim()
+      await login(
+        username,
+        password,
+        needsSecondFactor ? (useRecoveryCode ? { recoveryCode: code } : { totpCode: code }) : undefined
+      )
       navigate({ to: "/" })
     } catch (err) {
-      setError("Invalid username or password. Please try again.")
+      const code = err instanceof ClientResponseError ? err.response?.code : undefined
+      if (code === "totp_required") {
+        setNeedsSecondFactor(true)
+      } else if (code === "totp_invalid") {
+        setSecondFactorCode("")
+        setError("Invalid verification code. Please try again.")
+      } else {
+        setError("Invalid username or password. Please try again.")
+      }
       console.error(err)
     } finally {
       setIsLoading(false)
@@ -123,6 +140,43 @@ export default function Login() {
                   </Button>
                 </div>
               </div>
+
+              {needsSecondFactor && (
+                <div className="space-y-2">
+                  <Label htmlFor="second-factor" className="text-foreground">
+                    {useRecoveryCode ? "Recovery code" : "Authentication code"}
+                  </Label>
+                  <Input
+                    id="second-factor"
+                    type="text"
+                    inputMode={useRecoveryCode ? "text" : "numeric"}
+                    placeholder={useRecoveryCode ? "XXXX-XXXX" : "6-digit code from your authenticator app"}
+                    value={secondFactorCode}
+                    onChange={(e) => setSecondFactorCode(e.target.value)}
+                    disabled={isLoading}
+                    autoComplete="one-time-code"
+                    autoFocus
+                    className={`bg-input border-border text-foreground placeholder:text-muted-foreground ${
+                      isMobile ? 'h-12' : 'h-11'
+                    }`}
+                    required
+                  />
+                  <Button
+                    type="button"
+                    variant="link"
+                    size="sm"
+                    className="px-0"
+                    onClick={() => {
+                      setUseRecoveryCode(!useRecoveryCode)
+                      setSecondFactorCode("")
+                    }}
+                    disabled={isLoading}
+                  >
+                    <ShieldCheck className="mr-1 h-4 w-4" />
+                    {useRecoveryCode ? "Use an authenticator code" : "Use a recovery code"}
+                  </Button>
+                </div>
+              )}
             </div>
 
             <Button
@@ -10,6 +10,7 @@ import {
 import { DownloadsPage } from './pages/DownloadsPage'
 import Login from './pages/Login'
 import InitialSetup from './pages/InitialSetup'
+import AcceptInvite from './pages/AcceptInvite'
 import Preferences from './pages/Preferences'
 import UsersPage from './pages/UsersPage'
 import { Button } from '@shared/components/ui/button'
@@ -116,6 +117,18 @@ const loginRoute = createRoute({
   },
 })
 
+const inviteRoute = createRoute({
+  getParentRoute: () => rootRoute,
+  path: '/invite/$token',
+  component: AcceptInvite,
+  beforeLoad: ({ context }) => {
+    // Invitations create new accounts, so signed in users go to the app
+    if (context.auth?.user) {
+      throw redirect({ to: '/downloads' })
+    }
+  },
+})
+
 const appRoute = createRoute({
   getParentRoute: () => rootRoute,
   id: 'app',
@@ -166,6 +179,7 @@ const usersRoute = createRoute({
 const routeTree = rootRoute.addChildren([
   initialSetupRoute,
   loginRoute,
+  inviteRoute,
   appRoute.addChildren([indexRoute, downloadsRoute, prefsRoute, usersRoute]),
 ])
 
@@ -1,4 +1,5 @@
 import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
+import pb from '@shared/lib/pocketbase'
 
 export type UserRole = 'admin' | 'user'
 
@@ -44,8 +45,12 @@ export const usersKeys = {
   detail: (id: string) => [...usersKeys.all, 'detail', id] as const,
 }
 
+function authHeaders(): Record<string, string> {
+  return pb.authStore.token ? { Authorization: pb.authStore.token } : {}
+}
+
 async function getUsers(): Promise<UsersResponse> {
-  const response = await fetch('/api/users')
+  const response = await fetch('/api/users', { headers: authHeaders() })
 
   if (!response.ok) {
     const errorData = await response.json().catch(() => ({}))
@@ -60,6 +65,7 @@ async function createUser(payload: CreateUserRequest): Promise<UserRecord> {
     method: 'POST',
     headers: {
       'Content-Type': 'application/json',
+      ...authHeaders(),
     },
     body: JSON.stringify(payload),
   })
@@ -78,6 +84,7 @@ async function updateUser({ id, data }: UpdateUserRequest): Promise<UserRecord>
     method: 'PATCH',
     headers: {
       'Content-Type': 'application/json',
+      ...authHeaders(),
     },
     body: JSON.stringify(data),
   })
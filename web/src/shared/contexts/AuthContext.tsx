@@ -2,9 +2,14 @@ import { createContext, useContext, useEffect, useState } from 'react';
 import { pb } from '@/shared/lib/pocketbase';
 import { type RecordModel } from 'pocketbase';
 
+export interface SecondFactor {
+  totpCode?: string;
+  recoveryCode?: string;
+}
+
 interface AuthContextType {
   user: RecordModel | null;
-  login: (email: string, pass: string) => Promise<void>;
+  login: (email: string, pass: string, secondFactor?: SecondFactor) => Promise<void>;
   logout: () => void;
 }
 
@@ -23,8 +28,29 @@ export const AuthProvider = ({ children }: { children: React.ReactNode }) => {
     };
   }, []);
 
-  const login = async (email: string, pass: string) => {
-    await pb.collection('users').authWithPassword(email, pass);
+  // Behind a trusted reverse proxy the session comes from the proxy's identity headers
+  useEffect(() => {
+    if (pb.authStore.isValid) {
+      return;
+    }
+
+    fetch('/api/auth/proxy')
+      .then((response) => (response.ok ? response.json() : null))
+      .then((data) => {
+        if (data?.token && data?.record) {
+          pb.authStore.save(data.token, data.record);
+        }
+      })
+      .catch(() => {
+        // Proxy auth is optional; fall back to the regular login form
+      });
+  }, []);
+
+  const login = async (email: string, pass: string, secondFactor?: SecondFactor) => {
+    // The server expects the second factor alongside the credentials
+    await pb.collection('users').authWithPassword(email, pass, {
+      body: { identity: email, password: pass, ...secondFactor },
+    });
   };
 
   const logout = () => {
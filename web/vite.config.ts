@@ -44,6 +44,10 @@ export default defineConfig(({ mode }) => {
             },
           ],
         },
+        workbox: {
+          // Displays Web Push notifications, see public/push-sw.js
+          importScripts: ['push-sw.js'],
+        },
         devOptions: {
           enabled: true,
         },